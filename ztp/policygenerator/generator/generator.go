@@ -0,0 +1,413 @@
+// Package generator builds the ACM policies, placements and plain CRs of a set
+// of PolicyGenTemplate files. It processes every file, even past failures, and
+// returns the typed generated objects along with all the failures.
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	policyGen "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/policyGen"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Options overrides the PolicyGenTemplate settings for all the files
+type Options struct {
+	// Generate plain CRs regardless of the PGT wrapInPolicy setting
+	DisableWrapInPolicy bool
+	// Overrides the PGT placementKind when set
+	PlacementKind string
+	// Added to the tolerations of the generated Placements
+	PlacementTolerations []utils.Toleration
+	// Validates the generated CRs when set
+	SchemaValidator *policyGen.SchemaValidator
+	// Sets the wave dependencies across the policies of all the files, in the
+	// policy "dependencies" or the policy templates "extraDependencies"
+	WaveDependencies string
+	// Number of files built concurrently, the number of CPUs when not set
+	Workers int
+}
+
+// Output is a generated object along with the PGT file it comes from and the
+// path of the file it is written to, relative to the output directory and
+// without extension
+type Output struct {
+	PolicyGenTemplate string
+	Path              string
+	Object            interface{}
+	// PGT sourceFiles the object is built from, empty for the placement objects
+	SourceFiles []string
+}
+
+type GeneratedPolicy struct {
+	PolicyGenTemplate string
+	Path              string
+	Policy            utils.AcmPolicy
+}
+
+type GeneratedPolicySet struct {
+	PolicyGenTemplate string
+	Path              string
+	PolicySet         utils.PolicySet
+}
+
+type GeneratedPlacementRule struct {
+	PolicyGenTemplate string
+	Path              string
+	PlacementRule     utils.PlacementRule
+}
+
+type GeneratedPlacement struct {
+	PolicyGenTemplate string
+	Path              string
+	Placement         utils.Placement
+}
+
+type GeneratedManagedClusterSetBinding struct {
+	PolicyGenTemplate        string
+	Path                     string
+	ManagedClusterSetBinding utils.ManagedClusterSetBinding
+}
+
+type GeneratedPlacementBinding struct {
+	PolicyGenTemplate string
+	Path              string
+	PlacementBinding  utils.PlacementBinding
+}
+
+// GeneratedCRs holds the plain CRs (not wrapped in a policy) of a sourceFile
+type GeneratedCRs struct {
+	PolicyGenTemplate string
+	Path              string
+	CRs               []map[string]interface{}
+}
+
+// Result holds the objects generated from the PolicyGenTemplate files
+type Result struct {
+	Policies                  []GeneratedPolicy
+	PolicySets                []GeneratedPolicySet
+	PlacementRules            []GeneratedPlacementRule
+	Placements                []GeneratedPlacement
+	ManagedClusterSetBindings []GeneratedManagedClusterSetBinding
+	PlacementBindings         []GeneratedPlacementBinding
+	CustomResources           []GeneratedCRs
+	// Files skipped as they are not PolicyGenTemplates
+	Warnings []string
+	// All the generated objects, sorted by path
+	Outputs []Output
+}
+
+// FileError is the failure to generate the objects of a single file
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.File + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Errors aggregates the failures of all the files
+type Errors []*FileError
+
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for idx, err := range errs {
+		msgs[idx] = err.Error()
+	}
+	return fmt.Sprintf("%d PolicyGenTemplate file(s) failed:\n%s", len(errs), strings.Join(msgs, "\n"))
+}
+
+// GenerateDir generates the objects of all the files of the fHandler
+// PolicyGenTemplate directory, hidden files excepted
+func GenerateDir(fHandler *utils.FilesHandler, opts Options) (*Result, error) {
+	pgtFiles, err := ListDir(fHandler)
+	if err != nil {
+		return &Result{}, err
+	}
+	return Generate(fHandler, pgtFiles, opts)
+}
+
+// ListDir returns the paths of the files of the fHandler PolicyGenTemplate
+// directory, hidden files excepted, or none when the directory is unset
+func ListDir(fHandler *utils.FilesHandler) ([]string, error) {
+	if fHandler.PgtDir == utils.UnsetStringValue {
+		return nil, nil
+	}
+	files, err := fHandler.GetTempFiles()
+	if err != nil {
+		return nil, fmt.Errorf("could not get file list from %s: %s", fHandler.PgtDir, err)
+	}
+	pgtFiles := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.Name()[0] == '.' {
+			// Skip hidden files (for example, .gitignore or editor swap files)
+			continue
+		}
+		pgtFiles = append(pgtFiles, fHandler.PgtDir+"/"+file.Name())
+	}
+	return pgtFiles, nil
+}
+
+// Generate generates the objects of the given PolicyGenTemplate files. A file
+// which fails is skipped entirely and the processing goes on with the next
+// file. The returned error is an Errors holding every failure, or nil.
+func Generate(fHandler *utils.FilesHandler, pgtFiles []string, opts Options) (*Result, error) {
+	result := &Result{}
+	var errs Errors
+
+	if err := policyGen.CheckWaveDependencies(opts.WaveDependencies); err != nil {
+		return result, Errors{{File: "options", Err: err}}
+	}
+	// The files are built concurrently, each one into its own result, and the
+	// results are gathered in the order of the files
+	fileResults := make([]*Result, len(pgtFiles))
+	fileErrs := make([]error, len(pgtFiles))
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers && worker < len(pgtFiles); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				fileResults[idx] = &Result{}
+				fileErrs[idx] = fileResults[idx].generateFile(fHandler, pgtFiles[idx], opts)
+			}
+		}()
+	}
+	for idx := range pgtFiles {
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+
+	// A ManagedClusterSetBinding is generated once per namespace, by the PGT
+	// setting clusterSetBinding, the other ones failing
+	clusterSetBindings := make(map[string]string)
+	for idx, file := range pgtFiles {
+		if fileErrs[idx] != nil {
+			errs = append(errs, &FileError{File: file, Err: fileErrs[idx]})
+		} else if err := fileResults[idx].checkClusterSetBindings(clusterSetBindings); err != nil {
+			errs = append(errs, &FileError{File: file, Err: err})
+			continue
+		}
+		result.merge(fileResults[idx])
+	}
+	if opts.WaveDependencies != "" {
+		if err := result.setWaveDependencies(opts.WaveDependencies); err != nil {
+			errs = append(errs, &FileError{File: "options", Err: err})
+		}
+	}
+	// Keep the output independent of the order of the files
+	sort.SliceStable(result.Outputs, func(i, j int) bool {
+		return result.Outputs[i].Path < result.Outputs[j].Path
+	})
+	if len(errs) > 0 {
+		return result, errs
+	}
+	return result, nil
+}
+
+// merge appends the objects and warnings of the other result
+func (result *Result) merge(other *Result) {
+	result.Policies = append(result.Policies, other.Policies...)
+	result.PolicySets = append(result.PolicySets, other.PolicySets...)
+	result.PlacementRules = append(result.PlacementRules, other.PlacementRules...)
+	result.Placements = append(result.Placements, other.Placements...)
+	result.ManagedClusterSetBindings = append(result.ManagedClusterSetBindings, other.ManagedClusterSetBindings...)
+	result.PlacementBindings = append(result.PlacementBindings, other.PlacementBindings...)
+	result.CustomResources = append(result.CustomResources, other.CustomResources...)
+	result.Warnings = append(result.Warnings, other.Warnings...)
+	result.Outputs = append(result.Outputs, other.Outputs...)
+}
+
+// checkClusterSetBindings returns an error when a ManagedClusterSetBinding of
+// the result is generated by another file already, and records the others
+// in generated, keyed by namespace and name
+func (result *Result) checkClusterSetBindings(generated map[string]string) error {
+	for _, binding := range result.ManagedClusterSetBindings {
+		key := binding.ManagedClusterSetBinding.Metadata.Namespace + "/" + binding.ManagedClusterSetBinding.Metadata.Name
+		if other, found := generated[key]; found {
+			return fmt.Errorf("ManagedClusterSetBinding %s is generated by %s already, set clusterSetBinding on a single "+
+				"PolicyGenTemplate of the namespace", key, other)
+		}
+	}
+	for _, binding := range result.ManagedClusterSetBindings {
+		generated[binding.ManagedClusterSetBinding.Metadata.Namespace+"/"+binding.ManagedClusterSetBinding.Metadata.Name] = binding.PolicyGenTemplate
+	}
+	return nil
+}
+
+func (result *Result) generateFile(fHandler *utils.FilesHandler, file string, opts Options) error {
+	kindType := utils.KindType{}
+	yamlFile, err := fHandler.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("could not read file: %s", err)
+	}
+
+	err = yaml.Unmarshal(yamlFile, &kindType)
+	if err != nil {
+		return fmt.Errorf("could not parse as yaml: %s", err)
+	}
+	if kindType.Kind != "PolicyGenTemplate" {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Unsupported yaml structure kind in %s: %s", file, kindType))
+		return nil
+	}
+
+	policyGenTemp := utils.PolicyGenTemplate{}
+	err = yaml.Unmarshal(yamlFile, &policyGenTemp)
+	if err != nil {
+		return fmt.Errorf("could not unmarshal PolicyGenTemplate data: %s", err)
+	}
+	// overwrite template setting with the optional overrides
+	if opts.DisableWrapInPolicy {
+		policyGenTemp.Spec.WrapInPolicy = false
+	}
+	if opts.PlacementKind != "" {
+		policyGenTemp.Spec.PlacementKind = opts.PlacementKind
+	}
+	if policyGenTemp.Spec.PlacementKind == utils.PlacementKind {
+		policyGenTemp.Spec.PlacementTolerations = append(policyGenTemp.Spec.PlacementTolerations, opts.PlacementTolerations...)
+	}
+
+	fHandler, err = fHandler.ForSourceCRsRef(policyGenTemp.Spec.SourceCRsRef)
+	if err != nil {
+		return err
+	}
+	pBuilder := policyGen.NewPolicyBuilder(fHandler)
+	pBuilder.SetSchemaValidator(opts.SchemaValidator)
+	policies, err := pBuilder.Build(policyGenTemp)
+	if err != nil {
+		return fmt.Errorf("could not build the entire policy: %s", err)
+	}
+
+	// Only keep the objects once the whole file is built
+	paths := make([]string, 0, len(policies))
+	for path := range policies {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := result.add(file, path, policies[path], pBuilder.OutputSourceFiles(path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (result *Result) add(file string, path string, object interface{}, sourceFiles []string) error {
+	switch typed := object.(type) {
+	case utils.AcmPolicy:
+		result.Policies = append(result.Policies, GeneratedPolicy{file, path, typed})
+	case utils.PolicySet:
+		result.PolicySets = append(result.PolicySets, GeneratedPolicySet{file, path, typed})
+	case utils.PlacementRule:
+		result.PlacementRules = append(result.PlacementRules, GeneratedPlacementRule{file, path, typed})
+	case utils.Placement:
+		result.Placements = append(result.Placements, GeneratedPlacement{file, path, typed})
+	case utils.ManagedClusterSetBinding:
+		result.ManagedClusterSetBindings = append(result.ManagedClusterSetBindings, GeneratedManagedClusterSetBinding{file, path, typed})
+	case utils.PlacementBinding:
+		result.PlacementBindings = append(result.PlacementBindings, GeneratedPlacementBinding{file, path, typed})
+	case []map[string]interface{}:
+		result.CustomResources = append(result.CustomResources, GeneratedCRs{file, path, typed})
+	default:
+		return fmt.Errorf("unexpected object of type %T generated for %s", object, path)
+	}
+	result.Outputs = append(result.Outputs, Output{PolicyGenTemplate: file, Path: path, Object: object, SourceFiles: sourceFiles})
+	return nil
+}
+
+// setWaveDependencies sets the wave dependencies across the policies of all
+// the files, replacing the dependencies set within each PGT
+func (result *Result) setWaveDependencies(waveDependencies string) error {
+	acmPolicies := make([]*utils.AcmPolicy, len(result.Policies))
+	for idx := range result.Policies {
+		acmPolicies[idx] = &result.Policies[idx].Policy
+	}
+	if err := policyGen.SetWaveDependencies(acmPolicies, waveDependencies); err != nil {
+		return err
+	}
+
+	updated := make(map[string]utils.AcmPolicy, len(result.Policies))
+	for _, policy := range result.Policies {
+		updated[policy.Path] = policy.Policy
+	}
+	for idx, output := range result.Outputs {
+		if policy, found := updated[output.Path]; found {
+			result.Outputs[idx].Object = policy
+		}
+	}
+	return nil
+}
+
+// Marshal returns the yaml of the output object. Lists of objects are
+// marshalled as a multi-document yaml.
+func (output Output) Marshal() ([]byte, error) {
+	t := reflect.ValueOf(output.Object)
+	if t.Kind() != reflect.Slice {
+		return yaml.Marshal(output.Object)
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < t.Len(); i++ {
+		b, err := yaml.Marshal(t.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling yaml for %s[%d]: %s", output.Path, i, err)
+		}
+		buf.WriteString("---\n")
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+// Write writes every output to its file in the fHandler output directory, or
+// to stdout when the output directory is unset. Failures are collected and
+// the remaining outputs are still written.
+func (result *Result) Write(fHandler *utils.FilesHandler, stdout io.Writer) error {
+	var errs Errors
+	for _, output := range result.Outputs {
+		content, err := output.Marshal()
+		if err == nil {
+			err = writeOutput(fHandler, stdout, output.Path, content)
+		}
+		if err != nil {
+			errs = append(errs, &FileError{File: output.PolicyGenTemplate, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func writeOutput(fHandler *utils.FilesHandler, stdout io.Writer, path string, content []byte) error {
+	// write to file when out dir is provided, otherwise write to standard output
+	if fHandler.OutDir != utils.UnsetStringValue {
+		if err := fHandler.WriteFile(path+utils.FileExt, content); err != nil {
+			return fmt.Errorf("could not write file %s: %s", fHandler.OutDir+"/"+path+utils.FileExt, err)
+		}
+		return nil
+	}
+	strContent := string(content)
+	if !strings.HasPrefix(strContent, "---\n") {
+		strContent = "---\n" + strContent
+	}
+	_, err := fmt.Fprintln(stdout, strContent)
+	return err
+}
@@ -0,0 +1,224 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+const sourceDir = "../policyGen/testData/GenericSourceFiles"
+
+func writePgts(t *testing.T, pgts map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range pgts {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+const validPgt = `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+`
+
+func TestGenerateDir(t *testing.T) {
+	unwrappedPgt := strings.NewReplacer("test1", "test2", "spec:\n", "spec:\n  wrapInPolicy: false\n").Replace(validPgt)
+	dir := writePgts(t, map[string]string{
+		"valid.yaml":     validPgt,
+		"unwrapped.yaml": unwrappedPgt,
+		"other.yaml":     "apiVersion: v1\nkind: ConfigMap\n",
+		".hidden.yaml":   "not: [yaml",
+	})
+
+	fHandler := utils.NewFilesHandler(sourceDir, dir, utils.UnsetStringValue)
+	result, err := GenerateDir(fHandler, Options{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, len(result.Policies), 1)
+	assert.Equal(t, result.Policies[0].Path, "test1/test1-gen-policy")
+	assert.Equal(t, result.Policies[0].PolicyGenTemplate, dir+"/valid.yaml")
+	assert.Equal(t, result.Policies[0].Policy.Metadata.Name, "test1-gen-policy")
+	assert.Equal(t, len(result.PlacementRules), 1)
+	assert.Equal(t, result.PlacementRules[0].Path, "test1/test1-placementrules")
+	assert.Equal(t, len(result.PlacementBindings), 1)
+	assert.Equal(t, len(result.Placements), 0)
+
+	assert.Equal(t, len(result.CustomResources), 1)
+	assert.Equal(t, result.CustomResources[0].PolicyGenTemplate, dir+"/unwrapped.yaml")
+	assert.Equal(t, result.CustomResources[0].CRs[0]["kind"], "Namespace")
+
+	assert.Equal(t, len(result.Outputs), 4)
+	assert.Equal(t, len(result.Warnings), 1)
+	assert.Contains(t, result.Warnings[0], "other.yaml")
+
+	// The hidden files aren't listed, nor anything without directory
+	files, err := ListDir(fHandler)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{dir + "/other.yaml", dir + "/unwrapped.yaml", dir + "/valid.yaml"}, files)
+	files, err = ListDir(utils.NewFilesHandler(sourceDir, utils.UnsetStringValue, utils.UnsetStringValue))
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+	_, err = ListDir(utils.NewFilesHandler(sourceDir, dir+"/missing", utils.UnsetStringValue))
+	assert.ErrorContains(t, err, "could not get file list from "+dir+"/missing")
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := writePgts(t, map[string]string{
+		"valid.yaml":         validPgt,
+		"missingsource.yaml": strings.ReplaceAll(validPgt, "GenericNamespace.yaml", "Missing.yaml"),
+		"badyaml.yaml":       "not: [yaml",
+	})
+	files := []string{dir + "/badyaml.yaml", dir + "/missingsource.yaml", dir + "/valid.yaml"}
+
+	fHandler := utils.NewFilesHandler(sourceDir, dir, utils.UnsetStringValue)
+	result, err := Generate(fHandler, files, Options{})
+	assert.NotNil(t, err)
+
+	// Every failing file is reported
+	var errs Errors
+	assert.True(t, errors.As(err, &errs))
+	assert.Equal(t, len(errs), 2)
+	assert.Equal(t, errs[0].File, files[0])
+	assert.Contains(t, errs[0].Error(), "could not parse as yaml")
+	assert.Equal(t, errs[1].File, files[1])
+	assert.Contains(t, errs[1].Error(), "could not build the entire policy")
+	assert.Contains(t, err.Error(), "2 PolicyGenTemplate file(s) failed")
+
+	// The valid file is still generated, nothing is kept from the failing ones
+	assert.Equal(t, len(result.Policies), 1)
+	assert.Equal(t, result.Policies[0].PolicyGenTemplate, files[2])
+	assert.Equal(t, len(result.Outputs), 3)
+}
+
+func TestGenerateWorkers(t *testing.T) {
+	pgts := make(map[string]string)
+	files := make([]string, 0)
+	for idx := 0; idx < 20; idx++ {
+		name := fmt.Sprintf("test%d", idx)
+		pgts[name+".yaml"] = strings.ReplaceAll(validPgt, "test1", name)
+		files = append(files, name+".yaml")
+	}
+	pgts["other.yaml"] = "apiVersion: v1\nkind: ConfigMap\n"
+	pgts["missingsource.yaml"] = strings.ReplaceAll(validPgt, "GenericNamespace.yaml", "Missing.yaml")
+	files = append(files, "other.yaml", "missingsource.yaml")
+	dir := writePgts(t, pgts)
+	for idx := range files {
+		files[idx] = dir + "/" + files[idx]
+	}
+
+	// The result is the same whatever the number of files built concurrently
+	fHandler := utils.NewFilesHandler(sourceDir, dir, utils.UnsetStringValue)
+	expected, expectedErr := Generate(fHandler, files, Options{Workers: 1})
+	assert.NotNil(t, expectedErr)
+	assert.Equal(t, len(expected.Policies), 20)
+	for _, workers := range []int{0, 4, 50} {
+		fHandler := utils.NewFilesHandler(sourceDir, dir, utils.UnsetStringValue)
+		result, err := Generate(fHandler, files, Options{Workers: workers})
+		assert.Equal(t, expected, result)
+		assert.Equal(t, expectedErr, err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := writePgts(t, map[string]string{"valid.yaml": strings.Replace(validPgt, "spec:\n", "spec:\n  clusterSetBinding: true\n", 1)})
+	outDir := t.TempDir()
+
+	fHandler := utils.NewFilesHandler(sourceDir, dir, outDir)
+	result, err := GenerateDir(fHandler, Options{PlacementKind: utils.PlacementKind})
+	assert.Nil(t, err)
+	assert.Nil(t, result.Write(fHandler, nil))
+
+	for _, output := range result.Outputs {
+		content, err := os.ReadFile(outDir + "/" + output.Path + utils.FileExt)
+		assert.Nil(t, err)
+		expected, err := output.Marshal()
+		assert.Nil(t, err)
+		assert.Equal(t, string(content), string(expected))
+	}
+	assert.Equal(t, len(result.Placements), 1)
+	assert.Equal(t, len(result.ManagedClusterSetBindings), 1)
+}
+
+func TestGenerateClusterSetBindings(t *testing.T) {
+	bindingPgt := strings.Replace(validPgt, "spec:\n", "spec:\n  clusterSetBinding: true\n", 1)
+	dir := writePgts(t, map[string]string{
+		"a.yaml": strings.ReplaceAll(bindingPgt, `name: "test1"`, `name: "test-a"`),
+		"b.yaml": strings.ReplaceAll(bindingPgt, `name: "test1"`, `name: "test-b"`),
+		"c.yaml": strings.ReplaceAll(validPgt, "test1", "test-c"),
+	})
+
+	// The binding is only generated for the PGTs opting in, a second PGT of
+	// the namespace opting in fails
+	fHandler := utils.NewFilesHandler(sourceDir, dir, utils.UnsetStringValue)
+	result, err := GenerateDir(fHandler, Options{PlacementKind: utils.PlacementKind})
+	assert.Equal(t, Errors{{File: dir + "/b.yaml", Err: fmt.Errorf("ManagedClusterSetBinding test1/global is generated by %s already, "+
+		"set clusterSetBinding on a single PolicyGenTemplate of the namespace", dir+"/a.yaml")}}, err)
+	assert.Equal(t, len(result.Placements), 2)
+	assert.Equal(t, len(result.ManagedClusterSetBindings), 1)
+	assert.Equal(t, result.ManagedClusterSetBindings[0].Path, "test-a/global")
+	assert.Equal(t, result.ManagedClusterSetBindings[0].ManagedClusterSetBinding.Metadata.Namespace, "test1")
+
+	bindings := 0
+	for _, output := range result.Outputs {
+		if _, ok := output.Object.(utils.ManagedClusterSetBinding); ok {
+			bindings++
+		}
+	}
+	assert.Equal(t, bindings, 1)
+}
+
+func TestGenerateWaveDependencies(t *testing.T) {
+	configPgt := strings.NewReplacer("test1", "test2", "GenericNamespace.yaml", "GenericConfig.yaml").Replace(validPgt)
+	dir := writePgts(t, map[string]string{
+		"valid.yaml":  validPgt,
+		"config.yaml": configPgt,
+	})
+
+	fHandler := utils.NewFilesHandler(sourceDir, dir, utils.UnsetStringValue)
+	result, err := GenerateDir(fHandler, Options{WaveDependencies: utils.WaveDependencies})
+	assert.Nil(t, err)
+	assert.Equal(t, len(result.Policies), 2)
+
+	// The wave 2 policy of one PGT depends on the wave 1 policy of the other
+	for _, policy := range result.Policies {
+		if policy.Policy.Metadata.Name == "test1-gen-policy" {
+			assert.Empty(t, policy.Policy.Spec.Dependencies)
+			continue
+		}
+		assert.Equal(t, []utils.PolicyDependency{{
+			ApiVersion: "policy.open-cluster-management.io/v1",
+			Kind:       "Policy",
+			Name:       "test1-gen-policy",
+			Namespace:  "test1",
+			Compliance: "Compliant",
+		}}, policy.Policy.Spec.Dependencies)
+	}
+
+	// The written outputs hold the dependencies
+	for _, output := range result.Outputs {
+		if output.Path == "test2/test2-gen-policy" {
+			content, err := output.Marshal()
+			assert.Nil(t, err)
+			assert.Contains(t, string(content), "dependencies:")
+		}
+	}
+
+	_, err = GenerateDir(fHandler, Options{WaveDependencies: "spec"})
+	assert.EqualError(t, err, "1 PolicyGenTemplate file(s) failed:\n"+
+		"options: waveDependencies 'spec' is not supported, use 'dependencies' or 'extraDependencies'")
+}
@@ -0,0 +1,203 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+)
+
+// ManifestFileName is the name of the manifest written in the output directory
+const ManifestFileName = "manifest.json"
+
+// Manifest lists the files written by a policygenerator run, so that two runs
+// can be compared
+type Manifest struct {
+	Files []ManifestEntry `json:"files"`
+}
+
+type ManifestEntry struct {
+	// Path of the file, relative to the output directory
+	File string `json:"file"`
+	Kind string `json:"kind"`
+	// Path of the PolicyGenTemplate, relative to the PolicyGenTemplate
+	// directory when set
+	PolicyGenTemplate string   `json:"policyGenTemplate"`
+	SourceFiles       []string `json:"sourceFiles,omitempty"`
+	Wave              string   `json:"wave,omitempty"`
+	// SHA-256 of the rendered yaml
+	SHA256 string `json:"sha256"`
+}
+
+// ManifestDiff holds the files which differ between two manifests
+type ManifestDiff struct {
+	Added   []ManifestEntry
+	Removed []ManifestEntry
+	Changed []ManifestEntry
+}
+
+// Manifest returns the manifest of the outputs, sorted by file. The
+// PolicyGenTemplates are recorded relative to the fHandler PolicyGenTemplate
+// directory, so that the manifest doesn't depend on where it is checked out.
+func (result *Result) Manifest(fHandler *utils.FilesHandler) (Manifest, error) {
+	manifest := Manifest{Files: make([]ManifestEntry, 0, len(result.Outputs))}
+	for _, output := range result.Outputs {
+		content, err := output.Marshal()
+		if err != nil {
+			return manifest, err
+		}
+		sum := sha256.Sum256(content)
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			File:              output.Path + utils.FileExt,
+			Kind:              outputKind(output.Object),
+			PolicyGenTemplate: manifestPgtPath(fHandler, output.PolicyGenTemplate),
+			SourceFiles:       output.SourceFiles,
+			Wave:              outputWave(output.Object),
+			SHA256:            hex.EncodeToString(sum[:]),
+		})
+	}
+	sort.SliceStable(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].File < manifest.Files[j].File
+	})
+	return manifest, nil
+}
+
+// manifestPgtPath returns the path of the PolicyGenTemplate file relative to
+// the PolicyGenTemplate directory, or the file as given when it isn't within
+func manifestPgtPath(fHandler *utils.FilesHandler, file string) string {
+	if fHandler.PgtDir == utils.UnsetStringValue {
+		return file
+	}
+	rel, err := filepath.Rel(fHandler.PgtDir, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return file
+	}
+	return filepath.ToSlash(rel)
+}
+
+// WriteManifest writes the manifest of the outputs in the fHandler output
+// directory
+func (result *Result) WriteManifest(fHandler *utils.FilesHandler) error {
+	manifest, err := result.Manifest(fHandler)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fHandler.OutDir+"/"+ManifestFileName, append(content, '\n'), 0644)
+}
+
+// ReadManifest reads a manifest written by WriteManifest
+func ReadManifest(path string) (Manifest, error) {
+	manifest := Manifest{}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return manifest, fmt.Errorf("could not parse manifest %s: %s", path, err)
+	}
+	return manifest, nil
+}
+
+// CompareManifests returns the files added, removed or whose content changed
+// from the previous manifest to the current one, sorted by file
+func CompareManifests(previous Manifest, current Manifest) ManifestDiff {
+	diff := ManifestDiff{}
+	previousFiles := make(map[string]ManifestEntry, len(previous.Files))
+	for _, entry := range previous.Files {
+		previousFiles[entry.File] = entry
+	}
+	currentFiles := make(map[string]bool, len(current.Files))
+	for _, entry := range current.Files {
+		currentFiles[entry.File] = true
+		previousEntry, found := previousFiles[entry.File]
+		if !found {
+			diff.Added = append(diff.Added, entry)
+		} else if previousEntry.SHA256 != entry.SHA256 {
+			diff.Changed = append(diff.Changed, entry)
+		}
+	}
+	for _, entry := range previous.Files {
+		if !currentFiles[entry.File] {
+			diff.Removed = append(diff.Removed, entry)
+		}
+	}
+
+	for _, entries := range [][]ManifestEntry{diff.Added, diff.Removed, diff.Changed} {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].File < entries[j].File })
+	}
+	return diff
+}
+
+// Empty returns true when both manifests list the same files with the same
+// content
+func (diff ManifestDiff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+// String reports one line per file, for example:
+//
+//	changed: ztp-group/ztp-group-config-policy.yaml (Policy from group-du.yaml)
+func (diff ManifestDiff) String() string {
+	var report strings.Builder
+	for _, change := range []struct {
+		name    string
+		entries []ManifestEntry
+	}{{"changed", diff.Changed}, {"added", diff.Added}, {"removed", diff.Removed}} {
+		for _, entry := range change.entries {
+			fmt.Fprintf(&report, "%s: %s (%s from %s)\n", change.name, entry.File, entry.Kind, entry.PolicyGenTemplate)
+		}
+	}
+	return report.String()
+}
+
+func outputKind(object interface{}) string {
+	switch typed := object.(type) {
+	case utils.AcmPolicy:
+		return typed.Kind
+	case utils.PolicySet:
+		return typed.Kind
+	case utils.PlacementRule:
+		return typed.Kind
+	case utils.Placement:
+		return typed.Kind
+	case utils.ManagedClusterSetBinding:
+		return typed.Kind
+	case utils.PlacementBinding:
+		return typed.Kind
+	case []map[string]interface{}:
+		if len(typed) == 1 {
+			kind, _ := typed[0]["kind"].(string)
+			return kind
+		}
+		return "List"
+	}
+	return ""
+}
+
+// outputWave returns the ztp-deploy-wave of the policy, or of the first plain
+// CR holding one
+func outputWave(object interface{}) string {
+	switch typed := object.(type) {
+	case utils.AcmPolicy:
+		return typed.Metadata.Annotations[utils.ZtpDeployWaveAnnotation]
+	case []map[string]interface{}:
+		for _, cr := range typed {
+			metadata, _ := cr["metadata"].(map[string]interface{})
+			annotations, _ := metadata["annotations"].(map[string]interface{})
+			if wave, found := annotations[utils.ZtpDeployWaveAnnotation].(string); found {
+				return wave
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifest(t *testing.T) {
+	pgt := strings.Replace(validPgt, "policyName: \"gen-policy\"\n",
+		"policyName: \"gen-policy\"\n    - fileName: GenericOperatorGroup.yaml\n      policyName: \"gen-policy\"\n", 1)
+	dir := writePgts(t, map[string]string{"valid.yaml": pgt})
+	outDir := t.TempDir()
+
+	fHandler := utils.NewFilesHandler(sourceDir, dir, outDir)
+	result, err := GenerateDir(fHandler, Options{})
+	assert.Nil(t, err)
+	assert.Nil(t, result.Write(fHandler, nil))
+	assert.Nil(t, result.WriteManifest(fHandler))
+
+	manifest, err := ReadManifest(outDir + "/" + ManifestFileName)
+	assert.Nil(t, err)
+	assert.Len(t, manifest.Files, 3)
+
+	// Sorted by file
+	assert.Equal(t, "test1/test1-gen-policy.yaml", manifest.Files[0].File)
+	assert.Equal(t, "test1/test1-placementbinding.yaml", manifest.Files[1].File)
+	assert.Equal(t, "test1/test1-placementrules.yaml", manifest.Files[2].File)
+
+	policy := manifest.Files[0]
+	assert.Equal(t, "Policy", policy.Kind)
+	assert.Equal(t, "valid.yaml", policy.PolicyGenTemplate)
+	assert.Equal(t, []string{"GenericNamespace.yaml", "GenericOperatorGroup.yaml"}, policy.SourceFiles)
+	assert.Equal(t, "1", policy.Wave)
+	assert.Len(t, policy.SHA256, 64)
+	assert.Empty(t, manifest.Files[1].SourceFiles)
+	assert.Empty(t, manifest.Files[1].Wave)
+
+	// The same input renders the same manifest
+	again, err := GenerateDir(fHandler, Options{})
+	assert.Nil(t, err)
+	againManifest, err := again.Manifest(fHandler)
+	assert.Nil(t, err)
+	assert.Equal(t, manifest, againManifest)
+	assert.True(t, CompareManifests(manifest, againManifest).Empty())
+
+	// Files outside of the PolicyGenTemplate directory are kept as given
+	assert.Equal(t, "/other/valid.yaml", manifestPgtPath(fHandler, "/other/valid.yaml"))
+	unset := utils.NewFilesHandler(sourceDir, utils.UnsetStringValue, outDir)
+	assert.Equal(t, dir+"/valid.yaml", manifestPgtPath(unset, dir+"/valid.yaml"))
+}
+
+func TestCompareManifests(t *testing.T) {
+	previous := Manifest{Files: []ManifestEntry{
+		{File: "a/a-policy.yaml", Kind: "Policy", PolicyGenTemplate: "a.yaml", SHA256: "1"},
+		{File: "a/a-placementrules.yaml", Kind: "PlacementRule", PolicyGenTemplate: "a.yaml", SHA256: "2"},
+		{File: "b/b-policy.yaml", Kind: "Policy", PolicyGenTemplate: "b.yaml", SHA256: "3"},
+	}}
+	current := Manifest{Files: []ManifestEntry{
+		{File: "a/a-policy.yaml", Kind: "Policy", PolicyGenTemplate: "a.yaml", SHA256: "10"},
+		{File: "a/a-placementrules.yaml", Kind: "PlacementRule", PolicyGenTemplate: "a.yaml", SHA256: "2"},
+		{File: "c/c-policy.yaml", Kind: "Policy", PolicyGenTemplate: "c.yaml", SHA256: "4"},
+	}}
+
+	diff := CompareManifests(previous, current)
+	assert.False(t, diff.Empty())
+	assert.Equal(t, []ManifestEntry{current.Files[0]}, diff.Changed)
+	assert.Equal(t, []ManifestEntry{current.Files[2]}, diff.Added)
+	assert.Equal(t, []ManifestEntry{previous.Files[2]}, diff.Removed)
+	assert.Equal(t, "changed: a/a-policy.yaml (Policy from a.yaml)\n"+
+		"added: c/c-policy.yaml (Policy from c.yaml)\n"+
+		"removed: b/b-policy.yaml (Policy from b.yaml)\n", diff.String())
+}
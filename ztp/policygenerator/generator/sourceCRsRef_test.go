@@ -0,0 +1,134 @@
+package generator
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// bundleTar returns a gzipped tar of the files
+func bundleTar(t *testing.T, files map[string]string) []byte {
+	out := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&out)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		assert.Nil(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tarWriter.Write([]byte(content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tarWriter.Close())
+	assert.Nil(t, gzipWriter.Close())
+	return out.Bytes()
+}
+
+func writeBlob(t *testing.T, layoutDir string, content []byte) string {
+	sum := sha256.Sum256(content)
+	assert.Nil(t, os.MkdirAll(filepath.Join(layoutDir, "blobs", "sha256"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(layoutDir, "blobs", "sha256", hex.EncodeToString(sum[:])), content, 0644))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// writeOCILayout writes an OCI image layout holding an image per tag, each of
+// a single layer
+func writeOCILayout(t *testing.T, layoutDir string, images map[string][]byte) {
+	index := map[string]interface{}{"schemaVersion": 2, "manifests": []interface{}{}}
+	for tag, layer := range images {
+		manifest, _ := json.Marshal(map[string]interface{}{
+			"schemaVersion": 2,
+			"layers": []interface{}{map[string]interface{}{
+				"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+				"digest":    writeBlob(t, layoutDir, layer),
+			}},
+		})
+		index["manifests"] = append(index["manifests"].([]interface{}), map[string]interface{}{
+			"mediaType":   "application/vnd.oci.image.manifest.v1+json",
+			"digest":      writeBlob(t, layoutDir, manifest),
+			"annotations": map[string]string{"org.opencontainers.image.ref.name": tag},
+		})
+	}
+	content, _ := json.Marshal(index)
+	assert.Nil(t, os.WriteFile(filepath.Join(layoutDir, "index.json"), content, 0644))
+}
+
+func TestSourceCRsRef(t *testing.T) {
+	bundles := t.TempDir()
+	namespace := func(name string) string {
+		return "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: " + name + "\n"
+	}
+	tarball := filepath.Join(bundles, "source-crs-4.14.tar.gz")
+	assert.Nil(t, os.WriteFile(tarball, bundleTar(t, map[string]string{
+		"source-crs/GenericNamespace.yaml": namespace("ns-4-14"),
+	}), 0644))
+	layout := filepath.Join(bundles, "ztp-site-generate")
+	writeOCILayout(t, layout, map[string][]byte{
+		"4.15": bundleTar(t, map[string]string{"home/ztp/source-crs/GenericNamespace.yaml": namespace("ns-4-15")}),
+		"4.16": bundleTar(t, map[string]string{"home/ztp/source-crs/GenericNamespace.yaml": namespace("ns-4-16")}),
+	})
+
+	pgtWithRef := func(name string, ref string) string {
+		return strings.NewReplacer("test1", name, "spec:\n", "spec:\n  sourceCRsRef: "+ref+"\n").Replace(validPgt)
+	}
+	dir := writePgts(t, map[string]string{
+		"local.yaml":   validPgt,
+		"tarball.yaml": pgtWithRef("tarball", tarball),
+		"oci.yaml":     pgtWithRef("oci", "oci:"+layout+":4.15"),
+	})
+
+	lockFile := filepath.Join(t.TempDir(), utils.SourceCRsLockFile)
+	store, err := utils.NewSourceCRsStore(t.TempDir(), lockFile)
+	assert.Nil(t, err)
+	fHandler := utils.NewFilesHandler(sourceDir, dir, utils.UnsetStringValue)
+	fHandler.SetSourceCRs(store, "")
+	result, err := GenerateDir(fHandler, Options{})
+	assert.Nil(t, err)
+
+	namespaces := make(map[string]string)
+	for _, policy := range result.Policies {
+		objDef := policy.Policy.Spec.PolicyTemplates[0].ObjDef.Spec.ObjectTemplates[0].ObjectDefinition
+		namespaces[policy.Policy.Metadata.Name] = objDef["metadata"].(map[string]interface{})["name"].(string)
+	}
+	assert.Equal(t, map[string]string{
+		"test1-gen-policy":   "generic-ns",
+		"tarball-gen-policy": "ns-4-14",
+		"oci-gen-policy":     "ns-4-15",
+	}, namespaces)
+
+	// The digests are recorded in the lock file
+	assert.Nil(t, store.WriteLock())
+	lock, err := os.ReadFile(lockFile)
+	assert.Nil(t, err)
+	assert.Contains(t, string(lock), "ref: "+tarball+"\n")
+	assert.Contains(t, string(lock), "ref: oci:"+layout+":4.15\n")
+	assert.Equal(t, 2, strings.Count(string(lock), "digest: sha256:"))
+
+	// The default ref applies to the PGTs without one
+	fHandler.SetSourceCRs(store, "oci:"+layout+":4.16")
+	result, err = Generate(fHandler, []string{dir + "/local.yaml"}, Options{})
+	assert.Nil(t, err)
+	objDef := result.Policies[0].Policy.Spec.PolicyTemplates[0].ObjDef.Spec.ObjectTemplates[0].ObjectDefinition
+	assert.Equal(t, "ns-4-16", objDef["metadata"].(map[string]interface{})["name"])
+
+	// A changed bundle no longer matches the lock file
+	assert.Nil(t, os.WriteFile(tarball, bundleTar(t, map[string]string{
+		"source-crs/GenericNamespace.yaml": namespace("ns-changed"),
+	}), 0644))
+	store, err = utils.NewSourceCRsStore(t.TempDir(), lockFile)
+	assert.Nil(t, err)
+	fHandler.SetSourceCRs(store, "")
+	_, err = Generate(fHandler, []string{dir + "/tarball.yaml"}, Options{})
+	assert.ErrorContains(t, err, "doesn't match")
+	assert.ErrorContains(t, err, "locked in "+lockFile)
+
+	_, err = Generate(fHandler, []string{writePgts(t, map[string]string{"missing.yaml": pgtWithRef("missing", "oci:"+layout+":4.0")}) + "/missing.yaml"}, Options{})
+	assert.ErrorContains(t, err, "no image tagged '4.0'")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/krm"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+)
+
+// runKRMFunction implements the fn subcommand, running the generator as a KRM
+// function, and returns the exit code: 1 when the results hold an error or
+// the ResourceList can't be processed, 2 on invalid arguments
+func runKRMFunction(args []string) int {
+	flags := flag.NewFlagSet("fn", flag.ContinueOnError)
+	config := krm.Config{}
+	flags.StringVar(&config.SourcePath, "sourcePath", utils.SourceCRsPath, "Directory where source-crs files exist, the one of the working directory or else next to the executable by default (overridden by the functionConfig data)")
+	flags.StringVar(&config.SourceCRsRef, "sourceCRsRef", "", "Tarball or oci:<dir>[:<tag>] OCI image layout of the source-crs of the PolicyGenTemplates without spec.sourceCRsRef (overrides sourcePath)")
+	flags.StringVar(&config.SourceCRsCache, "sourceCRsCache", "", "Directory the sourceCRsRef bundles are extracted to (default the user cache directory)")
+	flags.StringVar(&config.SourceCRsLock, "sourceCRsLock", "", "Lock file the sourceCRsRef digests are verified against, it is never written")
+	flags.BoolVar(&config.Lint, "lint", false, "Report the lint findings of the PolicyGenTemplates in the results")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if config.SourcePath == utils.SourceCRsPath {
+		config.SourcePath = defaultKRMSourcePath()
+	}
+
+	err := krm.Run(os.Stdin, os.Stdout, config)
+	if errors.Is(err, krm.ErrResults) {
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// isKRMFunctionCall returns true when stdin is piped, as the legacy exec
+// plugin is always given its config file as argument
+func isKRMFunctionCall() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice == 0
+}
+
+// defaultKRMSourcePath returns the source-crs directory of the working
+// directory, or else the one next to the executable as laid out in the KRM
+// function image
+func defaultKRMSourcePath() string {
+	if _, err := os.Stat(utils.SourceCRsPath); err == nil {
+		return utils.SourceCRsPath
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return utils.SourceCRsPath
+	}
+	return filepath.Join(filepath.Dir(executable), utils.SourceCRsPath)
+}
@@ -0,0 +1,420 @@
+// Package krm runs the policy generator as a KRM function: it reads a
+// ResourceList on stdin and writes a ResourceList holding the generated
+// objects on stdout, as expected by "kustomize fn run" and the containerized
+// kustomize generators.
+package krm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/generator"
+	"github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/lint"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ResourceListAPIVersion = "config.kubernetes.io/v1"
+	ResourceListKind       = "ResourceList"
+
+	// Annotations setting the file each item is written to by kustomize fn
+	PathAnnotation          = "config.kubernetes.io/path"
+	InternalPathAnnotation  = "internal.config.kubernetes.io/path"
+	IndexAnnotation         = "config.kubernetes.io/index"
+	InternalIndexAnnotation = "internal.config.kubernetes.io/index"
+)
+
+// Severities of the results
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ErrResults is returned once the ResourceList is written when its results
+// hold an error
+var ErrResults = errors.New("the policy generator function reported errors")
+
+// ResourceList is the input and output of a KRM function
+type ResourceList struct {
+	APIVersion     string                   `yaml:"apiVersion"`
+	Kind           string                   `yaml:"kind"`
+	Items          []map[string]interface{} `yaml:"items"`
+	FunctionConfig map[string]interface{}   `yaml:"functionConfig,omitempty"`
+	Results        []Result                 `yaml:"results,omitempty"`
+}
+
+// Result is an issue reported by the function, about an item or the
+// functionConfig when ResourceRef is set
+type Result struct {
+	Message     string            `yaml:"message"`
+	Severity    string            `yaml:"severity"`
+	ResourceRef *ResourceRef      `yaml:"resourceRef,omitempty"`
+	Field       *Field            `yaml:"field,omitempty"`
+	File        *File             `yaml:"file,omitempty"`
+	Tags        map[string]string `yaml:"tags,omitempty"`
+}
+
+type ResourceRef struct {
+	APIVersion string `yaml:"apiVersion,omitempty"`
+	Kind       string `yaml:"kind"`
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace,omitempty"`
+}
+
+type Field struct {
+	Path string `yaml:"path"`
+}
+
+type File struct {
+	Path string `yaml:"path"`
+}
+
+// Config holds the settings of the function, which a ConfigMap
+// functionConfig overrides through its data keys of the same name
+type Config struct {
+	// Directory of the source CRs, used by the PGTs without sourceCRsRef
+	SourcePath string
+	// Default sourceCRsRef of the PGTs, overrides SourcePath when set
+	SourceCRsRef string
+	// Directory the sourceCRsRef bundles are extracted to
+	SourceCRsCache string
+	// Lock file the sourceCRsRef digests are verified against, never written
+	SourceCRsLock string
+	// Options overriding the settings of all the PGTs
+	Options generator.Options
+	// Reports the lint findings of the PGTs as results
+	Lint bool
+}
+
+// Run reads the ResourceList from in, generates the objects of its
+// PolicyGenTemplates and writes the resulting ResourceList to out. It returns
+// ErrResults when the written results hold an error.
+func Run(in io.Reader, out io.Writer, config Config) error {
+	content, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	list := ResourceList{}
+	if err := yaml.Unmarshal(content, &list); err != nil {
+		return fmt.Errorf("could not parse the ResourceList: %s", err)
+	}
+	if list.Kind != ResourceListKind {
+		return fmt.Errorf("expected a %s on stdin, got kind '%s'", ResourceListKind, list.Kind)
+	}
+
+	Process(&list, config)
+
+	buf := bytes.Buffer{}
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(list); err != nil {
+		return err
+	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if HasErrors(list.Results) {
+		return ErrResults
+	}
+	return nil
+}
+
+// HasErrors returns true when any result is an error
+func HasErrors(results []Result) bool {
+	for _, result := range results {
+		if result.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// pgtInput is a PolicyGenTemplate of the ResourceList
+type pgtInput struct {
+	ref  ResourceRef
+	file string
+	// item holding the PGT, nil for the functionConfig
+	item map[string]interface{}
+}
+
+// Process replaces the PolicyGenTemplates of the ResourceList items, and the
+// one given as functionConfig, by the objects generated from them. The other
+// items are kept as they are. The failures are reported in the results.
+func Process(list *ResourceList, config Config) {
+	list.APIVersion = ResourceListAPIVersion
+	list.Kind = ResourceListKind
+	if err := config.apply(list.FunctionConfig); err != nil {
+		list.Results = append(list.Results, Result{
+			Message:     err.Error(),
+			Severity:    SeverityError,
+			ResourceRef: resourceRef(list.FunctionConfig),
+		})
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", "policygenerator-krm-")
+	if err != nil {
+		list.Results = append(list.Results, Result{Message: err.Error(), Severity: SeverityError})
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Write the PGTs to files as the generator reads them
+	inputs := make([]pgtInput, 0)
+	addInput := func(object map[string]interface{}, item map[string]interface{}) error {
+		content, err := yaml.Marshal(withoutInternalAnnotations(object))
+		if err != nil {
+			return err
+		}
+		file := filepath.Join(tmpDir, fmt.Sprintf("pgt-%d.yaml", len(inputs)))
+		if err := os.WriteFile(file, content, 0644); err != nil {
+			return err
+		}
+		inputs = append(inputs, pgtInput{ref: *resourceRef(object), file: file, item: item})
+		return nil
+	}
+	if kind, _ := list.FunctionConfig["kind"].(string); kind == "PolicyGenTemplate" {
+		if err := addInput(list.FunctionConfig, nil); err != nil {
+			list.Results = append(list.Results, Result{Message: err.Error(), Severity: SeverityError})
+			return
+		}
+	}
+	items := make([]map[string]interface{}, 0, len(list.Items))
+	for _, item := range list.Items {
+		if kind, _ := item["kind"].(string); kind != "PolicyGenTemplate" {
+			items = append(items, item)
+			continue
+		}
+		if err := addInput(item, item); err != nil {
+			list.Results = append(list.Results, Result{Message: err.Error(), Severity: SeverityError, ResourceRef: resourceRef(item)})
+			return
+		}
+	}
+	if len(inputs) == 0 {
+		list.Results = append(list.Results, Result{
+			Message:  "no PolicyGenTemplate found in the functionConfig or the items",
+			Severity: SeverityWarning,
+		})
+		return
+	}
+
+	fHandler := utils.NewFilesHandler(config.SourcePath, utils.UnsetStringValue, utils.UnsetStringValue)
+	sourceCRs, err := utils.NewSourceCRsStore(config.SourceCRsCache, config.SourceCRsLock)
+	if err != nil {
+		list.Results = append(list.Results, Result{Message: err.Error(), Severity: SeverityError})
+		return
+	}
+	fHandler.SetSourceCRs(sourceCRs, config.SourceCRsRef)
+	files := make([]string, len(inputs))
+	byFile := make(map[string]pgtInput, len(inputs))
+	for idx, input := range inputs {
+		files[idx] = input.file
+		byFile[input.file] = input
+	}
+
+	result, genErr := generator.Generate(fHandler, files, config.Options)
+	if genErr != nil {
+		var errs generator.Errors
+		if !errors.As(genErr, &errs) {
+			errs = generator.Errors{{Err: genErr}}
+		}
+		for _, fileErr := range errs {
+			list.Results = append(list.Results, byFile[fileErr.File].result(SeverityError, fileErr.Err.Error(), ""))
+		}
+	}
+	for _, warning := range result.Warnings {
+		list.Results = append(list.Results, Result{Message: warning, Severity: SeverityWarning})
+	}
+	if config.Lint {
+		for _, finding := range lint.Lint(fHandler, files) {
+			if finding.Rule == lint.RuleInvalid {
+				// Already reported by the generation
+				continue
+			}
+			severity := SeverityWarning
+			if finding.Severity == lint.SeverityError {
+				severity = SeverityError
+			}
+			input := byFile[finding.File]
+			lintResult := input.result(severity, finding.Message, finding.Path)
+			lintResult.Tags = map[string]string{"rule": finding.Rule}
+			list.Results = append(list.Results, lintResult)
+		}
+	}
+
+	for _, output := range result.Outputs {
+		objects, err := outputObjects(output)
+		if err != nil {
+			list.Results = append(list.Results, byFile[output.PolicyGenTemplate].result(SeverityError, err.Error(), ""))
+			continue
+		}
+		items = append(items, objects...)
+	}
+	list.Items = items
+}
+
+// result returns a result about the PGT
+func (input pgtInput) result(severity string, message string, fieldPath string) Result {
+	result := Result{Message: message, Severity: severity}
+	if input.file == "" {
+		return result
+	}
+	ref := input.ref
+	result.ResourceRef = &ref
+	if fieldPath != "" {
+		result.Field = &Field{Path: fieldPath}
+	}
+	if input.item != nil {
+		if path := annotation(input.item, InternalPathAnnotation, PathAnnotation); path != "" {
+			result.File = &File{Path: path}
+		}
+	}
+	return result
+}
+
+// outputObjects returns the objects of the generator output, annotated with
+// the file they are written to by kustomize fn
+func outputObjects(output generator.Output) ([]map[string]interface{}, error) {
+	content, err := output.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]map[string]interface{}, 0, 1)
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		object := make(map[string]interface{})
+		err := decoder.Decode(&object)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse the generated %s: %s", output.Path, err)
+		}
+		if len(object) > 0 {
+			objects = append(objects, object)
+		}
+	}
+	for idx, object := range objects {
+		metadata, _ := object["metadata"].(map[string]interface{})
+		if metadata == nil {
+			metadata = make(map[string]interface{})
+			object["metadata"] = metadata
+		}
+		annotations, _ := metadata["annotations"].(map[string]interface{})
+		if annotations == nil {
+			annotations = make(map[string]interface{})
+			metadata["annotations"] = annotations
+		}
+		path := output.Path + utils.FileExt
+		annotations[PathAnnotation] = path
+		annotations[InternalPathAnnotation] = path
+		annotations[IndexAnnotation] = strconv.Itoa(idx)
+		annotations[InternalIndexAnnotation] = strconv.Itoa(idx)
+	}
+	return objects, nil
+}
+
+// apply overrides the config with the data of a ConfigMap functionConfig
+func (config *Config) apply(functionConfig map[string]interface{}) error {
+	if kind, _ := functionConfig["kind"].(string); kind != "ConfigMap" {
+		return nil
+	}
+	data, _ := functionConfig["data"].(map[string]interface{})
+	for key, value := range data {
+		str := fmt.Sprint(value)
+		switch key {
+		case "sourcePath":
+			config.SourcePath = str
+		case "sourceCRsRef":
+			config.SourceCRsRef = str
+		case "placementKind":
+			config.Options.PlacementKind = str
+		case "waveDependencies":
+			config.Options.WaveDependencies = str
+		case "workers":
+			workers, err := strconv.Atoi(str)
+			if err != nil || workers < 0 {
+				return fmt.Errorf("functionConfig.data.workers: '%s' is not a positive number", str)
+			}
+			config.Options.Workers = workers
+		case "wrapInPolicy", "lint":
+			enabled, err := strconv.ParseBool(str)
+			if err != nil {
+				return fmt.Errorf("functionConfig.data.%s: '%s' is not a boolean", key, str)
+			}
+			if key == "lint" {
+				config.Lint = enabled
+			} else {
+				config.Options.DisableWrapInPolicy = !enabled
+			}
+		default:
+			return fmt.Errorf("functionConfig.data.%s is not supported, use sourcePath, sourceCRsRef, placementKind, waveDependencies, workers, wrapInPolicy or lint",
+				key)
+		}
+	}
+	return nil
+}
+
+func resourceRef(object map[string]interface{}) *ResourceRef {
+	if object == nil {
+		return nil
+	}
+	ref := &ResourceRef{}
+	ref.APIVersion, _ = object["apiVersion"].(string)
+	ref.Kind, _ = object["kind"].(string)
+	metadata, _ := object["metadata"].(map[string]interface{})
+	ref.Name, _ = metadata["name"].(string)
+	ref.Namespace, _ = metadata["namespace"].(string)
+	return ref
+}
+
+func annotation(object map[string]interface{}, keys ...string) string {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	for _, key := range keys {
+		if value, ok := annotations[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// withoutInternalAnnotations returns a copy of the object without the
+// annotations set by kustomize, which are not part of the PGT
+func withoutInternalAnnotations(object map[string]interface{}) map[string]interface{} {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if len(annotations) == 0 {
+		return object
+	}
+	filtered := make(map[string]interface{}, len(annotations))
+	for key, value := range annotations {
+		if strings.HasPrefix(key, "config.kubernetes.io/") || strings.HasPrefix(key, "internal.config.kubernetes.io/") ||
+			strings.HasPrefix(key, "config.k8s.io/") {
+			continue
+		}
+		filtered[key] = value
+	}
+	copiedMetadata := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		copiedMetadata[key] = value
+	}
+	if len(filtered) > 0 {
+		copiedMetadata["annotations"] = filtered
+	} else {
+		delete(copiedMetadata, "annotations")
+	}
+	copied := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		copied[key] = value
+	}
+	copied["metadata"] = copiedMetadata
+	return copied
+}
@@ -0,0 +1,143 @@
+package krm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+const sourceDir = "../policyGen/testData/GenericSourceFiles"
+
+const pgt = `
+    apiVersion: ran.openshift.io/v1
+    kind: PolicyGenTemplate
+    metadata:
+      name: "test1"
+      namespace: "test1"
+    spec:
+      bindingRules:
+        justfortest: "true"
+      sourceFiles:
+        - fileName: GenericNamespace.yaml
+          policyName: "gen-policy"`
+
+func run(t *testing.T, input string, config Config) (ResourceList, error) {
+	out := bytes.Buffer{}
+	err := Run(strings.NewReader(input), &out, config)
+	list := ResourceList{}
+	assert.NoError(t, yaml.Unmarshal(out.Bytes(), &list))
+	return list, err
+}
+
+func itemPaths(list ResourceList) []string {
+	paths := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		paths = append(paths, annotation(item, PathAnnotation))
+	}
+	return paths
+}
+
+func TestRunFunctionConfig(t *testing.T) {
+	input := `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: kept
+functionConfig:` + pgt + `
+`
+	list, err := run(t, input, Config{SourcePath: sourceDir})
+	assert.NoError(t, err)
+	assert.Empty(t, list.Results)
+	assert.Equal(t, []string{"", "test1/test1-gen-policy.yaml", "test1/test1-placementbinding.yaml", "test1/test1-placementrules.yaml"},
+		itemPaths(list))
+	assert.Equal(t, "ConfigMap", list.Items[0]["kind"])
+	assert.Equal(t, "Policy", list.Items[1]["kind"])
+	assert.Equal(t, "test1-gen-policy", list.Items[1]["metadata"].(map[string]interface{})["name"])
+}
+
+func TestRunItems(t *testing.T) {
+	input := `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:` + strings.Replace(pgt, "    apiVersion", "  - apiVersion", 1) + `
+  - apiVersion: ran.openshift.io/v1
+    kind: PolicyGenTemplate
+    metadata:
+      name: "test2"
+      namespace: "test2"
+      annotations:
+        config.kubernetes.io/path: pgts/test2.yaml
+    spec:
+      sourceFiles:
+        - fileName: Missing.yaml
+          policyName: "gen-policy"
+functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: config
+  data:
+    sourcePath: ` + sourceDir + `
+    wrapInPolicy: "false"
+`
+	list, err := run(t, input, Config{})
+	assert.ErrorIs(t, err, ErrResults)
+
+	// The CRs of the valid PGT are generated, and the failing PGT reported
+	assert.Equal(t, []string{"customResource/test1/Namespace-generic-ns.yaml"}, itemPaths(list))
+	assert.Equal(t, 1, len(list.Results))
+	result := list.Results[0]
+	assert.Equal(t, SeverityError, result.Severity)
+	assert.Equal(t, &ResourceRef{APIVersion: "ran.openshift.io/v1", Kind: "PolicyGenTemplate", Name: "test2", Namespace: "test2"}, result.ResourceRef)
+	assert.Equal(t, &File{Path: "pgts/test2.yaml"}, result.File)
+	assert.Contains(t, result.Message, "Missing.yaml")
+}
+
+func TestRunInvalid(t *testing.T) {
+	err := Run(strings.NewReader("kind: ConfigMap\n"), &bytes.Buffer{}, Config{})
+	assert.EqualError(t, err, "expected a ResourceList on stdin, got kind 'ConfigMap'")
+
+	list, err := run(t, `
+kind: ResourceList
+items: []
+functionConfig:
+  kind: ConfigMap
+  metadata:
+    name: config
+  data:
+    outPath: out
+`, Config{})
+	assert.ErrorIs(t, err, ErrResults)
+	assert.Equal(t, []Result{{
+		Message:     "functionConfig.data.outPath is not supported, use sourcePath, sourceCRsRef, placementKind, waveDependencies, workers, wrapInPolicy or lint",
+		Severity:    SeverityError,
+		ResourceRef: &ResourceRef{Kind: "ConfigMap", Name: "config"},
+	}}, list.Results)
+
+	list, err = run(t, "kind: ResourceList\nitems: []\n", Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, SeverityWarning, list.Results[0].Severity)
+}
+
+func TestRunLint(t *testing.T) {
+	longName := strings.Repeat("a", 60)
+	input := `
+kind: ResourceList
+items: []
+functionConfig:` + strings.Replace(pgt, `"gen-policy"`, longName, 1) + `
+`
+	list, err := run(t, input, Config{SourcePath: sourceDir, Lint: true})
+	assert.ErrorIs(t, err, ErrResults)
+	rules := make([]string, 0)
+	for _, result := range list.Results {
+		rules = append(rules, result.Tags["rule"])
+		assert.Equal(t, "test1", result.ResourceRef.Name)
+	}
+	assert.Contains(t, rules, "name-length")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/generator"
+	"github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/lint"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+)
+
+// runLint implements the lint subcommand and returns the exit code: 1 when an
+// error is found, 2 on invalid arguments
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	sourceCRsPath := flags.String("sourcePath", utils.SourceCRsPath, "Directory where source-crs files exist")
+	pgtPath := flags.String("pgtPath", utils.UnsetStringValue, "Directory where policyGenTemp files exist")
+	sourceCRsRef := flags.String("sourceCRsRef", "", "Tarball or oci:<dir>[:<tag>] OCI image layout of the source-crs of the PolicyGenTemplates without spec.sourceCRsRef (overrides sourcePath)")
+	sourceCRsCache := flags.String("sourceCRsCache", "", "Directory the sourceCRsRef bundles are extracted to (default the user cache directory)")
+	sourceCRsLock := flags.String("sourceCRsLock", utils.SourceCRsLockFile, "Lock file of the sourceCRsRef digests, known refs are verified")
+	format := flags.String("format", lint.FormatText, "Output format of the findings: text, json or sarif")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	policyGenTemps := flags.Args()
+	fHandler := utils.NewFilesHandler(*sourceCRsPath, *pgtPath, utils.UnsetStringValue)
+	sourceCRs, err := utils.NewSourceCRsStore(*sourceCRsCache, *sourceCRsLock)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fHandler.SetSourceCRs(sourceCRs, *sourceCRsRef)
+	dirFiles, err := generator.ListDir(fHandler)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	policyGenTemps = append(policyGenTemps, dirFiles...)
+
+	findings := lint.Lint(fHandler, policyGenTemps)
+	if err := lint.Write(os.Stdout, findings, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if lint.HasErrors(findings) {
+		return 1
+	}
+	return 0
+}
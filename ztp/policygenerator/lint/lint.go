@@ -0,0 +1,406 @@
+// Package lint analyses PolicyGenTemplates without generating anything and
+// reports the issues which the policy generator either rejects or silently
+// accepts.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	policyGen "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/policyGen"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Rules reported by the linter
+const (
+	RuleInvalid           = "invalid-pgt"
+	RuleNameLength        = "name-length"
+	RuleDuplicateCR       = "duplicate-cr"
+	RuleMixedWaves        = "mixed-waves"
+	RuleUnknownOverlayKey = "unknown-overlay-key"
+	RuleUnusedPlaceholder = "unused-placeholder"
+)
+
+// RuleDescriptions describes each rule
+var RuleDescriptions = map[string]string{
+	RuleInvalid:           "The PolicyGenTemplate can't be generated",
+	RuleNameLength:        "The namespace and name of a generated resource exceed the 63 characters ACM limit",
+	RuleDuplicateCR:       "The same CR is in several policies binding the same clusters",
+	RuleMixedWaves:        "A policy holds CRs of different ztp-deploy-waves",
+	RuleUnknownOverlayKey: "The overlay sets a key which doesn't exist in the source CR",
+	RuleUnusedPlaceholder: "A $placeholder of the source CR has no value in the overlay",
+}
+
+// Finding is an issue found in a PolicyGenTemplate
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	// PolicyGenTemplate file
+	File string `json:"file"`
+	// Path of the offending field in the PolicyGenTemplate, and its line
+	Path    string `json:"path,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// policyCR is a CR wrapped in a policy, as seen by the cross PGT checks
+type policyCR struct {
+	file       string
+	path       string
+	line       int
+	policyName string
+	binding    string
+}
+
+type linter struct {
+	fHandler *utils.FilesHandler
+	findings []Finding
+	// CRs of the policies by binding then by kind/namespace/name
+	policyCRs map[string]map[string]policyCR
+}
+
+// Lint analyses the PolicyGenTemplate files. Files which are not
+// PolicyGenTemplates are ignored.
+func Lint(fHandler *utils.FilesHandler, pgtFiles []string) []Finding {
+	l := &linter{fHandler: fHandler, policyCRs: make(map[string]map[string]policyCR)}
+	for _, file := range pgtFiles {
+		l.lintFile(file)
+	}
+	return l.findings
+}
+
+// HasErrors returns true when any finding is an error
+func HasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) lintFile(file string) {
+	content, err := l.fHandler.ReadFile(file)
+	if err != nil {
+		l.add(Finding{Rule: RuleInvalid, Severity: SeverityError, File: file, Message: err.Error()})
+		return
+	}
+	kindType := utils.KindType{}
+	root := yaml.Node{}
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		l.add(Finding{Rule: RuleInvalid, Severity: SeverityError, File: file, Message: "could not parse as yaml: " + err.Error()})
+		return
+	}
+	if err := root.Decode(&kindType); err != nil || kindType.Kind != "PolicyGenTemplate" {
+		return
+	}
+	pgt := utils.PolicyGenTemplate{}
+	if err := root.Decode(&pgt); err != nil {
+		l.add(Finding{Rule: RuleInvalid, Severity: SeverityError, File: file, Line: 1,
+			Message: "could not unmarshal PolicyGenTemplate data: " + err.Error()})
+		return
+	}
+
+	errorsBefore := l.errorCount()
+	at := func(path string) (string, int) {
+		return path, lineOf(&root, path)
+	}
+	finding := func(rule string, severity string, path string, format string, args ...interface{}) {
+		path, line := at(path)
+		l.add(Finding{Rule: rule, Severity: severity, File: file, Path: path, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	l.lintNames(pgt, finding)
+
+	fHandler, err := l.fHandler.ForSourceCRsRef(pgt.Spec.SourceCRsRef)
+	if err != nil {
+		finding(RuleInvalid, SeverityError, "spec.sourceCRsRef", "%s", err)
+		return
+	}
+
+	binding := bindingKey(pgt.Spec)
+	pBuilder := policyGen.NewPolicyBuilder(fHandler)
+	// waves of the CRs of each policy, in the sourceFiles order
+	type crWave struct {
+		wave    string
+		sFileId int
+	}
+	policyWaves := make(map[string][]crWave)
+	policyNames := make([]string, 0)
+
+	for sFileIdx, sFile := range pgt.Spec.SourceFiles {
+		sFilePath := fmt.Sprintf("spec.sourceFiles[%d]", sFileIdx)
+		resources, err := pBuilder.BuildSourceFile(sFile, pgt)
+		if err != nil {
+			finding(RuleInvalid, SeverityError, sFilePath, "%s", err)
+			continue
+		}
+
+		report, err := pBuilder.LintOverlay(sFile, pgt.Spec)
+		if err != nil {
+			finding(RuleInvalid, SeverityError, sFilePath, "%s", err)
+			continue
+		}
+		for _, key := range report.UnknownKeys {
+			finding(RuleUnknownOverlayKey, SeverityWarning, sFilePath,
+				"%s is not in the source CR %s, it is added to the CR", key, sFile.FileName)
+		}
+		for _, placeholder := range report.UnusedPlaceholders {
+			finding(RuleUnusedPlaceholder, SeverityWarning, sFilePath,
+				"placeholder %s of the source CR %s has no value and is removed from the CR", placeholder, sFile.FileName)
+		}
+		for _, placeholder := range report.KeptPlaceholders {
+			finding(RuleUnusedPlaceholder, SeverityWarning, sFilePath,
+				"placeholder %s of the source CR %s has no value and is left as is in the CR", placeholder, sFile.FileName)
+		}
+
+		if sFile.PolicyName == "" || !pgt.Spec.WrapInPolicy {
+			continue
+		}
+		policyName := pgt.Metadata.Name + "-" + sFile.PolicyName
+		if _, found := policyWaves[policyName]; !found {
+			policyNames = append(policyNames, policyName)
+		}
+		for _, resource := range resources {
+			metadata, _ := resource["metadata"].(map[string]interface{})
+			annotations, _ := metadata["annotations"].(map[string]interface{})
+			wave, _ := annotations[utils.ZtpDeployWaveAnnotation].(string)
+			policyWaves[policyName] = append(policyWaves[policyName], crWave{wave, sFileIdx})
+
+			path, line := at(sFilePath)
+			l.checkDuplicate(resource, policyCR{
+				file:       file,
+				path:       path,
+				line:       line,
+				policyName: pgt.Metadata.Namespace + "/" + policyName,
+				binding:    binding,
+			})
+		}
+	}
+
+	for _, policyName := range policyNames {
+		var waved, unwaved *crWave
+		for idx := range policyWaves[policyName] {
+			cr := policyWaves[policyName][idx]
+			if cr.wave == "" {
+				if unwaved == nil {
+					unwaved = &cr
+				}
+				continue
+			}
+			if waved == nil {
+				waved = &cr
+			} else if cr.wave != waved.wave {
+				// Rejected by the generator
+				finding(RuleMixedWaves, SeverityError, fmt.Sprintf("spec.sourceFiles[%d]", cr.sFileId),
+					"policy %s mixes CRs of wave %s and wave %s", policyName, waved.wave, cr.wave)
+				unwaved = nil
+				break
+			}
+		}
+		if waved != nil && unwaved != nil {
+			finding(RuleMixedWaves, SeverityWarning, fmt.Sprintf("spec.sourceFiles[%d]", unwaved.sFileId),
+				"policy %s mixes CRs of wave %s and CRs without wave, which are applied in wave %s",
+				policyName, waved.wave, waved.wave)
+		}
+	}
+
+	// Report the remaining generation errors, unless already reported
+	if l.errorCount() == errorsBefore {
+		if _, err := pBuilder.Build(pgt); err != nil {
+			finding(RuleInvalid, SeverityError, "", "%s", err)
+		}
+	}
+}
+
+// lintNames checks the length of the names of the generated resources
+func (l *linter) lintNames(pgt utils.PolicyGenTemplate, finding func(string, string, string, string, ...interface{})) {
+	namespace := pgt.Metadata.Namespace
+	hasPolicy := false
+	checked := make(map[string]bool)
+	for sFileIdx, sFile := range pgt.Spec.SourceFiles {
+		if sFile.PolicyName == "" || !pgt.Spec.WrapInPolicy {
+			continue
+		}
+		hasPolicy = true
+		name := pgt.Metadata.Name + "-" + sFile.PolicyName
+		if checked[name] {
+			continue
+		}
+		checked[name] = true
+		if err := policyGen.CheckNameLength(namespace, name); err != nil {
+			finding(RuleNameLength, SeverityError, fmt.Sprintf("spec.sourceFiles[%d].policyName", sFileIdx), "%s", err)
+		}
+	}
+	if !hasPolicy {
+		return
+	}
+
+	names := []string{pgt.Metadata.Name + "-placementbinding"}
+	if pgt.Spec.PlacementKind == utils.PlacementKind {
+		names = append(names, pgt.Metadata.Name+"-placement")
+	} else {
+		names = append(names, pgt.Metadata.Name+"-placementrules")
+	}
+	for _, name := range names {
+		if err := policyGen.CheckNameLength(namespace, name); err != nil {
+			finding(RuleNameLength, SeverityError, "metadata.name", "%s", err)
+		}
+	}
+	if pgt.Spec.PolicySet != nil {
+		policySet := policyGen.CreatePolicySet(pgt.Metadata.Name, namespace, *pgt.Spec.PolicySet, nil)
+		if err := policyGen.CheckNameLength(namespace, policySet.Metadata.Name); err != nil {
+			finding(RuleNameLength, SeverityError, "spec.policySet", "%s", err)
+		}
+	}
+}
+
+// checkDuplicate reports the CRs already wrapped in another policy with the
+// same binding, which would be enforced twice on the same clusters
+func (l *linter) checkDuplicate(resource map[string]interface{}, cr policyCR) {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	kind, _ := resource["kind"].(string)
+	name, _ := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+	key := strings.Join([]string{kind, namespace, name}, "/")
+
+	crs, found := l.policyCRs[cr.binding]
+	if !found {
+		crs = make(map[string]policyCR)
+		l.policyCRs[cr.binding] = crs
+	}
+	first, found := crs[key]
+	if !found {
+		crs[key] = cr
+		return
+	}
+	if first.policyName == cr.policyName {
+		return
+	}
+	display := kind + " " + name
+	if namespace != "" {
+		display = kind + " " + namespace + "/" + name
+	}
+	l.add(Finding{
+		Rule:     RuleDuplicateCR,
+		Severity: SeverityError,
+		File:     cr.file,
+		Path:     cr.path,
+		Line:     cr.line,
+		Message: fmt.Sprintf("%s is in policy %s and in policy %s (%s), both binding the same clusters",
+			display, cr.policyName, first.policyName, first.file),
+	})
+}
+
+func (l *linter) add(finding Finding) {
+	l.findings = append(l.findings, finding)
+}
+
+func (l *linter) errorCount() int {
+	count := 0
+	for _, finding := range l.findings {
+		if finding.Severity == SeverityError {
+			count++
+		}
+	}
+	return count
+}
+
+// bindingKey identifies the clusters the policies of the PGT are bound to.
+// The bindingRules, bindingExcludedRules and the bindingSelector matchLabels
+// are converted to the label requirements they are generated as, so that the
+// same labels written either way give the same key.
+func bindingKey(spec utils.PolicyGenTempSpec) string {
+	requirements := make(map[string]bool)
+	add := func(prefix string, key string, operator string, values []string) {
+		sorted := append([]string{}, values...)
+		sort.Strings(sorted)
+		requirements[prefix+key+" "+operator+" "+strings.Join(sorted, ",")] = true
+	}
+	for key, value := range spec.BindingRules {
+		if value == "" {
+			add("", key, utils.ExistOper, nil)
+		} else {
+			add("", key, utils.InOper, strings.Split(value, ","))
+		}
+	}
+	for key, value := range spec.BindingExcludedRules {
+		if value == "" {
+			add("", key, utils.DoesNotExistOper, nil)
+		} else {
+			add("", key, utils.NotInOper, strings.Split(value, ","))
+		}
+	}
+	if spec.BindingSelector != nil {
+		for key, value := range spec.BindingSelector.LabelSelector.MatchLabels {
+			add("", key, utils.InOper, []string{value})
+		}
+		for _, requirement := range spec.BindingSelector.LabelSelector.MatchExpressions {
+			add("", requirement.Key, string(requirement.Operator), requirement.Values)
+		}
+		for _, requirement := range spec.BindingSelector.ClaimSelector.MatchExpressions {
+			add("claim:", requirement.Key, string(requirement.Operator), requirement.Values)
+		}
+	}
+
+	keys := make([]string, 0, len(requirements))
+	for requirement := range requirements {
+		keys = append(keys, requirement)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\n")
+}
+
+// lineOf returns the line of the node at the path, such as
+// spec.sourceFiles[2].policyName, or of its closest existing parent
+func lineOf(root *yaml.Node, path string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	if path == "" {
+		return line
+	}
+	for _, segment := range strings.Split(path, ".") {
+		key := segment
+		index := -1
+		if open := strings.Index(segment, "["); open >= 0 {
+			key = segment[:open]
+			fmt.Sscanf(segment[open:], "[%d]", &index)
+		}
+		next := mappingValue(node, key)
+		if next == nil {
+			return line
+		}
+		node = next
+		line = node.Line
+		if index >= 0 {
+			if node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				return line
+			}
+			node = node.Content[index]
+			line = node.Line
+		}
+	}
+	return line
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			return node.Content[idx+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+const sourceDir = "../policyGen/testData/GenericSourceFiles"
+
+const overlayPgt = `apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "config-policy"
+    - fileName: GenericConfig.yaml
+      policyName: "config-policy"
+    - fileName: GenericPtpConfig.yaml
+      policyName: "ptp-policy"
+      spec:
+        profile:
+          - name: "slave"
+        recomend: []
+`
+
+const duplicatePgt = `apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test2"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "a-policy-name-which-is-long-enough-to-exceed-the-acm-limit"
+`
+
+func lintPgts(t *testing.T, pgts ...string) ([]Finding, []string) {
+	dir := t.TempDir()
+	files := make([]string, 0, len(pgts))
+	for idx, pgt := range pgts {
+		file := filepath.Join(dir, string(rune('a'+idx))+".yaml")
+		assert.Nil(t, os.WriteFile(file, []byte(pgt), 0644))
+		files = append(files, file)
+	}
+	return Lint(utils.NewFilesHandler(sourceDir, utils.UnsetStringValue, utils.UnsetStringValue), files), files
+}
+
+func TestLint(t *testing.T) {
+	findings, files := lintPgts(t, overlayPgt, duplicatePgt, "apiVersion: v1\nkind: ConfigMap\n")
+	assert.True(t, HasErrors(findings))
+
+	type summary struct {
+		rule     string
+		severity string
+		file     string
+		line     int
+	}
+	summaries := make([]summary, 0, len(findings))
+	for _, finding := range findings {
+		summaries = append(summaries, summary{finding.Rule, finding.Severity, finding.File, finding.Line})
+	}
+	assert.Equal(t, []summary{
+		{RuleUnknownOverlayKey, SeverityWarning, files[0], 14},
+		{RuleUnusedPlaceholder, SeverityWarning, files[0], 14},
+		{RuleUnusedPlaceholder, SeverityWarning, files[0], 14},
+		{RuleUnusedPlaceholder, SeverityWarning, files[0], 14},
+		{RuleMixedWaves, SeverityError, files[0], 12},
+		{RuleNameLength, SeverityError, files[1], 11},
+		{RuleDuplicateCR, SeverityError, files[1], 10},
+	}, summaries)
+
+	assert.Contains(t, findings[0].Message, "spec.recomend")
+	assert.Contains(t, findings[1].Message, "spec.profile[0].interface")
+	assert.Contains(t, findings[1].Message, "removed")
+	assert.Contains(t, findings[2].Message, "spec.profile[1].interface")
+	assert.Contains(t, findings[2].Message, "left as is")
+	assert.Equal(t, "spec.sourceFiles[0].policyName", findings[5].Path)
+	assert.Contains(t, findings[6].Message, "test1/test1-config-policy")
+}
+
+func TestLintBinding(t *testing.T) {
+	// The same CR bound to other clusters is not a duplicate
+	otherClusters := strings.Replace(duplicatePgt, "justfortest", "other", 1)
+	otherClusters = strings.Replace(otherClusters, "a-policy-name-which-is-long-enough-to-exceed-the-acm-limit", "ns-policy", 1)
+	findings, _ := lintPgts(t, overlayPgt, otherClusters)
+	for _, finding := range findings {
+		assert.NotEqual(t, RuleDuplicateCR, finding.Rule)
+	}
+
+	// The same labels as bindingSelector matchLabels bind the same clusters
+	selector := strings.Replace(duplicatePgt, "  bindingRules:\n    justfortest: \"true\"\n",
+		"  bindingSelector:\n    matchLabels:\n      justfortest: \"true\"\n", 1)
+	findings, _ = lintPgts(t, overlayPgt, selector)
+	assert.Equal(t, RuleDuplicateCR, findings[len(findings)-1].Rule)
+	assert.Contains(t, findings[len(findings)-1].Message, "test1/test1-config-policy")
+
+	// A CR without wave in a policy with waves is only a warning
+	noWave := otherClusters + "    - fileName: GenericConfigWithoutWave.yaml\n      policyName: \"ns-policy\"\n"
+	findings, _ = lintPgts(t, noWave)
+	assert.Len(t, findings, 1)
+	assert.Equal(t, RuleMixedWaves, findings[0].Rule)
+	assert.Equal(t, SeverityWarning, findings[0].Severity)
+	assert.False(t, HasErrors(findings))
+}
+
+func TestLintInvalid(t *testing.T) {
+	invalid := strings.Replace(duplicatePgt, "GenericNamespace.yaml", "Missing.yaml", 1)
+	findings, _ := lintPgts(t, invalid, "not: [yaml")
+	assert.Len(t, findings, 3)
+	assert.Equal(t, RuleNameLength, findings[0].Rule)
+	assert.Equal(t, RuleInvalid, findings[1].Rule)
+	assert.Equal(t, 10, findings[1].Line)
+	assert.Equal(t, RuleInvalid, findings[2].Rule)
+}
+
+func TestWrite(t *testing.T) {
+	findings := []Finding{
+		{Rule: RuleUnknownOverlayKey, Severity: SeverityWarning, File: "a.yaml", Path: "spec.sourceFiles[0]", Line: 3, Message: "spec.foo"},
+		{Rule: RuleInvalid, Severity: SeverityError, File: "b.yaml", Message: "failed"},
+	}
+
+	out := bytes.Buffer{}
+	assert.Nil(t, Write(&out, findings, FormatText))
+	assert.Equal(t, "a.yaml:3: warning: [unknown-overlay-key] spec.foo\nb.yaml: error: [invalid-pgt] failed\n", out.String())
+
+	out.Reset()
+	assert.Nil(t, Write(&out, findings, FormatJSON))
+	parsed := struct{ Findings []Finding }{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &parsed))
+	assert.Equal(t, findings, parsed.Findings)
+
+	out.Reset()
+	assert.Nil(t, Write(&out, findings, FormatSARIF))
+	sarif := sarifLog{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &sarif))
+	assert.Equal(t, "2.1.0", sarif.Version)
+	assert.Len(t, sarif.Runs, 1)
+	assert.Len(t, sarif.Runs[0].Tool.Driver.Rules, len(RuleDescriptions))
+	assert.Len(t, sarif.Runs[0].Results, 2)
+	assert.Equal(t, "unknown-overlay-key", sarif.Runs[0].Results[0].RuleID)
+	assert.Equal(t, "warning", sarif.Runs[0].Results[0].Level)
+	assert.Equal(t, 3, sarif.Runs[0].Results[0].Locations[0].PhysicalLocation.Region.StartLine)
+	assert.Nil(t, sarif.Runs[0].Results[1].Locations[0].PhysicalLocation.Region)
+
+	assert.NotNil(t, Write(&out, findings, "xml"))
+}
@@ -0,0 +1,149 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Output formats of the findings
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// Write writes the findings in the given format
+func Write(out io.Writer, findings []Finding, format string) error {
+	switch format {
+	case FormatText, "":
+		return WriteText(out, findings)
+	case FormatJSON:
+		return WriteJSON(out, findings)
+	case FormatSARIF:
+		return WriteSARIF(out, findings)
+	}
+	return fmt.Errorf("format '%s' is not supported, use '%s', '%s' or '%s'", format, FormatText, FormatJSON, FormatSARIF)
+}
+
+// WriteText writes one line per finding, for example:
+//
+//	group-du.yaml:12: warning: [unknown-overlay-key] spec.foo is not in the source CR ...
+func WriteText(out io.Writer, findings []Finding) error {
+	for _, finding := range findings {
+		location := finding.File
+		if finding.Line > 0 {
+			location = fmt.Sprintf("%s:%d", finding.File, finding.Line)
+		}
+		if _, err := fmt.Fprintf(out, "%s: %s: [%s] %s\n", location, finding.Severity, finding.Rule, finding.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the findings as a JSON document
+func WriteJSON(out io.Writer, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	return writeIndented(out, struct {
+		Findings []Finding `json:"findings"`
+	}{findings})
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// WriteSARIF writes the findings as a SARIF 2.1.0 log, as consumed by code
+// scanning tools
+func WriteSARIF(out io.Writer, findings []Finding) error {
+	ruleIds := make([]string, 0, len(RuleDescriptions))
+	for id := range RuleDescriptions {
+		ruleIds = append(ruleIds, id)
+	}
+	sort.Strings(ruleIds)
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "policygenerator-lint"}},
+		Results: make([]sarifResult, 0, len(findings)),
+	}
+	for _, id := range ruleIds {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{RuleDescriptions[id]}})
+	}
+
+	for _, finding := range findings {
+		location := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: finding.File}}
+		if finding.Line > 0 {
+			location.Region = &sarifRegion{StartLine: finding.Line}
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    finding.Rule,
+			Level:     finding.Severity,
+			Message:   sarifMessage{finding.Message},
+			Locations: []sarifLocation{{PhysicalLocation: location}},
+		})
+	}
+	return writeIndented(out, sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}})
+}
+
+func writeIndented(out io.Writer, document interface{}) error {
+	content, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(content, '\n'))
+	return err
+}
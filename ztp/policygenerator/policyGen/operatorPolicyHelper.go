@@ -0,0 +1,162 @@
+package policyGen
+
+import (
+	"fmt"
+	"strings"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const subscriptionKind = "Subscription"
+const operatorGroupKind = "OperatorGroup"
+
+// operatorSource is a Subscription built from a sourceFile. It is converted
+// into an OperatorPolicy once all the sourceFiles of the policy are built.
+type operatorSource struct {
+	sourceFile   utils.SourceFile
+	subscription map[string]interface{}
+}
+
+// CheckOperatorPolicyOverlay validates the OperatorPolicy settings of the
+// sourceFile, which only apply to Subscriptions converted into OperatorPolicies
+func CheckOperatorPolicyOverlay(sFile utils.SourceFile, resources []map[string]interface{}, useOperatorPolicy bool) error {
+	if sFile.UpgradeApproval == "" && len(sFile.Versions) == 0 {
+		return nil
+	}
+	isSubscription := len(resources) == 1 && resources[0]["kind"] == subscriptionKind
+	if !useOperatorPolicy || !isSubscription {
+		return fmt.Errorf("%s: upgradeApproval and versions are only supported on Subscription sourceFiles when useOperatorPolicy is set", sFile.FileName)
+	}
+	if sFile.UpgradeApproval != "" && sFile.UpgradeApproval != utils.UpgradeApprovalAutomatic && sFile.UpgradeApproval != utils.UpgradeApprovalNone {
+		return fmt.Errorf("%s: upgradeApproval '%s' is not supported, use '%s' or '%s'",
+			sFile.FileName, sFile.UpgradeApproval, utils.UpgradeApprovalAutomatic, utils.UpgradeApprovalNone)
+	}
+	return nil
+}
+
+// ConvertToOperatorPolicies replaces the Subscriptions of the policy
+// ConfigurationPolicies with OperatorPolicy templates. The OperatorGroup of the
+// Subscription namespace, if any, moves to the OperatorPolicy as well. The
+// ConfigurationPolicies are dropped when they have no object template left.
+// The OperatorPolicies inherit the remediationAction and severity of the
+// ConfigurationPolicy holding their Subscription.
+func ConvertToOperatorPolicies(acmPolicy *utils.AcmPolicy, sources []operatorSource) error {
+	if len(sources) == 0 {
+		return nil
+	}
+	operatorTemplates := make([]utils.PolicyObjectDefinition, 0, len(sources))
+
+	for _, source := range sources {
+		metadata, _ := source.subscription["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		namespace, _ := metadata["namespace"].(string)
+		spec, _ := source.subscription["spec"].(map[string]interface{})
+		packageName, _ := spec["name"].(string)
+		if namespace == "" || packageName == "" {
+			return fmt.Errorf("%s: the Subscription metadata.namespace and spec.name must be set to generate an OperatorPolicy",
+				source.sourceFile.FileName)
+		}
+		configPolicy := findConfigurationPolicy(acmPolicy, subscriptionKind, namespace, name)
+		if configPolicy == nil {
+			return fmt.Errorf("%s: the Subscription %s/%s is not in a ConfigurationPolicy of policy %s",
+				source.sourceFile.FileName, namespace, name, acmPolicy.Metadata.Name)
+		}
+
+		operatorPolicy := &utils.AcmOperatorPolicy{}
+		operatorPolicy.ApiVersion = "policy.open-cluster-management.io/v1beta1"
+		operatorPolicy.Kind = "OperatorPolicy"
+		operatorPolicy.Metadata.Name = acmPolicy.Metadata.Name + "-" + packageName
+		if errs := validation.IsDNS1123Subdomain(operatorPolicy.Metadata.Name); len(errs) > 0 {
+			return fmt.Errorf("OperatorPolicy name '%s' of policy %s is invalid: %s",
+				operatorPolicy.Metadata.Name, acmPolicy.Metadata.Name, strings.Join(errs, ", "))
+		}
+		operatorPolicy.Spec.RemediationAction = configPolicy.Spec.RemediationAction
+		operatorPolicy.Spec.Severity = configPolicy.Spec.Severity
+		operatorPolicy.Spec.ComplianceType = "musthave"
+
+		// The OperatorPolicy manages the install plan approval itself
+		subscription := map[string]interface{}{"namespace": namespace}
+		for key, value := range spec {
+			if key != "installPlanApproval" {
+				subscription[key] = value
+			}
+		}
+		operatorPolicy.Spec.Subscription = subscription
+
+		operatorPolicy.Spec.UpgradeApproval = source.sourceFile.UpgradeApproval
+		if operatorPolicy.Spec.UpgradeApproval == "" {
+			// Keep the upgrades manual when the Subscription requires to
+			// approve its install plans
+			operatorPolicy.Spec.UpgradeApproval = utils.UpgradeApprovalAutomatic
+			if spec["installPlanApproval"] == "Manual" {
+				operatorPolicy.Spec.UpgradeApproval = utils.UpgradeApprovalNone
+			}
+		}
+		operatorPolicy.Spec.Versions = source.sourceFile.Versions
+
+		for idx := range acmPolicy.Spec.PolicyTemplates {
+			policyTemplate := &acmPolicy.Spec.PolicyTemplates[idx]
+			if !isConfigurationPolicy(*policyTemplate) {
+				continue
+			}
+			objectTemplates := make([]utils.ObjectTemplates, 0, len(policyTemplate.ObjDef.Spec.ObjectTemplates))
+			for _, objTemplate := range policyTemplate.ObjDef.Spec.ObjectTemplates {
+				objMetadata, _ := objTemplate.ObjectDefinition["metadata"].(map[string]interface{})
+				switch {
+				case objTemplate.ObjectDefinition["kind"] == subscriptionKind &&
+					objMetadata["namespace"] == namespace && objMetadata["name"] == name:
+					continue
+				case objTemplate.ObjectDefinition["kind"] == operatorGroupKind &&
+					objMetadata["namespace"] == namespace && operatorPolicy.Spec.OperatorGroup == nil:
+					operatorGroup := map[string]interface{}{
+						"name":      objMetadata["name"],
+						"namespace": namespace,
+					}
+					ogSpec, _ := objTemplate.ObjectDefinition["spec"].(map[string]interface{})
+					if targetNamespaces, found := ogSpec["targetNamespaces"]; found {
+						operatorGroup["targetNamespaces"] = targetNamespaces
+					}
+					operatorPolicy.Spec.OperatorGroup = operatorGroup
+					continue
+				}
+				objectTemplates = append(objectTemplates, objTemplate)
+			}
+			policyTemplate.ObjDef.Spec.ObjectTemplates = objectTemplates
+		}
+
+		operatorTemplates = append(operatorTemplates, utils.PolicyObjectDefinition{OperatorPolicy: operatorPolicy})
+	}
+
+	policyTemplates := make([]utils.PolicyObjectDefinition, 0, len(acmPolicy.Spec.PolicyTemplates)+len(operatorTemplates))
+	for _, policyTemplate := range acmPolicy.Spec.PolicyTemplates {
+		if isConfigurationPolicy(policyTemplate) && len(policyTemplate.ObjDef.Spec.ObjectTemplates) == 0 {
+			continue
+		}
+		policyTemplates = append(policyTemplates, policyTemplate)
+	}
+	acmPolicy.Spec.PolicyTemplates = append(policyTemplates, operatorTemplates...)
+	return nil
+}
+
+// isConfigurationPolicy tells whether the policy template is a ConfigurationPolicy
+func isConfigurationPolicy(policyTemplate utils.PolicyObjectDefinition) bool {
+	return policyTemplate.OperatorPolicy == nil && policyTemplate.ObjDef.Kind == configurationPolicyKind
+}
+
+// findConfigurationPolicy returns the ConfigurationPolicy of the policy holding
+// the object of the kind, namespace and name, or nil
+func findConfigurationPolicy(acmPolicy *utils.AcmPolicy, kind string, namespace string, name string) *utils.AcmConfigurationPolicy {
+	for idx, policyTemplate := range acmPolicy.Spec.PolicyTemplates {
+		if !isConfigurationPolicy(policyTemplate) {
+			continue
+		}
+		for _, objTemplate := range policyTemplate.ObjDef.Spec.ObjectTemplates {
+			objMetadata, _ := objTemplate.ObjectDefinition["metadata"].(map[string]interface{})
+			if objTemplate.ObjectDefinition["kind"] == kind && objMetadata["namespace"] == namespace && objMetadata["name"] == name {
+				return &acmPolicy.Spec.PolicyTemplates[idx].ObjDef
+			}
+		}
+	}
+	return nil
+}
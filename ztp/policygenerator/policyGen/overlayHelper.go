@@ -0,0 +1,419 @@
+package policyGen
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+)
+
+// Known lists of the source CRs which are merged by key rather than by
+// position when the listMerge strategy is "key". The lists are identified
+// by the CR kind and the path of the list in the CR.
+var listMergeKeys = map[string]map[string]string{
+	"PtpConfig": {
+		"spec.profile":   "name",
+		"spec.recommend": "priority",
+	},
+	"Tuned": {
+		"spec.profile":   "name",
+		"spec.recommend": "priority",
+	},
+	"ClusterLogForwarder": {
+		"spec.inputs":    "name",
+		"spec.outputs":   "name",
+		"spec.filters":   "name",
+		"spec.pipelines": "name",
+	},
+	"MachineConfig": {
+		"spec.config.systemd.units": "name",
+		"spec.config.storage.files": "path",
+	},
+}
+
+// getListMergeKeys returns the merge keys of the lists of the given kind
+// for the list merge strategy
+func getListMergeKeys(kind string, listMerge string) map[string]string {
+	if listMerge != utils.ListMergeByKey {
+		return nil
+	}
+	return listMergeKeys[kind]
+}
+
+// CheckListMerge validates the list merge strategy
+func CheckListMerge(listMerge string) error {
+	if listMerge != utils.ListMergeByIndex && listMerge != utils.ListMergeByKey {
+		return fmt.Errorf("listMerge '%s' is not supported, use '%s' or '%s'", listMerge, utils.ListMergeByIndex, utils.ListMergeByKey)
+	}
+	return nil
+}
+
+// mergeListByKey merges the user provided overlay list into the source-cr
+// list. Entries of the overlay are merged into the source-cr entry having
+// the same mergeKey value, or appended when there is none.
+func (pbuilder *PolicyBuilder) mergeListByKey(sourceList []interface{}, valueList []interface{},
+	mergeKey string, path string, mergeKeys map[string]string) []map[string]interface{} {
+
+	merged := make([]map[string]interface{}, len(sourceList))
+	for id, intfMap := range sourceList {
+		merged[id] = intfMap.(map[string]interface{})
+	}
+
+	for _, vIntfMap := range valueList {
+		valueEntry := vIntfMap.(map[string]interface{})
+		matched := false
+		if keyValue, found := valueEntry[mergeKey]; found {
+			for id, sourceEntry := range merged {
+				if sourceKeyValue, found := sourceEntry[mergeKey]; found && fmt.Sprint(sourceKeyValue) == fmt.Sprint(keyValue) {
+					merged[id] = pbuilder.mergeValues(sourceEntry, valueEntry, path, mergeKeys)
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			merged = append(merged, valueEntry)
+		}
+	}
+	return merged
+}
+
+// ApplyPatches applies the RFC 6902 JSON patch operations to the resource,
+// in order. The error reports the index, the operation and the path of the
+// first operation which can't be applied.
+func ApplyPatches(resource map[string]interface{}, patches []utils.PatchOperation) error {
+	for idx, patch := range patches {
+		if err := applyPatch(resource, patch); err != nil {
+			return fmt.Errorf("patches[%d] (%s %s): %s", idx, patch.Op, patch.Path, err)
+		}
+	}
+	return nil
+}
+
+func applyPatch(resource map[string]interface{}, patch utils.PatchOperation) error {
+	switch patch.Op {
+	case "add":
+		return patchAdd(resource, patch.Path, deepCopy(patch.Value))
+	case "remove":
+		_, err := patchRemove(resource, patch.Path)
+		return err
+	case "replace":
+		if _, err := patchRemove(resource, patch.Path); err != nil {
+			return err
+		}
+		return patchAdd(resource, patch.Path, deepCopy(patch.Value))
+	case "move":
+		if patch.From == "" {
+			return fmt.Errorf("from must be set")
+		}
+		if strings.HasPrefix(patch.Path, patch.From+"/") {
+			return fmt.Errorf("can't move %s into one of its children", patch.From)
+		}
+		value, err := patchRemove(resource, patch.From)
+		if err != nil {
+			return err
+		}
+		return patchAdd(resource, patch.Path, value)
+	case "copy":
+		if patch.From == "" {
+			return fmt.Errorf("from must be set")
+		}
+		value, err := patchGet(resource, patch.From)
+		if err != nil {
+			return err
+		}
+		return patchAdd(resource, patch.Path, deepCopy(value))
+	case "test":
+		value, err := patchGet(resource, patch.Path)
+		if err != nil {
+			return err
+		}
+		actual, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		expected, err := json.Marshal(patch.Value)
+		if err != nil {
+			return err
+		}
+		equal, err := jsonEqual(actual, expected)
+		if err != nil {
+			return err
+		}
+		if !equal {
+			return fmt.Errorf("value %s doesn't match %s", actual, expected)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported operation '%s', use one of add, remove, replace, move, copy or test", patch.Op)
+}
+
+// jsonEqual compares the JSON values, as required by the test operation, so
+// that the string "1" doesn't match the number 1 and the order of the keys
+// doesn't matter
+func jsonEqual(value []byte, expected []byte) (bool, error) {
+	var decodedValue, decodedExpected interface{}
+	if err := json.Unmarshal(value, &decodedValue); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(expected, &decodedExpected); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(decodedValue, decodedExpected), nil
+}
+
+// splitPointer splits a JSON pointer into its unescaped reference tokens
+func splitPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, fmt.Errorf("path must not target the whole resource")
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path must start with /")
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for idx, token := range tokens {
+		tokens[idx] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// patchParent returns the container holding the last token of the pointer
+func patchParent(resource map[string]interface{}, pointer string) (interface{}, string, error) {
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return nil, "", err
+	}
+	var current interface{} = resource
+	for idx, token := range tokens[:len(tokens)-1] {
+		current, err = patchChild(current, token)
+		if err != nil {
+			return nil, "", fmt.Errorf("path /%s does not exist: %s", strings.Join(tokens[:idx+1], "/"), err)
+		}
+	}
+	return current, tokens[len(tokens)-1], nil
+}
+
+func patchChild(container interface{}, token string) (interface{}, error) {
+	switch typed := container.(type) {
+	case map[string]interface{}:
+		child, found := typed[token]
+		if !found {
+			return nil, fmt.Errorf("missing key %s", token)
+		}
+		return child, nil
+	case []interface{}, []map[string]interface{}:
+		list := toList(typed)
+		idx, err := listIndex(token, len(list), false)
+		if err != nil {
+			return nil, err
+		}
+		return list[idx], nil
+	}
+	return nil, fmt.Errorf("%s is neither an object nor a list", token)
+}
+
+func patchGet(resource map[string]interface{}, pointer string) (interface{}, error) {
+	parent, token, err := patchParent(resource, pointer)
+	if err != nil {
+		return nil, err
+	}
+	value, err := patchChild(parent, token)
+	if err != nil {
+		return nil, fmt.Errorf("path %s does not exist: %s", pointer, err)
+	}
+	return value, nil
+}
+
+func patchAdd(resource map[string]interface{}, pointer string, value interface{}) error {
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return err
+	}
+	parent, token, err := patchParent(resource, pointer)
+	if err != nil {
+		return err
+	}
+	switch typed := parent.(type) {
+	case map[string]interface{}:
+		typed[token] = value
+		return nil
+	case []interface{}, []map[string]interface{}:
+		list := toList(typed)
+		idx := len(list)
+		if token != "-" {
+			idx, err = listIndex(token, len(list), true)
+			if err != nil {
+				return fmt.Errorf("path %s does not exist: %s", pointer, err)
+			}
+		}
+		list = append(list[:idx], append([]interface{}{value}, list[idx:]...)...)
+		return setList(resource, tokens[:len(tokens)-1], list)
+	}
+	return fmt.Errorf("path %s does not exist: parent is neither an object nor a list", pointer)
+}
+
+func patchRemove(resource map[string]interface{}, pointer string) (interface{}, error) {
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	parent, token, err := patchParent(resource, pointer)
+	if err != nil {
+		return nil, err
+	}
+	switch typed := parent.(type) {
+	case map[string]interface{}:
+		value, found := typed[token]
+		if !found {
+			return nil, fmt.Errorf("path %s does not exist: missing key %s", pointer, token)
+		}
+		delete(typed, token)
+		return value, nil
+	case []interface{}, []map[string]interface{}:
+		list := toList(typed)
+		idx, err := listIndex(token, len(list), false)
+		if err != nil {
+			return nil, fmt.Errorf("path %s does not exist: %s", pointer, err)
+		}
+		value := list[idx]
+		list = append(list[:idx], list[idx+1:]...)
+		return value, setList(resource, tokens[:len(tokens)-1], list)
+	}
+	return nil, fmt.Errorf("path %s does not exist: parent is neither an object nor a list", pointer)
+}
+
+// setList stores the updated list back into its parent, as adding or removing
+// entries of a slice doesn't update the slice held by the parent
+func setList(resource map[string]interface{}, tokens []string, list []interface{}) error {
+	var parent interface{} = resource
+	for _, token := range tokens[:len(tokens)-1] {
+		var err error
+		if parent, err = patchChild(parent, token); err != nil {
+			return err
+		}
+	}
+	token := tokens[len(tokens)-1]
+	switch typed := parent.(type) {
+	case map[string]interface{}:
+		typed[token] = list
+	case []interface{}:
+		idx, err := listIndex(token, len(typed), false)
+		if err != nil {
+			return err
+		}
+		typed[idx] = list
+	default:
+		return fmt.Errorf("can't update list %s", token)
+	}
+	return nil
+}
+
+func listIndex(token string, length int, allowEnd bool) (int, error) {
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid list index %s", token)
+	}
+	if idx > length || (idx == length && !allowEnd) {
+		return 0, fmt.Errorf("list index %d out of range, the list has %d entries", idx, length)
+	}
+	return idx, nil
+}
+
+// toList returns the list as a []interface{}. Lists merged from the user
+// overlay are held as []map[string]interface{}.
+func toList(list interface{}) []interface{} {
+	if maps, ok := list.([]map[string]interface{}); ok {
+		converted := make([]interface{}, len(maps))
+		for idx, item := range maps {
+			converted[idx] = item
+		}
+		return converted
+	}
+	return list.([]interface{})
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(typed))
+		for k, v := range typed {
+			copied[k] = deepCopy(v)
+		}
+		return copied
+	case []interface{}, []map[string]interface{}:
+		list := toList(typed)
+		copied := make([]interface{}, len(list))
+		for idx, item := range list {
+			copied[idx] = deepCopy(item)
+		}
+		return copied
+	}
+	return value
+}
+
+// CheckDocumentOverlays validates the per-document overlays of the sourceFile,
+// which replace its own spec, data, status and patches overlay
+func CheckDocumentOverlays(sFile utils.SourceFile) error {
+	if len(sFile.Documents) == 0 {
+		return nil
+	}
+	if len(sFile.Spec) > 0 || len(sFile.Data) > 0 || len(sFile.Status) > 0 || len(sFile.BinaryData) > 0 ||
+		len(sFile.StringData) > 0 || len(sFile.Patches) > 0 {
+		return fmt.Errorf("%s: documents can't be combined with the spec/data/status/binaryData/stringData/patches of the sourceFile, set them in the documents", sFile.FileName)
+	}
+	selectors := make(map[string]bool, len(sFile.Documents))
+	for idx, document := range sFile.Documents {
+		if document.Kind == "" || document.Metadata.Name == "" {
+			return fmt.Errorf("%s: documents[%d] must set the kind and metadata.name of the document", sFile.FileName, idx)
+		}
+		selector := document.Kind + "/" + document.Metadata.Name
+		if selectors[selector] {
+			return fmt.Errorf("%s: documents[%d] duplicates the overlay of %s", sFile.FileName, idx, selector)
+		}
+		selectors[selector] = true
+	}
+	return nil
+}
+
+// documentSourceFile returns the sourceFile holding the overlay of the
+// document of the given kind and name, along with the index of the matching
+// document overlay or -1. The metadata of the document overlay is merged into
+// the sourceFile metadata, its name only selecting the document.
+func documentSourceFile(sFile utils.SourceFile, kind string, name string) (utils.SourceFile, int) {
+	for idx, document := range sFile.Documents {
+		if document.Kind != kind || document.Metadata.Name != name {
+			continue
+		}
+		docSFile := sFile
+		docSFile.Spec = document.Spec
+		docSFile.Data = document.Data
+		docSFile.Status = document.Status
+		docSFile.BinaryData = document.BinaryData
+		docSFile.StringData = document.StringData
+		docSFile.Patches = document.Patches
+		if document.Metadata.Namespace != "" {
+			docSFile.Metadata.Namespace = document.Metadata.Namespace
+		}
+		docSFile.Metadata.Labels = mergeStringMaps(sFile.Metadata.Labels, document.Metadata.Labels)
+		docSFile.Metadata.Annotations = mergeStringMaps(sFile.Metadata.Annotations, document.Metadata.Annotations)
+		return docSFile, idx
+	}
+	return sFile, -1
+}
+
+func mergeStringMaps(base map[string]string, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,205 @@
+package policyGen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// OverlayReport lists the suspicious overlay values of a sourceFile. The paths
+// are the paths in the CR, list entries being identified by their index.
+type OverlayReport struct {
+	// Overlay values whose key doesn't exist in the source CR, they are added
+	// to the CR as they are
+	UnknownKeys []string
+	// Placeholders of the source CR without overlay value, which are removed
+	// from the CR
+	UnusedPlaceholders []string
+	// Placeholders of the source CR without overlay value, left as they are in
+	// the CR as no overlay is merged at their level
+	KeptPlaceholders []string
+}
+
+// LintOverlay compares the overlay of the sourceFile with its source CR the
+// same way the overlay is merged by the PolicyBuilder
+func (pbuilder *PolicyBuilder) LintOverlay(sFile utils.SourceFile, spec utils.PolicyGenTempSpec) (OverlayReport, error) {
+	report := OverlayReport{}
+	sFile = resolveListMerge(sFile, spec)
+
+	yamls, err := pbuilder.fHandler.ReadSourceDocuments(sFile.FileName)
+	if err != nil {
+		return report, err
+	}
+
+	for idx, sourceCR := range yamls {
+		if spec.Mcp != "" {
+			sourceCR = []byte(strings.Replace(string(sourceCR), "$mcp", spec.Mcp, -1))
+		}
+		resource := make(map[string]interface{})
+		if err := yaml.Unmarshal(sourceCR, &resource); err != nil {
+			return report, err
+		}
+		prefix := ""
+		if len(yamls) > 1 {
+			prefix = fmt.Sprintf("[%d].", idx)
+		}
+		kind, _ := resource["kind"].(string)
+		metadata, _ := resource["metadata"].(map[string]interface{})
+		docSFile := sFile
+		if len(sFile.Documents) > 0 {
+			name, _ := metadata["name"].(string)
+			docSFile, _ = documentSourceFile(sFile, kind, name)
+		}
+
+		sections := []struct {
+			name      string
+			source    interface{}
+			overlay   map[string]interface{}
+			mergeKeys map[string]string
+		}{
+			{"metadata.labels", metadata["labels"], stringMap(docSFile.Metadata.Labels), nil},
+			{"metadata.annotations", metadata["annotations"], stringMap(docSFile.Metadata.Annotations), nil},
+			{"spec", resource["spec"], docSFile.Spec, getListMergeKeys(kind, sFile.ListMerge)},
+			{"data", resource["data"], docSFile.Data, nil},
+			{"status", resource["status"], docSFile.Status, nil},
+			{"binaryData", resource["binaryData"], docSFile.BinaryData, nil},
+			{"stringData", resource["stringData"], docSFile.StringData, nil},
+		}
+		for _, section := range sections {
+			source, _ := section.source.(map[string]interface{})
+			overlay := section.overlay
+			if len(yamls) > 1 && len(sFile.Documents) == 0 {
+				// The overlay of multi-document source CRs is rejected by the builder
+				overlay = nil
+			}
+			// New labels and annotations are expected, unlike new keys in the
+			// other sections
+			reportUnknown := !strings.HasPrefix(section.name, "metadata.")
+			lintValues(source, overlay, section.name, prefix+section.name, section.mergeKeys, reportUnknown, &report)
+		}
+	}
+	return report, nil
+}
+
+// lintValues walks the source and overlay maps as mergeValues merges them.
+// keyPath is the path of the map without list indexes, as used by the list
+// merge keys, displayPath the path reported.
+func lintValues(source map[string]interface{}, overlay map[string]interface{}, keyPath string, displayPath string,
+	mergeKeys map[string]string, reportUnknown bool, report *OverlayReport) {
+
+	for _, k := range sortedMapKeys(source) {
+		childKeyPath := keyPath + "." + k
+		childDisplayPath := displayPath + "." + k
+		value := source[k]
+		overlayValue := overlay[k]
+		if overlayValue == nil {
+			if isPlaceholder(value) {
+				report.UnusedPlaceholders = append(report.UnusedPlaceholders, childDisplayPath)
+			} else {
+				collectPlaceholders(value, childDisplayPath, report)
+			}
+			continue
+		}
+
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			if overlayMap, ok := overlayValue.(map[string]interface{}); ok {
+				lintValues(typed, overlayMap, childKeyPath, childDisplayPath, mergeKeys, reportUnknown, report)
+			}
+		case []interface{}:
+			overlayList, ok := overlayValue.([]interface{})
+			if !ok || len(typed) == 0 {
+				continue
+			}
+			if _, isMap := typed[0].(map[string]interface{}); !isMap {
+				continue
+			}
+			mergeKey, byKey := mergeKeys[childKeyPath]
+			for idx, entry := range typed {
+				entryPath := fmt.Sprintf("%s[%d]", childDisplayPath, idx)
+				entryMap, _ := entry.(map[string]interface{})
+				var overlayEntry map[string]interface{}
+				if byKey {
+					overlayEntry = findListEntry(overlayList, mergeKey, entryMap[mergeKey])
+				} else if idx < len(overlayList) {
+					overlayEntry, _ = overlayList[idx].(map[string]interface{})
+				}
+				if overlayEntry == nil {
+					// Source entries without overlay entry are kept as they are
+					collectPlaceholders(entry, entryPath, report)
+					continue
+				}
+				lintValues(entryMap, overlayEntry, childKeyPath, entryPath, mergeKeys, reportUnknown, report)
+			}
+		}
+	}
+
+	if !reportUnknown {
+		return
+	}
+	for _, k := range sortedMapKeys(overlay) {
+		if source[k] == nil {
+			report.UnknownKeys = append(report.UnknownKeys, displayPath+"."+k)
+		}
+	}
+}
+
+func findListEntry(list []interface{}, mergeKey string, keyValue interface{}) map[string]interface{} {
+	if keyValue == nil {
+		return nil
+	}
+	for _, entry := range list {
+		entryMap, _ := entry.(map[string]interface{})
+		if value, found := entryMap[mergeKey]; found && fmt.Sprint(value) == fmt.Sprint(keyValue) {
+			return entryMap
+		}
+	}
+	return nil
+}
+
+// collectPlaceholders reports the placeholders nested in the value, which the
+// overlay merge doesn't reach
+func collectPlaceholders(value interface{}, path string, report *OverlayReport) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedMapKeys(typed) {
+			collectPlaceholders(typed[k], path+"."+k, report)
+		}
+	case []interface{}:
+		for idx, entry := range typed {
+			collectPlaceholders(entry, fmt.Sprintf("%s[%d]", path, idx), report)
+		}
+	default:
+		if isPlaceholder(value) {
+			report.KeptPlaceholders = append(report.KeptPlaceholders, path)
+		}
+	}
+}
+
+func isPlaceholder(value interface{}) bool {
+	str, ok := value.(string)
+	return ok && strings.HasPrefix(str, "$") && !ContainsTemplate(str)
+}
+
+func stringMap(in map[string]string) map[string]interface{} {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+func sortedMapKeys(in map[string]interface{}) []string {
+	keys := make([]string, 0, len(in))
+	for k := range in {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,10 +1,8 @@
 package policyGen
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"path"
 	"path/filepath"
 	"reflect"
@@ -15,41 +13,123 @@ import (
 )
 
 type PolicyBuilder struct {
-	fHandler *utils.FilesHandler
+	fHandler        *utils.FilesHandler
+	schemaValidator *SchemaValidator
+	// sourceFiles of each output of the last Build
+	outputSourceFiles map[string][]string
+	// generatedCR each object template of the last Build is built from, keyed
+	// by its objectDefinition, as splitting the ConfigurationPolicies relies
+	// on the sourceFile of the objects
+	objectSources map[uintptr]generatedCR
 }
 
 // struct used to keep the user PGT sourceFile data with the actual built CR
 // from that source file.
 type generatedCR struct {
-	globalComplianceType string
-	pgtSourceFile        utils.SourceFile
-	builtCR              map[string]interface{}
+	globalComplianceType         string
+	globalMetadataComplianceType string
+	globalRecordDiff             string
+	pgtSourceFile                utils.SourceFile
+	builtCR                      map[string]interface{}
+	// the built CR holds ACM hub or managed cluster templates
+	templated bool
 }
 
 func NewPolicyBuilder(fileHandler *utils.FilesHandler) *PolicyBuilder {
 	return &PolicyBuilder{fHandler: fileHandler}
 }
 
+// SetSchemaValidator enables the validation of the built CRs against the
+// schemas of their CustomResourceDefinitions
+func (pbuilder *PolicyBuilder) SetSchemaValidator(validator *SchemaValidator) {
+	pbuilder.schemaValidator = validator
+}
+
+// OutputSourceFiles returns the names of the sourceFiles the output of the
+// last Build was built from, in the PGT order
+func (pbuilder *PolicyBuilder) OutputSourceFiles(output string) []string {
+	return pbuilder.outputSourceFiles[output]
+}
+
+func (pbuilder *PolicyBuilder) addObjectSource(objTemplate utils.ObjectTemplates, resource generatedCR) {
+	if pbuilder.objectSources == nil {
+		pbuilder.objectSources = make(map[uintptr]generatedCR)
+	}
+	pbuilder.objectSources[reflect.ValueOf(objTemplate.ObjectDefinition).Pointer()] = resource
+}
+
+// objectSource returns the generatedCR the object template is built from, the
+// object templates being copied with their objectDefinition map
+func (pbuilder *PolicyBuilder) objectSource(objTemplate utils.ObjectTemplates) generatedCR {
+	return pbuilder.objectSources[reflect.ValueOf(objTemplate.ObjectDefinition).Pointer()]
+}
+
+func (pbuilder *PolicyBuilder) addOutputSourceFile(output string, fileName string) {
+	for _, existing := range pbuilder.outputSourceFiles[output] {
+		if existing == fileName {
+			return
+		}
+	}
+	pbuilder.outputSourceFiles[output] = append(pbuilder.outputSourceFiles[output], fileName)
+}
+
 func (pbuilder *PolicyBuilder) Build(policyGenTemp utils.PolicyGenTemplate) (map[string]interface{}, error) {
 	policies := make(map[string]interface{})
+	pbuilder.outputSourceFiles = make(map[string][]string)
+	pbuilder.objectSources = make(map[uintptr]generatedCR)
 
 	if policyGenTemp.Metadata.Name == "" || policyGenTemp.Metadata.Namespace == "" {
 		return policies, errors.New("PolicyGenTemplate Metadata.Name & Metadata.Namespace must be defined")
 	}
 
 	if len(policyGenTemp.Spec.SourceFiles) > 0 {
+		if err := CheckPolicyTemplateSplit(policyGenTemp.Spec); err != nil {
+			return policies, err
+		}
+		if err := CheckObjectTemplateOptions(policyGenTemp.Spec); err != nil {
+			return policies, err
+		}
 		subjects := make([]utils.Subject, 0)
-		for _, sFile := range policyGenTemp.Spec.SourceFiles {
-			sPolicyFile, err := pbuilder.fHandler.ReadSourceFile(sFile.FileName)
+		// schema violations of all the built CRs, reported together once all
+		// the sourceFiles are processed
+		schemaViolations := make([]string, 0)
+		// Subscriptions converted into OperatorPolicies once their policy is built
+		operatorSources := make(map[string][]operatorSource)
+		for sFileIdx, sFile := range policyGenTemp.Spec.SourceFiles {
+			sFile = resolveListMerge(sFile, policyGenTemp.Spec)
+			resources, err := pbuilder.BuildSourceFile(sFile, policyGenTemp)
 			if err != nil {
 				return policies, err
 			}
-
-			resources, err := pbuilder.getCustomResources(sFile, sPolicyFile, policyGenTemp.Spec.Mcp)
-			if err != nil {
-				return policies, errors.New("Failed to process the source file " + sFile.FileName + ": " + err.Error())
+			if err := CheckInlineSecrets(sFile, resources, policyGenTemp.Spec); err != nil {
+				return policies, err
+			}
+			// ACM only resolves the templates of the CRs wrapped in a policy, the
+			// plain CRs are generated verbatim
+			wrapped := sFile.PolicyName != "" && policyGenTemp.Spec.WrapInPolicy
+			templated := make([]bool, len(resources))
+			if wrapped && !sFile.DisableTemplates {
+				for idx, resource := range resources {
+					found, err := ValidateTemplates(resource)
+					if err != nil {
+						return policies, errors.New("Failed to process the source file " + sFile.FileName + ": " + err.Error() +
+							". Set disableTemplates on the sourceFile if the value is not meant to be resolved by ACM")
+					}
+					templated[idx] = found
+				}
+			}
+			if pbuilder.schemaValidator != nil {
+				for _, resource := range resources {
+					for _, violation := range pbuilder.schemaValidator.Validate(resource) {
+						schemaViolations = append(schemaViolations,
+							fmt.Sprintf("sourceFiles[%d] (%s): %s", sFileIdx, sFile.FileName, violation))
+					}
+				}
 			}
-			if sFile.PolicyName == "" || !policyGenTemp.Spec.WrapInPolicy {
+			if err := CheckOperatorPolicyOverlay(sFile, resources, policyGenTemp.Spec.UseOperatorPolicy); err != nil {
+				return policies, err
+			}
+			if !wrapped {
 				// Generate plain CRs (no policy)
 				var name string
 				if len(resources) > 1 {
@@ -70,6 +150,7 @@ func (pbuilder *PolicyBuilder) Build(policyGenTemp utils.PolicyGenTemplate) (map
 				}
 				output := path.Join(utils.CustomResource, policyGenTemp.Metadata.Name, name)
 				policies[output] = resources
+				pbuilder.addOutputSourceFile(output, sFile.FileName)
 			} else {
 				// Generate a policy-wrapped CR, with the filename based on the policy and source filename
 				name := strings.Join([]string{policyGenTemp.Metadata.Name, sFile.PolicyName}, "-")
@@ -80,9 +161,12 @@ func (pbuilder *PolicyBuilder) Build(policyGenTemp utils.PolicyGenTemplate) (map
 				annotatedResources := make([]generatedCR, len(resources))
 				for idx, cr := range resources {
 					annotatedResources[idx] = generatedCR{
-						globalComplianceType: policyGenTemp.Spec.ComplianceType,
-						pgtSourceFile:        sFile,
-						builtCR:              cr,
+						globalComplianceType:         policyGenTemp.Spec.ComplianceType,
+						globalMetadataComplianceType: policyGenTemp.Spec.MetadataComplianceType,
+						globalRecordDiff:             policyGenTemp.Spec.RecordDiff,
+						pgtSourceFile:                sFile,
+						builtCR:                      cr,
+						templated:                    templated[idx],
 					}
 				}
 				if sFile.PolicyName != "" && policies[output] == nil {
@@ -121,6 +205,9 @@ func (pbuilder *PolicyBuilder) Build(policyGenTemp utils.PolicyGenTemplate) (map
 						}
 						acmPolicy.Spec.PolicyTemplates[0].ObjDef.Spec.EvaluationInterval.NonCompliant = sFile.EvaluationInterval.NonCompliant
 					}
+					if err := SetConfigPolicyOptions(&acmPolicy, policyGenTemp.Spec, sFile); err != nil {
+						return policies, err
+					}
 
 					subject := CreatePolicySubject(name)
 					subjects = append(subjects, subject)
@@ -167,27 +254,109 @@ func (pbuilder *PolicyBuilder) Build(policyGenTemp utils.PolicyGenTemplate) (map
 						}
 						acmPolicy.Spec.PolicyTemplates[0].ObjDef.Spec.EvaluationInterval.NonCompliant = sFile.EvaluationInterval.NonCompliant
 					}
+					if err := MergeConfigPolicyOptions(&acmPolicy, policyGenTemp.Spec, sFile); err != nil {
+						return policies, err
+					}
+				}
 
+				policies[output] = acmPolicy
+				pbuilder.addOutputSourceFile(output, sFile.FileName)
+				if policyGenTemp.Spec.UseOperatorPolicy {
+					for _, resource := range resources {
+						if resource["kind"] == subscriptionKind {
+							operatorSources[output] = append(operatorSources[output], operatorSource{sFile, resource})
+						}
+					}
+				}
+			}
+		}
+		if len(schemaViolations) > 0 {
+			return policies, errors.New("Schema validation failed:\n  " + strings.Join(schemaViolations, "\n  "))
+		}
+		for output, sources := range operatorSources {
+			acmPolicy := policies[output].(utils.AcmPolicy)
+			if err := ConvertToOperatorPolicies(&acmPolicy, sources); err != nil {
+				return policies, err
+			}
+			policies[output] = acmPolicy
+		}
+		for output, policy := range policies {
+			if acmPolicy, ok := policy.(utils.AcmPolicy); ok {
+				if err := pbuilder.SplitConfigurationPolicies(&acmPolicy, policyGenTemp.Spec.SplitByKind, policyGenTemp.Spec.MaxObjectTemplates); err != nil {
+					return policies, err
 				}
 				policies[output] = acmPolicy
 			}
 		}
+		if policyGenTemp.Spec.WaveDependencies != "" {
+			if err := pbuilder.setWaveDependencies(policies, policyGenTemp.Spec.WaveDependencies); err != nil {
+				return policies, err
+			}
+		}
 		if len(subjects) > 0 {
 			// Create rules
-			if err := CheckBindingRules(policyGenTemp.Metadata.Name,
-				policyGenTemp.Spec.BindingRules, policyGenTemp.Spec.BindingExcludedRules); err != nil {
+			if err := CheckBindingRules(policyGenTemp.Metadata.Name, policyGenTemp.Spec.BindingRules,
+				policyGenTemp.Spec.BindingExcludedRules, policyGenTemp.Spec.BindingSelector); err != nil {
 				return policies, err
 			}
-			placementRule := CreatePlacementRule(policyGenTemp.Metadata.Name, policyGenTemp.Metadata.Namespace,
-				policyGenTemp.Spec.BindingRules, policyGenTemp.Spec.BindingExcludedRules)
-
-			if err := CheckNameLength(placementRule.Metadata.Namespace, placementRule.Metadata.Name); err != nil {
+			if err := CheckPlacement(policyGenTemp.Metadata.Name, policyGenTemp.Spec); err != nil {
 				return policies, err
 			}
-			policies[policyGenTemp.Metadata.Name+"/"+placementRule.Metadata.Name] = placementRule
+
+			var placementName string
+			if policyGenTemp.Spec.PlacementKind == utils.PlacementKind {
+				clusterSet := policyGenTemp.Spec.ClusterSet
+				if clusterSet == "" {
+					clusterSet = utils.DefaultClusterSet
+				}
+				placement := CreatePlacement(policyGenTemp.Metadata.Name, policyGenTemp.Metadata.Namespace, clusterSet,
+					policyGenTemp.Spec.BindingRules, policyGenTemp.Spec.BindingExcludedRules, policyGenTemp.Spec.BindingSelector,
+					policyGenTemp.Spec.PlacementTolerations)
+
+				if err := CheckNameLength(placement.Metadata.Namespace, placement.Metadata.Name); err != nil {
+					return policies, err
+				}
+				policies[policyGenTemp.Metadata.Name+"/"+placement.Metadata.Name] = placement
+				placementName = placement.Metadata.Name
+
+				if policyGenTemp.Spec.ClusterSetBinding {
+					// The ManagedClusterSet must be bound to the policy namespace
+					// before the Placement can select any cluster from it. The
+					// binding is opt-in as the PGTs sharing a namespace would all
+					// generate the same one.
+					clusterSetBinding := CreateManagedClusterSetBinding(policyGenTemp.Metadata.Namespace, clusterSet)
+					policies[policyGenTemp.Metadata.Name+"/"+clusterSetBinding.Metadata.Name] = clusterSetBinding
+				}
+			} else {
+				placementRule := CreatePlacementRule(policyGenTemp.Metadata.Name, policyGenTemp.Metadata.Namespace,
+					policyGenTemp.Spec.BindingRules, policyGenTemp.Spec.BindingExcludedRules, policyGenTemp.Spec.BindingSelector)
+
+				if err := CheckNameLength(placementRule.Metadata.Namespace, placementRule.Metadata.Name); err != nil {
+					return policies, err
+				}
+				policies[policyGenTemp.Metadata.Name+"/"+placementRule.Metadata.Name] = placementRule
+				placementName = placementRule.Metadata.Name
+			}
+
+			if policyGenTemp.Spec.PolicySet != nil {
+				// Bind the PolicySet grouping the policies rather than each policy
+				policyNames := make([]string, len(subjects))
+				for idx, subject := range subjects {
+					policyNames[idx] = subject.Name
+				}
+				policySet := CreatePolicySet(policyGenTemp.Metadata.Name, policyGenTemp.Metadata.Namespace,
+					*policyGenTemp.Spec.PolicySet, policyNames)
+
+				if err := CheckNameLength(policySet.Metadata.Namespace, policySet.Metadata.Name); err != nil {
+					return policies, err
+				}
+				policies[policyGenTemp.Metadata.Name+"/"+policySet.Metadata.Name+"-policyset"] = policySet
+				subjects = []utils.Subject{CreatePolicySetSubject(policySet.Metadata.Name)}
+			}
 
 			// Create binding
-			placementBinding := CreatePlacementBinding(policyGenTemp.Metadata.Name, policyGenTemp.Metadata.Namespace, placementRule.Metadata.Name, subjects)
+			placementBinding := CreatePlacementBinding(policyGenTemp.Metadata.Name, policyGenTemp.Metadata.Namespace,
+				placementName, policyGenTemp.Spec.PlacementKind, subjects)
 
 			if err := CheckNameLength(placementBinding.Metadata.Namespace, placementBinding.Metadata.Name); err != nil {
 				return policies, err
@@ -199,37 +368,91 @@ func (pbuilder *PolicyBuilder) Build(policyGenTemp utils.PolicyGenTemplate) (map
 	return policies, nil
 }
 
-func (pbuilder *PolicyBuilder) getCustomResources(sFile utils.SourceFile, sourceCRFile []byte, mcp string) ([]map[string]interface{}, error) {
-	yamls, err := pbuilder.splitYamls(sourceCRFile)
-	resources := make([]map[string]interface{}, 0)
+// resolveListMerge sets the sourceFile listMerge to the PGT listMerge when
+// unset
+func resolveListMerge(sFile utils.SourceFile, spec utils.PolicyGenTempSpec) utils.SourceFile {
+	if sFile.ListMerge == utils.UnsetStringValue || sFile.ListMerge == "" {
+		sFile.ListMerge = spec.ListMerge
+	}
+	if sFile.ListMerge == "" {
+		sFile.ListMerge = utils.ListMergeByIndex
+	}
+	return sFile
+}
+
+// BuildSourceFile returns the CRs built from the source CR file of the
+// sourceFile of the PGT with its overlay applied, as they are wrapped in the
+// policy
+func (pbuilder *PolicyBuilder) BuildSourceFile(sFile utils.SourceFile, policyGenTemp utils.PolicyGenTemplate) ([]map[string]interface{}, error) {
+	spec := policyGenTemp.Spec
+	sFile = resolveListMerge(sFile, spec)
+	if err := CheckListMerge(sFile.ListMerge); err != nil {
+		return nil, errors.New(sFile.FileName + ": " + err.Error())
+	}
+
+	yamls, err := pbuilder.fHandler.ReadSourceDocuments(sFile.FileName)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := sFile.PolicyName != "" && spec.WrapInPolicy
+	resources, err := pbuilder.getCustomResources(sFile, yamls, spec.Mcp, policyGenTemp.Metadata.Namespace, wrapped)
 	if err != nil {
+		return nil, errors.New("Failed to process the source file " + sFile.FileName + ": " + err.Error())
+	}
+	return resources, nil
+}
+
+func (pbuilder *PolicyBuilder) getCustomResources(sFile utils.SourceFile, yamls [][]byte, mcp string, namespace string,
+	wrapped bool) ([]map[string]interface{}, error) {
+	resources := make([]map[string]interface{}, 0)
+	if err := CheckDocumentOverlays(sFile); err != nil {
 		return resources, err
 	}
-	// Update multiple yamls structure in same file not allowed.
+	// Update multiple yamls structure in same file not allowed, unless per document.
 	if len(yamls) > 1 && (len(sFile.Data) > 0 || len(sFile.Spec) > 0 || len(sFile.Status) > 0) {
 		return resources, errors.New("Updating spec/data/status of multiple yamls structure in same file " + sFile.FileName +
 			" is not allowed. Instead separate them in multiple files")
-	} else if len(yamls) > 1 && len(sFile.Data) == 0 && len(sFile.Spec) == 0 {
-		// Append yaml structures without modify spec or data fields
-		for _, yaml := range yamls {
-			resource, err := pbuilder.getCustomResource(sFile, yaml, mcp)
-			if err != nil {
+	} else if len(yamls) > 1 && len(sFile.Patches) > 0 {
+		return resources, errors.New("Patching multiple yamls structure in same file " + sFile.FileName +
+			" is not allowed. Instead separate them in multiple files")
+	}
+
+	matched := make([]bool, len(sFile.Documents))
+	for _, sourceCR := range yamls {
+		docSFile := sFile
+		if len(sFile.Documents) > 0 {
+			header := struct {
+				Kind     string         `yaml:"kind"`
+				Metadata utils.MetaData `yaml:"metadata"`
+			}{}
+			if err := yaml.Unmarshal(sourceCR, &header); err != nil {
 				return resources, err
 			}
-			resources = append(resources, resource)
+			var idx int
+			docSFile, idx = documentSourceFile(sFile, header.Kind, header.Metadata.Name)
+			if idx >= 0 {
+				matched[idx] = true
+			}
 		}
-	} else if len(yamls) == 1 {
-		resource, err := pbuilder.getCustomResource(sFile, yamls[0], mcp)
+		resource, err := pbuilder.getCustomResource(docSFile, sourceCR, mcp, namespace, wrapped)
 		if err != nil {
 			return resources, err
 		}
 		resources = append(resources, resource)
 	}
+	for idx, document := range sFile.Documents {
+		if !matched[idx] {
+			return resources, fmt.Errorf("%s: no document of kind %s named %s for documents[%d]",
+				sFile.FileName, document.Kind, document.Metadata.Name, idx)
+		}
+	}
 
 	return resources, nil
 }
 
-func (pbuilder *PolicyBuilder) getCustomResource(sourceFile utils.SourceFile, sourceCR []byte, mcp string) (map[string]interface{}, error) {
+func (pbuilder *PolicyBuilder) getCustomResource(sourceFile utils.SourceFile, sourceCR []byte, mcp string, namespace string,
+	wrapped bool) (map[string]interface{}, error) {
 	resourceMap := make(map[string]interface{})
 	resourceStr := string(sourceCR)
 
@@ -245,6 +468,11 @@ func (pbuilder *PolicyBuilder) getCustomResource(sourceFile utils.SourceFile, so
 	if _, exists := resourceMap["metadata"]; !exists {
 		return resourceMap, errors.New(`All source files must have the "metadata" field set`)
 	}
+	// The secretRef values are read from the hub Secrets of the policy namespace
+	sourceFile, err = resolveSecretRefs(sourceFile, resourceMap, namespace, wrapped)
+	if err != nil {
+		return resourceMap, err
+	}
 
 	if sourceFile.Metadata.Name != "" {
 		resourceMap["metadata"].(map[string]interface{})["name"] = sourceFile.Metadata.Name
@@ -286,7 +514,9 @@ func (pbuilder *PolicyBuilder) getCustomResource(sourceFile utils.SourceFile, so
 		resourceMap["spec"] = make(map[string]interface{})
 	}
 	if resourceMap["spec"] != nil {
-		resourceMap["spec"] = pbuilder.setValues(resourceMap["spec"].(map[string]interface{}), sourceFile.Spec)
+		kind, _ := resourceMap["kind"].(string)
+		resourceMap["spec"] = pbuilder.mergeValues(resourceMap["spec"].(map[string]interface{}), sourceFile.Spec,
+			"spec", getListMergeKeys(kind, sourceFile.ListMerge))
 	}
 	if resourceMap["data"] == nil && sourceFile.Data != nil {
 		// If the user supplies a "data" section but the source CR does not have
@@ -324,25 +554,49 @@ func (pbuilder *PolicyBuilder) getCustomResource(sourceFile utils.SourceFile, so
 		resourceMap["stringData"] = pbuilder.setValues(resourceMap["stringData"].(map[string]interface{}), sourceFile.StringData)
 	}
 
+	// The patches are applied once the overlay is merged
+	if err := ApplyPatches(resourceMap, sourceFile.Patches); err != nil {
+		return resourceMap, err
+	}
+
 	return resourceMap, nil
 }
 
 func (pbuilder *PolicyBuilder) setValues(sourceMap map[string]interface{}, valueMap map[string]interface{}) map[string]interface{} {
+	return pbuilder.mergeValues(sourceMap, valueMap, "", nil)
+}
+
+// mergeValues merges the user provided values into the source-cr map found at
+// path. Lists of maps are merged by position, unless mergeKeys holds a merge
+// key for the path of the list.
+func (pbuilder *PolicyBuilder) mergeValues(sourceMap map[string]interface{}, valueMap map[string]interface{},
+	path string, mergeKeys map[string]string) map[string]interface{} {
 	for k, v := range sourceMap {
+		childPath := k
+		if path != "" {
+			childPath = path + "." + k
+		}
 		if valueMap[k] == nil {
-			if reflect.ValueOf(v).Kind() == reflect.String && (v.(string) == "" || strings.HasPrefix(v.(string), "$")) {
+			// Placeholders left without a user value are dropped, ACM templates are kept
+			// as they are resolved by ACM when the policy is applied
+			if reflect.ValueOf(v).Kind() == reflect.String && (v.(string) == "" ||
+				(strings.HasPrefix(v.(string), "$") && !ContainsTemplate(v.(string)))) {
 				delete(sourceMap, k)
 			}
 			continue
 		}
 		if reflect.ValueOf(sourceMap[k]).Kind() == reflect.Map {
-			sourceMap[k] = pbuilder.setValues(v.(map[string]interface{}), valueMap[k].(map[string]interface{}))
+			sourceMap[k] = pbuilder.mergeValues(v.(map[string]interface{}), valueMap[k].(map[string]interface{}), childPath, mergeKeys)
 		} else if reflect.ValueOf(v).Kind() == reflect.Slice ||
 			reflect.ValueOf(v).Kind() == reflect.Array {
 			intfArray := v.([]interface{})
 
 			// The slice in the source-cr is not empty and its element is map
-			if len(intfArray) > 0 && reflect.ValueOf(intfArray[0]).Kind() == reflect.Map {
+			if mergeKey, found := mergeKeys[childPath]; found && len(intfArray) > 0 &&
+				reflect.ValueOf(intfArray[0]).Kind() == reflect.Map {
+				// Merge the user provided entries into the source-cr entries with the same key
+				sourceMap[k] = pbuilder.mergeListByKey(intfArray, valueMap[k].([]interface{}), mergeKey, childPath, mergeKeys)
+			} else if len(intfArray) > 0 && reflect.ValueOf(intfArray[0]).Kind() == reflect.Map {
 				tmpMapValues := make([]map[string]interface{}, len(intfArray))
 				vIntfArray := valueMap[k].([]interface{})
 
@@ -351,7 +605,7 @@ func (pbuilder *PolicyBuilder) setValues(sourceMap map[string]interface{}, value
 				// in the source-cr if no user overrides
 				for id, intfMap := range intfArray {
 					if id < len(vIntfArray) {
-						tmpMapValues[id] = pbuilder.setValues(intfMap.(map[string]interface{}), vIntfArray[id].(map[string]interface{}))
+						tmpMapValues[id] = pbuilder.mergeValues(intfMap.(map[string]interface{}), vIntfArray[id].(map[string]interface{}), childPath, mergeKeys)
 					} else {
 						tmpMapValues[id] = intfMap.(map[string]interface{})
 					}
@@ -387,36 +641,6 @@ func (pbuilder *PolicyBuilder) setValues(sourceMap map[string]interface{}, value
 	return sourceMap
 }
 
-func (pbuilder *PolicyBuilder) splitYamls(yamls []byte) ([][]byte, error) {
-	decoder := yaml.NewDecoder(bytes.NewReader(yamls))
-	var resources [][]byte
-
-	for {
-		var resIntf interface{}
-		err := decoder.Decode(&resIntf)
-
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-
-		// Check that resIntf is not nil in order to mitigate appending an empty
-		// object as a result of redundant trailing seperator(s) "---""
-		if resIntf != nil {
-			resBytes, err := yaml.Marshal(resIntf)
-
-			if err != nil {
-				return nil, err
-			}
-
-			resources = append(resources, resBytes)
-		}
-	}
-	return resources, nil
-}
-
 func (pbuilder *PolicyBuilder) createAcmPolicy(name string, namespace string, resources []generatedCR) (utils.AcmPolicy, error) {
 	if err := CheckNameLength(namespace, name); err != nil {
 		return utils.AcmPolicy{}, err
@@ -443,6 +667,7 @@ func (pbuilder *PolicyBuilder) createAcmPolicy(name string, namespace string, re
 	for idx, resource := range resources {
 		objTemp := BuildObjectTemplate(resource)
 		objTempArr[idx] = objTemp
+		pbuilder.addObjectSource(objTemp, resource)
 
 		if err = SetPolicyDeployWave(acmPolicy.Metadata, resource); err != nil {
 			return acmPolicy, err
@@ -465,6 +690,7 @@ func (pbuilder *PolicyBuilder) AppendAcmPolicy(acmPolicy utils.AcmPolicy, resour
 	for _, resource := range resources {
 		objTemp := BuildObjectTemplate(resource)
 		objTempArr = append(objTempArr, objTemp)
+		pbuilder.addObjectSource(objTemp, resource)
 
 		if err := SetPolicyDeployWave(acmPolicy.Metadata, resource); err != nil {
 			return acmPolicy, err
@@ -474,3 +700,23 @@ func (pbuilder *PolicyBuilder) AppendAcmPolicy(acmPolicy utils.AcmPolicy, resour
 
 	return acmPolicy, nil
 }
+
+// setWaveDependencies sets the wave dependencies between the policies built
+// from the PGT
+func (pbuilder *PolicyBuilder) setWaveDependencies(policies map[string]interface{}, waveDependencies string) error {
+	outputs := make([]string, 0)
+	acmPolicies := make([]*utils.AcmPolicy, 0)
+	for output, policy := range policies {
+		if acmPolicy, ok := policy.(utils.AcmPolicy); ok {
+			outputs = append(outputs, output)
+			acmPolicies = append(acmPolicies, &acmPolicy)
+		}
+	}
+	if err := SetWaveDependencies(acmPolicies, waveDependencies); err != nil {
+		return err
+	}
+	for idx, output := range outputs {
+		policies[output] = *acmPolicies[idx]
+	}
+	return nil
+}
@@ -717,3 +717,544 @@ spec:
 	assert.Error(t, err)
 	assert.Equal(t, fmt.Errorf("Failed to process the source file GenericMultiYaml.yaml: Updating spec/data/status of multiple yamls structure in same file GenericMultiYaml.yaml is not allowed. Instead separate them in multiple files"), err)
 }
+
+func TestListOverlayByKey(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  listMerge: key
+  sourceFiles:
+    - fileName: GenericPtpConfig.yaml
+      policyName: "gen-policy1"
+      spec:
+        profile:
+        - name: "boundary"
+          interface: ens5f0
+        - name: "ordinary"
+          interface: ens5f1
+        recommend:
+        - priority: 5
+          profile: "boundary"
+`
+	policies, _ := buildTest(t, input)
+	objects := extractCRsFromPolicies(t, policies)
+	assert.Equal(t, len(objects), 1)
+
+	spec := objects[0].ObjectDefinition["spec"].(map[string]interface{})
+	// Source entries without user overlay are kept as they are, same as
+	// when merging by position
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"name":        "slave",
+			"interface":   "$interface",
+			"ptp4lOpts":   "-2 -s",
+			"phc2sysOpts": "-a -r -n 24",
+		},
+		{
+			"name":      "grandmaster",
+			"interface": "$interface",
+			"ptp4lOpts": "-2",
+		},
+		{
+			"name":      "boundary",
+			"interface": "ens5f0",
+			"ptp4lOpts": "-2",
+		},
+		{
+			"name":      "ordinary",
+			"interface": "ens5f1",
+		},
+	}, spec["profile"])
+
+	recommend := spec["recommend"].([]map[string]interface{})
+	assert.Len(t, recommend, 2)
+	assert.Equal(t, "slave", recommend[0]["profile"])
+	assert.Equal(t, "boundary", recommend[1]["profile"])
+	assert.Equal(t, 5, recommend[1]["priority"])
+}
+
+func TestListOverlayByKeySourceFileOverride(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  listMerge: key
+  sourceFiles:
+    - fileName: GenericPtpConfig.yaml
+      policyName: "gen-policy1"
+      listMerge: index
+      spec:
+        profile:
+        - name: "boundary"
+          interface: ens5f0
+`
+	policies, _ := buildTest(t, input)
+	objects := extractCRsFromPolicies(t, policies)
+	profiles := objects[0].ObjectDefinition["spec"].(map[string]interface{})["profile"].([]map[string]interface{})
+	assert.Len(t, profiles, 3)
+	// The first entry is overlaid by position
+	assert.Equal(t, "boundary", profiles[0]["name"])
+	assert.Equal(t, "ens5f0", profiles[0]["interface"])
+	assert.Equal(t, "-2 -s", profiles[0]["ptp4lOpts"])
+}
+
+func TestPatches(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericPtpConfig.yaml
+      policyName: "gen-policy1"
+      spec:
+        profile:
+        - name: "slave"
+          interface: ens5f0
+      patches:
+        - op: replace
+          path: /spec/profile/2/ptp4lOpts
+          value: "-2 --summary_interval -4"
+        - op: remove
+          path: /spec/profile/1
+        - op: add
+          path: /spec/recommend/-
+          value:
+            profile: "boundary"
+            priority: 6
+        - op: remove
+          path: /spec/recommend/1
+        - op: test
+          path: /spec/profile/0/interface
+          value: ens5f0
+        - op: test
+          path: /spec/recommend/0
+          value:
+            profile: "slave"
+            priority: 4
+            match:
+            - nodeLabel: "node-role.kubernetes.io/master"
+        - op: copy
+          from: /spec/profile/0/interface
+          path: /spec/profile/1/interface
+        - op: move
+          from: /spec/profile/0/phc2sysOpts
+          path: /spec/profile/1/phc2sysOpts
+`
+	policies, _ := buildTest(t, input)
+	objects := extractCRsFromPolicies(t, policies)
+	spec := objects[0].ObjectDefinition["spec"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"name":      "slave",
+			"interface": "ens5f0",
+			"ptp4lOpts": "-2 -s",
+		},
+		map[string]interface{}{
+			"name":        "boundary",
+			"interface":   "ens5f0",
+			"ptp4lOpts":   "-2 --summary_interval -4",
+			"phc2sysOpts": "-a -r -n 24",
+		},
+	}, spec["profile"])
+	recommend := spec["recommend"].([]interface{})
+	assert.Len(t, recommend, 2)
+	assert.Equal(t, "slave", recommend[0].(map[string]interface{})["profile"])
+	assert.Equal(t, "boundary", recommend[1].(map[string]interface{})["profile"])
+	assert.Equal(t, 6, recommend[1].(map[string]interface{})["priority"])
+}
+
+func TestPatchesInvalid(t *testing.T) {
+	testcases := []struct {
+		patch       string
+		expectedErr string
+	}{{
+		patch: `
+        - op: remove
+          path: /spec/profile/3`,
+		expectedErr: "patches[0] (remove /spec/profile/3): path /spec/profile/3 does not exist: list index 3 out of range, the list has 3 entries",
+	}, {
+		patch: `
+        - op: add
+          path: /spec/profile/0/interface
+          value: ens5f0
+        - op: replace
+          path: /spec/missing/key
+          value: "value"`,
+		expectedErr: "patches[1] (replace /spec/missing/key): path /spec/missing does not exist: missing key missing",
+	}, {
+		patch: `
+        - op: test
+          path: /spec/profile/0/name
+          value: master`,
+		expectedErr: "patches[0] (test /spec/profile/0/name): value \"slave\" doesn't match \"master\"",
+	}, {
+		// The values are compared with their JSON type
+		patch: `
+        - op: test
+          path: /spec/recommend/0/priority
+          value: "4"`,
+		expectedErr: "patches[0] (test /spec/recommend/0/priority): value 4 doesn't match \"4\"",
+	}, {
+		patch: `
+        - op: merge
+          path: /spec/profile`,
+		expectedErr: "unsupported operation 'merge'",
+	}}
+	for _, tc := range testcases {
+		input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericPtpConfig.yaml
+      policyName: "gen-policy1"
+      patches:` + tc.patch + `
+`
+		pgt := utils.PolicyGenTemplate{}
+		err := yaml.Unmarshal([]byte(input), &pgt)
+		assert.NoError(t, err)
+
+		fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+		pBuilder := NewPolicyBuilder(fHandler)
+		_, err = pBuilder.Build(pgt)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Failed to process the source file GenericPtpConfig.yaml")
+		assert.Contains(t, err.Error(), tc.expectedErr)
+	}
+}
+
+func TestLintOverlay(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericPtpConfig.yaml
+      policyName: "gen-policy1"
+      listMerge: key
+      metadata:
+        labels:
+          new-label: "true"
+      spec:
+        profile:
+          - name: "grandmaster"
+            interface: ens1
+            ptp4lopts: "-2"
+        recommend:
+          - priority: 4
+            matchh: []
+`
+	pgt := utils.PolicyGenTemplate{}
+	assert.NoError(t, yaml.Unmarshal([]byte(input), &pgt))
+
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	pBuilder := NewPolicyBuilder(fHandler)
+	report, err := pBuilder.LintOverlay(pgt.Spec.SourceFiles[0], pgt.Spec)
+	assert.NoError(t, err)
+
+	// Entries are matched by their merge key, new labels are expected
+	assert.Equal(t, []string{"spec.profile[1].ptp4lopts", "spec.recommend[0].matchh"}, report.UnknownKeys)
+	assert.Empty(t, report.UnusedPlaceholders)
+	assert.Equal(t, []string{"spec.profile[0].interface", "spec.profile[2].interface"}, report.KeptPlaceholders)
+
+	// Matched by index, the overlay entry removes the slave placeholder
+	pgt.Spec.SourceFiles[0].ListMerge = utils.ListMergeByIndex
+	report, err = pBuilder.LintOverlay(pgt.Spec.SourceFiles[0], pgt.Spec)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"spec.profile[0].ptp4lopts", "spec.recommend[0].matchh"}, report.UnknownKeys)
+	assert.Empty(t, report.UnusedPlaceholders)
+	assert.Equal(t, []string{"spec.profile[1].interface", "spec.profile[2].interface"}, report.KeptPlaceholders)
+
+	_, err = pBuilder.LintOverlay(utils.SourceFile{FileName: "Missing.yaml"}, pgt.Spec)
+	assert.Error(t, err)
+}
+
+func TestMultiYamlDocumentOverlay(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericOperatorInstall.yaml
+      policyName: "gen-policy1"
+      metadata:
+        labels:
+          all: "true"
+      documents:
+        - kind: Subscription
+          metadata:
+            name: generic-operator-subscription
+            labels:
+              subscription: "true"
+          spec:
+            channel: stable
+            installPlanApproval: Manual
+        - kind: OperatorGroup
+          metadata:
+            name: generic-operators
+          patches:
+            - op: add
+              path: /spec/upgradeStrategy
+              value: Default
+`
+	policies, err := buildTest(t, input)
+	assert.NoError(t, err)
+
+	objects := policies["test1/test1-gen-policy1"].(utils.AcmPolicy).Spec.PolicyTemplates[0].ObjDef.Spec.ObjectTemplates
+	assert.Len(t, objects, 3)
+	namespace := objects[0].ObjectDefinition
+	operatorGroup := objects[1].ObjectDefinition
+	subscription := objects[2].ObjectDefinition
+
+	// Only the sourceFile metadata applies to the documents without overlay
+	assert.Equal(t, map[string]interface{}{"all": "true"}, namespace["metadata"].(map[string]interface{})["labels"])
+	assert.Nil(t, namespace["spec"])
+
+	assert.Equal(t, "Default", operatorGroup["spec"].(map[string]interface{})["upgradeStrategy"])
+	assert.Equal(t, []interface{}{"generic-ns"}, operatorGroup["spec"].(map[string]interface{})["targetNamespaces"])
+
+	subscriptionMeta := subscription["metadata"].(map[string]interface{})
+	assert.Equal(t, "generic-operator-subscription", subscriptionMeta["name"])
+	assert.Equal(t, map[string]interface{}{"all": "true", "subscription": "true"}, subscriptionMeta["labels"])
+	assert.Equal(t, "stable", subscription["spec"].(map[string]interface{})["channel"])
+	assert.Equal(t, "Manual", subscription["spec"].(map[string]interface{})["installPlanApproval"])
+	assert.Equal(t, "generic-operator", subscription["spec"].(map[string]interface{})["name"])
+
+	// The document overlays are linted against their document
+	pgt := utils.PolicyGenTemplate{}
+	assert.NoError(t, yaml.Unmarshal([]byte(input), &pgt))
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	report, err := NewPolicyBuilder(fHandler).LintOverlay(pgt.Spec.SourceFiles[0], pgt.Spec)
+	assert.NoError(t, err)
+	assert.Empty(t, report.UnknownKeys)
+	assert.Empty(t, report.UnusedPlaceholders)
+
+	pgt.Spec.SourceFiles[0].Documents[0].Spec = map[string]interface{}{"chanel": "stable"}
+	report, err = NewPolicyBuilder(fHandler).LintOverlay(pgt.Spec.SourceFiles[0], pgt.Spec)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"[2].spec.chanel"}, report.UnknownKeys)
+	assert.Equal(t, []string{"[2].spec.installPlanApproval"}, report.UnusedPlaceholders)
+}
+
+func TestMultiYamlDocumentOverlayInvalid(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericOperatorInstall.yaml
+      policyName: "gen-policy1"
+%s
+`
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	build := func(overlay string) error {
+		pgt := utils.PolicyGenTemplate{}
+		assert.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(input, overlay)), &pgt))
+		_, err := NewPolicyBuilder(fHandler).Build(pgt)
+		return err
+	}
+
+	assert.EqualError(t, build(`      documents:
+        - kind: Subscription
+          metadata:
+            name: other-subscription`),
+		"Failed to process the source file GenericOperatorInstall.yaml: GenericOperatorInstall.yaml: no document of kind Subscription named other-subscription for documents[0]")
+	assert.EqualError(t, build(`      documents:
+        - kind: Subscription`),
+		"Failed to process the source file GenericOperatorInstall.yaml: GenericOperatorInstall.yaml: documents[0] must set the kind and metadata.name of the document")
+	assert.EqualError(t, build(`      documents:
+        - kind: Namespace
+          metadata:
+            name: generic-ns
+        - kind: Namespace
+          metadata:
+            name: generic-ns`),
+		"Failed to process the source file GenericOperatorInstall.yaml: GenericOperatorInstall.yaml: documents[1] duplicates the overlay of Namespace/generic-ns")
+	err := build(`      spec:
+        channel: stable
+      documents:
+        - kind: Namespace
+          metadata:
+            name: generic-ns`)
+	assert.ErrorContains(t, err, "documents can't be combined with the spec/data/status/binaryData/stringData/patches of the sourceFile")
+}
+
+func TestSecretRef(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericSecret.yaml
+      policyName: "gen-policy1"
+      data:
+        token:
+          secretRef:
+            name: du-credentials
+            key: token
+      stringData:
+        password:
+          secretRef:
+            name: du-credentials
+            key: password
+    - fileName: GenericCR.yaml
+      policyName: "gen-policy1"
+      spec:
+        topSimple:
+          secretRef:
+            name: du-credentials
+            key: simple
+        topMap:
+          subMap:
+            secretRef:
+              name: not-a-reference
+              key: key1
+      binaryData:
+        abc:
+          secretRef:
+            name: du-credentials
+            key: abc
+`
+	pgt := utils.PolicyGenTemplate{}
+	assert.NoError(t, yaml.Unmarshal([]byte(input), &pgt))
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	policies, err := NewPolicyBuilder(fHandler).Build(pgt)
+	assert.NoError(t, err)
+
+	objTemplates := policies["test1/test1-gen-policy1"].(utils.AcmPolicy).Spec.PolicyTemplates[0].ObjDef.Spec.ObjectTemplates
+	assert.Len(t, objTemplates, 2)
+
+	// The Secret data is kept base64 encoded, its stringData decoded
+	secret := objTemplates[0].ObjectDefinition
+	assert.Equal(t, map[string]interface{}{
+		"token": `{{hub fromSecret "test1" "du-credentials" "token" hub}}`,
+	}, secret["data"])
+	assert.Equal(t, map[string]interface{}{
+		"password": `{{hub fromSecret "test1" "du-credentials" "password" | base64dec hub}}`,
+	}, secret["stringData"])
+
+	cr := objTemplates[1].ObjectDefinition
+	spec := cr["spec"].(map[string]interface{})
+	assert.Equal(t, `{{hub fromSecret "test1" "du-credentials" "simple" | base64dec hub}}`, spec["topSimple"])
+	// A map of the source CR is a regular field, never a reference
+	subMap := spec["topMap"].(map[string]interface{})["subMap"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"name": "not-a-reference", "key": "key1"}, subMap["secretRef"])
+	assert.Equal(t, "value1", subMap["key1"])
+	assert.Equal(t, map[string]interface{}{
+		"abc": `{{hub fromSecret "test1" "du-credentials" "abc" hub}}`,
+	}, cr["binaryData"])
+}
+
+func TestSecretRefInvalid(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  %s
+  sourceFiles:
+    - fileName: GenericSecret.yaml
+      policyName: "gen-policy1"
+%s
+`
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	build := func(spec string, overlay string) error {
+		pgt := utils.PolicyGenTemplate{}
+		assert.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(input, spec, overlay)), &pgt))
+		_, err := NewPolicyBuilder(fHandler).Build(pgt)
+		return err
+	}
+
+	assert.EqualError(t, build("", `      stringData:
+        password:
+          secretRef:
+            name: du-credentials`),
+		"Failed to process the source file GenericSecret.yaml: secretRef at stringData.password must set the name and key of the hub Secret")
+	assert.EqualError(t, build("", `      stringData:
+        password:
+          secretRef:
+            name: du-credentials
+            key: password
+            namespace: other`),
+		"Failed to process the source file GenericSecret.yaml: secretRef at stringData.password only supports the name and key of the hub Secret, found namespace")
+	assert.EqualError(t, build("", `      stringData:
+        password:
+          secretRef:
+            name: Du_Credentials
+            key: password`),
+		"Failed to process the source file GenericSecret.yaml: secretRef at stringData.password: name 'Du_Credentials' is invalid: "+
+			"a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an "+
+			"alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')")
+	assert.EqualError(t, build("", `      disableTemplates: true
+      stringData:
+        password:
+          secretRef:
+            name: du-credentials
+            key: password`),
+		"Failed to process the source file GenericSecret.yaml: secretRef at stringData can't be resolved as templates are disabled on the sourceFile")
+
+	// The hub templates are only resolved in a policy
+	assert.EqualError(t, build("wrapInPolicy: false", `      stringData:
+        password:
+          secretRef:
+            name: du-credentials
+            key: password`),
+		"Failed to process the source file GenericSecret.yaml: secretRef at stringData can't be resolved as the CR isn't wrapped in a policy")
+
+	// Plain-text values of Secrets are refused unless explicitly allowed
+	plainText := `      data:
+        token: dG9rZW4=
+      stringData:
+        password: secret`
+	assert.EqualError(t, build("", plainText),
+		"GenericSecret.yaml: Secret test holds the plain-text value data.token. Read it from a hub Secret with a secretRef overlay, or set allowInlineSecrets")
+	assert.NoError(t, build("allowInlineSecrets: true", plainText))
+	assert.NoError(t, build("", plainText+`
+      allowInlineSecrets: true`))
+}
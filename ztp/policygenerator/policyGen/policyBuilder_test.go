@@ -2,6 +2,7 @@ package policyGen
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
@@ -276,6 +277,119 @@ spec:
 
 }
 
+// Test the metadataComplianceType and recordDiff of the object templates, set
+// in the spec and overridden per sourceFile
+func TestMetadataComplianceType(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  complianceType: mustonlyhave
+  metadataComplianceType: musthave
+  recordDiff: InStatus
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-sub-policy"
+    - fileName: GenericSubscription.yaml
+      policyName: "gen-sub-policy"
+      metadataComplianceType: mustonlyhave
+      recordDiff: None
+    - fileName: GenericOperatorGroup.yaml
+      policyName: "gen-sub-policy"
+      complianceType: musthave
+`
+	pgt := utils.PolicyGenTemplate{}
+	_ = yaml.Unmarshal([]byte(input), &pgt)
+
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	pBuilder := NewPolicyBuilder(fHandler)
+	policies, err := pBuilder.Build(pgt)
+	assert.Nil(t, err)
+
+	objects := extractCRsFromPolicies(t, policies)
+	assert.Equal(t, len(objects), 3)
+
+	assert.Equal(t, objects[0].ComplianceType, "mustonlyhave")
+	assert.Equal(t, objects[0].MetadataComplianceType, "musthave")
+	assert.Equal(t, objects[0].RecordDiff, "InStatus")
+
+	assert.Equal(t, objects[1].ComplianceType, "mustonlyhave")
+	assert.Equal(t, objects[1].MetadataComplianceType, "mustonlyhave")
+	assert.Equal(t, objects[1].RecordDiff, "None")
+
+	assert.Equal(t, objects[2].ComplianceType, "musthave")
+	assert.Equal(t, objects[2].MetadataComplianceType, "musthave")
+	assert.Equal(t, objects[2].RecordDiff, "InStatus")
+
+	// The fields are rendered in the object templates only when set
+	content, err := yaml.Marshal(policies["test1/test1-gen-sub-policy"])
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "metadataComplianceType: musthave")
+
+	pgt.Spec.MetadataComplianceType = ""
+	pgt.Spec.RecordDiff = ""
+	pgt.Spec.SourceFiles = pgt.Spec.SourceFiles[:1]
+	policies, err = pBuilder.Build(pgt)
+	assert.Nil(t, err)
+	content, err = yaml.Marshal(policies["test1/test1-gen-sub-policy"])
+	assert.Nil(t, err)
+	assert.NotContains(t, string(content), "metadataComplianceType")
+	assert.NotContains(t, string(content), "recordDiff")
+}
+
+func TestMetadataComplianceTypeInvalid(t *testing.T) {
+	tests := []struct {
+		spec          string
+		sourceFile    string
+		expectedError string
+	}{{
+		spec:          "metadataComplianceType: mustmatch",
+		expectedError: "Spec: metadataComplianceType 'mustmatch' is not supported, use 'musthave', 'mustonlyhave' or 'mustnothave'",
+	}, {
+		sourceFile:    "recordDiff: Everything",
+		expectedError: "GenericNamespace.yaml: recordDiff 'Everything' is not supported, use 'Log', 'InStatus' or 'None'",
+	}, {
+		sourceFile:    "complianceType: musthav",
+		expectedError: "GenericNamespace.yaml: complianceType 'musthav' is not supported, use 'musthave', 'mustonlyhave' or 'mustnothave'",
+	}, {
+		// ACM accepts the capitalized values
+		spec:       "complianceType: MustOnlyHave",
+		sourceFile: "metadataComplianceType: MustHave",
+	}}
+	for _, test := range tests {
+		input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  ` + test.spec + `
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-sub-policy"
+      ` + test.sourceFile + `
+`
+		pgt := utils.PolicyGenTemplate{}
+		assert.Nil(t, yaml.Unmarshal([]byte(input), &pgt))
+
+		fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+		_, err := NewPolicyBuilder(fHandler).Build(pgt)
+		if test.expectedError == "" {
+			assert.Nil(t, err)
+		} else {
+			assert.EqualError(t, err, test.expectedError)
+		}
+	}
+}
+
 func TestNamespaceRemediationActionDefault(t *testing.T) {
 	input := `
 apiVersion: ran.openshift.io/v1
@@ -1592,6 +1706,7 @@ spec:
   sourceFiles:
     - fileName: GenericSecret.yaml
       policyName: "gen-policy"
+      allowInlineSecrets: true
       stringData:
         stringkey: stringvalue
 `
@@ -1670,3 +1785,1136 @@ spec:
 	}
 
 }
+
+func TestPlacement(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  placementKind: Placement
+  clusterSetBinding: true
+  bindingRules:
+    labelKey1: ""
+    labelKey2: "labelValue2"
+  bindingExcludedRules:
+    labelKey3: ""
+  placementTolerations:
+    - key: cluster.open-cluster-management.io/unreachable
+      operator: Exists
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+`
+	policies, _ := buildTest(t, input)
+	assert.NotContains(t, policies, "test/test-placementrules")
+	assert.Contains(t, policies, "test/test-placement")
+	assert.Contains(t, policies, "test/global")
+	assert.Contains(t, policies, "test/test-placementbinding")
+
+	placement := policies["test/test-placement"].(utils.Placement)
+	assert.Equal(t, "cluster.open-cluster-management.io/v1beta1", placement.ApiVersion)
+	assert.Equal(t, "Placement", placement.Kind)
+	assert.Equal(t, "test", placement.Metadata.Namespace)
+	assert.Equal(t, []string{utils.DefaultClusterSet}, placement.Spec.ClusterSets)
+	assert.Len(t, placement.Spec.Predicates, 1)
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"key":      "labelKey1",
+			"operator": "Exists",
+		},
+		{
+			"key":      "labelKey2",
+			"operator": "In",
+			"values":   []string{"labelValue2"},
+		},
+		{
+			"key":      "labelKey3",
+			"operator": "DoesNotExist",
+		},
+	}, placement.Spec.Predicates[0].RequiredClusterSelector.LabelSelector.MatchExpressions)
+	assert.Equal(t, []utils.Toleration{{Key: "cluster.open-cluster-management.io/unreachable", Operator: "Exists"}},
+		placement.Spec.Tolerations)
+
+	clusterSetBinding := policies["test/global"].(utils.ManagedClusterSetBinding)
+	assert.Equal(t, utils.DefaultClusterSet, clusterSetBinding.Metadata.Name)
+	assert.Equal(t, "test", clusterSetBinding.Metadata.Namespace)
+	assert.Equal(t, utils.DefaultClusterSet, clusterSetBinding.Spec.ClusterSet)
+
+	placementBinding := policies["test/test-placementbinding"].(utils.PlacementBinding)
+	assert.Equal(t, utils.Subject{
+		Name:     "test-placement",
+		Kind:     "Placement",
+		ApiGroup: "cluster.open-cluster-management.io",
+	}, placementBinding.PlacementRef)
+}
+
+func TestPlacementClusterSet(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  placementKind: Placement
+  clusterSet: "ran-sites"
+  bindingRules:
+    labelKey1: ""
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+`
+	policies, _ := buildTest(t, input)
+	assert.NotContains(t, policies, "test/ran-sites")
+
+	placement := policies["test/test-placement"].(utils.Placement)
+	assert.Equal(t, []string{"ran-sites"}, placement.Spec.ClusterSets)
+	assert.Empty(t, placement.Spec.Tolerations)
+}
+
+func TestPlacementInvalid(t *testing.T) {
+	testcases := []struct {
+		input       string
+		expectedErr string
+	}{{
+		input: `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  placementKind: PlacementDecision
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+`,
+		expectedErr: "Invalid placementKind \"PlacementDecision\" found in PGT test",
+	}, {
+		input: `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  placementTolerations:
+    - key: cluster.open-cluster-management.io/unreachable
+      operator: Exists
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+`,
+		expectedErr: "Tolerations are only supported when placementKind is Placement",
+	}, {
+		input: `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  placementKind: Placement
+  placementTolerations:
+    - key: cluster.open-cluster-management.io/unreachable
+      operator: Exists
+      value: "true"
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+`,
+		expectedErr: "Value must be empty when operator is Exists",
+	}}
+	for _, tc := range testcases {
+		pgt := utils.PolicyGenTemplate{}
+		err := yaml.Unmarshal([]byte(tc.input), &pgt)
+		assert.NoError(t, err)
+
+		fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+		pBuilder := NewPolicyBuilder(fHandler)
+		_, err = pBuilder.Build(pgt)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), tc.expectedErr)
+	}
+}
+
+func TestBindingSelector(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    labelKey1: ""
+  bindingSelector:
+    matchLabels:
+      labelKey2: labelValue2
+    matchExpressions:
+      - key: du-profile
+        operator: In
+        values: ["4.16", "4.17"]
+      - key: du-profile
+        operator: NotIn
+        values: ["4.17"]
+      - key: labelKey3
+        operator: DoesNotExist
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+`
+	policies, _ := buildTest(t, input)
+	assert.Contains(t, policies, "test/test-placementrules")
+
+	placementRule := policies["test/test-placementrules"].(utils.PlacementRule)
+	assert.Equal(t, map[string]string{"labelKey2": "labelValue2"}, placementRule.Spec.ClusterSelector.MatchLabels)
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"key":      "labelKey1",
+			"operator": "Exists",
+		},
+		{
+			"key":      "du-profile",
+			"operator": "In",
+			"values":   []string{"4.16", "4.17"},
+		},
+		{
+			"key":      "du-profile",
+			"operator": "NotIn",
+			"values":   []string{"4.17"},
+		},
+		{
+			"key":      "labelKey3",
+			"operator": "DoesNotExist",
+		},
+	}, placementRule.Spec.ClusterSelector.MatchExpressions)
+}
+
+func TestBindingSelectorClaimSelector(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  placementKind: Placement
+  bindingSelector:
+    matchExpressions:
+      - key: group-du-sno
+        operator: Exists
+    claimSelector:
+      matchExpressions:
+        - key: version.openshift.io
+          operator: In
+          values: ["4.16.0"]
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+`
+	policies, _ := buildTest(t, input)
+	assert.Contains(t, policies, "test/test-placement")
+
+	placement := policies["test/test-placement"].(utils.Placement)
+	selector := placement.Spec.Predicates[0].RequiredClusterSelector
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"key":      "group-du-sno",
+			"operator": "Exists",
+		},
+	}, selector.LabelSelector.MatchExpressions)
+	assert.NotNil(t, selector.ClaimSelector)
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"key":      "version.openshift.io",
+			"operator": "In",
+			"values":   []string{"4.16.0"},
+		},
+	}, selector.ClaimSelector.MatchExpressions)
+}
+
+func TestBindingSelectorInvalid(t *testing.T) {
+	testcases := []struct {
+		name        string
+		selector    string
+		expectedErr string
+	}{{
+		name: "unknown operator",
+		selector: `
+    matchExpressions:
+      - key: labelKey1
+        operator: Equals
+        values: ["labelValue1"]`,
+		expectedErr: "Invalid bindingSelector found in PGT test: spec.bindingSelector.matchExpressions[0].operator",
+	}, {
+		name: "values with Exists",
+		selector: `
+    matchExpressions:
+      - key: labelKey1
+        operator: Exists
+        values: ["labelValue1"]`,
+		expectedErr: "spec.bindingSelector.matchExpressions[0].values",
+	}, {
+		name: "conflict with bindingRules",
+		selector: `
+    matchExpressions:
+      - key: labelKey1
+        operator: In
+        values: ["otherValue"]`,
+		expectedErr: "Requirement (labelKey1 In [otherValue]) conflicts with requirement (labelKey1 In [labelValue1])",
+	}, {
+		name: "conflict within bindingSelector",
+		selector: `
+    matchLabels:
+      labelKey2: labelValue2
+    matchExpressions:
+      - key: labelKey2
+        operator: NotIn
+        values: ["labelValue2", "labelValue3"]`,
+		expectedErr: "Requirement (labelKey2 In [labelValue2]) conflicts with requirement (labelKey2 NotIn [labelValue2,labelValue3])",
+	}, {
+		name: "claimSelector with PlacementRule",
+		selector: `
+    claimSelector:
+      matchExpressions:
+        - key: version.openshift.io
+          operator: Exists`,
+		expectedErr: "claimSelector is only supported when placementKind is Placement",
+	}, {
+		name: "unknown field",
+		selector: `
+    matchExpression:
+      - key: labelKey2
+        operator: Exists`,
+		expectedErr: "unknown field \"matchExpression\"",
+	}}
+	for _, tc := range testcases {
+		input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    labelKey1: labelValue1
+  bindingSelector:` + tc.selector + `
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+`
+		pgt := utils.PolicyGenTemplate{}
+		err := yaml.Unmarshal([]byte(input), &pgt)
+		if err == nil {
+			fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+			pBuilder := NewPolicyBuilder(fHandler)
+			_, err = pBuilder.Build(pgt)
+		}
+
+		assert.Error(t, err, tc.name)
+		if err != nil {
+			assert.Contains(t, err.Error(), tc.expectedErr, tc.name)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericTemplatedCR.yaml
+      policyName: "gen-policy"
+      spec:
+        clusterValue: '{{ fromClusterClaim "name" }}'
+        mixedValue: '{{hub .ManagedClusterName hub}}-{{ (lookup "v1" "Secret" "ns" "name").data.key | base64dec }}'
+`
+	policies, _ := buildTest(t, input)
+	objects := extractCRsFromPolicies(t, policies)
+	assert.Len(t, objects, 1)
+
+	spec := objects[0].ObjectDefinition["spec"].(map[string]interface{})
+	// The placeholder without user value is dropped while the templates are kept
+	assert.NotContains(t, spec, "placeholder")
+	assert.Equal(t, `{{hub fromConfigMap "" (printf "%s-values" .ManagedClusterName) "site-value" hub}}`, spec["siteValue"])
+	assert.Equal(t, `{{ fromClusterClaim "name" }}`, spec["clusterValue"])
+
+	policy := policies["test/test-gen-policy"].(utils.AcmPolicy)
+	assert.NotContains(t, policy.Spec.PolicyTemplates[0].ObjDef.Metadata.Annotations, utils.DisableTemplatesAnnotation)
+}
+
+func TestTemplatesInvalid(t *testing.T) {
+	testcases := []struct {
+		value       string
+		expectedErr string
+	}{{
+		value:       `'{{hub fromConfigMap "" "site-values" "value" }}'`,
+		expectedErr: "invalid hub template at spec.value",
+	}, {
+		value:       `'{{ fromConfigMap "" "site-values" "value" hub}}'`,
+		expectedErr: "invalid managed cluster template at spec.value",
+	}, {
+		value:       `'{{hub fromConfigMapp "" "site-values" "value" hub}}'`,
+		expectedErr: "function \"fromConfigMapp\" not defined",
+	}, {
+		value:       `'{{ $labels.instance }}'`,
+		expectedErr: "Set disableTemplates on the sourceFile",
+	}}
+	for _, tc := range testcases {
+		input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericCR.yaml
+      policyName: "gen-policy"
+      spec:
+        value: ` + tc.value + `
+`
+		pgt := utils.PolicyGenTemplate{}
+		err := yaml.Unmarshal([]byte(input), &pgt)
+		assert.NoError(t, err)
+
+		fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+		pBuilder := NewPolicyBuilder(fHandler)
+		_, err = pBuilder.Build(pgt)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), tc.expectedErr)
+	}
+}
+
+func TestTemplatesDisabled(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericCR.yaml
+      policyName: "gen-policy"
+      disableTemplates: true
+      spec:
+        value: '{{ $labels.instance }}'
+`
+	policies, _ := buildTest(t, input)
+	policy := policies["test/test-gen-policy"].(utils.AcmPolicy)
+	assert.Equal(t, "true", policy.Spec.PolicyTemplates[0].ObjDef.Metadata.Annotations[utils.DisableTemplatesAnnotation])
+
+	conflicts := []string{`
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericCR.yaml
+      policyName: "gen-policy"
+      disableTemplates: true
+    - fileName: GenericTemplatedCR.yaml
+      policyName: "gen-policy"
+`, `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericTemplatedCR.yaml
+      policyName: "gen-policy"
+    - fileName: GenericCR.yaml
+      policyName: "gen-policy"
+      disableTemplates: true
+`}
+	expectedErrs := []string{
+		"disableTemplates conflict in ConfigurationPolicy test-gen-policy-config: GenericTemplatedCR.yaml uses ACM templates but templates are disabled by GenericCR.yaml",
+		"disableTemplates conflict in ConfigurationPolicy test-gen-policy-config: GenericTemplatedCR.yaml uses ACM templates but templates are disabled by GenericCR.yaml",
+	}
+	for idx, input := range conflicts {
+		pgt := utils.PolicyGenTemplate{}
+		err := yaml.Unmarshal([]byte(input), &pgt)
+		assert.NoError(t, err)
+
+		fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+		pBuilder := NewPolicyBuilder(fHandler)
+		_, err = pBuilder.Build(pgt)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), expectedErrs[idx])
+	}
+}
+
+func TestTemplatesDisabledSplit(t *testing.T) {
+	// The templates are only disabled in the ConfigurationPolicy holding the
+	// CR of the sourceFile with disableTemplates
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericTemplatedCR.yaml
+      policyName: "gen-policy"
+    - fileName: GenericCR.yaml
+      policyName: "gen-policy"
+      policyTemplateName: "alerts"
+      disableTemplates: true
+      spec:
+        value: '{{ $labels.instance }}'
+`
+	policies, _ := buildTest(t, input)
+	policy := policies["test/test-gen-policy"].(utils.AcmPolicy)
+	assert.Len(t, policy.Spec.PolicyTemplates, 2)
+	assert.Equal(t, "test-gen-policy-config", policy.Spec.PolicyTemplates[0].ObjDef.Metadata.Name)
+	assert.NotContains(t, policy.Spec.PolicyTemplates[0].ObjDef.Metadata.Annotations, utils.DisableTemplatesAnnotation)
+	assert.Equal(t, "test-gen-policy-alerts", policy.Spec.PolicyTemplates[1].ObjDef.Metadata.Name)
+	assert.Equal(t, "true", policy.Spec.PolicyTemplates[1].ObjDef.Metadata.Annotations[utils.DisableTemplatesAnnotation])
+}
+
+func TestTemplatesPlainCRs(t *testing.T) {
+	// The plain CRs are generated verbatim, their templates aren't resolved by ACM
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  sourceFiles:
+    - fileName: GenericCR.yaml
+      spec:
+        value: '{{ $labels.instance }}'
+`
+	policies, _ := buildTest(t, input)
+	assert.Len(t, policies, 1)
+	for _, crs := range policies {
+		spec := crs.([]map[string]interface{})[0]["spec"].(map[string]interface{})
+		assert.Equal(t, "{{ $labels.instance }}", spec["value"])
+	}
+}
+
+func TestPolicySet(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    labelKey1: ""
+  policySet: {}
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy1"
+    - fileName: GenericConfig.yaml
+      policyName: "gen-policy2"
+    - fileName: GenericSubscription.yaml
+      policyName: "gen-policy1"
+`
+	policies, _ := buildTest(t, input)
+	assert.Contains(t, policies, "test/test-gen-policy1")
+	assert.Contains(t, policies, "test/test-gen-policy2")
+	assert.Contains(t, policies, "test/test-policyset")
+
+	policySet := policies["test/test-policyset"].(utils.PolicySet)
+	assert.Equal(t, "policy.open-cluster-management.io/v1beta1", policySet.ApiVersion)
+	assert.Equal(t, "PolicySet", policySet.Kind)
+	assert.Equal(t, "test", policySet.Metadata.Name)
+	assert.Equal(t, "test", policySet.Metadata.Namespace)
+	assert.Equal(t, "Policies generated from PolicyGenTemplate test/test", policySet.Spec.Description)
+	assert.Equal(t, []string{"test-gen-policy1", "test-gen-policy2"}, policySet.Spec.Policies)
+	out, err := yaml.Marshal(policySet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(out), "\nspec:\n    description: Policies generated from PolicyGenTemplate test/test\n")
+
+	placementBinding := policies["test/test-placementbinding"].(utils.PlacementBinding)
+	assert.Equal(t, []utils.Subject{{
+		Name:     "test",
+		Kind:     "PolicySet",
+		ApiGroup: "policy.open-cluster-management.io",
+	}}, placementBinding.Subjects)
+	assert.Equal(t, "test-placementrules", placementBinding.PlacementRef.Name)
+
+	input = `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    labelKey1: ""
+  placementKind: Placement
+  policySet:
+    name: "group-du"
+    description: "DU configuration of the sites"
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy1"
+`
+	policies, _ = buildTest(t, input)
+	policySet = policies["test/group-du-policyset"].(utils.PolicySet)
+	assert.Equal(t, "group-du", policySet.Metadata.Name)
+	assert.Equal(t, "DU configuration of the sites", policySet.Spec.Description)
+	assert.Equal(t, []string{"test-gen-policy1"}, policySet.Spec.Policies)
+
+	placementBinding = policies["test/test-placementbinding"].(utils.PlacementBinding)
+	assert.Equal(t, "group-du", placementBinding.Subjects[0].Name)
+	assert.Equal(t, "test-placement", placementBinding.PlacementRef.Name)
+
+	// Without policySet the policies are bound directly
+	input = `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    labelKey1: ""
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy1"
+`
+	policies, _ = buildTest(t, input)
+	assert.NotContains(t, policies, "test/test-policyset")
+	placementBinding = policies["test/test-placementbinding"].(utils.PlacementBinding)
+	assert.Equal(t, "Policy", placementBinding.Subjects[0].Kind)
+}
+
+func TestWaveDependencies(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    labelKey1: ""
+  waveDependencies: dependencies
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "wave1-policy"
+    - fileName: GenericConfig.yaml
+      policyName: "wave2-policy"
+    - fileName: GenericConfigWithoutWave.yaml
+      policyName: "nowave-policy"
+    - fileName: GenericSubscription.yaml
+      policyName: "wave10-policy"
+      metadata:
+        annotations:
+          ran.openshift.io/ztp-deploy-wave: "10"
+`
+	policies, _ := buildTest(t, input)
+
+	dependency := func(name string) utils.PolicyDependency {
+		return utils.PolicyDependency{
+			ApiVersion: "policy.open-cluster-management.io/v1",
+			Kind:       "Policy",
+			Name:       name,
+			Namespace:  "test",
+			Compliance: "Compliant",
+		}
+	}
+	assert.Empty(t, policies["test/test-wave1-policy"].(utils.AcmPolicy).Spec.Dependencies)
+	assert.Equal(t, []utils.PolicyDependency{dependency("test-wave1-policy")},
+		policies["test/test-wave2-policy"].(utils.AcmPolicy).Spec.Dependencies)
+	assert.Empty(t, policies["test/test-nowave-policy"].(utils.AcmPolicy).Spec.Dependencies)
+	// The wave 10 policy depends on all the lower waves, sorted by wave
+	assert.Equal(t, []utils.PolicyDependency{dependency("test-wave1-policy"), dependency("test-wave2-policy")},
+		policies["test/test-wave10-policy"].(utils.AcmPolicy).Spec.Dependencies)
+
+	input = strings.Replace(input, "waveDependencies: dependencies", "waveDependencies: extraDependencies", 1)
+	policies, _ = buildTest(t, input)
+	policy := policies["test/test-wave2-policy"].(utils.AcmPolicy)
+	assert.Empty(t, policy.Spec.Dependencies)
+	assert.Equal(t, []utils.PolicyDependency{dependency("test-wave1-policy")}, policy.Spec.PolicyTemplates[0].ExtraDependencies)
+
+	// Dependencies are only set on request
+	input = strings.Replace(input, "  waveDependencies: extraDependencies\n", "", 1)
+	policies, _ = buildTest(t, input)
+	policy = policies["test/test-wave2-policy"].(utils.AcmPolicy)
+	assert.Empty(t, policy.Spec.Dependencies)
+	assert.Empty(t, policy.Spec.PolicyTemplates[0].ExtraDependencies)
+}
+
+func TestWaveDependenciesInvalid(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    labelKey1: ""
+  waveDependencies: %s
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "wave-policy"
+      metadata:
+        annotations:
+          ran.openshift.io/ztp-deploy-wave: "%s"
+`
+	pgt := utils.PolicyGenTemplate{}
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+
+	_ = yaml.Unmarshal([]byte(fmt.Sprintf(input, "spec", "1")), &pgt)
+	_, err := NewPolicyBuilder(fHandler).Build(pgt)
+	assert.EqualError(t, err, "waveDependencies 'spec' is not supported, use 'dependencies' or 'extraDependencies'")
+
+	_ = yaml.Unmarshal([]byte(fmt.Sprintf(input, "dependencies", "first")), &pgt)
+	_, err = NewPolicyBuilder(fHandler).Build(pgt)
+	assert.EqualError(t, err, "ran.openshift.io/ztp-deploy-wave annotation of Policy test/test-wave-policy must be an integer: first")
+}
+
+func TestOperatorPolicy(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    labelKey1: ""
+  remediationAction: enforce
+  useOperatorPolicy: true
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "subscriptions-policy"
+    - fileName: GenericOperatorGroup.yaml
+      policyName: "subscriptions-policy"
+    - fileName: GenericSubscription.yaml
+      policyName: "subscriptions-policy"
+      spec:
+        channel: "stable"
+        startingCSV: generic-operator.v4.16.1
+        installPlanApproval: Manual
+      versions:
+        - generic-operator.v4.16.1
+        - generic-operator.v4.16.2
+    - fileName: GenericSubscription.yaml
+      policyName: "operator-policy"
+      metadata:
+        name: other-subscription
+        namespace: other-ns
+      spec:
+        name: other-operator
+      upgradeApproval: Automatic
+`
+	policies, _ := buildTest(t, input)
+
+	// The Namespace stays in the ConfigurationPolicy
+	policy := policies["test/test-subscriptions-policy"].(utils.AcmPolicy)
+	assert.Len(t, policy.Spec.PolicyTemplates, 2)
+	objects := policy.Spec.PolicyTemplates[0].ObjDef.Spec.ObjectTemplates
+	assert.Len(t, objects, 1)
+	assert.Equal(t, "Namespace", objects[0].ObjectDefinition["kind"])
+
+	operatorPolicy := policy.Spec.PolicyTemplates[1].OperatorPolicy
+	assert.NotNil(t, operatorPolicy)
+	assert.Equal(t, "policy.open-cluster-management.io/v1beta1", operatorPolicy.ApiVersion)
+	assert.Equal(t, "OperatorPolicy", operatorPolicy.Kind)
+	assert.Equal(t, "test-subscriptions-policy-generic-operator", operatorPolicy.Metadata.Name)
+	assert.Equal(t, "enforce", operatorPolicy.Spec.RemediationAction)
+	assert.Equal(t, "low", operatorPolicy.Spec.Severity)
+	assert.Equal(t, "musthave", operatorPolicy.Spec.ComplianceType)
+	assert.Equal(t, map[string]interface{}{
+		"name":             "generic-operators",
+		"namespace":        "generic-ns",
+		"targetNamespaces": []interface{}{"generic-ns"},
+	}, operatorPolicy.Spec.OperatorGroup)
+	assert.Equal(t, map[string]interface{}{
+		"channel":         "stable",
+		"name":            "generic-operator",
+		"namespace":       "generic-ns",
+		"source":          "redhat-operators",
+		"sourceNamespace": "openshift-marketplace",
+		"startingCSV":     "generic-operator.v4.16.1",
+	}, operatorPolicy.Spec.Subscription)
+	// Manual install plans keep the upgrades manual
+	assert.Equal(t, "None", operatorPolicy.Spec.UpgradeApproval)
+	assert.Equal(t, []string{"generic-operator.v4.16.1", "generic-operator.v4.16.2"}, operatorPolicy.Spec.Versions)
+
+	// The ConfigurationPolicy is dropped when only the Subscription is left
+	policy = policies["test/test-operator-policy"].(utils.AcmPolicy)
+	assert.Len(t, policy.Spec.PolicyTemplates, 1)
+	operatorPolicy = policy.Spec.PolicyTemplates[0].OperatorPolicy
+	assert.Equal(t, "test-operator-policy-other-operator", operatorPolicy.Metadata.Name)
+	assert.Equal(t, "other-ns", operatorPolicy.Spec.Subscription["namespace"])
+	assert.Nil(t, operatorPolicy.Spec.OperatorGroup)
+	assert.Equal(t, "Automatic", operatorPolicy.Spec.UpgradeApproval)
+
+	// The OperatorPolicy replaces the ConfigurationPolicy in the policy template
+	out, err := yaml.Marshal(policy)
+	assert.Nil(t, err)
+	assert.Contains(t, string(out), "kind: OperatorPolicy")
+	assert.NotContains(t, string(out), "ConfigurationPolicy")
+
+	// Without useOperatorPolicy the Subscriptions stay in the ConfigurationPolicy
+	input = `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    labelKey1: ""
+  sourceFiles:
+    - fileName: GenericSubscription.yaml
+      policyName: "operator-policy"
+`
+	policies, _ = buildTest(t, input)
+	policy = policies["test/test-operator-policy"].(utils.AcmPolicy)
+	assert.Nil(t, policy.Spec.PolicyTemplates[0].OperatorPolicy)
+	assert.Equal(t, "Subscription", policy.Spec.PolicyTemplates[0].ObjDef.Spec.ObjectTemplates[0].ObjectDefinition["kind"])
+}
+
+func TestOperatorPolicyInvalid(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test"
+  namespace: "test"
+spec:
+  bindingRules:
+    labelKey1: ""
+  useOperatorPolicy: %t
+  sourceFiles:
+    - fileName: %s
+      policyName: "operator-policy"
+      upgradeApproval: %s
+`
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	build := func(useOperatorPolicy bool, fileName string, upgradeApproval string) error {
+		pgt := utils.PolicyGenTemplate{}
+		_ = yaml.Unmarshal([]byte(fmt.Sprintf(input, useOperatorPolicy, fileName, upgradeApproval)), &pgt)
+		_, err := NewPolicyBuilder(fHandler).Build(pgt)
+		return err
+	}
+
+	assert.EqualError(t, build(false, "GenericSubscription.yaml", "None"),
+		"GenericSubscription.yaml: upgradeApproval and versions are only supported on Subscription sourceFiles when useOperatorPolicy is set")
+	assert.EqualError(t, build(true, "GenericNamespace.yaml", "None"),
+		"GenericNamespace.yaml: upgradeApproval and versions are only supported on Subscription sourceFiles when useOperatorPolicy is set")
+	assert.EqualError(t, build(true, "GenericSubscription.yaml", "Manual"),
+		"GenericSubscription.yaml: upgradeApproval 'Manual' is not supported, use 'Automatic' or 'None'")
+	assert.Nil(t, build(true, "GenericSubscription.yaml", "None"))
+
+	// The OperatorPolicy name must be a valid object name
+	pgt := utils.PolicyGenTemplate{}
+	_ = yaml.Unmarshal([]byte(fmt.Sprintf(input, true, "GenericSubscription.yaml", "None")), &pgt)
+	pgt.Spec.SourceFiles[0].Spec = map[string]interface{}{"name": strings.Repeat("operator", 32)}
+	_, err := NewPolicyBuilder(fHandler).Build(pgt)
+	assert.ErrorContains(t, err, "OperatorPolicy name 'test-operator-policy-operatoroperator")
+	assert.ErrorContains(t, err, "must be no more than 253 characters")
+}
+
+func TestConvertToOperatorPolicies(t *testing.T) {
+	configPolicy := func(name string, kinds ...string) utils.PolicyObjectDefinition {
+		policyTemplate := utils.PolicyObjectDefinition{}
+		policyTemplate.ObjDef.Kind = configurationPolicyKind
+		policyTemplate.ObjDef.Metadata.Name = name
+		policyTemplate.ObjDef.Spec.Severity = name
+		for _, kind := range kinds {
+			policyTemplate.ObjDef.Spec.ObjectTemplates = append(policyTemplate.ObjDef.Spec.ObjectTemplates, utils.ObjectTemplates{
+				ObjectDefinition: map[string]interface{}{
+					"kind":     kind,
+					"metadata": map[string]interface{}{"name": "generic", "namespace": "generic-ns"},
+				},
+			})
+		}
+		return policyTemplate
+	}
+	subscription := map[string]interface{}{
+		"kind":     subscriptionKind,
+		"metadata": map[string]interface{}{"name": "generic", "namespace": "generic-ns"},
+		"spec":     map[string]interface{}{"name": "generic-operator"},
+	}
+
+	// The Subscription and the OperatorGroup are taken from the
+	// ConfigurationPolicies holding them, whatever their index
+	acmPolicy := utils.AcmPolicy{}
+	acmPolicy.Metadata.Name = "test-policy"
+	acmPolicy.Spec.PolicyTemplates = []utils.PolicyObjectDefinition{
+		configPolicy("test-policy-config", "Namespace", operatorGroupKind),
+		configPolicy("test-policy-operators", subscriptionKind),
+	}
+	err := ConvertToOperatorPolicies(&acmPolicy, []operatorSource{{utils.SourceFile{FileName: "GenericSubscription.yaml"}, subscription}})
+	assert.Nil(t, err)
+	assert.Len(t, acmPolicy.Spec.PolicyTemplates, 2)
+	assert.Equal(t, "test-policy-config", acmPolicy.Spec.PolicyTemplates[0].ObjDef.Metadata.Name)
+	assert.Len(t, acmPolicy.Spec.PolicyTemplates[0].ObjDef.Spec.ObjectTemplates, 1)
+	operatorPolicy := acmPolicy.Spec.PolicyTemplates[1].OperatorPolicy
+	assert.Equal(t, "test-policy-operators", operatorPolicy.Spec.Severity)
+	assert.Equal(t, "generic", operatorPolicy.Spec.OperatorGroup["name"])
+
+	acmPolicy.Spec.PolicyTemplates = []utils.PolicyObjectDefinition{configPolicy("test-policy-config", "Namespace")}
+	err = ConvertToOperatorPolicies(&acmPolicy, []operatorSource{{utils.SourceFile{FileName: "GenericSubscription.yaml"}, subscription}})
+	assert.EqualError(t, err, "GenericSubscription.yaml: the Subscription generic-ns/generic is not in a ConfigurationPolicy of policy test-policy")
+}
+
+func TestConfigPolicyOptions(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  severity: medium
+  pruneObjectBehavior: DeleteIfCreated
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "default-policy"
+    - fileName: GenericPtpConfig.yaml
+      policyName: "ptp-policy"
+    - fileName: GenericConfig.yaml
+      policyName: "ptp-policy"
+      severity: high
+      pruneObjectBehavior: DeleteAll
+      namespaceSelector:
+        include:
+          - openshift-ptp
+        matchExpressions:
+          - key: name
+            operator: In
+            values:
+              - ptp
+`
+	pgt := utils.PolicyGenTemplate{}
+	assert.Nil(t, yaml.Unmarshal([]byte(input), &pgt))
+
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	policies, err := NewPolicyBuilder(fHandler).Build(pgt)
+	assert.Nil(t, err)
+
+	// PGT level values, the default namespaceSelector is kept
+	configPolicy := policies["test1/test1-default-policy"].(utils.AcmPolicy).Spec.PolicyTemplates[0].ObjDef
+	assert.Equal(t, "medium", configPolicy.Spec.Severity)
+	assert.Equal(t, "DeleteIfCreated", configPolicy.Spec.PruneObjectBehavior)
+	assert.Equal(t, utils.NamespaceSelector{Exclude: []string{"kube-*"}, Include: []string{"*"}}, configPolicy.Spec.NamespaceSelector)
+
+	// A sourceFile appended to the policy overrides the PGT values
+	configPolicy = policies["test1/test1-ptp-policy"].(utils.AcmPolicy).Spec.PolicyTemplates[0].ObjDef
+	assert.Equal(t, "high", configPolicy.Spec.Severity)
+	assert.Equal(t, "DeleteAll", configPolicy.Spec.PruneObjectBehavior)
+	assert.Equal(t, []string{"openshift-ptp"}, configPolicy.Spec.NamespaceSelector.Include)
+	assert.Empty(t, configPolicy.Spec.NamespaceSelector.Exclude)
+	assert.Equal(t, []string{"ptp"}, configPolicy.Spec.NamespaceSelector.MatchExpressions[0].Values)
+
+	out, err := yaml.Marshal(configPolicy)
+	assert.Nil(t, err)
+	assert.Contains(t, string(out), "pruneObjectBehavior: DeleteAll\n")
+	assert.Contains(t, string(out), "        matchExpressions:\n            - key: name\n              operator: In\n")
+
+	// The namespaceSelector is decoded strictly through its json tags
+	assert.ErrorContains(t, yaml.Unmarshal([]byte("includes: [a]\n"), &utils.NamespaceSelector{}),
+		`unknown field "includes"`)
+
+	// The pruneObjectBehavior is omitted unless set
+	pgt.Spec.PruneObjectBehavior = ""
+	pgt.Spec.SourceFiles = pgt.Spec.SourceFiles[:1]
+	policies, err = NewPolicyBuilder(fHandler).Build(pgt)
+	assert.Nil(t, err)
+	out, err = yaml.Marshal(policies["test1/test1-default-policy"])
+	assert.Nil(t, err)
+	assert.NotContains(t, string(out), "pruneObjectBehavior")
+	assert.Contains(t, string(out), "severity: medium")
+}
+
+func TestConfigPolicyOptionsConflict(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+      %s
+    - fileName: GenericOperatorGroup.yaml
+      policyName: "gen-policy"
+    - fileName: GenericSubscription.yaml
+      policyName: "gen-policy"
+      %s
+`
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	build := func(first string, last string) error {
+		pgt := utils.PolicyGenTemplate{}
+		assert.Nil(t, yaml.Unmarshal([]byte(fmt.Sprintf(input, first, last)), &pgt))
+		_, err := NewPolicyBuilder(fHandler).Build(pgt)
+		return err
+	}
+
+	assert.EqualError(t, build("severity: high", "severity: critical"),
+		"severity 'critical' conflict with 'high' already configured for policyName gen-policy")
+	assert.EqualError(t, build("pruneObjectBehavior: DeleteAll", "pruneObjectBehavior: None"),
+		"pruneObjectBehavior 'None' conflict with 'DeleteAll' already configured for policyName gen-policy")
+	assert.EqualError(t, build("namespaceSelector: {include: [a]}", "namespaceSelector: {include: [b]}"),
+		"namespaceSelector conflict for policyName gen-policy")
+
+	// The same value, or a single override, doesn't conflict
+	assert.Nil(t, build("severity: high", "severity: high"))
+	assert.Nil(t, build("", "pruneObjectBehavior: DeleteIfCreated"))
+	assert.Nil(t, build("namespaceSelector: {include: [a]}", "namespaceSelector: {include: [a]}"))
+
+	assert.EqualError(t, build("severity: urgent", ""),
+		"GenericNamespace.yaml: severity 'urgent' is not supported, use 'low', 'medium', 'high' or 'critical'")
+	assert.EqualError(t, build("", "pruneObjectBehavior: Delete"),
+		"GenericSubscription.yaml: pruneObjectBehavior 'Delete' is not supported, use 'None', 'DeleteIfCreated' or 'DeleteAll'")
+}
+
+func TestSplitConfigurationPolicies(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  remediationAction: enforce
+  evaluationInterval:
+    compliant: 5m
+  %s
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+    - fileName: GenericOperatorGroup.yaml
+      policyName: "gen-policy"
+    - fileName: GenericSubscription.yaml
+      policyName: "gen-policy"
+      policyTemplateName: "subscription"
+    - fileName: GenericSecret.yaml
+      policyName: "gen-policy"
+`
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	build := func(split string) utils.AcmPolicy {
+		pgt := utils.PolicyGenTemplate{}
+		assert.Nil(t, yaml.Unmarshal([]byte(fmt.Sprintf(input, split)), &pgt))
+		policies, err := NewPolicyBuilder(fHandler).Build(pgt)
+		assert.Nil(t, err)
+		return policies["test1/test1-gen-policy"].(utils.AcmPolicy)
+	}
+	type configPolicy struct {
+		name  string
+		kinds []string
+	}
+	configPolicies := func(policy utils.AcmPolicy) []configPolicy {
+		result := make([]configPolicy, 0)
+		for _, policyTemplate := range policy.Spec.PolicyTemplates {
+			kinds := make([]string, 0)
+			for _, objTemplate := range policyTemplate.ObjDef.Spec.ObjectTemplates {
+				kinds = append(kinds, objTemplate.ObjectDefinition["kind"].(string))
+			}
+			result = append(result, configPolicy{policyTemplate.ObjDef.Metadata.Name, kinds})
+
+			// The split ConfigurationPolicies inherit the policy settings
+			assert.Equal(t, "enforce", policyTemplate.ObjDef.Spec.RemediationAction)
+			assert.Equal(t, "5m", policyTemplate.ObjDef.Spec.EvaluationInterval.Compliant)
+			assert.Equal(t, "10s", policyTemplate.ObjDef.Spec.EvaluationInterval.NonCompliant)
+		}
+		return result
+	}
+
+	// Only the sourceFile with a policyTemplateName by default
+	assert.Equal(t, []configPolicy{
+		{"test1-gen-policy-config", []string{"Namespace", "OperatorGroup", "Secret"}},
+		{"test1-gen-policy-subscription", []string{"Subscription"}},
+	}, configPolicies(build("")))
+
+	assert.Equal(t, []configPolicy{
+		{"test1-gen-policy-config-namespace", []string{"Namespace"}},
+		{"test1-gen-policy-config-operatorgroup", []string{"OperatorGroup"}},
+		{"test1-gen-policy-subscription", []string{"Subscription"}},
+		{"test1-gen-policy-config-secret", []string{"Secret"}},
+	}, configPolicies(build("splitByKind: true")))
+
+	assert.Equal(t, []configPolicy{
+		{"test1-gen-policy-config", []string{"Namespace", "OperatorGroup"}},
+		{"test1-gen-policy-config-2", []string{"Secret"}},
+		{"test1-gen-policy-subscription", []string{"Subscription"}},
+	}, configPolicies(build("maxObjectTemplates: 2")))
+
+	out, err := yaml.Marshal(build("maxObjectTemplates: 2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, strings.Count(string(out), "kind: ConfigurationPolicy"))
+	assert.NotContains(t, string(out), "policyTemplateName")
+}
+
+func TestSplitConfigurationPoliciesInvalid(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  %s
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      %s
+`
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	build := func(spec string, sFile string) error {
+		pgt := utils.PolicyGenTemplate{}
+		assert.Nil(t, yaml.Unmarshal([]byte(fmt.Sprintf(input, spec, sFile)), &pgt))
+		_, err := NewPolicyBuilder(fHandler).Build(pgt)
+		return err
+	}
+
+	assert.EqualError(t, build("maxObjectTemplates: -1", "policyName: gen-policy"),
+		"Spec: maxObjectTemplates must not be negative: -1")
+	assert.EqualError(t, build("", "policyTemplateName: ns"),
+		"GenericNamespace.yaml: policyTemplateName is only supported on sourceFiles wrapped in a policy")
+	assert.EqualError(t, build("wrapInPolicy: false", "policyName: gen-policy\n      policyTemplateName: ns"),
+		"GenericNamespace.yaml: policyTemplateName is only supported on sourceFiles wrapped in a policy")
+	err := build("", "policyName: gen-policy\n      policyTemplateName: Ns_1")
+	assert.ErrorContains(t, err, "GenericNamespace.yaml: policyTemplateName 'Ns_1' is invalid")
+	assert.Nil(t, build("", "policyName: gen-policy\n      policyTemplateName: ns"))
+}
@@ -2,22 +2,32 @@ package policyGen
 
 import (
 	"fmt"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
-func CreatePlacementBinding(name string, namespace string, ruleName string, subjects []utils.Subject) utils.PlacementBinding {
+func CreatePlacementBinding(name string, namespace string, ruleName string, placementKind string, subjects []utils.Subject) utils.PlacementBinding {
 	placementBinding := utils.PlacementBinding{}
 	placementBinding.ApiVersion = "policy.open-cluster-management.io/v1"
 	placementBinding.Kind = "PlacementBinding"
 	placementBinding.Metadata.Name = name + "-placementbinding"
 	placementBinding.Metadata.Namespace = namespace
 	placementBinding.PlacementRef.Name = ruleName
-	placementBinding.PlacementRef.Kind = "PlacementRule"
-	placementBinding.PlacementRef.ApiGroup = "apps.open-cluster-management.io"
+	if placementKind == utils.PlacementKind {
+		placementBinding.PlacementRef.Kind = utils.PlacementKind
+		placementBinding.PlacementRef.ApiGroup = "cluster.open-cluster-management.io"
+	} else {
+		placementBinding.PlacementRef.Kind = utils.PlacementRuleKind
+		placementBinding.PlacementRef.ApiGroup = "apps.open-cluster-management.io"
+	}
 	placementBinding.Subjects = subjects
 
 	return placementBinding
@@ -32,6 +42,35 @@ func CreatePolicySubject(policyName string) utils.Subject {
 	return subject
 }
 
+// CreatePolicySet groups the policies of the PGT in a PolicySet. The
+// description shows in the ACM console and the PolicySet status.
+func CreatePolicySet(pgtName string, namespace string, policySetSpec utils.PolicySetSpec, policyNames []string) utils.PolicySet {
+	policySet := utils.PolicySet{}
+	policySet.ApiVersion = "policy.open-cluster-management.io/v1beta1"
+	policySet.Kind = utils.PolicySetKind
+	policySet.Metadata.Name = policySetSpec.Name
+	if policySet.Metadata.Name == "" {
+		policySet.Metadata.Name = pgtName
+	}
+	policySet.Metadata.Namespace = namespace
+	policySet.Spec.Description = policySetSpec.Description
+	if policySet.Spec.Description == "" {
+		policySet.Spec.Description = fmt.Sprintf("Policies generated from PolicyGenTemplate %s/%s", namespace, pgtName)
+	}
+	policySet.Spec.Policies = policyNames
+
+	return policySet
+}
+
+func CreatePolicySetSubject(policySetName string) utils.Subject {
+	subject := utils.Subject{}
+	subject.ApiGroup = "policy.open-cluster-management.io"
+	subject.Kind = utils.PolicySetKind
+	subject.Name = policySetName
+
+	return subject
+}
+
 /*
 	Func CheckBindindRules checks the following invalid rules:
 
@@ -61,9 +100,28 @@ bindingRules:
 bindingExcludedRules:
 
 	labelKey: "labelValue"
+
+-----------------------
+
+The bindingSelector is validated as a metav1.LabelSelector and each of its
+requirements is checked against the bindingRules, the bindingExcludedRules
+and the other bindingSelector requirements on the same key. Requirements which
+can't be satisfied by any cluster together are rejected, for example:
+
+bindingRules:
+
+	labelKey: "labelValue"
+
+bindingSelector:
+
+	matchExpressions:
+	  - key: labelKey
+	    operator: In
+	    values: ["otherValue"]
 */
 func CheckBindingRules(pgtName string,
-	bindingRules map[string]string, bindingExcludedRules map[string]string) error {
+	bindingRules map[string]string, bindingExcludedRules map[string]string,
+	bindingSelector *utils.BindingSelector) error {
 
 	for key, valueExcludedRules := range bindingExcludedRules {
 		valueRules, found := bindingRules[key]
@@ -73,20 +131,254 @@ func CheckBindingRules(pgtName string,
 				pgtName, key, valueRules, key, valueExcludedRules)
 		}
 	}
+
+	if bindingSelector == nil {
+		return nil
+	}
+
+	selectorPath := field.NewPath("spec", "bindingSelector")
+	opts := metav1validation.LabelSelectorValidationOptions{}
+	errs := metav1validation.ValidateLabelSelector(&bindingSelector.LabelSelector, opts, selectorPath)
+	for idx, requirement := range bindingSelector.ClaimSelector.MatchExpressions {
+		errs = append(errs, metav1validation.ValidateLabelSelectorRequirement(requirement, opts,
+			selectorPath.Child("claimSelector", "matchExpressions").Index(idx))...)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid bindingSelector found in PGT %s: %s", pgtName, errs.ToAggregate())
+	}
+
+	bindingRequirements := bindingRulesAsRequirements(bindingRules, bindingExcludedRules)
+	selectorRequirements := labelSelectorAsRequirements(bindingSelector.LabelSelector)
+	for idx, requirement := range selectorRequirements {
+		for _, other := range append(bindingRequirements, selectorRequirements[idx+1:]...) {
+			if requirementsConflict(requirement, other) {
+				return fmt.Errorf("Invalid bindingSelector found in PGT %s. "+
+					"Requirement (%s) conflicts with requirement (%s), no cluster can match both.",
+					pgtName, requirementDisplay(requirement), requirementDisplay(other))
+			}
+		}
+	}
+
+	claimRequirements := bindingSelector.ClaimSelector.MatchExpressions
+	for idx, requirement := range claimRequirements {
+		for _, other := range claimRequirements[idx+1:] {
+			if requirementsConflict(requirement, other) {
+				return fmt.Errorf("Invalid bindingSelector.claimSelector found in PGT %s. "+
+					"Requirement (%s) conflicts with requirement (%s), no cluster can match both.",
+					pgtName, requirementDisplay(requirement), requirementDisplay(other))
+			}
+		}
+	}
 	return nil
 }
 
+// bindingRulesAsRequirements converts the bindingRules and bindingExcludedRules
+// into the label selector requirements rendered by createMatchExpressions
+func bindingRulesAsRequirements(bindingRules map[string]string, bindingExcludedRules map[string]string) []metav1.LabelSelectorRequirement {
+	requirements := make([]metav1.LabelSelectorRequirement, 0)
+	for _, expression := range createMatchExpressions(bindingRules, bindingExcludedRules) {
+		requirement := metav1.LabelSelectorRequirement{
+			Key:      expression["key"].(string),
+			Operator: metav1.LabelSelectorOperator(expression["operator"].(string)),
+		}
+		if values, ok := expression["values"].([]string); ok {
+			requirement.Values = values
+		}
+		requirements = append(requirements, requirement)
+	}
+	return requirements
+}
+
+// labelSelectorAsRequirements converts matchLabels into In requirements and
+// appends them to the matchExpressions of the selector
+func labelSelectorAsRequirements(selector metav1.LabelSelector) []metav1.LabelSelectorRequirement {
+	requirements := make([]metav1.LabelSelectorRequirement, 0)
+	for _, key := range sortKeys(selector.MatchLabels) {
+		requirements = append(requirements, metav1.LabelSelectorRequirement{
+			Key:      key,
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   []string{selector.MatchLabels[key]},
+		})
+	}
+	return append(requirements, selector.MatchExpressions...)
+}
+
+// requirementsConflict returns true when no set of labels can satisfy both requirements
+func requirementsConflict(a metav1.LabelSelectorRequirement, b metav1.LabelSelectorRequirement) bool {
+	if a.Key != b.Key {
+		return false
+	}
+	requiresLabel := func(r metav1.LabelSelectorRequirement) bool {
+		return r.Operator == metav1.LabelSelectorOpExists || r.Operator == metav1.LabelSelectorOpIn
+	}
+	switch {
+	case a.Operator == metav1.LabelSelectorOpDoesNotExist:
+		return requiresLabel(b)
+	case b.Operator == metav1.LabelSelectorOpDoesNotExist:
+		return requiresLabel(a)
+	case a.Operator == metav1.LabelSelectorOpIn && b.Operator == metav1.LabelSelectorOpIn:
+		return !containsAny(a.Values, b.Values)
+	case a.Operator == metav1.LabelSelectorOpIn && b.Operator == metav1.LabelSelectorOpNotIn:
+		return containsAll(b.Values, a.Values)
+	case a.Operator == metav1.LabelSelectorOpNotIn && b.Operator == metav1.LabelSelectorOpIn:
+		return containsAll(a.Values, b.Values)
+	}
+	return false
+}
+
+func containsAny(values []string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if containsAll(values, []string{candidate}) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(values []string, candidates []string) bool {
+	for _, candidate := range candidates {
+		found := false
+		for _, value := range values {
+			if value == candidate {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func requirementDisplay(requirement metav1.LabelSelectorRequirement) string {
+	if len(requirement.Values) == 0 {
+		return fmt.Sprintf("%s %s", requirement.Key, requirement.Operator)
+	}
+	return fmt.Sprintf("%s %s [%s]", requirement.Key, requirement.Operator, strings.Join(requirement.Values, ","))
+}
+
 func CreatePlacementRule(name string, namespace string,
-	bindingRules map[string]string, bindingExcludedRules map[string]string) utils.PlacementRule {
+	bindingRules map[string]string, bindingExcludedRules map[string]string,
+	bindingSelector *utils.BindingSelector) utils.PlacementRule {
 
 	placementRule := utils.PlacementRule{}
 	placementRule.ApiVersion = "apps.open-cluster-management.io/v1"
-	placementRule.Kind = "PlacementRule"
+	placementRule.Kind = utils.PlacementRuleKind
 	placementRule.Metadata.Name = name + "-placementrules"
 	placementRule.Metadata.Namespace = namespace
+	placementRule.Spec.ClusterSelector = createClusterSelector(bindingRules, bindingExcludedRules, bindingSelector)
+
+	return placementRule
+}
+
+// CreatePlacement builds a cluster.open-cluster-management.io Placement which
+// selects the same clusters as the PlacementRule built from the binding rules.
+// The Placement only considers clusters in the given ManagedClusterSet.
+func CreatePlacement(name string, namespace string, clusterSet string,
+	bindingRules map[string]string, bindingExcludedRules map[string]string,
+	bindingSelector *utils.BindingSelector, tolerations []utils.Toleration) utils.Placement {
+
+	placement := utils.Placement{}
+	placement.ApiVersion = "cluster.open-cluster-management.io/v1beta1"
+	placement.Kind = utils.PlacementKind
+	placement.Metadata.Name = name + "-placement"
+	placement.Metadata.Namespace = namespace
+	placement.Spec.ClusterSets = []string{clusterSet}
+
+	predicate := utils.PlacementPredicate{}
+	predicate.RequiredClusterSelector.LabelSelector = createClusterSelector(bindingRules, bindingExcludedRules, bindingSelector)
+	if bindingSelector != nil && len(bindingSelector.ClaimSelector.MatchExpressions) > 0 {
+		predicate.RequiredClusterSelector.ClaimSelector = &utils.ClusterSelector{
+			MatchExpressions: createSelectorExpressions(bindingSelector.ClaimSelector.MatchExpressions),
+		}
+	}
+	placement.Spec.Predicates = []utils.PlacementPredicate{predicate}
+	placement.Spec.Tolerations = tolerations
+
+	return placement
+}
+
+// CreateManagedClusterSetBinding builds the ManagedClusterSetBinding which
+// makes the ManagedClusterSet available to Placements in the given namespace.
+// The name of the binding must match the name of the ManagedClusterSet.
+func CreateManagedClusterSetBinding(namespace string, clusterSet string) utils.ManagedClusterSetBinding {
+	binding := utils.ManagedClusterSetBinding{}
+	binding.ApiVersion = "cluster.open-cluster-management.io/v1beta2"
+	binding.Kind = "ManagedClusterSetBinding"
+	binding.Metadata.Name = clusterSet
+	binding.Metadata.Namespace = namespace
+	binding.Spec.ClusterSet = clusterSet
+
+	return binding
+}
+
+// CheckPlacement validates the placement related settings of the PGT spec
+func CheckPlacement(pgtName string, spec utils.PolicyGenTempSpec) error {
+	switch spec.PlacementKind {
+	case utils.PlacementKind:
+		for _, toleration := range spec.PlacementTolerations {
+			if toleration.Operator != "" && toleration.Operator != "Exists" && toleration.Operator != "Equal" {
+				return fmt.Errorf("Invalid placementTolerations found in PGT %s. Unsupported operator \"%s\" for key \"%s\"",
+					pgtName, toleration.Operator, toleration.Key)
+			}
+			if toleration.Operator == "Exists" && toleration.Value != "" {
+				return fmt.Errorf("Invalid placementTolerations found in PGT %s. Value must be empty when operator is Exists for key \"%s\"",
+					pgtName, toleration.Key)
+			}
+		}
+	case "", utils.PlacementRuleKind:
+		if len(spec.PlacementTolerations) > 0 {
+			return fmt.Errorf("Invalid placementTolerations found in PGT %s. Tolerations are only supported when placementKind is %s",
+				pgtName, utils.PlacementKind)
+		}
+		if spec.BindingSelector != nil && len(spec.BindingSelector.ClaimSelector.MatchExpressions) > 0 {
+			return fmt.Errorf("Invalid bindingSelector found in PGT %s. claimSelector is only supported when placementKind is %s",
+				pgtName, utils.PlacementKind)
+		}
+	default:
+		return fmt.Errorf("Invalid placementKind \"%s\" found in PGT %s. Supported values are %s and %s",
+			spec.PlacementKind, pgtName, utils.PlacementRuleKind, utils.PlacementKind)
+	}
+	return nil
+}
+
+// createClusterSelector renders the bindingRules and bindingExcludedRules
+// followed by the bindingSelector requirements into a single selector
+func createClusterSelector(bindingRules map[string]string, bindingExcludedRules map[string]string,
+	bindingSelector *utils.BindingSelector) utils.ClusterSelector {
+
+	selector := utils.ClusterSelector{}
+	selector.MatchExpressions = createMatchExpressions(bindingRules, bindingExcludedRules)
+	if bindingSelector != nil {
+		if len(bindingSelector.LabelSelector.MatchLabels) > 0 {
+			selector.MatchLabels = bindingSelector.LabelSelector.MatchLabels
+		}
+		selector.MatchExpressions = append(selector.MatchExpressions,
+			createSelectorExpressions(bindingSelector.LabelSelector.MatchExpressions)...)
+	}
+	return selector
+}
+
+// createSelectorExpressions renders the requirements in the order given by the user
+func createSelectorExpressions(requirements []metav1.LabelSelectorRequirement) []map[string]interface{} {
+	expressions := make([]map[string]interface{}, 0)
+	for _, requirement := range requirements {
+		expression := make(map[string]interface{})
+		expression["key"] = requirement.Key
+		expression["operator"] = string(requirement.Operator)
+		if len(requirement.Values) > 0 {
+			expression["values"] = requirement.Values
+		}
+		expressions = append(expressions, expression)
+	}
+	return expressions
+}
+
+func createMatchExpressions(bindingRules map[string]string, bindingExcludedRules map[string]string) []map[string]interface{} {
 	expressions := make([]map[string]interface{}, 0)
 
-	// Sort bindingRules to ensure consistent ordering of generated PlacementRules
+	// Sort bindingRules to ensure consistent ordering of generated placements
 	bindingRulesKeys := sortKeys(bindingRules)
 
 	for _, key := range bindingRulesKeys {
@@ -102,7 +394,7 @@ func CreatePlacementRule(name string, namespace string,
 		expressions = append(expressions, expression)
 	}
 
-	// Sort bindingExcludedRules to ensure consistent ordering of generated PlacementRules
+	// Sort bindingExcludedRules to ensure consistent ordering of generated placements
 	bindingExcludedRulesKeys := sortKeys(bindingExcludedRules)
 
 	for _, key := range bindingExcludedRulesKeys {
@@ -118,9 +410,7 @@ func CreatePlacementRule(name string, namespace string,
 		expressions = append(expressions, expression)
 	}
 
-	placementRule.Spec.ClusterSelector.MatchExpressions = expressions
-
-	return placementRule
+	return expressions
 }
 
 func CheckNameLength(namespace string, name string) error {
@@ -148,6 +438,18 @@ func BuildObjectTemplate(resource generatedCR) utils.ObjectTemplates {
 		complianceType = resource.pgtSourceFile.ComplianceType
 	}
 	objTemplate.ComplianceType = complianceType
+
+	// The metadataComplianceType applies to the labels and annotations only, so
+	// that the spec can be enforced with mustonlyhave while tolerating the
+	// metadata added by OLM and other controllers
+	objTemplate.MetadataComplianceType = resource.globalMetadataComplianceType
+	if resource.pgtSourceFile.MetadataComplianceType != "" {
+		objTemplate.MetadataComplianceType = resource.pgtSourceFile.MetadataComplianceType
+	}
+	objTemplate.RecordDiff = resource.globalRecordDiff
+	if resource.pgtSourceFile.RecordDiff != "" {
+		objTemplate.RecordDiff = resource.pgtSourceFile.RecordDiff
+	}
 	objTemplate.ObjectDefinition = resource.builtCR
 
 	return objTemplate
@@ -201,6 +503,216 @@ func waveDisplay(wave string) string {
 	return wave
 }
 
+// CheckWaveDependencies validates the field the wave dependencies are set in
+func CheckWaveDependencies(waveDependencies string) error {
+	if waveDependencies != "" && waveDependencies != utils.WaveDependencies && waveDependencies != utils.WaveExtraDependencies {
+		return fmt.Errorf("waveDependencies '%s' is not supported, use '%s' or '%s'",
+			waveDependencies, utils.WaveDependencies, utils.WaveExtraDependencies)
+	}
+	return nil
+}
+
+// SetWaveDependencies translates the ztp-deploy-wave of the policies into ACM
+// policy dependencies, for rollouts which are not ordered by TALM. Each policy
+// depends on the compliance of all the given policies of a lower wave. The
+// dependencies are set in the policy spec.dependencies, or in the
+// extraDependencies of each of its policy templates. Policies without wave
+// neither depend on nor are a dependency of any other policy.
+func SetWaveDependencies(policies []*utils.AcmPolicy, waveDependencies string) error {
+	if err := CheckWaveDependencies(waveDependencies); err != nil {
+		return err
+	}
+
+	type wavedPolicy struct {
+		wave   int
+		policy *utils.AcmPolicy
+	}
+	waved := make([]wavedPolicy, 0, len(policies))
+	for _, policy := range policies {
+		wave, found := policy.Metadata.Annotations[utils.ZtpDeployWaveAnnotation]
+		if !found {
+			continue
+		}
+		waveValue, err := strconv.Atoi(wave)
+		if err != nil {
+			return fmt.Errorf("%s annotation of Policy %s/%s must be an integer: %s",
+				utils.ZtpDeployWaveAnnotation, policy.Metadata.Namespace, policy.Metadata.Name, wave)
+		}
+		waved = append(waved, wavedPolicy{waveValue, policy})
+	}
+	// Order the dependencies by wave, then by namespace and name
+	sort.SliceStable(waved, func(i, j int) bool {
+		if waved[i].wave != waved[j].wave {
+			return waved[i].wave < waved[j].wave
+		}
+		if waved[i].policy.Metadata.Namespace != waved[j].policy.Metadata.Namespace {
+			return waved[i].policy.Metadata.Namespace < waved[j].policy.Metadata.Namespace
+		}
+		return waved[i].policy.Metadata.Name < waved[j].policy.Metadata.Name
+	})
+
+	for _, dependent := range waved {
+		var dependencies []utils.PolicyDependency
+		for _, dependency := range waved {
+			if dependency.wave >= dependent.wave {
+				break
+			}
+			dependencies = append(dependencies, utils.PolicyDependency{
+				ApiVersion: "policy.open-cluster-management.io/v1",
+				Kind:       "Policy",
+				Name:       dependency.policy.Metadata.Name,
+				Namespace:  dependency.policy.Metadata.Namespace,
+				Compliance: "Compliant",
+			})
+		}
+		// Replace the dependencies previously set in either field
+		dependent.policy.Spec.Dependencies = nil
+		for idx := range dependent.policy.Spec.PolicyTemplates {
+			dependent.policy.Spec.PolicyTemplates[idx].ExtraDependencies = nil
+			if waveDependencies == utils.WaveExtraDependencies {
+				dependent.policy.Spec.PolicyTemplates[idx].ExtraDependencies = dependencies
+			}
+		}
+		if waveDependencies == utils.WaveDependencies {
+			dependent.policy.Spec.Dependencies = dependencies
+		}
+	}
+	return nil
+}
+
+// SetConfigPolicyOptions sets the severity, namespaceSelector and
+// pruneObjectBehavior of the ConfigurationPolicy of a new policy, the
+// sourceFile values overriding the PGT ones
+func SetConfigPolicyOptions(acmPolicy *utils.AcmPolicy, spec utils.PolicyGenTempSpec, sFile utils.SourceFile) error {
+	if err := validateSeverity(spec.Severity); err != nil {
+		return fmt.Errorf("Spec: %s", err)
+	}
+	if err := validatePruneObjectBehavior(spec.PruneObjectBehavior); err != nil {
+		return fmt.Errorf("Spec: %s", err)
+	}
+	configPolicySpec := &acmPolicy.Spec.PolicyTemplates[0].ObjDef.Spec
+	if spec.Severity != "" {
+		configPolicySpec.Severity = spec.Severity
+	}
+	if spec.NamespaceSelector != nil {
+		configPolicySpec.NamespaceSelector = *spec.NamespaceSelector
+	}
+	configPolicySpec.PruneObjectBehavior = spec.PruneObjectBehavior
+	return MergeConfigPolicyOptions(acmPolicy, spec, sFile)
+}
+
+// MergeConfigPolicyOptions sets the severity, namespaceSelector and
+// pruneObjectBehavior of the sourceFile on the ConfigurationPolicy of its
+// policy. A value conflicts with the one of a previous sourceFile of the
+// policy when it overrides the PGT value differently.
+func MergeConfigPolicyOptions(acmPolicy *utils.AcmPolicy, spec utils.PolicyGenTempSpec, sFile utils.SourceFile) error {
+	configPolicySpec := &acmPolicy.Spec.PolicyTemplates[0].ObjDef.Spec
+	// PGT level values the sourceFiles may override
+	pgtSeverity := spec.Severity
+	if pgtSeverity == "" {
+		pgtSeverity = utils.DefaultSeverity
+	}
+	pgtNamespaceSelector := defaultNamespaceSelector()
+	if spec.NamespaceSelector != nil {
+		pgtNamespaceSelector = *spec.NamespaceSelector
+	}
+
+	if sFile.Severity != utils.UnsetStringValue && sFile.Severity != "" {
+		if err := validateSeverity(sFile.Severity); err != nil {
+			return fmt.Errorf("%s: %s", sFile.FileName, err)
+		}
+		if sFile.Severity != configPolicySpec.Severity && configPolicySpec.Severity != pgtSeverity {
+			return fmt.Errorf("severity '%s' conflict with '%s' already configured for policyName %s",
+				sFile.Severity, configPolicySpec.Severity, sFile.PolicyName)
+		}
+		configPolicySpec.Severity = sFile.Severity
+	}
+	if sFile.NamespaceSelector != nil {
+		if !reflect.DeepEqual(*sFile.NamespaceSelector, configPolicySpec.NamespaceSelector) &&
+			!reflect.DeepEqual(configPolicySpec.NamespaceSelector, pgtNamespaceSelector) {
+			return fmt.Errorf("namespaceSelector conflict for policyName %s", sFile.PolicyName)
+		}
+		configPolicySpec.NamespaceSelector = *sFile.NamespaceSelector
+	}
+	if sFile.PruneObjectBehavior != utils.UnsetStringValue && sFile.PruneObjectBehavior != "" {
+		if err := validatePruneObjectBehavior(sFile.PruneObjectBehavior); err != nil {
+			return fmt.Errorf("%s: %s", sFile.FileName, err)
+		}
+		if sFile.PruneObjectBehavior != configPolicySpec.PruneObjectBehavior && configPolicySpec.PruneObjectBehavior != spec.PruneObjectBehavior {
+			return fmt.Errorf("pruneObjectBehavior '%s' conflict with '%s' already configured for policyName %s",
+				sFile.PruneObjectBehavior, configPolicySpec.PruneObjectBehavior, sFile.PolicyName)
+		}
+		configPolicySpec.PruneObjectBehavior = sFile.PruneObjectBehavior
+	}
+	return nil
+}
+
+// CheckObjectTemplateOptions validates the complianceType, metadataComplianceType
+// and recordDiff of the object templates, set in the PGT spec or the sourceFiles
+func CheckObjectTemplateOptions(spec utils.PolicyGenTempSpec) error {
+	if err := validateComplianceType("complianceType", spec.ComplianceType); err != nil {
+		return fmt.Errorf("Spec: %s", err)
+	}
+	if err := validateComplianceType("metadataComplianceType", spec.MetadataComplianceType); err != nil {
+		return fmt.Errorf("Spec: %s", err)
+	}
+	if err := validateRecordDiff(spec.RecordDiff); err != nil {
+		return fmt.Errorf("Spec: %s", err)
+	}
+	for _, sFile := range spec.SourceFiles {
+		if sFile.ComplianceType != utils.UnsetStringValue {
+			if err := validateComplianceType("complianceType", sFile.ComplianceType); err != nil {
+				return fmt.Errorf("%s: %s", sFile.FileName, err)
+			}
+		}
+		if err := validateComplianceType("metadataComplianceType", sFile.MetadataComplianceType); err != nil {
+			return fmt.Errorf("%s: %s", sFile.FileName, err)
+		}
+		if err := validateRecordDiff(sFile.RecordDiff); err != nil {
+			return fmt.Errorf("%s: %s", sFile.FileName, err)
+		}
+	}
+	return nil
+}
+
+func validateComplianceType(field string, complianceType string) error {
+	// ACM accepts the capitalized values, such as MustHave
+	switch strings.ToLower(complianceType) {
+	case "", "musthave", "mustonlyhave", "mustnothave":
+		return nil
+	}
+	return fmt.Errorf("%s '%s' is not supported, use 'musthave', 'mustonlyhave' or 'mustnothave'", field, complianceType)
+}
+
+func validateRecordDiff(recordDiff string) error {
+	switch recordDiff {
+	case "", "Log", "InStatus", "None":
+		return nil
+	}
+	return fmt.Errorf("recordDiff '%s' is not supported, use 'Log', 'InStatus' or 'None'", recordDiff)
+}
+
+// defaultNamespaceSelector returns the namespaceSelector of the acmPolicyTemplate
+func defaultNamespaceSelector() utils.NamespaceSelector {
+	return utils.NamespaceSelector{Exclude: []string{"kube-*"}, Include: []string{"*"}}
+}
+
+func validateSeverity(severity string) error {
+	switch severity {
+	case "", "low", "medium", "high", "critical":
+		return nil
+	}
+	return fmt.Errorf("severity '%s' is not supported, use 'low', 'medium', 'high' or 'critical'", severity)
+}
+
+func validatePruneObjectBehavior(pruneObjectBehavior string) error {
+	switch pruneObjectBehavior {
+	case "", "None", "DeleteIfCreated", "DeleteAll":
+		return nil
+	}
+	return fmt.Errorf("pruneObjectBehavior '%s' is not supported, use 'None', 'DeleteIfCreated' or 'DeleteAll'", pruneObjectBehavior)
+}
+
 func validateInterval(interval string) error {
 	if interval == utils.DisableEvaluationInterval || interval == utils.WatchEvaluationInterval {
 		return nil
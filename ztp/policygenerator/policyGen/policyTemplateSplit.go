@@ -0,0 +1,139 @@
+package policyGen
+
+import (
+	"fmt"
+	"strings"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const configurationPolicyKind = "ConfigurationPolicy"
+
+// CheckPolicyTemplateSplit validates the settings splitting the
+// ConfigurationPolicies of the PGT
+func CheckPolicyTemplateSplit(spec utils.PolicyGenTempSpec) error {
+	if spec.MaxObjectTemplates < 0 {
+		return fmt.Errorf("Spec: maxObjectTemplates must not be negative: %d", spec.MaxObjectTemplates)
+	}
+	for _, sFile := range spec.SourceFiles {
+		if sFile.PolicyTemplateName == "" {
+			continue
+		}
+		if !spec.WrapInPolicy || sFile.PolicyName == "" {
+			return fmt.Errorf("%s: policyTemplateName is only supported on sourceFiles wrapped in a policy", sFile.FileName)
+		}
+		if errs := validation.IsDNS1123Label(sFile.PolicyTemplateName); len(errs) > 0 {
+			return fmt.Errorf("%s: policyTemplateName '%s' is invalid: %s", sFile.FileName, sFile.PolicyTemplateName, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// SplitConfigurationPolicies splits the ConfigurationPolicies of the policy
+// into several policy templates. The object templates of the sourceFiles with
+// a policyTemplateName go to the <policy>-<policyTemplateName>
+// ConfigurationPolicy. With splitByKind the other object templates go to a
+// <policy>-config-<kind> ConfigurationPolicy per kind. Each resulting
+// ConfigurationPolicy is then split in chunks of maxObjectTemplates, suffixed
+// by their index from the second one. The split ConfigurationPolicies inherit
+// all the settings of the original one, such as the remediationAction and
+// evaluationInterval.
+func (pbuilder *PolicyBuilder) SplitConfigurationPolicies(acmPolicy *utils.AcmPolicy, splitByKind bool, maxObjectTemplates int) error {
+	policyTemplates := make([]utils.PolicyObjectDefinition, 0, len(acmPolicy.Spec.PolicyTemplates))
+	for _, policyTemplate := range acmPolicy.Spec.PolicyTemplates {
+		if !isConfigurationPolicy(policyTemplate) {
+			policyTemplates = append(policyTemplates, policyTemplate)
+			continue
+		}
+
+		// Group the object templates by ConfigurationPolicy name, in the order
+		// they first appear
+		names := make([]string, 0, 1)
+		groups := make(map[string][]utils.ObjectTemplates)
+		for _, objTemplate := range policyTemplate.ObjDef.Spec.ObjectTemplates {
+			name := policyTemplate.ObjDef.Metadata.Name
+			if policyTemplateName := pbuilder.objectSource(objTemplate).pgtSourceFile.PolicyTemplateName; policyTemplateName != "" {
+				name = acmPolicy.Metadata.Name + "-" + policyTemplateName
+			} else if splitByKind {
+				kind, _ := objTemplate.ObjectDefinition["kind"].(string)
+				name = name + "-" + strings.ToLower(kind)
+			}
+			if _, found := groups[name]; !found {
+				names = append(names, name)
+			}
+			groups[name] = append(groups[name], objTemplate)
+		}
+
+		for _, name := range names {
+			objTemplates := groups[name]
+			for chunk := 0; len(objTemplates) > 0; chunk++ {
+				size := len(objTemplates)
+				if maxObjectTemplates > 0 && size > maxObjectTemplates {
+					size = maxObjectTemplates
+				}
+				chunkName := name
+				if chunk > 0 {
+					chunkName = fmt.Sprintf("%s-%d", name, chunk+1)
+				}
+				if errs := validation.IsDNS1123Subdomain(chunkName); len(errs) > 0 {
+					return fmt.Errorf("ConfigurationPolicy name '%s' of policy %s is invalid: %s",
+						chunkName, acmPolicy.Metadata.Name, strings.Join(errs, ", "))
+				}
+				copied := copyConfigurationPolicy(policyTemplate, chunkName, objTemplates[:size])
+				if err := pbuilder.setDisableTemplates(&copied); err != nil {
+					return err
+				}
+				policyTemplates = append(policyTemplates, copied)
+				objTemplates = objTemplates[size:]
+			}
+		}
+	}
+	acmPolicy.Spec.PolicyTemplates = policyTemplates
+	return nil
+}
+
+// setDisableTemplates disables the ACM template processing of the
+// ConfigurationPolicy when one of its objects comes from a sourceFile with
+// disableTemplates. The templates can't be disabled for a ConfigurationPolicy
+// holding objects which rely on them.
+func (pbuilder *PolicyBuilder) setDisableTemplates(policyTemplate *utils.PolicyObjectDefinition) error {
+	disabledBy, templatedBy := "", ""
+	for _, objTemplate := range policyTemplate.ObjDef.Spec.ObjectTemplates {
+		source := pbuilder.objectSource(objTemplate)
+		if source.pgtSourceFile.DisableTemplates && disabledBy == "" {
+			disabledBy = source.pgtSourceFile.FileName
+		}
+		if source.templated && templatedBy == "" {
+			templatedBy = source.pgtSourceFile.FileName
+		}
+	}
+	if disabledBy == "" {
+		return nil
+	}
+	if templatedBy != "" {
+		return fmt.Errorf("disableTemplates conflict in ConfigurationPolicy %s: %s uses ACM templates but templates are disabled by %s",
+			policyTemplate.ObjDef.Metadata.Name, templatedBy, disabledBy)
+	}
+	if policyTemplate.ObjDef.Metadata.Annotations == nil {
+		policyTemplate.ObjDef.Metadata.Annotations = make(map[string]string)
+	}
+	policyTemplate.ObjDef.Metadata.Annotations[utils.DisableTemplatesAnnotation] = "true"
+	return nil
+}
+
+// copyConfigurationPolicy returns a copy of the policy template with the given
+// name and object templates
+func copyConfigurationPolicy(policyTemplate utils.PolicyObjectDefinition, name string, objTemplates []utils.ObjectTemplates) utils.PolicyObjectDefinition {
+	copied := policyTemplate
+	copied.ObjDef.Metadata.Name = name
+	if policyTemplate.ObjDef.Metadata.Annotations != nil {
+		copied.ObjDef.Metadata.Annotations = make(map[string]string, len(policyTemplate.ObjDef.Metadata.Annotations))
+		for key, value := range policyTemplate.ObjDef.Metadata.Annotations {
+			copied.ObjDef.Metadata.Annotations[key] = value
+		}
+	}
+	copied.ObjDef.Spec.ObjectTemplates = append([]utils.ObjectTemplates{}, objTemplates...)
+	copied.ExtraDependencies = append([]utils.PolicyDependency(nil), policyTemplate.ExtraDependencies...)
+	return copied
+}
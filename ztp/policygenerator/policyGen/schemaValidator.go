@@ -0,0 +1,160 @@
+package policyGen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/pruning"
+	apiservervalidation "k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+)
+
+// SchemaValidator validates the CRs built from the PGT sourceFiles against the
+// OpenAPI schemas of their CustomResourceDefinitions, the same way the API
+// server would once the CRs are applied on the managed cluster.
+type SchemaValidator struct {
+	schemas            map[string]*crdSchema
+	allowUnknownFields bool
+}
+
+type crdSchema struct {
+	structural *structuralschema.Structural
+	validator  apiservervalidation.SchemaValidator
+}
+
+// NewSchemaValidator loads the CustomResourceDefinitions found in the yaml
+// files of schemaDir. Unknown fields in the validated CRs are reported as
+// errors unless allowUnknownFields is set.
+func NewSchemaValidator(schemaDir string, allowUnknownFields bool) (*SchemaValidator, error) {
+	validator := &SchemaValidator{schemas: make(map[string]*crdSchema), allowUnknownFields: allowUnknownFields}
+
+	err := filepath.WalkDir(schemaDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := validator.loadCRDs(content); err != nil {
+			return fmt.Errorf("could not load CustomResourceDefinition from %s: %s", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(validator.schemas) == 0 {
+		return nil, errors.New("no CustomResourceDefinition found in " + schemaDir)
+	}
+	return validator, nil
+}
+
+func (validator *SchemaValidator) loadCRDs(content []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		doc := make(map[string]interface{})
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if doc["kind"] != "CustomResourceDefinition" {
+			continue
+		}
+
+		// The apiextensions types only carry json tags
+		crd := apiextensionsv1.CustomResourceDefinition{}
+		if err := decodeJSON(doc, &crd); err != nil {
+			return err
+		}
+		for _, version := range crd.Spec.Versions {
+			if version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
+				continue
+			}
+			internal := &apiextensions.JSONSchemaProps{}
+			if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(
+				version.Schema.OpenAPIV3Schema, internal, nil); err != nil {
+				return err
+			}
+			structural, err := structuralschema.NewStructural(internal)
+			if err != nil {
+				return fmt.Errorf("%s/%s is not a structural schema: %s", crd.Name, version.Name, err)
+			}
+			schemaValidator, _, err := apiservervalidation.NewSchemaValidator(internal)
+			if err != nil {
+				return err
+			}
+			apiVersion := crd.Spec.Group + "/" + version.Name
+			validator.schemas[schemaKey(apiVersion, crd.Spec.Names.Kind)] = &crdSchema{
+				structural: structural,
+				validator:  schemaValidator,
+			}
+		}
+	}
+}
+
+// Validate returns the schema violations of the CR, each prefixed with the
+// JSON path of the offending field. CRs without a loaded schema are not
+// validated. Values holding ACM templates are only resolved once the policy
+// is applied, so their violations are ignored.
+func (validator *SchemaValidator) Validate(resource map[string]interface{}) []string {
+	apiVersion, _ := resource["apiVersion"].(string)
+	kind, _ := resource["kind"].(string)
+	schema, found := validator.schemas[schemaKey(apiVersion, kind)]
+	if !found {
+		return nil
+	}
+
+	// Validate a JSON copy of the CR, pruning modifies the object in place and
+	// the validators expect the JSON data types
+	var obj interface{}
+	if err := decodeJSON(resource, &obj); err != nil {
+		return []string{err.Error()}
+	}
+
+	violations := make([]string, 0)
+	if !validator.allowUnknownFields {
+		unknownFields := pruning.PruneWithOptions(obj, schema.structural, true,
+			structuralschema.UnknownFieldPathOptions{TrackUnknownFieldPaths: true})
+		for _, unknownField := range unknownFields {
+			violations = append(violations, unknownField+": unknown field")
+		}
+	}
+	templated := templatePaths(resource, "", make(map[string]bool))
+	for _, fieldErr := range apiservervalidation.ValidateCustomResource(nil, obj, schema.validator) {
+		if templated[fieldErr.Field] {
+			continue
+		}
+		violations = append(violations, fieldErr.Error())
+	}
+	return violations
+}
+
+func schemaKey(apiVersion string, kind string) string {
+	return strings.Join([]string{apiVersion, kind}, ", Kind=")
+}
+
+func decodeJSON(in interface{}, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
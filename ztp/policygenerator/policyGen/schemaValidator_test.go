@@ -0,0 +1,99 @@
+package policyGen
+
+import (
+	"testing"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func buildWithSchemas(t *testing.T, input string, allowUnknownFields bool) (map[string]interface{}, error) {
+	pgt := utils.PolicyGenTemplate{}
+	err := yaml.Unmarshal([]byte(input), &pgt)
+	assert.NoError(t, err)
+
+	validator, err := NewSchemaValidator("./testData/schemas", allowUnknownFields)
+	assert.NoError(t, err)
+
+	fHandler := utils.NewFilesHandler("./testData/GenericSourceFiles", "/dev/null", "/dev/null")
+	pBuilder := NewPolicyBuilder(fHandler)
+	pBuilder.SetSchemaValidator(validator)
+	return pBuilder.Build(pgt)
+}
+
+func TestSchemaValidation(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericCR.yaml
+      policyName: "gen-policy1"
+    - fileName: GenericPtpConfig.yaml
+      policyName: "gen-policy1"
+      spec:
+        profile:
+        - name: "slave"
+          interface: ens5f0
+        recommend:
+        - profile: "slave"
+          priority: '{{hub fromConfigMap "" "site-values" "ptp-priority" | toInt hub}}'
+`
+	policies, err := buildWithSchemas(t, input, false)
+	assert.NoError(t, err)
+	assert.Contains(t, policies, "test1/test1-gen-policy1")
+}
+
+func TestSchemaValidationErrors(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericPtpConfig.yaml
+      policyName: "gen-policy1"
+      spec:
+        profile:
+        - name: "slave"
+          interfce: ens5f0
+    - fileName: GenericPtpConfig.yaml
+      policyName: "gen-policy2"
+      spec:
+        recommend:
+        - profile: "slave"
+          priority: high
+`
+	_, err := buildWithSchemas(t, input, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Schema validation failed")
+	// All the violations of all the sourceFiles are reported
+	assert.Contains(t, err.Error(), "sourceFiles[0] (GenericPtpConfig.yaml): spec.profile[0].interfce: unknown field")
+	assert.Contains(t, err.Error(), "sourceFiles[1] (GenericPtpConfig.yaml): spec.recommend[0].priority: Invalid value: \"string\"")
+
+	// Unknown fields are accepted on request
+	_, err = buildWithSchemas(t, input, true)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "interfce")
+	assert.Contains(t, err.Error(), "spec.recommend[0].priority")
+}
+
+func TestSchemaValidatorLoad(t *testing.T) {
+	_, err := NewSchemaValidator("./testData/GenericSourceFiles", false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no CustomResourceDefinition found")
+
+	_, err = NewSchemaValidator("./testData/missing", false)
+	assert.Error(t, err)
+}
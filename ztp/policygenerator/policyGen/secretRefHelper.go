@@ -0,0 +1,157 @@
+package policyGen
+
+import (
+	"fmt"
+	"strings"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const secretRefKey = "secretRef"
+const secretKind = "Secret"
+
+// resolveSecretRefs replaces the secretRef values of the overlay of the
+// sourceFile by hub templates reading the value from a Secret of the policy
+// namespace on the hub. A secretRef value is a map holding only a secretRef
+// map with the name and key of the hub Secret:
+//
+//	stringData:
+//	  password:
+//	    secretRef:
+//	      name: logging-credentials
+//	      key: password
+//
+// The value is kept base64 encoded in binaryData and in the data of a Secret,
+// and decoded everywhere else. Maps of the source CR are never replaced, as
+// they are regular fields of the CR. The hub templates are only resolved in a
+// policy, so a secretRef is an error unless the CR is wrapped in one.
+func resolveSecretRefs(sFile utils.SourceFile, resource map[string]interface{}, namespace string, wrapped bool) (utils.SourceFile, error) {
+	kind, _ := resource["kind"].(string)
+	sections := []struct {
+		name    string
+		overlay *map[string]interface{}
+		encoded bool
+	}{
+		{"spec", &sFile.Spec, false},
+		{"data", &sFile.Data, kind == secretKind},
+		{"status", &sFile.Status, false},
+		{"binaryData", &sFile.BinaryData, true},
+		{"stringData", &sFile.StringData, false},
+	}
+	for _, section := range sections {
+		if *section.overlay == nil {
+			continue
+		}
+		resolved, found, err := resolveSecretRefValue(*section.overlay, resource[section.name], section.name, namespace, section.encoded)
+		if err != nil {
+			return sFile, err
+		}
+		if !found {
+			continue
+		}
+		if !wrapped {
+			return sFile, fmt.Errorf("secretRef at %s can't be resolved as the CR isn't wrapped in a policy", section.name)
+		}
+		if sFile.DisableTemplates {
+			return sFile, fmt.Errorf("secretRef at %s can't be resolved as templates are disabled on the sourceFile", section.name)
+		}
+		*section.overlay = resolved.(map[string]interface{})
+	}
+	return sFile, nil
+}
+
+// resolveSecretRefValue returns a copy of the overlay value with its secretRef
+// values replaced, and whether it held any
+func resolveSecretRefValue(value interface{}, source interface{}, path string, namespace string, encoded bool) (interface{}, bool, error) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		sourceMap, sourceIsMap := source.(map[string]interface{})
+		if ref, isRef := typed[secretRefKey].(map[string]interface{}); isRef && len(typed) == 1 && !sourceIsMap {
+			template, err := secretRefTemplate(ref, path, namespace, encoded)
+			return template, err == nil, err
+		}
+		resolved := make(map[string]interface{}, len(typed))
+		found := false
+		for k, v := range typed {
+			childResolved, childFound, err := resolveSecretRefValue(v, sourceMap[k], path+"."+k, namespace, encoded)
+			if err != nil {
+				return value, false, err
+			}
+			resolved[k] = childResolved
+			found = found || childFound
+		}
+		return resolved, found, nil
+	case []interface{}:
+		sourceList, _ := source.([]interface{})
+		resolved := make([]interface{}, len(typed))
+		found := false
+		for idx, entry := range typed {
+			var sourceEntry interface{}
+			if idx < len(sourceList) {
+				sourceEntry = sourceList[idx]
+			}
+			entryResolved, entryFound, err := resolveSecretRefValue(entry, sourceEntry, fmt.Sprintf("%s[%d]", path, idx), namespace, encoded)
+			if err != nil {
+				return value, false, err
+			}
+			resolved[idx] = entryResolved
+			found = found || entryFound
+		}
+		return resolved, found, nil
+	}
+	return value, false, nil
+}
+
+func secretRefTemplate(ref map[string]interface{}, path string, namespace string, encoded bool) (string, error) {
+	for k := range ref {
+		if k != "name" && k != "key" {
+			return "", fmt.Errorf("secretRef at %s only supports the name and key of the hub Secret, found %s", path, k)
+		}
+	}
+	name, _ := ref["name"].(string)
+	key, _ := ref["key"].(string)
+	if name == "" || key == "" {
+		return "", fmt.Errorf("secretRef at %s must set the name and key of the hub Secret", path)
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("secretRef at %s: name '%s' is invalid: %s", path, name, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+		return "", fmt.Errorf("secretRef at %s: key '%s' is invalid: %s", path, key, strings.Join(errs, ", "))
+	}
+
+	// fromSecret returns the base64 encoded value of the Secret data
+	function := fmt.Sprintf("fromSecret %q %q %q", namespace, name, key)
+	if !encoded {
+		function += " | base64dec"
+	}
+	return hubTemplateStart + " " + function + " " + hubTemplateEnd, nil
+}
+
+// CheckInlineSecrets rejects the Secrets built from the sourceFile holding
+// plain-text values in their data or stringData, unless inline secrets are
+// allowed by the PGT or the sourceFile. Values read from the hub with ACM
+// templates, such as the ones of a secretRef overlay, are accepted.
+func CheckInlineSecrets(sFile utils.SourceFile, resources []map[string]interface{}, spec utils.PolicyGenTempSpec) error {
+	if spec.AllowInlineSecrets || sFile.AllowInlineSecrets {
+		return nil
+	}
+	for _, resource := range resources {
+		if kind, _ := resource["kind"].(string); kind != secretKind {
+			continue
+		}
+		for _, section := range []string{"data", "stringData"} {
+			values, _ := resource[section].(map[string]interface{})
+			for _, k := range sortedMapKeys(values) {
+				if str, ok := values[k].(string); ok && ContainsTemplate(str) {
+					continue
+				}
+				metadata, _ := resource["metadata"].(map[string]interface{})
+				return fmt.Errorf("%s: Secret %v holds the plain-text value %s.%s. Read it from a hub Secret with a secretRef overlay, "+
+					"or set allowInlineSecrets", sFile.FileName, metadata["name"], section, k)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package policyGen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const hubTemplateStart = "{{hub"
+const hubTemplateEnd = "hub}}"
+const managedTemplateStart = "{{"
+const managedTemplateEnd = "}}"
+
+// Functions available to ACM hub and managed cluster templates. The templates
+// are only parsed by the generator, the functions are never executed.
+var templateFuncNames = []string{
+	// ACM specific functions
+	"fromSecret", "fromConfigMap", "fromClusterClaim", "lookup", "base64enc", "base64dec",
+	"indent", "autoindent", "atoi", "toInt", "toBool", "toLiteral", "protect",
+	"copySecretData", "copyConfigMapData", "getNodesWithExactRoles", "hasNodesWithExactRoles",
+	"skipObject",
+	// Sprig functions enabled by ACM
+	"add", "append", "cat", "concat", "contains", "default", "dict", "div", "empty",
+	"fromJson", "has", "hasKey", "hasPrefix", "hasSuffix", "join", "list", "lower", "mod",
+	"mul", "mustAppend", "mustFromJson", "mustHas", "mustPrepend", "mustRegexFind",
+	"mustRegexFindAll", "mustRegexMatch", "mustToJson", "mustToRawJson", "mustUniq",
+	"prepend", "quote", "regexFind", "regexFindAll", "regexMatch", "regexQuoteMeta",
+	"replace", "semver", "semverCompare", "sortAlpha", "split", "splitList", "splitn",
+	"squote", "sub", "substr", "ternary", "toJson", "toRawJson", "toString", "trim",
+	"trimAll", "trimPrefix", "trimSuffix", "uniq", "until", "untilStep", "upper",
+}
+
+var templateFuncs = func() template.FuncMap {
+	funcs := template.FuncMap{}
+	for _, name := range templateFuncNames {
+		funcs[name] = func(args ...interface{}) (interface{}, error) { return nil, nil }
+	}
+	return funcs
+}()
+
+// ContainsTemplate returns true when the value holds an ACM hub or managed
+// cluster template
+func ContainsTemplate(value string) bool {
+	return strings.Contains(value, managedTemplateStart)
+}
+
+// ValidateTemplates parses every hub ({{hub ... hub}}) and managed cluster
+// ({{ ... }}) template found in the string values of the resource. It returns
+// whether the resource holds any template, and an error pointing at the path
+// of the first template which can't be parsed.
+func ValidateTemplates(resource map[string]interface{}) (bool, error) {
+	return validateTemplates(resource, "")
+}
+
+func validateTemplates(value interface{}, path string) (bool, error) {
+	found := false
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		// Walk the keys in order so the first reported error is stable
+		keys := make([]string, 0, len(typed))
+		for k := range typed {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			childFound, err := validateTemplates(typed[k], childPath)
+			if err != nil {
+				return found, err
+			}
+			found = found || childFound
+		}
+	case []interface{}:
+		for idx, item := range typed {
+			childFound, err := validateTemplates(item, fmt.Sprintf("%s[%d]", path, idx))
+			if err != nil {
+				return found, err
+			}
+			found = found || childFound
+		}
+	case []map[string]interface{}:
+		for idx, item := range typed {
+			childFound, err := validateTemplates(item, fmt.Sprintf("%s[%d]", path, idx))
+			if err != nil {
+				return found, err
+			}
+			found = found || childFound
+		}
+	case string:
+		if !ContainsTemplate(typed) {
+			return false, nil
+		}
+		return true, validateTemplate(typed, path)
+	}
+	return found, nil
+}
+
+// templatePaths returns the paths of the string values holding a template,
+// using the same notation as the field paths of the API validation errors
+func templatePaths(value interface{}, path string, paths map[string]bool) map[string]bool {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for k, v := range typed {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			templatePaths(v, childPath, paths)
+		}
+	case []interface{}:
+		for idx, item := range typed {
+			templatePaths(item, fmt.Sprintf("%s[%d]", path, idx), paths)
+		}
+	case []map[string]interface{}:
+		for idx, item := range typed {
+			templatePaths(item, fmt.Sprintf("%s[%d]", path, idx), paths)
+		}
+	case string:
+		if ContainsTemplate(typed) {
+			paths[path] = true
+		}
+	}
+	return paths
+}
+
+func validateTemplate(value string, path string) error {
+	managedValue := value
+	if strings.Contains(value, hubTemplateStart) {
+		_, err := template.New(path).Delims(hubTemplateStart, hubTemplateEnd).Funcs(templateFuncs).Parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid hub template at %s: %s", path, err)
+		}
+		// The hub templates are resolved on the hub before the managed cluster
+		// templates, drop them before parsing the managed cluster templates
+		managedValue = stripHubTemplates(value)
+	}
+	if strings.Contains(managedValue, managedTemplateStart) {
+		_, err := template.New(path).Delims(managedTemplateStart, managedTemplateEnd).Funcs(templateFuncs).Parse(managedValue)
+		if err != nil {
+			return fmt.Errorf("invalid managed cluster template at %s: %s", path, err)
+		}
+	}
+	return nil
+}
+
+func stripHubTemplates(value string) string {
+	var stripped strings.Builder
+	for {
+		start := strings.Index(value, hubTemplateStart)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(value[start:], hubTemplateEnd)
+		if end < 0 {
+			break
+		}
+		stripped.WriteString(value[:start])
+		value = value[start+end+len(hubTemplateEnd):]
+	}
+	stripped.WriteString(value)
+	return stripped.String()
+}
@@ -1,24 +1,46 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
 	"log"
-	"reflect"
+	"os"
 	"strings"
 
+	"github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/generator"
 	policyGen "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/policyGen"
 	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
-	"gopkg.in/yaml.v3"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(runLint(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "pgt-from-policies" {
+		os.Exit(runReverse(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fn" {
+		os.Exit(runKRMFunction(os.Args[2:]))
+	}
+	if len(os.Args) == 1 && isKRMFunctionCall() {
+		// kustomize runs the exec and container KRM functions without arguments
+		os.Exit(runKRMFunction(nil))
+	}
 
 	sourceCRsPath := flag.String("sourcePath", utils.SourceCRsPath, "Directory where source-crs files exist")
 	pgtPath := flag.String("pgtPath", utils.UnsetStringValue, "Directory where policyGenTemp files exist")
 	outPath := flag.String("outPath", utils.UnsetStringValue, "Directory to write the generated policies")
 	wrapInPolicy := flag.Bool("wrapInPolicy", true, "Wrap the CRs in acm Policy")
+	placementKind := flag.String("placementKind", "", "Kind of placement generated for the policies, PlacementRule or Placement (overrides spec.placementKind)")
+	schemaDir := flag.String("schemaDir", "", "Directory of CustomResourceDefinition files used to validate the generated CRs")
+	allowUnknownFields := flag.Bool("allowUnknownFields", false, "Do not fail the schema validation on fields unknown to the CustomResourceDefinition")
+	waveDependencies := flag.String("waveDependencies", "", "Make each policy depend on the policies of all the lower ztp-deploy-waves across all the PolicyGenTemplates, set in the policy dependencies or extraDependencies")
+	previousManifest := flag.String("previousManifest", "", "Manifest of a previous run to report the added, removed and changed files against")
+	sourceCRsRef := flag.String("sourceCRsRef", "", "Tarball or oci:<dir>[:<tag>] OCI image layout of the source-crs of the PolicyGenTemplates without spec.sourceCRsRef (overrides sourcePath)")
+	sourceCRsCache := flag.String("sourceCRsCache", "", "Directory the sourceCRsRef bundles are extracted to (default the user cache directory)")
+	sourceCRsLock := flag.String("sourceCRsLock", utils.SourceCRsLockFile, "Lock file of the sourceCRsRef digests, new refs are recorded and known refs verified")
+	workers := flag.Int("workers", 0, "Number of PolicyGenTemplate files built concurrently (default the number of CPUs)")
+	placementTolerations := flag.String("placementTolerations", "", "Comma separated list of taint keys tolerated by generated Placements, e.g. cluster.open-cluster-management.io/unreachable")
 
 	// Parse command input
 	flag.Parse()
@@ -27,97 +49,105 @@ func main() {
 	policyGenTemps := flag.Args()
 
 	fHandler := utils.NewFilesHandler(*sourceCRsPath, *pgtPath, *outPath)
-	if fHandler.PgtDir != utils.UnsetStringValue {
-		files, err := fHandler.GetTempFiles()
+	sourceCRs, err := utils.NewSourceCRsStore(*sourceCRsCache, *sourceCRsLock)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fHandler.SetSourceCRs(sourceCRs, *sourceCRsRef)
+	dirFiles, err := generator.ListDir(fHandler)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policyGenTemps = append(policyGenTemps, dirFiles...)
+
+	var schemaValidator *policyGen.SchemaValidator
+	if *schemaDir != "" {
+		var err error
+		schemaValidator, err = policyGen.NewSchemaValidator(*schemaDir, *allowUnknownFields)
 		if err != nil {
-			log.Fatalf("Could not get file list from %s: %s", fHandler.PgtDir, err)
-		}
-		for _, file := range files {
-			if file.Name()[0] == '.' {
-				// Skip hidden files (for example, .gitignore or editor swap files)
-				continue
-			}
-			policyGenTemps = append(policyGenTemps, fHandler.PgtDir+"/"+file.Name())
+			log.Fatalf("Could not load the schemas from %s: %s", *schemaDir, err)
 		}
+	}
 
+	err = InitiatePolicyGen(fHandler, policyGenTemps, generator.Options{
+		DisableWrapInPolicy:  !*wrapInPolicy,
+		PlacementKind:        *placementKind,
+		PlacementTolerations: parseTolerations(*placementTolerations),
+		SchemaValidator:      schemaValidator,
+		WaveDependencies:     *waveDependencies,
+		Workers:              *workers,
+	}, *previousManifest)
+	if lockErr := sourceCRs.WriteLock(); lockErr != nil {
+		log.Print(lockErr)
 	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-	InitiatePolicyGen(fHandler, policyGenTemps, *wrapInPolicy)
+// parseTolerations converts a comma separated list of taint keys into
+// tolerations which tolerate the taint regardless of its value
+func parseTolerations(taintKeys string) []utils.Toleration {
+	tolerations := make([]utils.Toleration, 0)
+	for _, key := range strings.Split(taintKeys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		tolerations = append(tolerations, utils.Toleration{Key: key, Operator: "Exists"})
+	}
+	return tolerations
 }
 
-func InitiatePolicyGen(fHandler *utils.FilesHandler, pgtFiles []string, wrapInPolicy bool) {
-	for _, file := range pgtFiles {
+// InitiatePolicyGen generates and writes the objects of every PGT file, along
+// with their manifest when writing to an output directory. The changes from
+// the previousManifest, when set, are reported on the standard error. It goes
+// on past the failing files and returns all the failures.
+func InitiatePolicyGen(fHandler *utils.FilesHandler, pgtFiles []string, opts generator.Options, previousManifest string) error {
+	result, genErr := generator.Generate(fHandler, pgtFiles, opts)
+	for _, warning := range result.Warnings {
+		log.Print(warning)
+	}
+	// Write the objects of the successful files even if some files failed
+	writeErr := result.Write(fHandler, os.Stdout)
 
-		kindType := utils.KindType{}
-		yamlFile, err := fHandler.ReadFile(file)
-		if err != nil {
-			log.Fatalf("Could not read %s: %s\n", file, err)
+	var errs generator.Errors
+	if genErr != nil {
+		errs = append(errs, genErr.(generator.Errors)...)
+	}
+	if writeErr != nil {
+		errs = append(errs, writeErr.(generator.Errors)...)
+	}
+	if fHandler.OutDir != utils.UnsetStringValue {
+		if err := result.WriteManifest(fHandler); err != nil {
+			errs = append(errs, &generator.FileError{File: generator.ManifestFileName, Err: err})
 		}
-
-		err = yaml.Unmarshal(yamlFile, &kindType)
-		if err != nil {
-			log.Fatalf("Could not parse %s as yaml: %s\n", file, err)
+	}
+	if previousManifest != "" {
+		if err := reportChanges(fHandler, result, previousManifest); err != nil {
+			errs = append(errs, &generator.FileError{File: previousManifest, Err: err})
 		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
 
-		if kindType.Kind == "PolicyGenTemplate" {
-			policyGenTemp := utils.PolicyGenTemplate{}
-			err := yaml.Unmarshal(yamlFile, &policyGenTemp)
-			if err != nil {
-				log.Fatalf("Could not unmarshal PolicyGenTemplate data from %s: %s", file, err)
-			}
-			// overwrite template setting with optional command line argument
-			if !wrapInPolicy {
-				policyGenTemp.Spec.WrapInPolicy = wrapInPolicy
-			}
-
-			pBuilder := policyGen.NewPolicyBuilder(fHandler)
-			policies, err := pBuilder.Build(policyGenTemp)
-			if err != nil {
-				log.Fatalf("Could not build the entire policy defined by %s: %s", file, err)
-			}
-			for k, v := range policies {
-				var policy []byte
-				var pErr error
-				t := reflect.ValueOf(v)
-				switch t.Kind() {
-				case reflect.Slice:
-					var buf bytes.Buffer
-					for i := 0; i < t.Len(); i++ {
-						b, pErr := yaml.Marshal(t.Index(i).Interface())
-						if pErr != nil {
-							log.Fatalf("Error marshalling yaml for %s[%d]: %s\n", k, i, pErr)
-						} else {
-							if t.Len() > 0 {
-								buf.WriteString("---\n")
-							}
-							buf.Write(b)
-						}
-					}
-					policy = buf.Bytes()
-				default:
-					policy, pErr = yaml.Marshal(v)
-					if pErr != nil {
-						log.Fatalf("Error marshalling yaml for %s: %s", k, pErr)
-					}
-				}
-				if pErr == nil {
-					// write to file when out dir is provided, otherwise write to standard output
-					if fHandler.OutDir != utils.UnsetStringValue {
-						err := fHandler.WriteFile(k+utils.FileExt, policy)
-						if err != nil {
-							log.Fatalf("Error: could not write file %s: %s", fHandler.OutDir+"/"+k+utils.FileExt, err)
-						}
-					} else {
-						strPolicy := string(policy)
-						if !strings.HasPrefix(strPolicy, "---\n") {
-							fmt.Println("---")
-						}
-						fmt.Println(strPolicy)
-					}
-				}
-			}
-		} else {
-			log.Printf("Unsupported yaml structure kind in %s: %s", file, kindType)
-		}
+func reportChanges(fHandler *utils.FilesHandler, result *generator.Result, previousManifest string) error {
+	previous, err := generator.ReadManifest(previousManifest)
+	if err != nil {
+		return err
+	}
+	current, err := result.Manifest(fHandler)
+	if err != nil {
+		return err
+	}
+	diff := generator.CompareManifests(previous, current)
+	if diff.Empty() {
+		fmt.Fprintf(os.Stderr, "No changes since %s\n", previousManifest)
+		return nil
 	}
+	fmt.Fprintf(os.Stderr, "Changes since %s:\n%s", previousManifest, diff)
+	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/generator"
 	"github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/testSource"
 	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
 	"github.com/stretchr/testify/assert"
@@ -104,7 +105,8 @@ func generateACMResourceDefinitions(t *testing.T) {
 		policyGenTemps = append(policyGenTemps, testSource.GetTemplatePath(t)+"/"+file.Name())
 	}
 
-	InitiatePolicyGen(fHandler, policyGenTemps, true)
+	err = InitiatePolicyGen(fHandler, policyGenTemps, generator.Options{}, "")
+	assert.Nil(t, err)
 }
 
 func generateCustomResourceDefinitions(t *testing.T) {
@@ -116,7 +118,8 @@ func generateCustomResourceDefinitions(t *testing.T) {
 		policyGenTemps = append(policyGenTemps, testSource.GetTemplatePath(t)+"/"+file.Name())
 	}
 
-	InitiatePolicyGen(fHandler, policyGenTemps, false)
+	err = InitiatePolicyGen(fHandler, policyGenTemps, generator.Options{DisableWrapInPolicy: true}, "")
+	assert.Nil(t, err)
 }
 
 /* Section Test Trigger Functions Ends */
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/reverse"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+)
+
+// runReverse implements the pgt-from-policies subcommand and returns the exit
+// code: 1 when the written PGTs don't reproduce the policies, 2 on errors
+func runReverse(args []string) int {
+	flags := flag.NewFlagSet("pgt-from-policies", flag.ContinueOnError)
+	sourceCRsPath := flags.String("sourcePath", utils.SourceCRsPath, "Directory where source-crs files exist, the one of the working directory or else next to the executable by default")
+	outPath := flags.String("outPath", "out", "Directory to write the PolicyGenTemplates and their custom source-crs to")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *sourceCRsPath == utils.SourceCRsPath {
+		*sourceCRsPath = defaultKRMSourcePath()
+	}
+
+	objects, err := readPolicies(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	result, err := reverse.Reverse(objects, *sourceCRsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// The custom source CRs are in the source-crs directory next to the PGTs,
+	// like in the ztp site configuration repositories
+	write := func(fileName string, content []byte) error {
+		filePath := filepath.Join(*outPath, fileName)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0775); err != nil {
+			return err
+		}
+		return os.WriteFile(filePath, content, 0644)
+	}
+	for _, pgt := range result.PolicyGenTemplates {
+		content, err := reverse.MarshalPolicyGenTemplate(pgt)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if err := write(pgt.Metadata.Name+utils.FileExt, content); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	fileNames := make([]string, 0, len(result.CustomSourceCRs))
+	for fileName := range result.CustomSourceCRs {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		if err := write(filepath.Join(utils.SourceCRsPath, fileName), result.CustomSourceCRs[fileName]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	for _, warning := range result.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+	for _, difference := range result.Differences {
+		fmt.Fprintln(os.Stderr, "difference:", difference)
+	}
+	if len(result.Differences) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readPolicies reads the objects of the files, of the YAML files of the
+// directories, or of the standard input for -
+func readPolicies(paths []string) ([]map[string]interface{}, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no policy file given, pass the files or directories of the policies, or - for the standard input")
+	}
+	objects := make([]map[string]interface{}, 0)
+	read := func(in io.Reader, name string) error {
+		decoded, err := reverse.Decode(in)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		objects = append(objects, decoded...)
+		return nil
+	}
+	for _, path := range paths {
+		if path == "-" {
+			if err := read(os.Stdin, "stdin"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{path}
+		if info.IsDir() {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			files = files[:0]
+			for _, entry := range entries {
+				if ext := filepath.Ext(entry.Name()); !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+		for _, file := range files {
+			content, err := os.Open(file)
+			if err != nil {
+				return nil, err
+			}
+			err = read(content, file)
+			content.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return objects, nil
+}
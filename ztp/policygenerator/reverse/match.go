@@ -0,0 +1,265 @@
+package reverse
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	policyGen "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/policyGen"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// policyMatcher matches the objectDefinitions of the policies of a PGT to the
+// source CRs, for the mcp of the PGT
+type policyMatcher struct {
+	*reverser
+	pgt         utils.PolicyGenTemplate
+	sourceFiles []utils.SourceFile
+	custom      map[string][]byte
+	warnings    []string
+	// Total size of the overlays, the custom source CRs counting as a whole
+	size int
+}
+
+func (m *policyMatcher) warn(format string, args ...interface{}) {
+	m.warnings = append(m.warnings, fmt.Sprintf(format, args...))
+}
+
+// reversePolicy appends the sourceFiles reproducing the ConfigurationPolicies
+// of the policy. The policy and ConfigurationPolicy settings which differ
+// from the defaults are set on the first sourceFile of the policy.
+func (m *policyMatcher) reversePolicy(policy map[string]interface{}) error {
+	key := keyOf(policy)
+	acmPolicy := utils.AcmPolicy{}
+	if err := convert(policy, &acmPolicy); err != nil {
+		return fmt.Errorf("%s: %s", key, err)
+	}
+	pgtName := m.pgt.Metadata.Name
+	policyName := strings.TrimPrefix(key.name, pgtName+"-")
+	if policyName == key.name {
+		m.warn("%s: the name doesn't start with the PGT name, the policy is generated as %s-%s", key, pgtName, policyName)
+	}
+	wave := acmPolicy.Metadata.Annotations[utils.ZtpDeployWaveAnnotation]
+
+	spec, _ := policy["spec"].(map[string]interface{})
+	templates, _ := spec["policy-templates"].([]interface{})
+	first := len(m.sourceFiles)
+	var firstConfigPolicy *utils.AcmConfigurationPolicy
+	var firstObject map[string]interface{}
+	firstSize := 0
+	waveSet := false
+	for idx, template := range templates {
+		templateMap, _ := template.(map[string]interface{})
+		objDef, _ := templateMap["objectDefinition"].(map[string]interface{})
+		if kind, _ := objDef["kind"].(string); kind != configurationPolicyKind {
+			m.warn("%s: policy-templates[%d] of kind %s is not supported, skipping it", key, idx, kind)
+			continue
+		}
+		configPolicy := acmPolicy.Spec.PolicyTemplates[idx].ObjDef
+		if firstConfigPolicy == nil {
+			firstConfigPolicy = &configPolicy
+		}
+		policyTemplateName := ""
+		if configPolicy.Metadata.Name != key.name+configPolicySuffix {
+			if strings.HasPrefix(configPolicy.Metadata.Name, key.name+"-") {
+				policyTemplateName = strings.TrimPrefix(configPolicy.Metadata.Name, key.name+"-")
+			} else {
+				m.warn("%s: ConfigurationPolicy %s doesn't start with the policy name, it is generated as %s%s",
+					key, configPolicy.Metadata.Name, key.name, configPolicySuffix)
+			}
+		}
+		disableTemplates := configPolicy.Metadata.Annotations[utils.DisableTemplatesAnnotation] == "true"
+
+		for _, objTemplate := range configPolicy.Spec.ObjectTemplates {
+			sFile, carriesWave, size := m.matchObject(objTemplate.ObjectDefinition, wave, false)
+			if firstObject == nil {
+				firstObject, firstSize = objTemplate.ObjectDefinition, size
+			}
+			m.size += size
+			waveSet = waveSet || carriesWave
+			sFile.PolicyName = policyName
+			if objTemplate.ComplianceType != utils.DefaultComplianceType {
+				sFile.ComplianceType = objTemplate.ComplianceType
+			}
+			sFile.MetadataComplianceType = objTemplate.MetadataComplianceType
+			sFile.RecordDiff = objTemplate.RecordDiff
+			sFile.PolicyTemplateName = policyTemplateName
+			sFile.DisableTemplates = disableTemplates
+			m.sourceFiles = append(m.sourceFiles, sFile)
+		}
+	}
+	if firstObject == nil {
+		m.warn("%s has no object template to reproduce, skipping it", key)
+		return nil
+	}
+
+	if wave != "" && !waveSet {
+		// None of the source CRs carries a wave, the first one carries the
+		// policy wave
+		sFile, _, size := m.matchObject(firstObject, wave, true)
+		m.size += size - firstSize
+		sFile.PolicyName = m.sourceFiles[first].PolicyName
+		sFile.ComplianceType = m.sourceFiles[first].ComplianceType
+		sFile.MetadataComplianceType = m.sourceFiles[first].MetadataComplianceType
+		sFile.RecordDiff = m.sourceFiles[first].RecordDiff
+		sFile.PolicyTemplateName = m.sourceFiles[first].PolicyTemplateName
+		sFile.DisableTemplates = m.sourceFiles[first].DisableTemplates
+		m.sourceFiles[first] = sFile
+	}
+
+	sFile := &m.sourceFiles[first]
+	if acmPolicy.Spec.RemediationAction != defaultRemediationAction {
+		sFile.RemediationAction = acmPolicy.Spec.RemediationAction
+	}
+	configSpec := firstConfigPolicy.Spec
+	if configSpec.EvaluationInterval.Compliant != utils.DefaultCompliantEvaluationInterval {
+		sFile.EvaluationInterval.Compliant = configSpec.EvaluationInterval.Compliant
+	}
+	if configSpec.EvaluationInterval.NonCompliant != utils.DefaultNonCompliantEvaluationInterval {
+		sFile.EvaluationInterval.NonCompliant = configSpec.EvaluationInterval.NonCompliant
+	}
+	if configSpec.Severity != utils.DefaultSeverity {
+		sFile.Severity = configSpec.Severity
+	}
+	defaultSelector := utils.NamespaceSelector{Exclude: []string{"kube-*"}, Include: []string{"*"}}
+	if !reflect.DeepEqual(configSpec.NamespaceSelector, defaultSelector) {
+		namespaceSelector := configSpec.NamespaceSelector
+		sFile.NamespaceSelector = &namespaceSelector
+	}
+	if configSpec.PruneObjectBehavior != "" {
+		sFile.PruneObjectBehavior = configSpec.PruneObjectBehavior
+	}
+	return nil
+}
+
+// matchObject returns the sourceFile building the objectDefinition from the
+// source CR of the same kind with the smallest overlay, whether the built CR
+// carries the policy wave and the overlay size. The source CRs carrying a
+// wave carry the policy wave once built, or all of them when forced. The
+// objectDefinitions without a matching source CR are written as custom source
+// CRs carrying the policy wave.
+func (m *policyMatcher) matchObject(object map[string]interface{}, wave string, force bool) (utils.SourceFile, bool, int) {
+	kind, _ := object["kind"].(string)
+	var best utils.SourceFile
+	bestSize := -1
+	bestWave := false
+	for _, candidate := range m.index.byKind[kind] {
+		source, err := candidate.resource(m.pgt.Spec.Mcp)
+		if err != nil {
+			continue
+		}
+		target := deepCopy(object).(map[string]interface{})
+		withWave := wave != "" && (force || hasWave(source))
+		if withWave {
+			setWave(target, wave)
+		}
+		sFile, size, ok := m.overlayFor(candidate, source, target)
+		if ok && (bestSize < 0 || size < bestSize) {
+			best, bestSize, bestWave = sFile, size, withWave
+		}
+	}
+	if bestSize < 0 {
+		target := deepCopy(object).(map[string]interface{})
+		if wave != "" {
+			setWave(target, wave)
+		}
+		fileName := m.customFileName(target)
+		content, err := yaml.Marshal(target)
+		if err == nil {
+			m.custom[fileName] = content
+		}
+		best, bestSize, bestWave = newSourceFile(fileName), leafCount(object), wave != ""
+	}
+
+	if err := policyGen.CheckInlineSecrets(best, []map[string]interface{}{object}, m.pgt.Spec); err != nil {
+		m.warn("%s: %s", keyOf(object), err)
+		best.AllowInlineSecrets = true
+	}
+	return best, bestWave, bestSize
+}
+
+// overlayFor returns the sourceFile building the target CR from the source CR
+// with the minimal overlay. When the overlay doesn't build the target CR, the
+// top-level fields which differ once merged are replaced by patches.
+func (m *policyMatcher) overlayFor(candidate sourceCR, source map[string]interface{}, target map[string]interface{}) (utils.SourceFile, int, bool) {
+	ov := computeOverlay(source, target)
+	sFile := newSourceFile(candidate.fileName)
+	ov.apply(&sFile)
+	built, ok := m.build(sFile)
+	if ok && equal(built, target) {
+		return sFile, ov.size(), true
+	}
+
+	fallback := overlay{metadata: ov.metadata}
+	sFile = newSourceFile(candidate.fileName)
+	fallback.apply(&sFile)
+	built, ok = m.build(sFile)
+	if !ok {
+		return sFile, 0, false
+	}
+	for _, key := range sortedKeys(union(built, target)) {
+		builtValue, inBuilt := built[key]
+		targetValue, inTarget := target[key]
+		fallback.patches = append(fallback.patches, diffPatch(builtValue, inBuilt, targetValue, inTarget, pointer(key))...)
+	}
+	fallback.apply(&sFile)
+	built, ok = m.build(sFile)
+	return sFile, fallback.size(), ok && equal(built, target)
+}
+
+// build returns the CR built from a copy of the sourceFile, as the
+// PolicyBuilder merges the overlay values into the CR
+func (m *policyMatcher) build(sFile utils.SourceFile) (map[string]interface{}, bool) {
+	copied := sFile
+	copied.Metadata.Labels = copyStringMap(sFile.Metadata.Labels)
+	copied.Metadata.Annotations = copyStringMap(sFile.Metadata.Annotations)
+	copied.Spec = copyMap(sFile.Spec)
+	copied.Data = copyMap(sFile.Data)
+	copied.Status = copyMap(sFile.Status)
+	copied.BinaryData = copyMap(sFile.BinaryData)
+	copied.StringData = copyMap(sFile.StringData)
+	copied.Patches = copyPatches(sFile.Patches)
+	resources, err := m.builder.BuildSourceFile(copied, m.pgt)
+	if err != nil || len(resources) != 1 {
+		return nil, false
+	}
+	return resources[0], true
+}
+
+// customFileName returns the name of the custom source CR of the object,
+// built like the name of the CRs generated without policy
+func (m *policyMatcher) customFileName(object map[string]interface{}) string {
+	key := keyOf(object)
+	nameParts := []string{key.kind, key.name}
+	if key.namespace != "" {
+		nameParts = append(nameParts, key.namespace)
+	}
+	name := strings.Join(nameParts, "-")
+	fileName := name + utils.FileExt
+	for idx := 2; m.index.files[fileName] || m.custom[fileName] != nil; idx++ {
+		fileName = fmt.Sprintf("%s-%d%s", name, idx, utils.FileExt)
+	}
+	return fileName
+}
+
+func hasWave(resource map[string]interface{}) bool {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	_, found := annotations[utils.ZtpDeployWaveAnnotation]
+	return found
+}
+
+func setWave(resource map[string]interface{}, wave string) {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+		resource["metadata"] = metadata
+	}
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = make(map[string]interface{})
+		metadata["annotations"] = annotations
+	}
+	annotations[utils.ZtpDeployWaveAnnotation] = wave
+}
@@ -0,0 +1,116 @@
+package reverse
+
+import (
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// cleanObject returns a copy of the object without its status and the
+// metadata set by the API server
+func cleanObject(object map[string]interface{}) map[string]interface{} {
+	cleaned := deepCopy(object).(map[string]interface{})
+	delete(cleaned, "status")
+	metadata, _ := cleaned["metadata"].(map[string]interface{})
+	for _, key := range serverMetadata {
+		delete(metadata, key)
+	}
+	if annotations, _ := metadata["annotations"].(map[string]interface{}); annotations != nil {
+		delete(annotations, lastAppliedAnnotation)
+		if len(annotations) == 0 {
+			delete(metadata, "annotations")
+		}
+	}
+	return cleaned
+}
+
+// isReplicatedPolicy returns true for the policies replicated by ACM in the
+// namespaces of the managed clusters
+func isReplicatedPolicy(policy map[string]interface{}) bool {
+	metadata, _ := policy["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	_, found := labels[rootPolicyLabel]
+	return found
+}
+
+// convert decodes the object into the typed struct out
+func convert(object interface{}, out interface{}) error {
+	content, err := yaml.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(content, out)
+}
+
+// newPolicyGenTemplate returns a PGT with the default spec values set by its
+// YAML decoding
+func newPolicyGenTemplate(name string, namespace string) (utils.PolicyGenTemplate, error) {
+	pgt := utils.PolicyGenTemplate{ApiVersion: pgtApiVersion, Kind: pgtKind}
+	pgt.Metadata.Name = name
+	pgt.Metadata.Namespace = namespace
+	err := yaml.Unmarshal([]byte("{}"), &pgt.Spec)
+	return pgt, err
+}
+
+// newSourceFile returns a sourceFile with the default values set by its YAML
+// decoding
+func newSourceFile(fileName string) utils.SourceFile {
+	sFile := utils.SourceFile{}
+	// Can't fail on an empty map
+	_ = yaml.Unmarshal([]byte("{}"), &sFile)
+	sFile.FileName = fileName
+	return sFile
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(typed))
+		for k, v := range typed {
+			copied[k] = deepCopy(v)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(typed))
+		for idx, item := range typed {
+			copied[idx] = deepCopy(item)
+		}
+		return copied
+	case []map[string]interface{}:
+		copied := make([]interface{}, len(typed))
+		for idx, item := range typed {
+			copied[idx] = deepCopy(item)
+		}
+		return copied
+	}
+	return value
+}
+
+func copyMap(in map[string]interface{}) map[string]interface{} {
+	if in == nil {
+		return nil
+	}
+	return deepCopy(in).(map[string]interface{})
+}
+
+func copyStringMap(in map[string]string) map[string]string {
+	if in == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(in))
+	for k, v := range in {
+		copied[k] = v
+	}
+	return copied
+}
+
+func copyPatches(in []utils.PatchOperation) []utils.PatchOperation {
+	if len(in) == 0 {
+		return nil
+	}
+	copied := make([]utils.PatchOperation, len(in))
+	for idx, patch := range in {
+		copied[idx] = patch
+		copied[idx].Value = deepCopy(patch.Value)
+	}
+	return copied
+}
@@ -0,0 +1,405 @@
+package reverse
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	policyGen "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/policyGen"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+)
+
+// Sections of the CR merged with the sourceFile overlay
+var overlaySections = []string{"spec", "data", "status", "binaryData", "stringData"}
+
+// overlay is the part of a sourceFile turning a source CR into a target CR
+type overlay struct {
+	metadata utils.MetaData
+	sections map[string]map[string]interface{}
+	patches  []utils.PatchOperation
+}
+
+// size is the number of overlay values and patches, used to pick the closest
+// source CR
+func (o overlay) size() int {
+	size := len(o.metadata.Labels) + len(o.metadata.Annotations)
+	for _, patch := range o.patches {
+		size += 1 + leafCount(patch.Value)
+	}
+	if o.metadata.Name != "" {
+		size++
+	}
+	if o.metadata.Namespace != "" {
+		size++
+	}
+	for _, section := range o.sections {
+		size += leafCount(section)
+	}
+	return size
+}
+
+func leafCount(value interface{}) int {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		count := 0
+		for _, v := range typed {
+			count += leafCount(v)
+		}
+		return count
+	case []interface{}:
+		count := 0
+		for _, v := range typed {
+			count += leafCount(v)
+		}
+		return count
+	}
+	return 1
+}
+
+// apply sets a copy of the overlay in the sourceFile
+func (o overlay) apply(sFile *utils.SourceFile) {
+	sFile.Metadata = o.metadata
+	sFile.Spec = copyMap(o.sections["spec"])
+	sFile.Data = copyMap(o.sections["data"])
+	sFile.Status = copyMap(o.sections["status"])
+	sFile.BinaryData = copyMap(o.sections["binaryData"])
+	sFile.StringData = copyMap(o.sections["stringData"])
+	sFile.Patches = copyPatches(o.patches)
+}
+
+// computeOverlay returns the minimal overlay turning the source CR into the
+// target CR the way the PolicyBuilder merges it: the overlay values are
+// merged into the source CR maps, the $placeholders and empty values of the
+// merged maps are dropped, and lists of maps are merged by index. What can't
+// be expressed as an overlay, such as removed keys, is expressed as patches.
+func computeOverlay(source map[string]interface{}, target map[string]interface{}) overlay {
+	result := overlay{sections: make(map[string]map[string]interface{})}
+
+	sourceMeta, _ := source["metadata"].(map[string]interface{})
+	targetMeta, _ := target["metadata"].(map[string]interface{})
+	result.metadata, result.patches = diffMetadata(sourceMeta, targetMeta)
+
+	for _, key := range sortedKeys(union(source, target)) {
+		if key == "metadata" {
+			continue
+		}
+		sourceValue, inSource := source[key]
+		targetValue, inTarget := target[key]
+		sourceMap, sourceIsMap := sourceValue.(map[string]interface{})
+		targetMap, targetIsMap := targetValue.(map[string]interface{})
+		if isOverlaySection(key) && (sourceIsMap || !inSource) && (targetIsMap || !inTarget) {
+			// The section is always merged when present in the source CR
+			if !inSource && !inTarget {
+				continue
+			}
+			if !inTarget {
+				result.patches = append(result.patches, utils.PatchOperation{Op: "remove", Path: pointer(key)})
+				continue
+			}
+			if !inSource {
+				if len(targetMap) == 0 {
+					result.patches = append(result.patches, utils.PatchOperation{Op: "add", Path: pointer(key), Value: targetMap})
+				} else {
+					result.sections[key] = targetMap
+				}
+				continue
+			}
+			values, patches := diffMap(sourceMap, targetMap, pointer(key), true)
+			if len(values) > 0 {
+				result.sections[key] = values
+			}
+			result.patches = append(result.patches, patches...)
+			continue
+		}
+		result.patches = append(result.patches, diffPatch(sourceValue, inSource, targetValue, inTarget, pointer(key))...)
+	}
+	return result
+}
+
+func isOverlaySection(key string) bool {
+	for _, section := range overlaySections {
+		if key == section {
+			return true
+		}
+	}
+	return false
+}
+
+// diffMetadata returns the metadata overlay and the patches of the other
+// metadata fields
+func diffMetadata(source map[string]interface{}, target map[string]interface{}) (utils.MetaData, []utils.PatchOperation) {
+	metadata := utils.MetaData{}
+	patches := make([]utils.PatchOperation, 0)
+	for _, key := range sortedKeys(union(source, target)) {
+		sourceValue, inSource := source[key]
+		targetValue, inTarget := target[key]
+		path := pointer("metadata", key)
+		switch key {
+		case "name", "namespace":
+			targetStr, isStr := targetValue.(string)
+			if equal(sourceValue, targetValue) && inSource == inTarget {
+				continue
+			}
+			if !inTarget || !isStr || targetStr == "" {
+				patches = append(patches, diffPatch(sourceValue, inSource, targetValue, inTarget, path)...)
+			} else if key == "name" {
+				metadata.Name = targetStr
+			} else {
+				metadata.Namespace = targetStr
+			}
+		case "labels", "annotations":
+			sourceMap, _ := sourceValue.(map[string]interface{})
+			targetMap, isMap := targetValue.(map[string]interface{})
+			if inTarget && !isMap {
+				patches = append(patches, diffPatch(sourceValue, inSource, targetValue, inTarget, path)...)
+				continue
+			}
+			values, valuePatches := diffStringMap(sourceMap, targetMap, path)
+			if key == "labels" {
+				metadata.Labels = values
+			} else {
+				metadata.Annotations = values
+			}
+			patches = append(patches, valuePatches...)
+			if inSource && !inTarget && len(sourceMap) == 0 {
+				patches = append(patches, utils.PatchOperation{Op: "remove", Path: path})
+			}
+		default:
+			patches = append(patches, diffPatch(sourceValue, inSource, targetValue, inTarget, path)...)
+		}
+	}
+	return metadata, patches
+}
+
+// diffStringMap diffs the labels or annotations, which are only merged when
+// the overlay sets any
+func diffStringMap(source map[string]interface{}, target map[string]interface{}, path string) (map[string]string, []utils.PatchOperation) {
+	unmerged := make(map[string]string)
+	unmergedPatches := make([]utils.PatchOperation, 0)
+	merged := make(map[string]string)
+	mergedPatches := make([]utils.PatchOperation, 0)
+	for _, key := range sortedKeys(union(source, target)) {
+		sourceValue, inSource := source[key]
+		targetValue, inTarget := target[key]
+		targetStr, isStr := targetValue.(string)
+		keyPath := path + "/" + escape(key)
+		switch {
+		case inTarget && !isStr:
+			patch := diffPatch(sourceValue, inSource, targetValue, inTarget, keyPath)
+			unmergedPatches = append(unmergedPatches, patch...)
+			mergedPatches = append(mergedPatches, patch...)
+		case !inTarget:
+			patch := utils.PatchOperation{Op: "remove", Path: keyPath}
+			unmergedPatches = append(unmergedPatches, patch)
+			if !isDropped(sourceValue) {
+				mergedPatches = append(mergedPatches, patch)
+			}
+		case !inSource || !equal(sourceValue, targetValue):
+			unmerged[key] = targetStr
+			merged[key] = targetStr
+		case isDropped(sourceValue):
+			merged[key] = targetStr
+		}
+	}
+	if len(unmerged) == 0 {
+		return nil, unmergedPatches
+	}
+	return merged, mergedPatches
+}
+
+// diffMap returns the overlay of the map and the patches completing it. When
+// merged, the source $placeholders and empty values without overlay value are
+// dropped by the merge.
+func diffMap(source map[string]interface{}, target map[string]interface{}, path string, merged bool) (map[string]interface{}, []utils.PatchOperation) {
+	values := make(map[string]interface{})
+	patches := make([]utils.PatchOperation, 0)
+	for _, key := range sortedKeys(union(source, target)) {
+		sourceValue, inSource := source[key]
+		targetValue, inTarget := target[key]
+		keyPath := path + "/" + escape(key)
+
+		if !inTarget {
+			if !(merged && isDropped(sourceValue)) {
+				patches = append(patches, utils.PatchOperation{Op: "remove", Path: keyPath})
+			}
+			continue
+		}
+		if targetValue == nil {
+			// A nil overlay value is ignored by the merge
+			if inSource && sourceValue == nil {
+				continue
+			}
+			patches = append(patches, diffPatch(sourceValue, inSource, targetValue, inTarget, keyPath)...)
+			continue
+		}
+		if !inSource || sourceValue == nil {
+			values[key] = targetValue
+			continue
+		}
+		if equal(sourceValue, targetValue) {
+			if merged && isDropped(sourceValue) {
+				values[key] = targetValue
+			}
+			continue
+		}
+
+		switch sourceTyped := sourceValue.(type) {
+		case map[string]interface{}:
+			targetMap, isMap := targetValue.(map[string]interface{})
+			if !isMap {
+				patches = append(patches, utils.PatchOperation{Op: "replace", Path: keyPath, Value: targetValue})
+				continue
+			}
+			// Only merge the child map when needed
+			unmergedValues, unmergedPatches := diffMap(sourceTyped, targetMap, keyPath, false)
+			if len(unmergedValues) == 0 {
+				mergedValues, mergedPatches := diffMap(sourceTyped, targetMap, keyPath, true)
+				if len(mergedPatches) < len(unmergedPatches) {
+					values[key] = mergedValues
+					patches = append(patches, mergedPatches...)
+				} else {
+					patches = append(patches, unmergedPatches...)
+				}
+				continue
+			}
+			mergedValues, mergedPatches := diffMap(sourceTyped, targetMap, keyPath, true)
+			values[key] = mergedValues
+			patches = append(patches, mergedPatches...)
+		case []interface{}:
+			targetList, isList := targetValue.([]interface{})
+			if !isList {
+				patches = append(patches, utils.PatchOperation{Op: "replace", Path: keyPath, Value: targetValue})
+				continue
+			}
+			if len(sourceTyped) == 0 || !isMapValue(sourceTyped[0]) {
+				// Lists which are not lists of maps are replaced by the overlay
+				values[key] = targetList
+				continue
+			}
+			entries, entryPatches, ok := diffList(sourceTyped, targetList, keyPath)
+			if !ok {
+				patches = append(patches, utils.PatchOperation{Op: "replace", Path: keyPath, Value: targetValue})
+				continue
+			}
+			values[key] = entries
+			patches = append(patches, entryPatches...)
+		default:
+			values[key] = targetValue
+		}
+	}
+	return values, patches
+}
+
+// diffList returns the overlay of a list of maps merged by index, or false
+// when the target list can't be expressed as such an overlay
+func diffList(source []interface{}, target []interface{}, path string) ([]interface{}, []utils.PatchOperation, bool) {
+	if len(target) < len(source) {
+		// The source entries without overlay entry are kept
+		return nil, nil, false
+	}
+	// The source entries without overlay entry are kept unmerged, the
+	// trailing entries equal to the source ones are left out of the overlay
+	length := len(target)
+	for length > 0 && length <= len(source) && equal(source[length-1], target[length-1]) {
+		length--
+	}
+	entries := make([]interface{}, length)
+	patches := make([]utils.PatchOperation, 0)
+	for idx, targetEntry := range target[:length] {
+		targetMap, isMap := targetEntry.(map[string]interface{})
+		if !isMap {
+			return nil, nil, false
+		}
+		if idx >= len(source) {
+			entries[idx] = targetMap
+			continue
+		}
+		sourceMap, isMap := source[idx].(map[string]interface{})
+		if !isMap {
+			return nil, nil, false
+		}
+		entryValues, entryPatches := diffMap(sourceMap, targetMap, fmt.Sprintf("%s/%d", path, idx), true)
+		entries[idx] = entryValues
+		patches = append(patches, entryPatches...)
+	}
+	return entries, patches, true
+}
+
+// diffPatch returns the patch replacing the source value by the target value
+func diffPatch(sourceValue interface{}, inSource bool, targetValue interface{}, inTarget bool, path string) []utils.PatchOperation {
+	switch {
+	case !inSource && !inTarget:
+		return nil
+	case !inTarget:
+		return []utils.PatchOperation{{Op: "remove", Path: path}}
+	case !inSource:
+		return []utils.PatchOperation{{Op: "add", Path: path, Value: targetValue}}
+	case equal(sourceValue, targetValue):
+		return nil
+	}
+	return []utils.PatchOperation{{Op: "replace", Path: path, Value: targetValue}}
+}
+
+// isDropped returns true for the source values dropped by a merge without
+// overlay value
+func isDropped(value interface{}) bool {
+	str, ok := value.(string)
+	return ok && (str == "" || (strings.HasPrefix(str, "$") && !policyGen.ContainsTemplate(str)))
+}
+
+func isMapValue(value interface{}) bool {
+	_, ok := value.(map[string]interface{})
+	return ok
+}
+
+// equal compares values as JSON, regardless of the numeric types
+func equal(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func normalize(value interface{}) interface{} {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(content, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+func union(a map[string]interface{}, b map[string]interface{}) map[string]interface{} {
+	keys := make(map[string]interface{}, len(a)+len(b))
+	for k := range a {
+		keys[k] = nil
+	}
+	for k := range b {
+		keys[k] = nil
+	}
+	return keys
+}
+
+func sortedKeys(in map[string]interface{}) []string {
+	keys := make([]string, 0, len(in))
+	for k := range in {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pointer returns the JSON pointer of the path
+func pointer(keys ...string) string {
+	escaped := make([]string, len(keys))
+	for idx, key := range keys {
+		escaped[idx] = escape(key)
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+func escape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,160 @@
+package reverse
+
+import (
+	"fmt"
+	"strings"
+
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setBindingRules sets the bindingRules, bindingExcludedRules and
+// bindingSelector of the PGT spec rendering the cluster selector. The
+// leading expressions rendered the way the PolicyBuilder renders the binding
+// rules, sorted by key with the In and Exists expressions first, become
+// binding rules. The other expressions and the matchLabels go to the
+// bindingSelector.
+func setBindingRules(spec *utils.PolicyGenTempSpec, selector utils.ClusterSelector, claimSelector *utils.ClusterSelector) error {
+	rules := make(map[string]string)
+	excludedRules := make(map[string]string)
+	excluded := false
+	lastKey := ""
+	idx := 0
+	for ; idx < len(selector.MatchExpressions); idx++ {
+		requirement, err := toRequirement(selector.MatchExpressions[idx])
+		if err != nil {
+			return err
+		}
+		value, isRule, isExcluded := bindingRuleValue(requirement)
+		if !isRule || (excluded && !isExcluded) {
+			break
+		}
+		if isExcluded && !excluded {
+			excluded = true
+			lastKey = ""
+		}
+		if requirement.Key <= lastKey {
+			// Not in the order the PolicyBuilder renders the binding rules
+			break
+		}
+		if _, found := rules[requirement.Key]; found && isExcluded {
+			break
+		}
+		lastKey = requirement.Key
+		if isExcluded {
+			excludedRules[requirement.Key] = value
+		} else {
+			rules[requirement.Key] = value
+		}
+	}
+	if len(rules) > 0 {
+		spec.BindingRules = rules
+	}
+	if len(excludedRules) > 0 {
+		spec.BindingExcludedRules = excludedRules
+	}
+
+	bindingSelector := utils.BindingSelector{}
+	bindingSelector.LabelSelector.MatchLabels = selector.MatchLabels
+	for _, expression := range selector.MatchExpressions[idx:] {
+		requirement, err := toRequirement(expression)
+		if err != nil {
+			return err
+		}
+		bindingSelector.LabelSelector.MatchExpressions = append(bindingSelector.LabelSelector.MatchExpressions, requirement)
+	}
+	if claimSelector != nil {
+		for _, expression := range claimSelector.MatchExpressions {
+			requirement, err := toRequirement(expression)
+			if err != nil {
+				return err
+			}
+			bindingSelector.ClaimSelector.MatchExpressions = append(bindingSelector.ClaimSelector.MatchExpressions, requirement)
+		}
+	}
+	if len(bindingSelector.LabelSelector.MatchLabels) > 0 || len(bindingSelector.LabelSelector.MatchExpressions) > 0 ||
+		len(bindingSelector.ClaimSelector.MatchExpressions) > 0 {
+		spec.BindingSelector = &bindingSelector
+	}
+	return nil
+}
+
+// bindingRuleValue returns the value of the binding rule rendered as the
+// requirement, whether the requirement is rendered from a binding rule and
+// whether it is an excluded one
+func bindingRuleValue(requirement metav1.LabelSelectorRequirement) (string, bool, bool) {
+	excluded := false
+	switch requirement.Operator {
+	case utils.ExistOper:
+		return "", len(requirement.Values) == 0, false
+	case utils.DoesNotExistOper:
+		return "", len(requirement.Values) == 0, true
+	case utils.NotInOper:
+		excluded = true
+	case utils.InOper:
+	default:
+		return "", false, false
+	}
+	if len(requirement.Values) == 0 {
+		return "", false, false
+	}
+	for _, value := range requirement.Values {
+		// The binding rule values are split on the commas
+		if value == "" || strings.Contains(value, ",") {
+			return "", false, false
+		}
+	}
+	return strings.Join(requirement.Values, ","), true, excluded
+}
+
+func toRequirement(expression map[string]interface{}) (metav1.LabelSelectorRequirement, error) {
+	requirement := metav1.LabelSelectorRequirement{}
+	key, _ := expression["key"].(string)
+	operator, _ := expression["operator"].(string)
+	if key == "" || operator == "" {
+		return requirement, fmt.Errorf("invalid cluster selector expression %v: the key and operator must be set", expression)
+	}
+	requirement.Key = key
+	requirement.Operator = metav1.LabelSelectorOperator(operator)
+	if values, found := expression["values"]; found {
+		list, isList := values.([]interface{})
+		if !isList {
+			return requirement, fmt.Errorf("invalid cluster selector expression %v: the values must be a list", expression)
+		}
+		for _, value := range list {
+			requirement.Values = append(requirement.Values, fmt.Sprint(value))
+		}
+	}
+	return requirement, nil
+}
+
+// setPlacement sets the placement settings of the PGT spec from the
+// PlacementRule or Placement of the PlacementBinding
+func setPlacement(spec *utils.PolicyGenTempSpec, placement interface{}) error {
+	switch typed := placement.(type) {
+	case utils.PlacementRule:
+		spec.PlacementKind = utils.PlacementRuleKind
+		return setBindingRules(spec, typed.Spec.ClusterSelector, nil)
+	case utils.Placement:
+		spec.PlacementKind = utils.PlacementKind
+		switch len(typed.Spec.ClusterSets) {
+		case 0:
+			spec.ClusterSet = utils.DefaultClusterSet
+		case 1:
+			spec.ClusterSet = typed.Spec.ClusterSets[0]
+		default:
+			return fmt.Errorf("Placement %s selects several ManagedClusterSets %v, the PGT only supports one",
+				typed.Metadata.Name, typed.Spec.ClusterSets)
+		}
+		spec.PlacementTolerations = typed.Spec.Tolerations
+		switch len(typed.Spec.Predicates) {
+		case 0:
+			return nil
+		case 1:
+			predicate := typed.Spec.Predicates[0].RequiredClusterSelector
+			return setBindingRules(spec, predicate.LabelSelector, predicate.ClaimSelector)
+		}
+		return fmt.Errorf("Placement %s has several predicates, the PGT only supports one", typed.Metadata.Name)
+	}
+	return fmt.Errorf("unsupported placement %T", placement)
+}
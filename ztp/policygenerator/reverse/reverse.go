@@ -0,0 +1,275 @@
+// Package reverse reverse-engineers PolicyGenTemplates from existing ACM
+// policies. Each objectDefinition of the policies is matched to the closest
+// source CR of the source directory and the minimal overlay turning the source
+// CR into the objectDefinition is computed. The PGTs are then built again and
+// the output is compared to the input policies, which proves the PGTs
+// reproduce them.
+package reverse
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	policyGen "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/policyGen"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+)
+
+const pgtApiVersion = "ran.openshift.io/v1"
+const pgtKind = "PolicyGenTemplate"
+const policyKind = "Policy"
+const placementBindingKind = "PlacementBinding"
+const managedClusterSetBindingKind = "ManagedClusterSetBinding"
+const configurationPolicyKind = "ConfigurationPolicy"
+const rootPolicyLabel = "policy.open-cluster-management.io/root-policy"
+const placementBindingSuffix = "-placementbinding"
+const configPolicySuffix = "-config"
+const defaultRemediationAction = "inform"
+
+// mcp values tried when the source CRs hold the $mcp placeholder
+var mcpCandidates = []string{"", "master", "worker"}
+
+// Metadata set by the API server, which isn't part of the generated objects
+var serverMetadata = []string{"uid", "resourceVersion", "generation", "creationTimestamp", "managedFields", "selfLink", "ownerReferences"}
+
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Result of the reverse engineering of the policies
+type Result struct {
+	PolicyGenTemplates []utils.PolicyGenTemplate
+	// Content of the source CRs written for the objectDefinitions without a
+	// matching source CR, by sourceFile fileName
+	CustomSourceCRs map[string][]byte
+	// Input objects which are not reproduced by the PGTs
+	Warnings []string
+	// Differences between the objects built from the PGTs and the input ones
+	Differences []string
+}
+
+type objectKey struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func (key objectKey) String() string {
+	return fmt.Sprintf("%s %s/%s", key.kind, key.namespace, key.name)
+}
+
+func keyOf(object map[string]interface{}) objectKey {
+	kind, _ := object["kind"].(string)
+	metadata, _ := object["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+	return objectKey{kind, namespace, name}
+}
+
+type reverser struct {
+	index     *sourceCRIndex
+	sourceDir string
+	builder   *policyGen.PolicyBuilder
+	objects   map[objectKey]map[string]interface{}
+	result    *Result
+}
+
+// Reverse returns the PolicyGenTemplates reproducing the Policies bound by the
+// PlacementBindings of the objects, with their PlacementRules or Placements,
+// PolicySets and ManagedClusterSetBindings. Each PlacementBinding gives a PGT.
+// The objectDefinitions are matched to the source CRs of sourceDir.
+func Reverse(objects []map[string]interface{}, sourceDir string) (*Result, error) {
+	index, err := loadSourceCRs(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+	rev := &reverser{
+		index:     index,
+		sourceDir: sourceDir,
+		builder:   policyGen.NewPolicyBuilder(utils.NewFilesHandler(sourceDir, "", "")),
+		objects:   make(map[objectKey]map[string]interface{}),
+		result:    &Result{CustomSourceCRs: make(map[string][]byte)},
+	}
+
+	bindings := make([]objectKey, 0)
+	for _, object := range objects {
+		object = cleanObject(object)
+		key := keyOf(object)
+		if key.kind == "" || key.name == "" {
+			return nil, errors.New("all the objects must set their kind and metadata.name")
+		}
+		if key.kind == policyKind && isReplicatedPolicy(object) {
+			rev.warn("%s is replicated from a root policy, skipping it", key)
+			continue
+		}
+		rev.objects[key] = object
+		if key.kind == placementBindingKind {
+			bindings = append(bindings, key)
+		}
+	}
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i].String() < bindings[j].String() })
+
+	bound := make(map[objectKey]bool)
+	for _, binding := range bindings {
+		pgt, inputs, err := rev.reverseBinding(binding)
+		if err != nil {
+			rev.warn("%s: %s", binding, err)
+			continue
+		}
+		for _, input := range inputs {
+			bound[input] = true
+		}
+		rev.result.PolicyGenTemplates = append(rev.result.PolicyGenTemplates, pgt)
+		if err := rev.verify(pgt, inputs); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]objectKey, 0, len(rev.objects))
+	for key := range rev.objects {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	for _, key := range keys {
+		if !bound[key] && key.kind != placementBindingKind {
+			rev.warn("%s is not bound by any of the PlacementBindings, skipping it", key)
+		}
+	}
+	return rev.result, nil
+}
+
+func (rev *reverser) warn(format string, args ...interface{}) {
+	rev.result.Warnings = append(rev.result.Warnings, fmt.Sprintf(format, args...))
+}
+
+// reverseBinding returns the PGT reproducing the PlacementBinding, and the
+// input objects it reproduces
+func (rev *reverser) reverseBinding(bindingKey objectKey) (utils.PolicyGenTemplate, []objectKey, error) {
+	binding := utils.PlacementBinding{}
+	if err := convert(rev.objects[bindingKey], &binding); err != nil {
+		return utils.PolicyGenTemplate{}, nil, err
+	}
+	pgt, err := newPolicyGenTemplate(strings.TrimSuffix(binding.Metadata.Name, placementBindingSuffix), bindingKey.namespace)
+	if err != nil {
+		return pgt, nil, err
+	}
+	inputs := []objectKey{bindingKey}
+
+	placementKey := objectKey{binding.PlacementRef.Kind, bindingKey.namespace, binding.PlacementRef.Name}
+	placementObject, found := rev.objects[placementKey]
+	if !found {
+		return pgt, nil, fmt.Errorf("%s is not found", placementKey)
+	}
+	var placement interface{}
+	switch placementKey.kind {
+	case utils.PlacementRuleKind:
+		placementRule := utils.PlacementRule{}
+		err = convert(placementObject, &placementRule)
+		placement = placementRule
+	case utils.PlacementKind:
+		typed := utils.Placement{}
+		err = convert(placementObject, &typed)
+		placement = typed
+	default:
+		return pgt, nil, fmt.Errorf("placementRef of kind %s is not supported", placementKey.kind)
+	}
+	if err != nil {
+		return pgt, nil, err
+	}
+	if err := setPlacement(&pgt.Spec, placement); err != nil {
+		return pgt, nil, err
+	}
+	inputs = append(inputs, placementKey)
+	if placementKey.kind == utils.PlacementKind {
+		clusterSetBindingKey := objectKey{managedClusterSetBindingKind, bindingKey.namespace, pgt.Spec.ClusterSet}
+		if _, found := rev.objects[clusterSetBindingKey]; found {
+			inputs = append(inputs, clusterSetBindingKey)
+			pgt.Spec.ClusterSetBinding = true
+		}
+	}
+
+	policyNames := make([]string, 0)
+	for _, subject := range binding.Subjects {
+		switch subject.Kind {
+		case policyKind:
+			policyNames = append(policyNames, subject.Name)
+		case utils.PolicySetKind:
+			if len(binding.Subjects) > 1 {
+				return pgt, nil, errors.New("binding a PolicySet together with other subjects is not supported")
+			}
+			policySetKey := objectKey{utils.PolicySetKind, bindingKey.namespace, subject.Name}
+			policySet := utils.PolicySet{}
+			if _, found := rev.objects[policySetKey]; !found {
+				return pgt, nil, fmt.Errorf("%s is not found", policySetKey)
+			}
+			if err := convert(rev.objects[policySetKey], &policySet); err != nil {
+				return pgt, nil, err
+			}
+			pgt.Spec.PolicySet = &utils.PolicySetSpec{}
+			if policySet.Metadata.Name != pgt.Metadata.Name {
+				pgt.Spec.PolicySet.Name = policySet.Metadata.Name
+			}
+			if policySet.Spec.Description != fmt.Sprintf("Policies generated from PolicyGenTemplate %s/%s", pgt.Metadata.Namespace, pgt.Metadata.Name) {
+				pgt.Spec.PolicySet.Description = policySet.Spec.Description
+			}
+			policyNames = append(policyNames, policySet.Spec.Policies...)
+			inputs = append(inputs, policySetKey)
+		default:
+			return pgt, nil, fmt.Errorf("subject of kind %s is not supported", subject.Kind)
+		}
+	}
+
+	policies := make([]map[string]interface{}, 0, len(policyNames))
+	for _, name := range policyNames {
+		policyKey := objectKey{policyKind, bindingKey.namespace, name}
+		policy, found := rev.objects[policyKey]
+		if !found {
+			rev.warn("%s: %s is not found", bindingKey, policyKey)
+			continue
+		}
+		policies = append(policies, policy)
+		inputs = append(inputs, policyKey)
+	}
+	if len(policies) == 0 {
+		return pgt, nil, errors.New("none of the bound policies is found")
+	}
+
+	// The source CRs holding $mcp are matched for each mcp, keeping the mcp
+	// giving the smallest overlays
+	mcps := []string{""}
+	if rev.index.usesMcp() {
+		mcps = mcpCandidates
+	}
+	var best *policyMatcher
+	for _, mcp := range mcps {
+		pgt.Spec.Mcp = mcp
+		matcher := &policyMatcher{reverser: rev, pgt: pgt, custom: make(map[string][]byte)}
+		for _, policy := range policies {
+			if err := matcher.reversePolicy(policy); err != nil {
+				return pgt, nil, err
+			}
+		}
+		if best == nil || matcher.size < best.size {
+			best = matcher
+		}
+	}
+	pgt.Spec.Mcp = best.pgt.Spec.Mcp
+	pgt.Spec.SourceFiles = best.sourceFiles
+	rev.result.Warnings = append(rev.result.Warnings, best.warnings...)
+	for fileName, content := range best.custom {
+		rev.result.CustomSourceCRs[fileName] = content
+	}
+
+	for _, policy := range policies {
+		spec, _ := policy["spec"].(map[string]interface{})
+		if _, found := spec["dependencies"]; found {
+			pgt.Spec.WaveDependencies = utils.WaveDependencies
+		}
+		templates, _ := spec["policy-templates"].([]interface{})
+		for _, template := range templates {
+			if templateMap, isMap := template.(map[string]interface{}); isMap && templateMap["extraDependencies"] != nil {
+				pgt.Spec.WaveDependencies = utils.WaveExtraDependencies
+			}
+		}
+	}
+	return pgt, inputs, nil
+}
@@ -0,0 +1,282 @@
+package reverse
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	policyGen "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/policyGen"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v3"
+)
+
+const sourceDir = "../policyGen/testData/GenericSourceFiles"
+
+// generate returns the objects built from the PGT, as read from the hub
+func generate(t *testing.T, input string) []map[string]interface{} {
+	pgt := utils.PolicyGenTemplate{}
+	assert.NoError(t, yaml.Unmarshal([]byte(input), &pgt))
+	outputs, err := policyGen.NewPolicyBuilder(utils.NewFilesHandler(sourceDir, "", "")).Build(pgt)
+	assert.NoError(t, err)
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	objects := make([]map[string]interface{}, 0, len(outputs))
+	for _, name := range names {
+		object := make(map[string]interface{})
+		assert.NoError(t, convert(outputs[name], &object))
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+func reverseOne(t *testing.T, objects []map[string]interface{}) (*Result, utils.PolicyGenTemplate) {
+	result, err := Reverse(objects, sourceDir)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Differences)
+	assert.Equal(t, 1, len(result.PolicyGenTemplates))
+	return result, result.PolicyGenTemplates[0]
+}
+
+func TestReverseRoundTrip(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  bindingExcludedRules:
+    skip: ""
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+      metadata:
+        labels:
+          extra: "yes"
+    - fileName: GenericSubscription.yaml
+      policyName: "gen-policy"
+      spec:
+        channel: "stable"
+    - fileName: GenericPtpConfig.yaml
+      policyName: "ptp-policy"
+      remediationAction: enforce
+      severity: high
+      spec:
+        profile:
+          - name: "slave"
+            interface: ens5f0
+`
+	result, pgt := reverseOne(t, generate(t, input))
+	assert.Empty(t, result.Warnings)
+	assert.Empty(t, result.CustomSourceCRs)
+	assert.Equal(t, map[string]string{"justfortest": "true"}, pgt.Spec.BindingRules)
+	assert.Equal(t, map[string]string{"skip": ""}, pgt.Spec.BindingExcludedRules)
+	assert.Nil(t, pgt.Spec.BindingSelector)
+
+	sourceFiles := pgt.Spec.SourceFiles
+	assert.Equal(t, 3, len(sourceFiles))
+	assert.Equal(t, "GenericNamespace.yaml", sourceFiles[0].FileName)
+	assert.Equal(t, "gen-policy", sourceFiles[0].PolicyName)
+	assert.Equal(t, map[string]string{"extra": "yes"}, sourceFiles[0].Metadata.Labels)
+	assert.Equal(t, "GenericSubscription.yaml", sourceFiles[1].FileName)
+	assert.Equal(t, map[string]interface{}{"channel": "stable"}, sourceFiles[1].Spec)
+	assert.Equal(t, "GenericPtpConfig.yaml", sourceFiles[2].FileName)
+	assert.Equal(t, "ptp-policy", sourceFiles[2].PolicyName)
+	assert.Equal(t, "enforce", sourceFiles[2].RemediationAction)
+	assert.Equal(t, "high", sourceFiles[2].Severity)
+	// The placeholders without values are dropped by the merge
+	assert.Equal(t, map[string]interface{}{"profile": []interface{}{map[string]interface{}{"interface": "ens5f0"}}},
+		sourceFiles[2].Spec)
+	assert.Empty(t, sourceFiles[2].Patches)
+
+	// The written PGT builds the same policies
+	content, err := MarshalPolicyGenTemplate(pgt)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), utils.UnsetStringValue)
+	assert.NotContains(t, string(content), "wrapInPolicy")
+	assert.Equal(t, generate(t, input), generate(t, string(content)))
+}
+
+func TestReversePatches(t *testing.T) {
+	input := `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  placementKind: Placement
+  clusterSet: ran
+  clusterSetBinding: true
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericCR.yaml
+      policyName: "gen-policy"
+      complianceType: mustonlyhave
+      metadataComplianceType: musthave
+      recordDiff: Log
+      patches:
+        - op: remove
+          path: /spec/topMap/subMap/key2
+        - op: replace
+          path: /spec/topListMap
+          value:
+            - mapKey1: zzz
+`
+	result, pgt := reverseOne(t, generate(t, input))
+	assert.Empty(t, result.CustomSourceCRs)
+	assert.Equal(t, utils.PlacementKind, pgt.Spec.PlacementKind)
+	assert.Equal(t, "ran", pgt.Spec.ClusterSet)
+	assert.True(t, pgt.Spec.ClusterSetBinding)
+
+	sFile := pgt.Spec.SourceFiles[0]
+	assert.Equal(t, "GenericCR.yaml", sFile.FileName)
+	assert.Equal(t, "mustonlyhave", sFile.ComplianceType)
+	assert.Equal(t, "musthave", sFile.MetadataComplianceType)
+	assert.Equal(t, "Log", sFile.RecordDiff)
+	assert.Equal(t, []utils.PatchOperation{
+		{Op: "replace", Path: "/spec/topListMap", Value: []interface{}{map[string]interface{}{"mapKey1": "zzz"}}},
+		{Op: "remove", Path: "/spec/topMap/subMap/key2"},
+	}, sFile.Patches)
+}
+
+func TestReverseCustomSourceCR(t *testing.T) {
+	objects := generate(t, `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericConfig.yaml
+      policyName: "gen-policy"
+`)
+	// An object the source CRs don't hold, written by hand in the policy
+	policy := objects[0]
+	templates := policy["spec"].(map[string]interface{})["policy-templates"].([]interface{})
+	configPolicy := templates[0].(map[string]interface{})["objectDefinition"].(map[string]interface{})
+	objTemplates := configPolicy["spec"].(map[string]interface{})["object-templates"].([]interface{})
+	configPolicy["spec"].(map[string]interface{})["object-templates"] = append(objTemplates, map[string]interface{}{
+		"complianceType": "musthave",
+		"objectDefinition": map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "handwritten", "namespace": "default"},
+			"data":       map[string]interface{}{"key": "value"},
+		},
+	})
+	// Unbound objects are reported
+	objects = append(objects, map[string]interface{}{"kind": "Policy", "metadata": map[string]interface{}{"name": "other", "namespace": "test1"}})
+
+	result, pgt := reverseOne(t, objects)
+	assert.Equal(t, []string{"Policy test1/other is not bound by any of the PlacementBindings, skipping it"}, result.Warnings)
+	assert.Equal(t, 2, len(pgt.Spec.SourceFiles))
+	assert.Equal(t, "GenericConfig.yaml", pgt.Spec.SourceFiles[0].FileName)
+	assert.Equal(t, "ConfigMap-handwritten-default.yaml", pgt.Spec.SourceFiles[1].FileName)
+
+	custom := make(map[string]interface{})
+	assert.NoError(t, yaml.Unmarshal(result.CustomSourceCRs["ConfigMap-handwritten-default.yaml"], &custom))
+	// The custom source CR carries the policy wave
+	assert.Equal(t, map[string]interface{}{utils.ZtpDeployWaveAnnotation: "2"},
+		custom["metadata"].(map[string]interface{})["annotations"])
+}
+
+func TestReverseDifferences(t *testing.T) {
+	objects := generate(t, `
+apiVersion: ran.openshift.io/v1
+kind: PolicyGenTemplate
+metadata:
+  name: "test1"
+  namespace: "test1"
+spec:
+  bindingRules:
+    justfortest: "true"
+  sourceFiles:
+    - fileName: GenericNamespace.yaml
+      policyName: "gen-policy"
+`)
+	// The policy categories can't be set in a PGT
+	objects[0]["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})["policy.open-cluster-management.io/categories"] = "custom"
+	result, err := Reverse(objects, sourceDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Policy test1/test1-gen-policy differs: .metadata.annotations.policy.open-cluster-management.io/categories " +
+		"is custom in the input and CM Configuration Management generated"}, result.Differences)
+}
+
+func TestSetBindingRules(t *testing.T) {
+	tests := []struct {
+		selector string
+		expected string
+	}{{
+		selector: `
+matchExpressions:
+  - {key: a, operator: In, values: [x, y]}
+  - {key: b, operator: Exists}
+  - {key: c, operator: DoesNotExist}
+  - {key: d, operator: NotIn, values: [z]}
+`,
+		expected: `
+bindingRules: {a: "x,y", b: ""}
+bindingExcludedRules: {c: "", d: z}
+`,
+	}, {
+		// Out of order expressions and matchLabels go to the bindingSelector
+		selector: `
+matchLabels: {site: sno}
+matchExpressions:
+  - {key: b, operator: In, values: [x]}
+  - {key: a, operator: In, values: [y]}
+  - {key: c, operator: Gt, values: ["1"]}
+`,
+		expected: `
+bindingRules: {b: x}
+bindingSelector:
+  matchLabels: {site: sno}
+  matchExpressions:
+    - {key: a, operator: In, values: [y]}
+    - {key: c, operator: Gt, values: ["1"]}
+`,
+	}}
+	for _, test := range tests {
+		selector := utils.ClusterSelector{}
+		assert.NoError(t, yaml.Unmarshal([]byte(test.selector), &selector))
+		spec := utils.PolicyGenTempSpec{}
+		assert.NoError(t, setBindingRules(&spec, selector, nil))
+		expected := utils.PolicyGenTempSpec{}
+		assert.NoError(t, yaml.Unmarshal([]byte(test.expected), &expected))
+		assert.Equal(t, expected.BindingRules, spec.BindingRules)
+		assert.Equal(t, expected.BindingExcludedRules, spec.BindingExcludedRules)
+		assert.Equal(t, expected.BindingSelector, spec.BindingSelector)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	objects, err := Decode(strings.NewReader(`
+apiVersion: v1
+kind: List
+items:
+  - kind: Policy
+    metadata: {name: a}
+  - kind: Policy
+    metadata: {name: b}
+---
+kind: PlacementBinding
+metadata: {name: c}
+`))
+	assert.NoError(t, err)
+	names := make([]string, 0)
+	for _, object := range objects {
+		names = append(names, keyOf(object).name)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+}
@@ -0,0 +1,146 @@
+package reverse
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// sourceCR is a single-document source CR of the source directory
+type sourceCR struct {
+	// Path relative to the source directory, used as sourceFile fileName
+	fileName string
+	content  string
+	kind     string
+}
+
+// usesMcp returns true when the source CR holds the $mcp placeholder replaced
+// by the PGT mcp
+func (cr sourceCR) usesMcp() bool {
+	return strings.Contains(cr.content, "$mcp")
+}
+
+// resource returns the source CR as the PolicyBuilder reads it for the mcp
+func (cr sourceCR) resource(mcp string) (map[string]interface{}, error) {
+	content := cr.content
+	if mcp != "" {
+		content = strings.Replace(content, "$mcp", mcp, -1)
+	}
+	resource := make(map[string]interface{})
+	err := yaml.Unmarshal([]byte(content), &resource)
+	return resource, err
+}
+
+// sourceCRIndex indexes the source CRs by kind
+type sourceCRIndex struct {
+	byKind map[string][]sourceCR
+	files  map[string]bool
+}
+
+// loadSourceCRs reads the single-document source CRs of the directory and its
+// sub-directories. Multi-document files are not candidates, as their
+// documents can't be matched on their own.
+func loadSourceCRs(sourceDir string) (*sourceCRIndex, error) {
+	index := &sourceCRIndex{byKind: make(map[string][]sourceCR), files: make(map[string]bool)}
+	err := filepath.WalkDir(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+		fileName, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		fileName = filepath.ToSlash(fileName)
+		index.files[fileName] = true
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		documents, err := decodeDocuments(content)
+		if err != nil || len(documents) != 1 {
+			// Not a source CR, or not a single one
+			return nil
+		}
+		kind, _ := documents[0]["kind"].(string)
+		if _, found := documents[0]["metadata"]; !found || kind == "" {
+			return nil
+		}
+		index.byKind[kind] = append(index.byKind[kind], sourceCR{fileName: fileName, content: string(content), kind: kind})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, candidates := range index.byKind {
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].fileName < candidates[j].fileName })
+	}
+	return index, nil
+}
+
+// Decode returns the objects of the YAML documents, expanding the items of
+// the List documents such as the output of oc get -o yaml
+func Decode(in io.Reader) ([]map[string]interface{}, error) {
+	content, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	documents, err := decodeDocuments(content)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]map[string]interface{}, 0, len(documents))
+	for _, document := range documents {
+		if kind, _ := document["kind"].(string); strings.HasSuffix(kind, "List") {
+			if items, isList := document["items"].([]interface{}); isList {
+				for _, item := range items {
+					if object, isMap := item.(map[string]interface{}); isMap {
+						objects = append(objects, object)
+					}
+				}
+				continue
+			}
+		}
+		objects = append(objects, document)
+	}
+	return objects, nil
+}
+
+func decodeDocuments(content []byte) ([]map[string]interface{}, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	documents := make([]map[string]interface{}, 0)
+	for {
+		document := make(map[string]interface{})
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(document) > 0 {
+			documents = append(documents, document)
+		}
+	}
+	return documents, nil
+}
+
+// usesMcp returns true when any of the source CRs holds the $mcp placeholder
+func (index *sourceCRIndex) usesMcp() bool {
+	for _, candidates := range index.byKind {
+		for _, candidate := range candidates {
+			if candidate.usesMcp() {
+				return true
+			}
+		}
+	}
+	return false
+}
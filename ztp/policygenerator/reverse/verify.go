@@ -0,0 +1,196 @@
+package reverse
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	policyGen "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/policyGen"
+	utils "github.com/openshift-kni/cnf-features-deploy/ztp/policygenerator/utils"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// verify builds the PGT from its source CRs, the matched ones and the custom
+// ones, and records the differences between the built objects and the input
+// objects the PGT reproduces
+func (rev *reverser) verify(pgt utils.PolicyGenTemplate, inputs []objectKey) error {
+	pgtKey := objectKey{pgtKind, pgt.Metadata.Namespace, pgt.Metadata.Name}
+	dir, err := os.MkdirTemp("", "pgt-from-policies-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	for _, sFile := range pgt.Spec.SourceFiles {
+		content, found := rev.result.CustomSourceCRs[sFile.FileName]
+		if !found {
+			if content, err = os.ReadFile(filepath.Join(rev.sourceDir, sFile.FileName)); err != nil {
+				return err
+			}
+		}
+		filePath := filepath.Join(dir, sFile.FileName)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			return err
+		}
+	}
+
+	outputs, err := policyGen.NewPolicyBuilder(utils.NewFilesHandler(dir, "", "")).Build(pgt)
+	if err != nil {
+		rev.difference("%s fails to build: %s", pgtKey, err)
+		return nil
+	}
+	generated := make(map[objectKey]map[string]interface{}, len(outputs))
+	for _, output := range outputs {
+		object := make(map[string]interface{})
+		if err := convert(output, &object); err != nil {
+			return err
+		}
+		generated[keyOf(object)] = object
+	}
+	for _, key := range inputs {
+		object, found := generated[key]
+		if !found {
+			rev.difference("%s is not generated by %s", key, pgtKey)
+			continue
+		}
+		for _, difference := range diffValues(normalize(rev.objects[key]), normalize(object), "") {
+			rev.difference("%s differs: %s", key, difference)
+		}
+		delete(generated, key)
+	}
+	extra := make([]string, 0, len(generated))
+	for key := range generated {
+		extra = append(extra, key.String())
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		rev.difference("%s is generated by %s but not in the input", key, pgtKey)
+	}
+	return nil
+}
+
+func (rev *reverser) difference(format string, args ...interface{}) {
+	rev.result.Differences = append(rev.result.Differences, fmt.Sprintf(format, args...))
+}
+
+// diffValues returns the paths at which the generated value differs from the
+// input one
+func diffValues(input interface{}, generated interface{}, path string) []string {
+	display := path
+	if display == "" {
+		display = "."
+	}
+	switch typed := input.(type) {
+	case map[string]interface{}:
+		generatedMap, isMap := generated.(map[string]interface{})
+		if !isMap {
+			break
+		}
+		differences := make([]string, 0)
+		for _, key := range sortedKeys(union(typed, generatedMap)) {
+			inputValue, inInput := typed[key]
+			generatedValue, inGenerated := generatedMap[key]
+			switch {
+			case !inGenerated:
+				differences = append(differences, fmt.Sprintf("%s.%s is not generated", path, key))
+			case !inInput:
+				differences = append(differences, fmt.Sprintf("%s.%s is generated but not in the input", path, key))
+			default:
+				differences = append(differences, diffValues(inputValue, generatedValue, path+"."+key)...)
+			}
+		}
+		return differences
+	case []interface{}:
+		generatedList, isList := generated.([]interface{})
+		if !isList {
+			break
+		}
+		if len(typed) != len(generatedList) {
+			return []string{fmt.Sprintf("%s has %d entries in the input and %d generated", display, len(typed), len(generatedList))}
+		}
+		differences := make([]string, 0)
+		for idx := range typed {
+			differences = append(differences, diffValues(typed[idx], generatedList[idx], fmt.Sprintf("%s[%d]", path, idx))...)
+		}
+		return differences
+	}
+	if equal(input, generated) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s is %v in the input and %v generated", display, input, generated)}
+}
+
+// MarshalPolicyGenTemplate returns the YAML of the PGT without the values set
+// to their defaults, which the PGT YAML decoding sets again
+func MarshalPolicyGenTemplate(pgt utils.PolicyGenTemplate) ([]byte, error) {
+	spec := pgt.Spec
+	spec.WrapInPolicy = false
+	spec.RemediationAction = ""
+	spec.ComplianceType = ""
+	spec.EvaluationInterval = utils.EvaluationInterval{}
+	spec.ListMerge = ""
+	if spec.PlacementKind == utils.PlacementRuleKind {
+		spec.PlacementKind = ""
+	}
+	if spec.ClusterSet == utils.DefaultClusterSet {
+		spec.ClusterSet = ""
+	}
+	spec.Severity = ""
+	spec.SourceFiles = make([]utils.SourceFile, len(pgt.Spec.SourceFiles))
+	for idx, sFile := range pgt.Spec.SourceFiles {
+		for _, value := range []*string{&sFile.ComplianceType, &sFile.RemediationAction, &sFile.EvaluationInterval.Compliant,
+			&sFile.EvaluationInterval.NonCompliant, &sFile.ListMerge, &sFile.Severity, &sFile.PruneObjectBehavior} {
+			if *value == utils.UnsetStringValue {
+				*value = ""
+			}
+		}
+		spec.SourceFiles[idx] = sFile
+	}
+	pgt.Spec = spec
+
+	node := yaml.Node{}
+	if err := node.Encode(pgt); err != nil {
+		return nil, err
+	}
+	// The sourceFiles overriding only the labels or annotations have an
+	// empty metadata.name
+	if sourceFiles := mappingValue(mappingValue(&node, "spec"), "sourceFiles"); sourceFiles != nil {
+		for _, sFile := range sourceFiles.Content {
+			metadata := mappingValue(sFile, "metadata")
+			if metadata == nil {
+				continue
+			}
+			for idx := 0; idx+1 < len(metadata.Content); idx += 2 {
+				if metadata.Content[idx].Value == "name" && metadata.Content[idx+1].Value == "" {
+					metadata.Content = append(metadata.Content[:idx], metadata.Content[idx+2:]...)
+					break
+				}
+			}
+		}
+	}
+
+	out := bytes.Buffer{}
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	err := encoder.Close()
+	return out.Bytes(), err
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			return node.Content[idx+1]
+		}
+	}
+	return nil
+}
@@ -1,20 +1,86 @@
 package utils
 
 import (
+	"bytes"
 	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
 )
 
 type FilesHandler struct {
 	sourceDir string
 	PgtDir    string
 	OutDir    string
+	// Resolves the sourceCRsRef of the PGTs, and the default one when set
+	sourceCRs    *SourceCRsStore
+	sourceCRsRef string
+	// Shared with the FilesHandlers of the sourceCRsRefs
+	cache *sourceCRsCache
+}
+
+// sourceCRsCache holds the documents of the source CR files already read, so
+// that each file is read and parsed once however many PGTs use it, the PGTs
+// being possibly built concurrently
+type sourceCRsCache struct {
+	mutex sync.Mutex
+	files map[string]*cachedSourceCR
+}
+
+type cachedSourceCR struct {
+	once      sync.Once
+	documents [][]byte
+	err       error
 }
 
 func NewFilesHandler(sourceDir string, pgtDir string, OutDir string) *FilesHandler {
-	return &FilesHandler{sourceDir: sourceDir, PgtDir: pgtDir, OutDir: OutDir}
+	return &FilesHandler{sourceDir: sourceDir, PgtDir: pgtDir, OutDir: OutDir,
+		cache: &sourceCRsCache{files: make(map[string]*cachedSourceCR)}}
+}
+
+// SetSourceCRs sets the store resolving the sourceCRsRefs, and the default
+// sourceCRsRef used instead of the source directory by the PGTs without one
+func (fHandler *FilesHandler) SetSourceCRs(store *SourceCRsStore, defaultRef string) {
+	fHandler.sourceCRs = store
+	fHandler.sourceCRsRef = defaultRef
+}
+
+// ForSourceCRsRef returns a FilesHandler reading the source CRs from the
+// bundle of the ref, or from the default ref when empty. It returns the
+// fHandler itself when neither is set.
+func (fHandler *FilesHandler) ForSourceCRsRef(ref string) (*FilesHandler, error) {
+	if ref == "" {
+		ref = fHandler.sourceCRsRef
+	}
+	if ref == "" {
+		return fHandler, nil
+	}
+	fHandler.cache.mutex.Lock()
+	if fHandler.sourceCRs == nil {
+		store, err := NewSourceCRsStore("", "")
+		if err != nil {
+			fHandler.cache.mutex.Unlock()
+			return nil, err
+		}
+		fHandler.sourceCRs = store
+	}
+	fHandler.cache.mutex.Unlock()
+	dir, err := fHandler.sourceCRs.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	return &FilesHandler{
+		sourceDir:    dir,
+		PgtDir:       fHandler.PgtDir,
+		OutDir:       fHandler.OutDir,
+		sourceCRs:    fHandler.sourceCRs,
+		sourceCRsRef: fHandler.sourceCRsRef,
+		cache:        fHandler.cache,
+	}, nil
 }
 
 func (fHandler *FilesHandler) WriteFile(filePath string, content []byte) error {
@@ -54,6 +120,62 @@ func (fHandler *FilesHandler) ReadSourceFile(fileName string) ([]byte, error) {
 	return fHandler.ReadFile(fHandler.sourceDir + "/" + fileName)
 }
 
+// ReadSourceDocuments returns the YAML documents of the source CR file, read
+// and split once for all the PGTs. The returned documents must not be
+// modified.
+func (fHandler *FilesHandler) ReadSourceDocuments(fileName string) ([][]byte, error) {
+	fHandler.cache.mutex.Lock()
+	key := fHandler.sourceDir + "/" + fileName
+	cached, found := fHandler.cache.files[key]
+	if !found {
+		cached = &cachedSourceCR{}
+		fHandler.cache.files[key] = cached
+	}
+	fHandler.cache.mutex.Unlock()
+
+	cached.once.Do(func() {
+		content, err := fHandler.ReadSourceFile(fileName)
+		if err != nil {
+			cached.err = err
+			return
+		}
+		cached.documents, cached.err = SplitYamls(content)
+	})
+	return cached.documents, cached.err
+}
+
+// SplitYamls returns the documents of the multi-document YAML, skipping the
+// empty ones
+func SplitYamls(yamls []byte) ([][]byte, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(yamls))
+	var resources [][]byte
+
+	for {
+		var resIntf interface{}
+		err := decoder.Decode(&resIntf)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Check that resIntf is not nil in order to mitigate appending an empty
+		// object as a result of redundant trailing seperator(s) "---""
+		if resIntf != nil {
+			resBytes, err := yaml.Marshal(resIntf)
+
+			if err != nil {
+				return nil, err
+			}
+
+			resources = append(resources, resBytes)
+		}
+	}
+	return resources, nil
+}
+
 func (fHandler *FilesHandler) ReadSourceCRFile(fileName string) ([]byte, error) {
 	var (
 		gitDir   = ""
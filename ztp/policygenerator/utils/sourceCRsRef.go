@@ -0,0 +1,398 @@
+package utils
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OCIRefPrefix prefixes the sourceCRsRef of an OCI image layout directory, as
+// in oci:<dir>[:<tag>]
+const OCIRefPrefix = "oci:"
+
+// SourceCRsLockFile is the default name of the lock file of the sourceCRsRef
+// digests
+const SourceCRsLockFile = "source-crs.lock"
+
+// Directories of an extracted bundle searched for the source CRs, the bundle
+// root being used when none exists
+var sourceCRsBundleDirs = []string{SourceCRsPath, "home/ztp/" + SourceCRsPath}
+
+const ociIndexMediaType = "application/vnd.oci.image.index.v1+json"
+const ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// SourceCRsLock pins the digest of each sourceCRsRef
+type SourceCRsLock struct {
+	SourceCRs []SourceCRsLockEntry `yaml:"sourceCRs"`
+}
+
+type SourceCRsLockEntry struct {
+	Ref    string `yaml:"ref"`
+	Digest string `yaml:"digest"`
+}
+
+// SourceCRsStore resolves sourceCRsRefs, versioned bundles of source CRs, to
+// the directory they are extracted to in a local cache. The digest of each
+// bundle is checked against the lock file, and recorded in it when missing.
+type SourceCRsStore struct {
+	cacheDir string
+	lockFile string
+	lock     map[string]string
+	modified bool
+	resolved map[string]string
+	mutex    sync.Mutex
+}
+
+// DefaultSourceCRsCacheDir returns the cache directory used when none is set
+func DefaultSourceCRsCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "ztp-policygenerator", SourceCRsPath)
+}
+
+// NewSourceCRsStore returns a store extracting the bundles to cacheDir, or to
+// the default cache directory when empty. The digests are verified against
+// lockFile when set.
+func NewSourceCRsStore(cacheDir string, lockFile string) (*SourceCRsStore, error) {
+	if cacheDir == "" {
+		cacheDir = DefaultSourceCRsCacheDir()
+	}
+	store := &SourceCRsStore{
+		cacheDir: cacheDir,
+		lockFile: lockFile,
+		lock:     make(map[string]string),
+		resolved: make(map[string]string),
+	}
+	if lockFile == "" {
+		return store, nil
+	}
+	content, err := os.ReadFile(lockFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lock := SourceCRsLock{}
+	if err := yaml.Unmarshal(content, &lock); err != nil {
+		return nil, fmt.Errorf("could not parse lock file %s: %s", lockFile, err)
+	}
+	for _, entry := range lock.SourceCRs {
+		store.lock[entry.Ref] = entry.Digest
+	}
+	return store, nil
+}
+
+// Resolve returns the directory holding the source CRs of the ref, extracting
+// the bundle to the cache unless already there
+func (store *SourceCRsStore) Resolve(ref string) (string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if dir, found := store.resolved[ref]; found {
+		return dir, nil
+	}
+
+	var (
+		digest  string
+		extract func(dir string) error
+		err     error
+	)
+	if strings.HasPrefix(ref, OCIRefPrefix) {
+		digest, extract, err = ociBundle(strings.TrimPrefix(ref, OCIRefPrefix))
+	} else {
+		digest, extract, err = tarballBundle(ref)
+	}
+	if err != nil {
+		return "", fmt.Errorf("sourceCRsRef %s: %s", ref, err)
+	}
+
+	if locked, found := store.lock[ref]; found && locked != digest {
+		return "", fmt.Errorf("sourceCRsRef %s: digest %s doesn't match %s locked in %s", ref, digest, locked, store.lockFile)
+	} else if !found && store.lockFile != "" {
+		store.lock[ref] = digest
+		store.modified = true
+	}
+
+	dir := filepath.Join(store.cacheDir, strings.Replace(digest, ":", "-", 1))
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if err := store.extract(dir, extract); err != nil {
+			return "", fmt.Errorf("sourceCRsRef %s: %s", ref, err)
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	for _, bundleDir := range sourceCRsBundleDirs {
+		if info, err := os.Stat(filepath.Join(dir, bundleDir)); err == nil && info.IsDir() {
+			dir = filepath.Join(dir, bundleDir)
+			break
+		}
+	}
+	store.resolved[ref] = dir
+	return dir, nil
+}
+
+// extract extracts the bundle to a temporary directory renamed once complete,
+// so that an interrupted extraction is never used
+func (store *SourceCRsStore) extract(dir string, extract func(dir string) error) error {
+	if err := os.MkdirAll(store.cacheDir, 0755); err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp(store.cacheDir, ".extract-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := extract(tmpDir); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		if _, statErr := os.Stat(dir); statErr == nil {
+			// Extracted concurrently by another run
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// WriteLock writes the lock file when new digests were recorded
+func (store *SourceCRsStore) WriteLock() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.lockFile == "" || !store.modified {
+		return nil
+	}
+	lock := SourceCRsLock{SourceCRs: make([]SourceCRsLockEntry, 0, len(store.lock))}
+	for ref, digest := range store.lock {
+		lock.SourceCRs = append(lock.SourceCRs, SourceCRsLockEntry{Ref: ref, Digest: digest})
+	}
+	sort.Slice(lock.SourceCRs, func(i, j int) bool { return lock.SourceCRs[i].Ref < lock.SourceCRs[j].Ref })
+	content, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(store.lockFile, content, 0644); err != nil {
+		return err
+	}
+	store.modified = false
+	return nil
+}
+
+// tarballBundle returns the digest of a tar, optionally gzipped, file
+func tarballBundle(path string) (string, func(dir string) error, error) {
+	digest, err := fileDigest(path)
+	if err != nil {
+		return "", nil, err
+	}
+	extract := func(dir string) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return extractTar(file, dir)
+	}
+	return digest, extract, nil
+}
+
+// ociBundle returns the manifest digest of the image of an OCI image layout
+// directory, given as <dir>[:<tag>]. The tag is optional when the layout holds
+// a single image.
+func ociBundle(layoutRef string) (string, func(dir string) error, error) {
+	layoutDir, tag := layoutRef, ""
+	if idx := strings.LastIndex(layoutRef, ":"); idx > 0 {
+		layoutDir, tag = layoutRef[:idx], layoutRef[idx+1:]
+	}
+
+	descriptor, err := ociFindManifest(layoutDir, tag)
+	if err != nil {
+		return "", nil, err
+	}
+	extract := func(dir string) error {
+		content, err := ociReadBlob(layoutDir, descriptor.Digest)
+		if err != nil {
+			return err
+		}
+		manifest := ociManifest{}
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return fmt.Errorf("could not parse manifest %s: %s", descriptor.Digest, err)
+		}
+		// Layers apply in order, whiteouts removing the files of the lower layers
+		for _, layer := range manifest.Layers {
+			if err := ociVerifyBlob(layoutDir, layer.Digest); err != nil {
+				return err
+			}
+			file, err := os.Open(ociBlobPath(layoutDir, layer.Digest))
+			if err != nil {
+				return err
+			}
+			err = extractTar(file, dir)
+			file.Close()
+			if err != nil {
+				return fmt.Errorf("layer %s: %s", layer.Digest, err)
+			}
+		}
+		return nil
+	}
+	return descriptor.Digest, extract, nil
+}
+
+func ociFindManifest(layoutDir string, tag string) (ociDescriptor, error) {
+	content, err := os.ReadFile(filepath.Join(layoutDir, "index.json"))
+	if err != nil {
+		return ociDescriptor{}, fmt.Errorf("not an OCI image layout: %s", err)
+	}
+	index := ociIndex{}
+	if err := json.Unmarshal(content, &index); err != nil {
+		return ociDescriptor{}, fmt.Errorf("could not parse index.json: %s", err)
+	}
+
+	matches := make([]ociDescriptor, 0, 1)
+	for _, descriptor := range index.Manifests {
+		if tag == "" || descriptor.Annotations[ociRefNameAnnotation] == tag {
+			matches = append(matches, descriptor)
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		return ociDescriptor{}, fmt.Errorf("no image tagged '%s' in %s", tag, layoutDir)
+	case len(matches) > 1:
+		return ociDescriptor{}, fmt.Errorf("%d images in %s, set the tag as in %s%s:<tag>", len(matches), layoutDir, OCIRefPrefix, layoutDir)
+	case matches[0].MediaType == ociIndexMediaType:
+		return ociDescriptor{}, fmt.Errorf("multi-platform image indexes are not supported, %s", matches[0].Digest)
+	}
+	return matches[0], nil
+}
+
+func ociBlobPath(layoutDir string, digest string) string {
+	return filepath.Join(layoutDir, "blobs", strings.Replace(digest, ":", "/", 1))
+}
+
+func ociReadBlob(layoutDir string, digest string) ([]byte, error) {
+	if err := ociVerifyBlob(layoutDir, digest); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(ociBlobPath(layoutDir, digest))
+}
+
+func ociVerifyBlob(layoutDir string, digest string) error {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return fmt.Errorf("digest %s is not supported, only sha256 is", digest)
+	}
+	actual, err := fileDigest(ociBlobPath(layoutDir, digest))
+	if err != nil {
+		return err
+	}
+	if actual != digest {
+		return fmt.Errorf("blob %s is corrupted, its digest is %s", digest, actual)
+	}
+	return nil
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// extractTar extracts the directories and regular files of a tar stream,
+// gzipped or not, to dir. Whiteout files remove the files they hide.
+func extractTar(in io.Reader, dir string) error {
+	reader := bufio.NewReader(in)
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		in = gzipReader
+	} else {
+		in = reader
+	}
+
+	tarReader := tar.NewReader(in)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(header.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("invalid path %s in the archive", header.Name)
+		}
+		target := filepath.Join(dir, name)
+
+		base := filepath.Base(name)
+		if base == ".wh..wh..opq" {
+			entries, _ := os.ReadDir(filepath.Dir(target))
+			for _, entry := range entries {
+				os.RemoveAll(filepath.Join(filepath.Dir(target), entry.Name()))
+			}
+			continue
+		}
+		if strings.HasPrefix(base, ".wh.") {
+			os.RemoveAll(filepath.Join(filepath.Dir(target), strings.TrimPrefix(base, ".wh.")))
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, tarReader)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
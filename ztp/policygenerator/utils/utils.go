@@ -1,5 +1,12 @@
 package utils
 
+import (
+	"bytes"
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 const ExistOper = "Exists"
 const InOper = "In"
 const DoesNotExistOper = "DoesNotExist"
@@ -11,8 +18,20 @@ const UnsetStringValue = "__unset_value__"
 const ZtpDeployWaveAnnotation = "ran.openshift.io/ztp-deploy-wave"
 const DefaultCompliantEvaluationInterval = "10m"
 const DefaultNonCompliantEvaluationInterval = "10s"
+const DefaultSeverity = "low"
 const DisableEvaluationInterval = "never"
 const WatchEvaluationInterval = "watch"
+const PlacementRuleKind = "PlacementRule"
+const PlacementKind = "Placement"
+const PolicySetKind = "PolicySet"
+const DefaultClusterSet = "global"
+const ListMergeByIndex = "index"
+const ListMergeByKey = "key"
+const UpgradeApprovalAutomatic = "Automatic"
+const UpgradeApprovalNone = "None"
+const WaveDependencies = "dependencies"
+const WaveExtraDependencies = "extraDependencies"
+const DisableTemplatesAnnotation = "policy.open-cluster-management.io/disable-templates"
 
 // ComplianceType of "mustonlyhave" uses significant CPU to enforce. Default to
 // "musthave" so that we realize the CPU reductions unless explicitly told otherwise
@@ -37,14 +56,32 @@ type MetaData struct {
 }
 
 type PolicyGenTempSpec struct {
-	BindingRules         map[string]string  `yaml:"bindingRules,omitempty"`
-	BindingExcludedRules map[string]string  `yaml:"bindingExcludedRules,omitempty"`
-	Mcp                  string             `yaml:"mcp,omitempty"`
-	WrapInPolicy         bool               `yaml:"wrapInPolicy,omitempty"`
-	RemediationAction    string             `yaml:"remediationAction,omitempty"`
-	ComplianceType       string             `yaml:"complianceType,omitempty"`
-	EvaluationInterval   EvaluationInterval `yaml:"evaluationInterval,omitempty"`
-	SourceFiles          []SourceFile       `yaml:"sourceFiles,omitempty"`
+	BindingRules           map[string]string  `yaml:"bindingRules,omitempty"`
+	BindingExcludedRules   map[string]string  `yaml:"bindingExcludedRules,omitempty"`
+	BindingSelector        *BindingSelector   `yaml:"bindingSelector,omitempty"`
+	Mcp                    string             `yaml:"mcp,omitempty"`
+	WrapInPolicy           bool               `yaml:"wrapInPolicy,omitempty"`
+	RemediationAction      string             `yaml:"remediationAction,omitempty"`
+	ComplianceType         string             `yaml:"complianceType,omitempty"`
+	MetadataComplianceType string             `yaml:"metadataComplianceType,omitempty"`
+	RecordDiff             string             `yaml:"recordDiff,omitempty"`
+	EvaluationInterval     EvaluationInterval `yaml:"evaluationInterval,omitempty"`
+	ListMerge              string             `yaml:"listMerge,omitempty"`
+	PlacementKind          string             `yaml:"placementKind,omitempty"`
+	ClusterSet             string             `yaml:"clusterSet,omitempty"`
+	ClusterSetBinding      bool               `yaml:"clusterSetBinding,omitempty"`
+	PlacementTolerations   []Toleration       `yaml:"placementTolerations,omitempty"`
+	PolicySet              *PolicySetSpec     `yaml:"policySet,omitempty"`
+	WaveDependencies       string             `yaml:"waveDependencies,omitempty"`
+	UseOperatorPolicy      bool               `yaml:"useOperatorPolicy,omitempty"`
+	SourceCRsRef           string             `yaml:"sourceCRsRef,omitempty"`
+	Severity               string             `yaml:"severity,omitempty"`
+	NamespaceSelector      *NamespaceSelector `yaml:"namespaceSelector,omitempty"`
+	PruneObjectBehavior    string             `yaml:"pruneObjectBehavior,omitempty"`
+	SplitByKind            bool               `yaml:"splitByKind,omitempty"`
+	MaxObjectTemplates     int                `yaml:"maxObjectTemplates,omitempty"`
+	AllowInlineSecrets     bool               `yaml:"allowInlineSecrets,omitempty"`
+	SourceFiles            []SourceFile       `yaml:"sourceFiles,omitempty"`
 }
 
 func (pgt *PolicyGenTempSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -54,6 +91,10 @@ func (pgt *PolicyGenTempSpec) UnmarshalYAML(unmarshal func(interface{}) error) e
 		RemediationAction:  "inform", // Generate inform policies by default
 		ComplianceType:     DefaultComplianceType,
 		EvaluationInterval: EvaluationInterval{DefaultCompliantEvaluationInterval, DefaultNonCompliantEvaluationInterval},
+		ListMerge:          ListMergeByIndex,
+		PlacementKind:      PlacementRuleKind,
+		ClusterSet:         DefaultClusterSet,
+		Severity:           DefaultSeverity,
 	}
 
 	out := defaults
@@ -62,32 +103,171 @@ func (pgt *PolicyGenTempSpec) UnmarshalYAML(unmarshal func(interface{}) error) e
 	return err
 }
 
+// PolicySetSpec enables the generation of a PolicySet grouping the policies
+// of the PGT. The PlacementBinding then binds the PolicySet instead of the
+// individual policies.
+type PolicySetSpec struct {
+	// Defaults to the PGT name
+	Name string `yaml:"name,omitempty"`
+	// Defaults to a description naming the PGT
+	Description string `yaml:"description,omitempty"`
+}
+
+// BindingSelector selects the clusters the policies are bound to. The label
+// selector applies to the ManagedCluster labels while the ClaimSelector
+// applies to the ClusterClaims of the ManagedCluster.
+type BindingSelector struct {
+	LabelSelector metav1.LabelSelector
+	ClaimSelector ClaimSelector
+}
+
+type ClaimSelector struct {
+	MatchExpressions []metav1.LabelSelectorRequirement `json:"matchExpressions,omitempty"`
+}
+
+// Provide custom YAML unmarshal for BindingSelector which decodes the selector
+// through its JSON representation, as the metav1 types only carry json tags
+func (bs *BindingSelector) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	raw := make(map[string]interface{})
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	claimSelector, found := raw["claimSelector"]
+	delete(raw, "claimSelector")
+
+	if err := decodeStrict(raw, &bs.LabelSelector); err != nil {
+		return err
+	}
+	if found {
+		return decodeStrict(claimSelector, &bs.ClaimSelector)
+	}
+	return nil
+}
+
+// Provide custom YAML marshal for BindingSelector which renders the selector
+// the way UnmarshalYAML decodes it
+func (bs BindingSelector) MarshalYAML() (interface{}, error) {
+	out := make(map[string]interface{})
+	data, err := json.Marshal(bs.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	if len(bs.ClaimSelector.MatchExpressions) > 0 {
+		claimSelector := make(map[string]interface{})
+		if data, err = json.Marshal(bs.ClaimSelector); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &claimSelector); err != nil {
+			return nil, err
+		}
+		out["claimSelector"] = claimSelector
+	}
+	return out, nil
+}
+
+func decodeStrict(in interface{}, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(out)
+}
+
+// NamespaceSelector selects the namespaces of the namespaced objects of the
+// ConfigurationPolicy which don't set their namespace
+type NamespaceSelector struct {
+	Exclude          []string                          `json:"exclude,omitempty"`
+	Include          []string                          `json:"include,omitempty"`
+	MatchLabels      map[string]string                 `json:"matchLabels,omitempty"`
+	MatchExpressions []metav1.LabelSelectorRequirement `json:"matchExpressions,omitempty"`
+}
+
+// Provide custom YAML unmarshal for NamespaceSelector which decodes the
+// selector through its JSON representation, as the metav1 types only carry
+// json tags
+func (ns *NamespaceSelector) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	raw := make(map[string]interface{})
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	return decodeStrict(raw, ns)
+}
+
+// Provide custom YAML marshal for NamespaceSelector which renders the selector
+// the way UnmarshalYAML decodes it
+func (ns NamespaceSelector) MarshalYAML() (interface{}, error) {
+	out := make(map[string]interface{})
+	data, err := json.Marshal(ns)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 type EvaluationInterval struct {
 	Compliant    string `yaml:"compliant,omitempty"`
 	NonCompliant string `yaml:"noncompliant,omitempty"`
 }
 
 type SourceFile struct {
-	FileName           string                 `yaml:"fileName"`
-	PolicyName         string                 `yaml:"policyName,omitempty"`
-	ComplianceType     string                 `yaml:"complianceType,omitempty"`
-	RemediationAction  string                 `yaml:"remediationAction,omitempty"`
-	Metadata           MetaData               `yaml:"metadata,omitempty"`
-	Spec               map[string]interface{} `yaml:"spec,omitempty"`
-	Data               map[string]interface{} `yaml:"data,omitempty"`
-	Status             map[string]interface{} `yaml:"status,omitempty"`
-	BinaryData         map[string]interface{} `yaml:"binaryData,omitempty"`
-	StringData         map[string]interface{} `yaml:"stringData,omitempty"`
-	EvaluationInterval EvaluationInterval     `yaml:"evaluationInterval,omitempty"`
+	FileName               string                 `yaml:"fileName"`
+	PolicyName             string                 `yaml:"policyName,omitempty"`
+	ComplianceType         string                 `yaml:"complianceType,omitempty"`
+	MetadataComplianceType string                 `yaml:"metadataComplianceType,omitempty"`
+	RecordDiff             string                 `yaml:"recordDiff,omitempty"`
+	RemediationAction      string                 `yaml:"remediationAction,omitempty"`
+	Metadata               MetaData               `yaml:"metadata,omitempty"`
+	Spec                   map[string]interface{} `yaml:"spec,omitempty"`
+	Data                   map[string]interface{} `yaml:"data,omitempty"`
+	Status                 map[string]interface{} `yaml:"status,omitempty"`
+	BinaryData             map[string]interface{} `yaml:"binaryData,omitempty"`
+	StringData             map[string]interface{} `yaml:"stringData,omitempty"`
+	EvaluationInterval     EvaluationInterval     `yaml:"evaluationInterval,omitempty"`
+	DisableTemplates       bool                   `yaml:"disableTemplates,omitempty"`
+	ListMerge              string                 `yaml:"listMerge,omitempty"`
+	Patches                []PatchOperation       `yaml:"patches,omitempty"`
+	UpgradeApproval        string                 `yaml:"upgradeApproval,omitempty"`
+	Versions               []string               `yaml:"versions,omitempty"`
+	Severity               string                 `yaml:"severity,omitempty"`
+	NamespaceSelector      *NamespaceSelector     `yaml:"namespaceSelector,omitempty"`
+	PruneObjectBehavior    string                 `yaml:"pruneObjectBehavior,omitempty"`
+	PolicyTemplateName     string                 `yaml:"policyTemplateName,omitempty"`
+	Documents              []DocumentOverlay      `yaml:"documents,omitempty"`
+	AllowInlineSecrets     bool                   `yaml:"allowInlineSecrets,omitempty"`
+}
+
+// DocumentOverlay is the overlay of the documents of a multi-document source
+// CR file with the given kind and metadata.name. The other metadata fields are
+// merged into the document metadata.
+type DocumentOverlay struct {
+	Kind       string                 `yaml:"kind"`
+	Metadata   MetaData               `yaml:"metadata"`
+	Spec       map[string]interface{} `yaml:"spec,omitempty"`
+	Data       map[string]interface{} `yaml:"data,omitempty"`
+	Status     map[string]interface{} `yaml:"status,omitempty"`
+	BinaryData map[string]interface{} `yaml:"binaryData,omitempty"`
+	StringData map[string]interface{} `yaml:"stringData,omitempty"`
+	Patches    []PatchOperation       `yaml:"patches,omitempty"`
 }
 
 // Provide custom YAML unmarshal for SourceFile which provides default values
 func (rv *SourceFile) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type Defaulted SourceFile
 	var defaults = Defaulted{
-		ComplianceType:     UnsetStringValue,
-		RemediationAction:  UnsetStringValue,
-		EvaluationInterval: EvaluationInterval{UnsetStringValue, UnsetStringValue},
+		ComplianceType:      UnsetStringValue,
+		RemediationAction:   UnsetStringValue,
+		EvaluationInterval:  EvaluationInterval{UnsetStringValue, UnsetStringValue},
+		ListMerge:           UnsetStringValue,
+		Severity:            UnsetStringValue,
+		PruneObjectBehavior: UnsetStringValue,
 	}
 
 	out := defaults
@@ -96,6 +276,15 @@ func (rv *SourceFile) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return err
 }
 
+// PatchOperation is a RFC 6902 JSON patch operation applied to the CR
+// built from the sourceFile, after the overlay
+type PatchOperation struct {
+	Op    string      `yaml:"op"`
+	Path  string      `yaml:"path"`
+	From  string      `yaml:"from,omitempty"`
+	Value interface{} `yaml:"value,omitempty"`
+}
+
 type AcmPolicy struct {
 	ApiVersion string        `yaml:"apiVersion"`
 	Kind       string        `yaml:"kind"`
@@ -107,10 +296,35 @@ type acmPolicySpec struct {
 	RemediationAction string                   `yaml:"remediationAction"`
 	Disabled          bool                     `yaml:"disabled"`
 	PolicyTemplates   []PolicyObjectDefinition `yaml:"policy-templates"`
+	Dependencies      []PolicyDependency       `yaml:"dependencies,omitempty"`
 }
 
 type PolicyObjectDefinition struct {
-	ObjDef AcmConfigurationPolicy `yaml:"objectDefinition"`
+	ObjDef            AcmConfigurationPolicy `yaml:"objectDefinition"`
+	ExtraDependencies []PolicyDependency     `yaml:"extraDependencies,omitempty"`
+	// Replaces ObjDef as the objectDefinition of the policy template when set
+	OperatorPolicy *AcmOperatorPolicy `yaml:"-"`
+}
+
+func (pod PolicyObjectDefinition) MarshalYAML() (interface{}, error) {
+	type plain PolicyObjectDefinition
+	if pod.OperatorPolicy == nil {
+		return plain(pod), nil
+	}
+	return struct {
+		ObjDef            *AcmOperatorPolicy `yaml:"objectDefinition"`
+		ExtraDependencies []PolicyDependency `yaml:"extraDependencies,omitempty"`
+	}{pod.OperatorPolicy, pod.ExtraDependencies}, nil
+}
+
+// PolicyDependency is a policy which must reach the compliance state before
+// the dependent policy (or policy template) is evaluated
+type PolicyDependency struct {
+	ApiVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace,omitempty"`
+	Compliance string `yaml:"compliance"`
 }
 
 type AcmConfigurationPolicy struct {
@@ -121,19 +335,36 @@ type AcmConfigurationPolicy struct {
 }
 
 type acmConfigPolicySpec struct {
-	RemediationAction string `yaml:"remediationAction"`
-	Severity          string `yaml:"severity"`
-	NamespaceSelector struct {
-		Exclude []string `yaml:"exclude"`
-		Include []string `yaml:"include"`
-	} `yaml:"namespaceSelector"`
-	ObjectTemplates    []ObjectTemplates  `yaml:"object-templates"`
-	EvaluationInterval EvaluationInterval `yaml:"evaluationInterval,omitempty"`
+	RemediationAction   string             `yaml:"remediationAction"`
+	Severity            string             `yaml:"severity"`
+	NamespaceSelector   NamespaceSelector  `yaml:"namespaceSelector"`
+	ObjectTemplates     []ObjectTemplates  `yaml:"object-templates"`
+	EvaluationInterval  EvaluationInterval `yaml:"evaluationInterval,omitempty"`
+	PruneObjectBehavior string             `yaml:"pruneObjectBehavior,omitempty"`
+}
+
+type AcmOperatorPolicy struct {
+	ApiVersion string                `yaml:"apiVersion"`
+	Kind       string                `yaml:"kind"`
+	Metadata   MetaData              `yaml:"metadata"`
+	Spec       acmOperatorPolicySpec `yaml:"spec"`
+}
+
+type acmOperatorPolicySpec struct {
+	RemediationAction string                 `yaml:"remediationAction"`
+	Severity          string                 `yaml:"severity"`
+	ComplianceType    string                 `yaml:"complianceType"`
+	OperatorGroup     map[string]interface{} `yaml:"operatorGroup,omitempty"`
+	Subscription      map[string]interface{} `yaml:"subscription"`
+	UpgradeApproval   string                 `yaml:"upgradeApproval"`
+	Versions          []string               `yaml:"versions,omitempty"`
 }
 
 type ObjectTemplates struct {
-	ComplianceType   string                 `yaml:"complianceType"`
-	ObjectDefinition map[string]interface{} `yaml:"objectDefinition"`
+	ComplianceType         string                 `yaml:"complianceType"`
+	MetadataComplianceType string                 `yaml:"metadataComplianceType,omitempty"`
+	RecordDiff             string                 `yaml:"recordDiff,omitempty"`
+	ObjectDefinition       map[string]interface{} `yaml:"objectDefinition"`
 }
 
 type PlacementBinding struct {
@@ -150,6 +381,16 @@ type Subject struct {
 	ApiGroup string `yaml:"apiGroup"`
 }
 
+type PolicySet struct {
+	ApiVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   MetaData `yaml:"metadata"`
+	Spec       struct {
+		Description string   `yaml:"description,omitempty"`
+		Policies    []string `yaml:"policies"`
+	} `yaml:"spec"`
+}
+
 type PlacementRule struct {
 	ApiVersion string   `yaml:"apiVersion"`
 	Kind       string   `yaml:"kind"`
@@ -160,5 +401,41 @@ type PlacementRule struct {
 }
 
 type ClusterSelector struct {
+	MatchLabels      map[string]string        `yaml:"matchLabels,omitempty"`
 	MatchExpressions []map[string]interface{} `yaml:"matchExpressions"`
 }
+
+type Placement struct {
+	ApiVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   MetaData `yaml:"metadata"`
+	Spec       struct {
+		ClusterSets []string             `yaml:"clusterSets,omitempty"`
+		Predicates  []PlacementPredicate `yaml:"predicates"`
+		Tolerations []Toleration         `yaml:"tolerations,omitempty"`
+	} `yaml:"spec"`
+}
+
+type PlacementPredicate struct {
+	RequiredClusterSelector struct {
+		LabelSelector ClusterSelector  `yaml:"labelSelector"`
+		ClaimSelector *ClusterSelector `yaml:"claimSelector,omitempty"`
+	} `yaml:"requiredClusterSelector"`
+}
+
+type Toleration struct {
+	Key               string `yaml:"key,omitempty"`
+	Operator          string `yaml:"operator,omitempty"`
+	Value             string `yaml:"value,omitempty"`
+	Effect            string `yaml:"effect,omitempty"`
+	TolerationSeconds *int64 `yaml:"tolerationSeconds,omitempty"`
+}
+
+type ManagedClusterSetBinding struct {
+	ApiVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   MetaData `yaml:"metadata"`
+	Spec       struct {
+		ClusterSet string `yaml:"clusterSet"`
+	} `yaml:"spec"`
+}
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// BatchReportFile is the summary report written to the output directory of a batch conversion
+	BatchReportFile = "conversion-report.md"
+	// batchManifestsDir is the directory of the extra manifests in the output directory of a cluster
+	batchManifestsDir = "extra-manifests"
+	// kustomizationFile is the kustomization written to the output directory of a cluster
+	kustomizationFile = "kustomization.yaml"
+)
+
+// batchInputs are the SiteConfig files found by a batch conversion, along
+// with the kustomizations listing them as generators
+type batchInputs struct {
+	siteConfigs    []string
+	kustomizations []string
+	generators     map[string][]string
+	seen           map[string]bool
+}
+
+// batchCluster is the outcome of the conversion of a cluster
+type batchCluster struct {
+	Name       string
+	SiteConfig string
+	OutputDir  string
+	Warnings   []string
+	Err        error
+}
+
+// batchReport is the outcome of a batch conversion
+type batchReport struct {
+	Clusters       []batchCluster
+	Errors         map[string]error
+	Kustomizations []string
+}
+
+// runBatch implements the batch subcommand and returns the exit code, 1 when
+// a SiteConfig or a cluster failed to convert
+func runBatch(args []string) int {
+	flags := flag.NewFlagSet("batch", flag.ContinueOnError)
+	outputDir := flags.String("d", "", "Output directory, holding a directory per cluster (required)")
+	clusterTemplate := flags.String("t", DefaultClusterTemplates, "Comma-separated list of template references for Cluster (format: namespace/name,namespace/name,...)")
+	nodeTemplate := flags.String("n", DefaultNodeTemplates, "Comma-separated list of template references for Nodes (format: namespace/name,namespace/name,...)")
+	extraManifestsRefs := flags.String("m", "", "Comma-separated list of ConfigMap names for extra manifests references")
+	suppressedManifests := flags.String("s", "", "Comma-separated list of manifest names to suppress at cluster level")
+	writeWarnings := flags.Bool("w", false, "Write conversion warnings as comments to the head of converted YAML files")
+	copyComments := flags.Bool("c", false, "Copy comments from SiteConfig to ClusterInstance YAML files")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if *outputDir == "" || flags.NArg() == 0 {
+		fmt.Println("Usage: siteconfig-converter batch -d output_dir [-t cluster_namespace/name,...] [-n node_namespace/name,...] [-m configmap1,configmap2,...] [-s manifest1,manifest2,...] [-w] [-c] <directory|kustomization.yaml|siteconfig.yaml>...")
+		return 1
+	}
+	opts, err := newConversionOptions(*clusterTemplate, *nodeTemplate, *extraManifestsRefs, *suppressedManifests)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	inputs, err := findSiteConfigs(flags.Args(), *outputDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(inputs.siteConfigs) == 0 {
+		fmt.Printf("Error: no SiteConfig found in %s\n", strings.Join(flags.Args(), ", "))
+		return 1
+	}
+	report, err := convertBatch(inputs, *outputDir, opts, *writeWarnings, *copyComments)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	converted, failed := 0, len(report.Errors)
+	for _, cluster := range report.Clusters {
+		if cluster.Err != nil {
+			failed++
+		} else {
+			converted++
+		}
+	}
+	fmt.Printf("Converted %d cluster(s) of %d SiteConfig(s) with %d failure(s), see %s\n",
+		converted, len(inputs.siteConfigs), failed, filepath.Join(*outputDir, BatchReportFile))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// findSiteConfigs returns the SiteConfig files of the paths. The directories
+// are walked, skipping the hidden ones and the output directory, and the
+// kustomizations are followed through their resources and generators.
+func findSiteConfigs(paths []string, outputDir string) (*batchInputs, error) {
+	inputs := &batchInputs{generators: make(map[string][]string), seen: make(map[string]bool)}
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		info, err := os.Stat(absPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		switch {
+		case info.IsDir():
+			err = inputs.walkDir(absPath, absOutputDir)
+		case isKustomizationFile(absPath):
+			err = inputs.addKustomization(absPath, true)
+		case isSiteConfigFile(absPath):
+			inputs.addSiteConfig(absPath)
+		default:
+			err = fmt.Errorf("%s is neither a directory, a kustomization nor a SiteConfig", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return inputs, nil
+}
+
+// walkDir adds the SiteConfigs and the kustomizations of the directory tree
+func (inputs *batchInputs) walkDir(root string, outputDir string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path == outputDir || (path != root && strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isKustomizationFile(path) {
+			return inputs.addKustomization(path, false)
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if (ext == ".yaml" || ext == ".yml") && isSiteConfigFile(path) {
+			inputs.addSiteConfig(path)
+		}
+		return nil
+	})
+}
+
+// addKustomization adds the SiteConfigs listed as generators by the
+// kustomization, and the ones of the kustomizations of its resources and
+// generators directories when recurse is set
+func (inputs *batchInputs) addKustomization(path string, recurse bool) error {
+	if _, found := inputs.generators[path]; found {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	kustomization := struct {
+		Resources  []string `yaml:"resources"`
+		Generators []string `yaml:"generators"`
+	}{}
+	if err := yaml.Unmarshal(data, &kustomization); err != nil {
+		return fmt.Errorf("failed to unmarshal kustomization %s: %w", path, err)
+	}
+	inputs.kustomizations = append(inputs.kustomizations, path)
+	inputs.generators[path] = nil
+
+	dir := filepath.Dir(path)
+	for _, entry := range kustomization.Generators {
+		if isRemoteResource(entry) {
+			continue
+		}
+		file := filepath.Join(dir, entry)
+		if isSiteConfigFile(file) {
+			inputs.generators[path] = append(inputs.generators[path], file)
+			inputs.addSiteConfig(file)
+		}
+	}
+	if !recurse {
+		return nil
+	}
+	for _, entry := range append(kustomization.Resources, kustomization.Generators...) {
+		if isRemoteResource(entry) {
+			continue
+		}
+		subDir := filepath.Join(dir, entry)
+		if info, err := os.Stat(subDir); err != nil || !info.IsDir() {
+			continue
+		}
+		for _, name := range []string{"kustomization.yaml", "kustomization.yml", "Kustomization"} {
+			if _, err := os.Stat(filepath.Join(subDir, name)); err == nil {
+				if err := inputs.addKustomization(filepath.Join(subDir, name), true); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (inputs *batchInputs) addSiteConfig(path string) {
+	if !inputs.seen[path] {
+		inputs.seen[path] = true
+		inputs.siteConfigs = append(inputs.siteConfigs, path)
+	}
+}
+
+func isKustomizationFile(path string) bool {
+	name := filepath.Base(path)
+	return name == "kustomization.yaml" || name == "kustomization.yml" || name == "Kustomization"
+}
+
+func isRemoteResource(entry string) bool {
+	return strings.Contains(entry, "://") || strings.HasPrefix(entry, "git@")
+}
+
+// isSiteConfigFile tells whether the file is a YAML file holding a SiteConfig
+func isSiteConfigFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	header := struct {
+		Kind string `yaml:"kind"`
+	}{}
+	if err := yaml.NewDecoder(strings.NewReader(string(data))).Decode(&header); err != nil {
+		return false
+	}
+	return header.Kind == "SiteConfig"
+}
+
+// convertBatch converts every cluster of the SiteConfigs to a directory of the
+// output directory named after the cluster, holding its ClusterInstance, its
+// extra manifests and a kustomization generating their ConfigMap in the
+// cluster namespace. The kustomizations listing the SiteConfigs as generators
+// are rewritten to list the cluster directories as resources instead, then
+// the report is written to the output directory.
+func convertBatch(inputs *batchInputs, outputDir string, opts conversionOptions, writeWarnings bool, copyComments bool) (*batchReport, error) {
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if err := os.MkdirAll(absOutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	report := &batchReport{Errors: make(map[string]error)}
+	converted := make(map[string]string)
+	seen := make(map[string]string)
+	clusterDirs := make(map[string][]string)
+	for _, file := range inputs.siteConfigs {
+		clusters, err := convertBatchSiteConfig(file, absOutputDir, opts, writeWarnings, copyComments, converted, seen)
+		if err != nil {
+			report.Errors[file] = err
+			continue
+		}
+		report.Clusters = append(report.Clusters, clusters...)
+		var dirs []string
+		for _, cluster := range clusters {
+			if cluster.Err != nil {
+				dirs = nil
+				break
+			}
+			dirs = append(dirs, cluster.OutputDir)
+		}
+		// The SiteConfig stays a generator unless all its clusters are converted
+		if dirs != nil {
+			clusterDirs[file] = dirs
+		}
+	}
+
+	for _, kustomization := range inputs.kustomizations {
+		var siteConfigs, dirs []string
+		for _, file := range inputs.generators[kustomization] {
+			if _, ok := clusterDirs[file]; ok {
+				siteConfigs = append(siteConfigs, file)
+				dirs = append(dirs, clusterDirs[file]...)
+			}
+		}
+		if len(siteConfigs) == 0 {
+			continue
+		}
+		if err := rewriteKustomization(kustomization, siteConfigs, dirs); err != nil {
+			report.Errors[kustomization] = err
+			continue
+		}
+		report.Kustomizations = append(report.Kustomizations, kustomization)
+	}
+
+	if err := writeBatchReport(report, filepath.Join(absOutputDir, BatchReportFile)); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// convertBatchSiteConfig validates and converts the clusters of the SiteConfig,
+// the clusters already converted from another SiteConfig failing. The MAC
+// addresses are recorded in seen to detect the ones of other SiteConfigs.
+func convertBatchSiteConfig(file string, outputDir string, opts conversionOptions, writeWarnings bool, copyComments bool, converted map[string]string, seen map[string]string) ([]batchCluster, error) {
+	siteConfig, err := readSiteConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SiteConfig file: %w", err)
+	}
+	if len(siteConfig.Spec.Clusters) == 0 {
+		return nil, fmt.Errorf("no clusters found in SiteConfig")
+	}
+	commentCollector := &CommentCollector{}
+	if copyComments {
+		if commentCollector, err = parseSiteConfigWithComments(file); err != nil {
+			return nil, fmt.Errorf("failed to parse comments from SiteConfig: %w", err)
+		}
+	}
+
+	var clusters []batchCluster
+	for idx, cluster := range siteConfig.Spec.Clusters {
+		result := batchCluster{Name: cluster.ClusterName, SiteConfig: file, OutputDir: filepath.Join(outputDir, cluster.ClusterName)}
+		if other, found := converted[cluster.ClusterName]; found {
+			result.Err = fmt.Errorf("cluster %s is converted from %s already", cluster.ClusterName, other)
+			clusters = append(clusters, result)
+			continue
+		}
+		converted[cluster.ClusterName] = file
+
+		warningsCollector := &WarningsCollector{}
+		for _, ref := range opts.extraManifestsRefs {
+			addExtraManifestsRefWarning(ref.Name, warningsCollector)
+		}
+		validateCluster(cluster, idx, seen, warningsCollector)
+		if len(warningsCollector.Errors) > 0 {
+			result.Err = fmt.Errorf("%d validation error(s)", len(warningsCollector.Errors))
+			result.Warnings = append(warningsCollector.Warnings, warningsCollector.Errors...)
+			clusters = append(clusters, result)
+			continue
+		}
+		addSiteConfigWarnings(siteConfig, warningsCollector)
+		addClusterWarnings(cluster, warningsCollector)
+		result.Err = convertBatchCluster(siteConfig, idx, file, result.OutputDir, opts, warningsCollector, writeWarnings, commentCollector, copyComments)
+		result.Warnings = warningsCollector.Warnings
+		clusters = append(clusters, result)
+	}
+	return clusters, nil
+}
+
+// convertBatchCluster writes the ClusterInstance of the cluster, its extra
+// manifests and their kustomization to the cluster directory
+func convertBatchCluster(siteConfig *SiteConfig, idx int, file string, clusterDir string, opts conversionOptions, warningsCollector *WarningsCollector,
+	writeWarnings bool, commentCollector *CommentCollector, copyComments bool) error {
+	cluster := siteConfig.Spec.Clusters[idx]
+	if err := os.MkdirAll(clusterDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	clusterInstance := convertClusterToClusterInstance(siteConfig, cluster, opts.clusterTemplateRefs, opts.nodeTemplateRefs,
+		opts.extraManifestsRefs, opts.suppressedManifests, warningsCollector, idx, filepath.Base(file), opts.configMapName)
+	manifests, err := getExtraManifest(make(map[string]interface{}), cluster, filepath.Dir(file))
+	if err != nil {
+		return fmt.Errorf("failed to generate extra manifests: %w", err)
+	}
+
+	clusterInstanceFile := fmt.Sprintf("%s.yaml", cluster.ClusterName)
+	if err := writeClusterInstanceToFile(clusterInstance, filepath.Join(clusterDir, clusterInstanceFile), warningsCollector, writeWarnings,
+		commentCollector, copyComments, idx, cluster); err != nil {
+		return err
+	}
+	configMap, err := writeExtraManifests(manifests, filepath.Join(clusterDir, batchManifestsDir), opts.configMapName)
+	if err != nil {
+		return err
+	}
+	generator := ConfigMapGenerator{Name: configMap.Name, Namespace: cluster.ClusterName, Files: []string{}}
+	for _, manifest := range configMap.Files {
+		relPath, err := filepath.Rel(clusterDir, manifest)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path for %s: %w", manifest, err)
+		}
+		generator.Files = append(generator.Files, relPath)
+	}
+	kustomization := Kustomization{
+		ApiVersion:         "kustomize.config.k8s.io/v1beta1",
+		Kind:               "Kustomization",
+		Resources:          []string{clusterInstanceFile},
+		ConfigMapGenerator: []ConfigMapGenerator{generator},
+		GeneratorOptions:   GeneratorOptions{DisableNameSuffixHash: true},
+	}
+	kustomizationData, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return fmt.Errorf("failed to marshal kustomization to YAML: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(clusterDir, kustomizationFile), kustomizationData, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", kustomizationFile, err)
+	}
+	return nil
+}
+
+// rewriteKustomization removes the SiteConfigs from the generators of the
+// kustomization and adds the cluster directories to its resources, keeping
+// its other fields and comments
+func rewriteKustomization(path string, siteConfigs []string, clusterDirs []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("failed to unmarshal kustomization %s: %w", path, err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("kustomization %s is not a YAML mapping", path)
+	}
+	root := document.Content[0]
+	dir := filepath.Dir(path)
+
+	removed := make(map[string]bool)
+	for _, file := range siteConfigs {
+		removed[file] = true
+	}
+	for idx := 0; idx < len(root.Content); idx += 2 {
+		if root.Content[idx].Value != "generators" || root.Content[idx+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		generators := root.Content[idx+1]
+		var kept []*yaml.Node
+		for _, entry := range generators.Content {
+			if !removed[filepath.Join(dir, entry.Value)] {
+				kept = append(kept, entry)
+			}
+		}
+		generators.Content = kept
+		if len(kept) == 0 {
+			// The comments above the generators stay with the next field
+			if comment := root.Content[idx].HeadComment; comment != "" && idx+2 < len(root.Content) {
+				next := root.Content[idx+2]
+				next.HeadComment = strings.TrimSpace(comment + "\n" + next.HeadComment)
+			}
+			root.Content = append(root.Content[:idx], root.Content[idx+2:]...)
+		}
+		break
+	}
+
+	var resources *yaml.Node
+	for idx := 0; idx < len(root.Content); idx += 2 {
+		if root.Content[idx].Value == "resources" {
+			resources = root.Content[idx+1]
+			break
+		}
+	}
+	if resources == nil {
+		resources = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "resources"}, resources)
+	} else if resources.Kind != yaml.SequenceNode {
+		return fmt.Errorf("resources of kustomization %s is not a list", path)
+	}
+	listed := make(map[string]bool)
+	for _, entry := range resources.Content {
+		listed[filepath.Clean(entry.Value)] = true
+	}
+	for _, clusterDir := range clusterDirs {
+		relPath, err := filepath.Rel(dir, clusterDir)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path for %s: %w", clusterDir, err)
+		}
+		if !listed[relPath] {
+			listed[relPath] = true
+			resources.Content = append(resources.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: relPath})
+		}
+	}
+
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return fmt.Errorf("failed to marshal kustomization to YAML: %w", err)
+	}
+	encoder.Close()
+	if err := os.WriteFile(path, []byte(buf.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// writeBatchReport writes the summary of the batch conversion as Markdown: a
+// table of the clusters, then their warnings and the failures
+func writeBatchReport(report *batchReport, filename string) error {
+	var buf strings.Builder
+	buf.WriteString("# SiteConfig Conversion Report\n\n")
+	buf.WriteString("| Cluster | SiteConfig | Output | Warnings | Status |\n")
+	buf.WriteString("|---------|------------|--------|----------|--------|\n")
+	for _, cluster := range report.Clusters {
+		status := "converted"
+		if cluster.Err != nil {
+			status = "failed"
+		}
+		fmt.Fprintf(&buf, "| %s | %s | %s | %d | %s |\n", cluster.Name, displayPath(cluster.SiteConfig), displayPath(cluster.OutputDir), len(cluster.Warnings), status)
+	}
+
+	for _, cluster := range report.Clusters {
+		if cluster.Err == nil && len(cluster.Warnings) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "\n## %s\n\n", cluster.Name)
+		if cluster.Err != nil {
+			fmt.Fprintf(&buf, "ERROR: %v\n\n", cluster.Err)
+		}
+		for _, warning := range cluster.Warnings {
+			fmt.Fprintf(&buf, "- %s\n", strings.TrimSpace(strings.TrimPrefix(warning, "WARNING: ")))
+		}
+	}
+
+	if len(report.Errors) > 0 {
+		buf.WriteString("\n## Failures\n\n")
+		for _, file := range mapKeys(report.Errors) {
+			fmt.Fprintf(&buf, "- %s: %v\n", displayPath(file), report.Errors[file])
+		}
+	}
+
+	if len(report.Kustomizations) > 0 {
+		buf.WriteString("\n## Rewritten Kustomizations\n\n")
+		for _, kustomization := range report.Kustomizations {
+			fmt.Fprintf(&buf, "- %s\n", displayPath(kustomization))
+		}
+	}
+
+	if err := os.WriteFile(filename, []byte(buf.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return nil
+}
+
+// displayPath returns the path relative to the working directory when it is
+// below it
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	relPath, err := filepath.Rel(wd, path)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return relPath
+}
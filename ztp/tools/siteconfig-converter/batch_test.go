@@ -0,0 +1,214 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// writeBatchSites writes a sites repository: a kustomization listing a
+// SiteConfig of two clusters, and a sub directory kustomization listing a
+// SiteConfig with the name of one of these clusters
+func writeBatchSites(t *testing.T) string {
+	dir := t.TempDir()
+	sno, err := readSiteConfig("samples/test-sno-siteconfig.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read SiteConfig: %v", err)
+	}
+	threeNode, err := readSiteConfig("samples/test-3node-siteconfig.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read SiteConfig: %v", err)
+	}
+	duplicate := *threeNode
+	// The MAC addresses of the clusters of a SiteConfig are different
+	multi := threeNode.Spec.Clusters[0]
+	multi.Nodes = append([]Node(nil), multi.Nodes...)
+	multi.Nodes[0].BootMACAddress = "AA:BB:CC:DD:EE:00"
+	multi.Nodes[0].NodeNetwork.Interfaces = []NetworkInterface{{Name: "eno1", MacAddress: "AA:BB:CC:DD:EE:00"}}
+	sno.Spec.Clusters = append(sno.Spec.Clusters, multi)
+
+	files := map[string]interface{}{
+		"sites/multi.yaml":         sno,
+		"sites/sub/duplicate.yaml": duplicate,
+	}
+	for name, content := range files {
+		data, err := yaml.Marshal(content)
+		if err != nil {
+			t.Fatalf("Failed to marshal %s: %v", name, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	kustomizations := map[string]string{
+		"sites/kustomization.yaml":     "# The sites\ngenerators:\n  - multi.yaml\nresources:\n  - sub\n",
+		"sites/sub/kustomization.yaml": "generators:\n  - duplicate.yaml\n",
+	}
+	for name, content := range kustomizations {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestFindSiteConfigs(t *testing.T) {
+	dir := writeBatchSites(t)
+	for _, path := range []string{"sites", "sites/kustomization.yaml"} {
+		inputs, err := findSiteConfigs([]string{filepath.Join(dir, path)}, filepath.Join(dir, "out"))
+		if err != nil {
+			t.Fatalf("Failed to find SiteConfigs in %s: %v", path, err)
+		}
+		if len(inputs.siteConfigs) != 2 || len(inputs.kustomizations) != 2 {
+			t.Errorf("Expected 2 SiteConfigs and 2 kustomizations in %s, got %v and %v", path, inputs.siteConfigs, inputs.kustomizations)
+		}
+		generators := inputs.generators[filepath.Join(dir, "sites/kustomization.yaml")]
+		if len(generators) != 1 || generators[0] != filepath.Join(dir, "sites/multi.yaml") {
+			t.Errorf("Expected multi.yaml as generator, got %v", generators)
+		}
+	}
+}
+
+func TestConvertBatch(t *testing.T) {
+	dir := writeBatchSites(t)
+	outputDir := filepath.Join(dir, "out")
+	inputs, err := findSiteConfigs([]string{filepath.Join(dir, "sites/kustomization.yaml")}, outputDir)
+	if err != nil {
+		t.Fatalf("Failed to find SiteConfigs: %v", err)
+	}
+	opts, err := newConversionOptions(DefaultClusterTemplates, DefaultNodeTemplates, "", "")
+	if err != nil {
+		t.Fatalf("Failed to parse options: %v", err)
+	}
+	report, err := convertBatch(inputs, outputDir, opts, false, false)
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+
+	if len(report.Clusters) != 3 {
+		t.Fatalf("Expected 3 clusters, got %d", len(report.Clusters))
+	}
+	for idx, cluster := range report.Clusters[:2] {
+		if cluster.Err != nil {
+			t.Errorf("Expected cluster %d to be converted, got %v", idx, cluster.Err)
+		}
+		data, err := os.ReadFile(filepath.Join(outputDir, cluster.Name, kustomizationFile))
+		if err != nil {
+			t.Fatalf("Failed to read the kustomization of %s: %v", cluster.Name, err)
+		}
+		kustomization := Kustomization{}
+		if err := yaml.Unmarshal(data, &kustomization); err != nil {
+			t.Fatalf("Failed to unmarshal the kustomization of %s: %v", cluster.Name, err)
+		}
+		if kustomization.ConfigMapGenerator[0].Namespace != cluster.Name || kustomization.Resources[0] != cluster.Name+".yaml" {
+			t.Errorf("Unexpected kustomization for %s: %+v", cluster.Name, kustomization)
+		}
+		if _, err := os.Stat(filepath.Join(outputDir, cluster.Name, cluster.Name+".yaml")); err != nil {
+			t.Errorf("Expected the ClusterInstance of %s: %v", cluster.Name, err)
+		}
+	}
+	if report.Clusters[2].Err == nil || !strings.Contains(report.Clusters[2].Err.Error(), "is converted from") {
+		t.Errorf("Expected the duplicate cluster to fail, got %v", report.Clusters[2].Err)
+	}
+
+	// The SiteConfig of the duplicate cluster stays a generator
+	data, err := os.ReadFile(filepath.Join(dir, "sites/kustomization.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read kustomization: %v", err)
+	}
+	expected := "# The sites\nresources:\n  - sub\n  - ../out/example-sno\n  - ../out/example-3node\n"
+	if string(data) != expected {
+		t.Errorf("Expected kustomization:\n%s\ngot:\n%s", expected, data)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "sites/sub/kustomization.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read kustomization: %v", err)
+	}
+	if string(data) != "generators:\n  - duplicate.yaml\n" {
+		t.Errorf("Expected the sub kustomization unchanged, got:\n%s", data)
+	}
+
+	data, err = os.ReadFile(filepath.Join(outputDir, BatchReportFile))
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	for _, expected := range []string{"| example-sno |", "## example-3node", "ERROR: cluster example-3node is converted from", "apiVIP is removed in ClusterInstance"} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %q in the report:\n%s", expected, data)
+		}
+	}
+}
+
+func TestConvertMultiClusterSiteConfig(t *testing.T) {
+	dir := writeBatchSites(t)
+	siteConfigFile := filepath.Join(dir, "sites/multi.yaml")
+	outputDir := filepath.Join(dir, "out")
+
+	// The clusters have an extra manifest of the same name
+	siteConfig := mustReadSiteConfig(t, siteConfigFile)
+	for idx := range siteConfig.Spec.Clusters {
+		cluster := &siteConfig.Spec.Clusters[idx]
+		searchPaths := []string{filepath.Join("manifests", cluster.ClusterName)}
+		cluster.ExtraManifests.SearchPaths = &searchPaths
+		if err := os.MkdirAll(filepath.Join(dir, "sites", searchPaths[0]), 0755); err != nil {
+			t.Fatal(err)
+		}
+		manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + cluster.ClusterName + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "sites", searchPaths[0], "a.yaml"), []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := yaml.Marshal(siteConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(siteConfigFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := convertToClusterInstance(siteConfig, outputDir, DefaultClusterTemplates, DefaultNodeTemplates,
+		"", "", false, false, siteConfigFile, DefaultExtraManifestConfigMapName); err != nil {
+		t.Fatal(err)
+	}
+	if err := handleNewExtraManifestFlags(DefaultExtraManifestConfigMapName, "extra-manifests", siteConfigFile, outputDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each ClusterInstance finds its ConfigMap in the namespace of its cluster
+	clusterInstances, configMaps, err := readClusterInstancesAndKustomizations([]string{
+		filepath.Join(outputDir, "example-sno.yaml"),
+		filepath.Join(outputDir, "example-3node.yaml"),
+		filepath.Join(outputDir, KustomizationConfigMapGeneratorSnippetFile),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusterInstances) != 2 || len(configMaps) != 2 {
+		t.Fatalf("Expected 2 ClusterInstances and 2 ConfigMaps, got %d and %v", len(clusterInstances), configMaps)
+	}
+	for _, clusterInstance := range clusterInstances {
+		configMap := findExtraManifestsConfigMap(clusterInstance, configMaps)
+		if configMap == nil || configMap.Namespace != clusterInstance.Spec.ClusterName {
+			t.Errorf("Expected the ConfigMap of %s in its namespace, got %+v", clusterInstance.Spec.ClusterName, configMap)
+			continue
+		}
+		manifestsDir := filepath.Join(outputDir, "extra-manifests", clusterInstance.Spec.ClusterName)
+		if len(configMap.Files) != 1 {
+			t.Errorf("Expected one extra manifest for %s, got %v", clusterInstance.Spec.ClusterName, configMap.Files)
+		}
+		for _, file := range configMap.Files {
+			if filepath.Dir(file) != manifestsDir {
+				t.Errorf("Expected the manifests of %s in %s, got %s", clusterInstance.Spec.ClusterName, manifestsDir, file)
+			}
+			if content, err := os.ReadFile(file); err != nil || !strings.Contains(string(content), "name: "+clusterInstance.Spec.ClusterName) {
+				t.Errorf("Expected the manifest %s of %s, got %s (%v)", file, clusterInstance.Spec.ClusterName, content, err)
+			}
+		}
+	}
+}
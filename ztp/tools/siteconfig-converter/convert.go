@@ -174,6 +174,7 @@ type TemplateRef struct {
 type Kustomization struct {
 	ApiVersion         string               `yaml:"apiVersion"`
 	Kind               string               `yaml:"kind"`
+	Resources          []string             `yaml:"resources,omitempty"`
 	ConfigMapGenerator []ConfigMapGenerator `yaml:"configMapGenerator"`
 	GeneratorOptions   GeneratorOptions     `yaml:"generatorOptions"`
 }
@@ -190,9 +191,11 @@ type GeneratorOptions struct {
 	DisableNameSuffixHash bool `yaml:"disableNameSuffixHash"`
 }
 
-// WarningsCollector collects warnings during conversion
+// WarningsCollector collects warnings during conversion, and the errors
+// failing it
 type WarningsCollector struct {
 	Warnings []string
+	Errors   []string
 }
 
 // AddWarning adds a warning to the collector
@@ -200,11 +203,19 @@ func (w *WarningsCollector) AddWarning(warning string) {
 	w.Warnings = append(w.Warnings, warning)
 }
 
-// PrintWarnings prints all collected warnings
+// AddError adds an error to the collector
+func (w *WarningsCollector) AddError(err string) {
+	w.Errors = append(w.Errors, err)
+}
+
+// PrintWarnings prints all collected warnings, then the errors
 func (w *WarningsCollector) PrintWarnings() {
 	for _, warning := range w.Warnings {
 		fmt.Print(warning)
 	}
+	for _, err := range w.Errors {
+		fmt.Print(err)
+	}
 }
 
 // GenerateYAMLComments generates YAML comments from warnings
@@ -395,118 +406,15 @@ func convertToClusterInstance(siteConfig *SiteConfig, outputDir string, clusterT
 			name = strings.TrimSpace(name)
 			if name != "" {
 				manifestsRefs = append(manifestsRefs, LocalObjectReference{Name: name})
-				warningsCollector.AddWarning(fmt.Sprintf("WARNING: The specified extra manifests ConfigMap '%s' is expected to contain the correct set of manifests for the cluster which must match the content generated by the extraManifests content from the original SiteConfig. This tool can't validate that expectation\n", name))
+				addExtraManifestsRefWarning(name, warningsCollector)
 			}
 		}
 	}
 
 	// Check for non-convertible fields and print warnings
-	if siteConfig.Spec.SshPrivateKeySecretRef.Name != "" {
-		warningsCollector.AddWarning(fmt.Sprintf("WARNING: sshPrivateKeySecretRef field '%s' is not supported in ClusterInstance and will be ignored\n",
-			siteConfig.Spec.SshPrivateKeySecretRef.Name))
-	}
-
-	// Check for global biosConfigRef
-	if siteConfig.Spec.BiosConfigRef.FilePath != "" {
-		warningsCollector.AddWarning(fmt.Sprintf("WARNING: biosConfigRef field '%s' at SiteConfig spec level is not supported in ClusterInstance and will be ignored. "+
-			"Please create a custom node template for HostFirmwareSettings and reference it through templateRefs instead."+
-			"Any nodes which use that custom template will then get the bios settings indicated in that CR\n",
-			siteConfig.Spec.BiosConfigRef.FilePath))
-	}
-
-	// Check for SiteConfig spec level crTemplates
-	if len(siteConfig.Spec.CrTemplates) > 0 {
-		warningsCollector.AddWarning("WARNING: crTemplates field at SiteConfig spec level is not supported in ClusterInstance and will be ignored. " +
-			"To provide custom CR templates please use ConfigMaps and reference them through templateRefs instead.\n")
-	}
-
-	// Check for cluster and node level fields
+	addSiteConfigWarnings(siteConfig, warningsCollector)
 	for _, cluster := range siteConfig.Spec.Clusters {
-		// Check for live cluster migration warnings
-		if cluster.ApiVIP != "" {
-			warningsCollector.AddWarning("WARNING: apiVIP is removed in ClusterInstance. " +
-				"Using apiVIPs instead. If you are doing a live cluster migration, you need to create a custom template for AgentClusterInstall or suppress it.\n")
-		}
-
-		if cluster.IngressVIP != "" {
-			warningsCollector.AddWarning("WARNING: ingressVIP is removed in ClusterInstance. " +
-				"Using ingressVIPs instead. If you are doing a live cluster migration, you need to create a custom template for AgentClusterInstall or suppress it.\n")
-		}
-
-		// Check for cluster-level biosConfigRef
-		if cluster.BiosConfigRef.FilePath != "" {
-			warningsCollector.AddWarning(fmt.Sprintf("WARNING: biosConfigRef field '%s' at cluster level is not supported in ClusterInstance and will be ignored. "+
-				"Please create a custom node template for HostFirmwareSettings and reference it through templateRefs instead."+
-				"Any nodes which use that custom template will then get the bios settings indicated in that CR\n",
-				cluster.BiosConfigRef.FilePath))
-		}
-
-		// Check for cluster-level crTemplates
-		if len(cluster.CrTemplates) > 0 {
-			warningsCollector.AddWarning("WARNING: crTemplates field at cluster level is not supported in ClusterInstance and will be ignored. " +
-				"To provide custom CR templates please use ConfigMaps and reference them through templateRefs instead.\n")
-		}
-
-		// Check for mergeDefaultMachineConfigs
-		if cluster.MergeDefaultMachineConfigs {
-			warningsCollector.AddWarning("WARNING: mergeDefaultMachineConfigs field is not supported in ClusterInstance and will be ignored. " +
-				"Use a ConfigMap which contains the already merged MachineConfigs and reference it through extraManifestsRefs instead.\n")
-		}
-
-		if cluster.ExtraManifestOnly {
-			warningsCollector.AddWarning("WARNING: extraManifestOnly field is not part of ClusterInstance spec. " +
-				"Extra manifests will be generated from this SiteConfig and included in the extraManifestsRefs ConfigMap, but the full ClusterInstance CR set will also be generated.\n")
-		}
-
-		if cluster.ExtraManifestPath != "" {
-			warningsCollector.AddWarning(fmt.Sprintf("WARNING: extraManifestPath field '%s' is not supported in ClusterInstance and will be ignored. "+
-				"Use extraManifests field instead\n",
-				cluster.ExtraManifestPath))
-		}
-
-		// Check for siteConfigMap
-		if cluster.SiteConfigMap.Name != "" {
-			warningsCollector.AddWarning(fmt.Sprintf("WARNING: siteConfigMap field '%s' is not supported in ClusterInstance and will be ignored. "+
-				"Create the site specific ConfigMap and place in git as a separate resource.\n", cluster.SiteConfigMap.Name))
-		}
-
-		// Check for tpm2 in disk encryption
-		if cluster.DiskEncryption.Tpm2.PCRList != "" {
-			warningsCollector.AddWarning("WARNING: tpm2 disk encryption configuration is not supported in ClusterInstance and will be ignored. Conversion will be done only for the Tang server field." +
-				"disk encryption MachineConfig with correct parameters must be added directly to the extramanifests configmap\n")
-		}
-
-		for _, node := range cluster.Nodes {
-			if len(node.DiskPartition) > 0 {
-				warningsCollector.AddWarning(fmt.Sprintf("WARNING: diskPartition field on node '%s' is not supported in ClusterInstance and will be ignored. "+
-					"Consider using IgnitionConfigOverride at the node level to configure disk partitions instead.\n",
-					node.HostName))
-			}
-			if len(node.UserData) > 0 {
-				warningsCollector.AddWarning(fmt.Sprintf("WARNING: userData field on node '%s' is not supported in ClusterInstance and will be ignored."+
-					"Add userData through custom templates which add the necessary field to BareMetalHost\n",
-					node.HostName))
-			}
-			// Check for node-level biosConfigRef
-			if node.BiosConfigRef.FilePath != "" {
-				warningsCollector.AddWarning(fmt.Sprintf("WARNING: biosConfigRef field '%s' on node '%s' is not supported in ClusterInstance and will be ignored. "+
-					"Please create a custom node template that includes HostFirmwareSettings and reference it through templateRefs instead."+
-					"Any nodes which use that custom template will then get the bios settings indicated in that CR\n",
-					node.BiosConfigRef.FilePath, node.HostName))
-			}
-			// Check for node-level crTemplates
-			if len(node.CrTemplates) > 0 {
-				warningsCollector.AddWarning(fmt.Sprintf("WARNING: crTemplates field on node '%s' is not supported in ClusterInstance and will be ignored. "+
-					"To provide custom CR templates please use ConfigMaps and reference them through templateRefs instead.\n",
-					node.HostName))
-			}
-			// Check for cpuset
-			if node.Cpuset != "" {
-				warningsCollector.AddWarning(fmt.Sprintf("WARNING: cpuset field '%s' on node '%s' is not supported in ClusterInstance and will be ignored. "+
-					"Please see Workload Partitioning Feature for setting specific reserved/isolated CPUSets.\n",
-					node.Cpuset, node.HostName))
-			}
-		}
+		addClusterWarnings(cluster, warningsCollector)
 	}
 
 	// Create output directory if it doesn't exist
@@ -547,6 +455,125 @@ func convertToClusterInstance(siteConfig *SiteConfig, outputDir string, clusterT
 	return nil
 }
 
+// addExtraManifestsRefWarning adds the warning about an extra manifests
+// ConfigMap given on the command line
+func addExtraManifestsRefWarning(name string, warningsCollector *WarningsCollector) {
+	warningsCollector.AddWarning(fmt.Sprintf("WARNING: The specified extra manifests ConfigMap '%s' is expected to contain the correct set of manifests for the cluster which must match the content generated by the extraManifests content from the original SiteConfig. This tool can't validate that expectation\n", name))
+}
+
+// addSiteConfigWarnings adds the warnings about the SiteConfig spec fields
+// which are not supported in ClusterInstance
+func addSiteConfigWarnings(siteConfig *SiteConfig, warningsCollector *WarningsCollector) {
+	if siteConfig.Spec.SshPrivateKeySecretRef.Name != "" {
+		warningsCollector.AddWarning(fmt.Sprintf("WARNING: sshPrivateKeySecretRef field '%s' is not supported in ClusterInstance and will be ignored\n",
+			siteConfig.Spec.SshPrivateKeySecretRef.Name))
+	}
+
+	// Check for global biosConfigRef
+	if siteConfig.Spec.BiosConfigRef.FilePath != "" {
+		warningsCollector.AddWarning(fmt.Sprintf("WARNING: biosConfigRef field '%s' at SiteConfig spec level is not supported in ClusterInstance and will be ignored. "+
+			"Please create a custom node template for HostFirmwareSettings and reference it through templateRefs instead."+
+			"Any nodes which use that custom template will then get the bios settings indicated in that CR\n",
+			siteConfig.Spec.BiosConfigRef.FilePath))
+	}
+
+	// Check for SiteConfig spec level crTemplates
+	if len(siteConfig.Spec.CrTemplates) > 0 {
+		warningsCollector.AddWarning("WARNING: crTemplates field at SiteConfig spec level is not supported in ClusterInstance and will be ignored. " +
+			"To provide custom CR templates please use ConfigMaps and reference them through templateRefs instead.\n")
+	}
+}
+
+// addClusterWarnings adds the warnings about the fields of the cluster and of
+// its nodes which are not supported in ClusterInstance
+func addClusterWarnings(cluster Cluster, warningsCollector *WarningsCollector) {
+	// Check for live cluster migration warnings
+	if cluster.ApiVIP != "" {
+		warningsCollector.AddWarning("WARNING: apiVIP is removed in ClusterInstance. " +
+			"Using apiVIPs instead. If you are doing a live cluster migration, you need to create a custom template for AgentClusterInstall or suppress it.\n")
+	}
+
+	if cluster.IngressVIP != "" {
+		warningsCollector.AddWarning("WARNING: ingressVIP is removed in ClusterInstance. " +
+			"Using ingressVIPs instead. If you are doing a live cluster migration, you need to create a custom template for AgentClusterInstall or suppress it.\n")
+	}
+
+	// Check for cluster-level biosConfigRef
+	if cluster.BiosConfigRef.FilePath != "" {
+		warningsCollector.AddWarning(fmt.Sprintf("WARNING: biosConfigRef field '%s' at cluster level is not supported in ClusterInstance and will be ignored. "+
+			"Please create a custom node template for HostFirmwareSettings and reference it through templateRefs instead."+
+			"Any nodes which use that custom template will then get the bios settings indicated in that CR\n",
+			cluster.BiosConfigRef.FilePath))
+	}
+
+	// Check for cluster-level crTemplates
+	if len(cluster.CrTemplates) > 0 {
+		warningsCollector.AddWarning("WARNING: crTemplates field at cluster level is not supported in ClusterInstance and will be ignored. " +
+			"To provide custom CR templates please use ConfigMaps and reference them through templateRefs instead.\n")
+	}
+
+	// Check for mergeDefaultMachineConfigs
+	if cluster.MergeDefaultMachineConfigs {
+		warningsCollector.AddWarning("WARNING: mergeDefaultMachineConfigs field is not supported in ClusterInstance and will be ignored. " +
+			"Use a ConfigMap which contains the already merged MachineConfigs and reference it through extraManifestsRefs instead.\n")
+	}
+
+	if cluster.ExtraManifestOnly {
+		warningsCollector.AddWarning("WARNING: extraManifestOnly field is not part of ClusterInstance spec. " +
+			"Extra manifests will be generated from this SiteConfig and included in the extraManifestsRefs ConfigMap, but the full ClusterInstance CR set will also be generated.\n")
+	}
+
+	if cluster.ExtraManifestPath != "" {
+		warningsCollector.AddWarning(fmt.Sprintf("WARNING: extraManifestPath field '%s' is not supported in ClusterInstance and will be ignored. "+
+			"Use extraManifests field instead\n",
+			cluster.ExtraManifestPath))
+	}
+
+	// Check for siteConfigMap
+	if cluster.SiteConfigMap.Name != "" {
+		warningsCollector.AddWarning(fmt.Sprintf("WARNING: siteConfigMap field '%s' is not supported in ClusterInstance and will be ignored. "+
+			"Create the site specific ConfigMap and place in git as a separate resource.\n", cluster.SiteConfigMap.Name))
+	}
+
+	// Check for tpm2 in disk encryption
+	if cluster.DiskEncryption.Tpm2.PCRList != "" {
+		warningsCollector.AddWarning("WARNING: tpm2 disk encryption configuration is not supported in ClusterInstance and will be ignored. Conversion will be done only for the Tang server field." +
+			"disk encryption MachineConfig with correct parameters must be added directly to the extramanifests configmap\n")
+	}
+
+	for _, node := range cluster.Nodes {
+		if len(node.DiskPartition) > 0 {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: diskPartition field on node '%s' is not supported in ClusterInstance and will be ignored. "+
+				"Consider using IgnitionConfigOverride at the node level to configure disk partitions instead.\n",
+				node.HostName))
+		}
+		if len(node.UserData) > 0 {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: userData field on node '%s' is not supported in ClusterInstance and will be ignored."+
+				"Add userData through custom templates which add the necessary field to BareMetalHost\n",
+				node.HostName))
+		}
+		// Check for node-level biosConfigRef
+		if node.BiosConfigRef.FilePath != "" {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: biosConfigRef field '%s' on node '%s' is not supported in ClusterInstance and will be ignored. "+
+				"Please create a custom node template that includes HostFirmwareSettings and reference it through templateRefs instead."+
+				"Any nodes which use that custom template will then get the bios settings indicated in that CR\n",
+				node.BiosConfigRef.FilePath, node.HostName))
+		}
+		// Check for node-level crTemplates
+		if len(node.CrTemplates) > 0 {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: crTemplates field on node '%s' is not supported in ClusterInstance and will be ignored. "+
+				"To provide custom CR templates please use ConfigMaps and reference them through templateRefs instead.\n",
+				node.HostName))
+		}
+		// Check for cpuset
+		if node.Cpuset != "" {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: cpuset field '%s' on node '%s' is not supported in ClusterInstance and will be ignored. "+
+				"Please see Workload Partitioning Feature for setting specific reserved/isolated CPUSets.\n",
+				node.Cpuset, node.HostName))
+		}
+	}
+}
+
 // insertSiteConfigComments inserts comments from SiteConfig into ClusterInstance YAML
 func insertSiteConfigComments(content string, commentCollector *CommentCollector, clusterIndex int, cluster Cluster) string {
 	if commentCollector == nil || commentCollector.Comments == nil {
@@ -994,18 +1021,21 @@ func writeClusterInstanceToFile(clusterInstance *ClusterInstance, filename strin
 	return nil
 }
 
-func generateKustomizationYAML(configMapName, configMapNamespace, manifestsDir, outputDir string) error {
-	fmt.Println("--- Kustomization.yaml Generator ---")
+// extraManifestsConfigMapGenerator returns the generator of the extra
+// manifests ConfigMap from the yaml files of the manifests directory, relative
+// to the output directory
+func extraManifestsConfigMapGenerator(configMapName, configMapNamespace, manifestsDir, outputDir string) (ConfigMapGenerator, error) {
+	generator := ConfigMapGenerator{Name: configMapName, Namespace: configMapNamespace}
 
 	// Validate if the directory exists
 	if _, err := os.Stat(manifestsDir); os.IsNotExist(err) {
-		return fmt.Errorf("directory '%s' not found", manifestsDir)
+		return generator, fmt.Errorf("directory '%s' not found", manifestsDir)
 	}
 
 	// Get absolute path for debugging
 	absPath, err := filepath.Abs(manifestsDir)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return generator, fmt.Errorf("failed to get absolute path: %w", err)
 	}
 	fmt.Printf("Scanning directory: %s\n", absPath)
 
@@ -1013,7 +1043,7 @@ func generateKustomizationYAML(configMapName, configMapNamespace, manifestsDir,
 	var yamlFiles []string
 	entries, err := os.ReadDir(manifestsDir)
 	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
+		return generator, fmt.Errorf("failed to read directory: %w", err)
 	}
 
 	for _, entry := range entries {
@@ -1023,7 +1053,7 @@ func generateKustomizationYAML(configMapName, configMapNamespace, manifestsDir,
 				// Get relative path from outputDir to the manifest file
 				relPath, err := filepath.Rel(outputDir, filepath.Join(manifestsDir, entry.Name()))
 				if err != nil {
-					return fmt.Errorf("failed to get relative path for %s: %w", entry.Name(), err)
+					return generator, fmt.Errorf("failed to get relative path for %s: %w", entry.Name(), err)
 				}
 				yamlFiles = append(yamlFiles, relPath)
 				fmt.Printf("Found and adding: %s\n", relPath)
@@ -1038,17 +1068,20 @@ func generateKustomizationYAML(configMapName, configMapNamespace, manifestsDir,
 	// Sort files alphanumerically
 	sort.Strings(yamlFiles)
 
+	generator.Files = yamlFiles
+	return generator, nil
+}
+
+// generateKustomizationYAML writes the kustomization snippet generating the
+// extra manifests ConfigMaps to the output directory
+func generateKustomizationYAML(generators []ConfigMapGenerator, outputDir string) error {
+	fmt.Println("--- Kustomization.yaml Generator ---")
+
 	// Create the kustomization struct
 	kustomization := Kustomization{
-		ApiVersion: "kustomize.config.k8s.io/v1beta1",
-		Kind:       "Kustomization",
-		ConfigMapGenerator: []ConfigMapGenerator{
-			{
-				Files:     yamlFiles,
-				Name:      configMapName,
-				Namespace: configMapNamespace,
-			},
-		},
+		ApiVersion:         "kustomize.config.k8s.io/v1beta1",
+		Kind:               "Kustomization",
+		ConfigMapGenerator: generators,
 		GeneratorOptions: GeneratorOptions{
 			DisableNameSuffixHash: true,
 		},
@@ -494,32 +494,28 @@ func getExtraManifest(dataMap map[string]interface{}, clusterSpec Cluster, input
 	return dataMap, nil
 }
 
-// generateExtraManifests generates extra manifests for a SiteConfig and writes them to the output directory
-func generateExtraManifests(siteConfig *SiteConfig, outputDir string, inputFileDir string) error {
-	if len(siteConfig.Spec.Clusters) == 0 {
-		return fmt.Errorf("no clusters found in SiteConfig")
+// generateExtraManifests generates the extra manifests of a cluster and writes them to the output directory
+func generateExtraManifests(cluster Cluster, outputDir string, inputFileDir string) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create manifests directory: %w", err)
 	}
 
-	// Process each cluster
-	for _, cluster := range siteConfig.Spec.Clusters {
-		// Generate extra manifests for this cluster
-		dataMap := make(map[string]interface{})
-		extraManifests, err := getExtraManifest(dataMap, cluster, inputFileDir)
-		if err != nil {
-			return fmt.Errorf("failed to generate extra manifests for cluster %s: %w", cluster.ClusterName, err)
-		}
+	dataMap := make(map[string]interface{})
+	extraManifests, err := getExtraManifest(dataMap, cluster, inputFileDir)
+	if err != nil {
+		return fmt.Errorf("failed to generate extra manifests for cluster %s: %w", cluster.ClusterName, err)
+	}
 
-		// Write each manifest to a file
-		for filename, content := range extraManifests {
-			manifestContent, ok := content.(string)
-			if !ok {
-				return fmt.Errorf("invalid manifest content type for %s", filename)
-			}
+	// Write each manifest to a file
+	for filename, content := range extraManifests {
+		manifestContent, ok := content.(string)
+		if !ok {
+			return fmt.Errorf("invalid manifest content type for %s", filename)
+		}
 
-			outputFile := filepath.Join(outputDir, filename)
-			if err := os.WriteFile(outputFile, []byte(manifestContent), 0644); err != nil {
-				return fmt.Errorf("failed to write manifest file %s: %w", outputFile, err)
-			}
+		outputFile := filepath.Join(outputDir, filename)
+		if err := os.WriteFile(outputFile, []byte(manifestContent), 0644); err != nil {
+			return fmt.Errorf("failed to write manifest file %s: %w", outputFile, err)
 		}
 	}
 
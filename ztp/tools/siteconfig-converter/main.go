@@ -234,16 +234,27 @@ type Partition struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerify(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		os.Exit(runRender(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		os.Exit(runBatch(os.Args[2:]))
+	}
+
 	var (
 		outputDir           = flag.String("d", "", "Output directory for converted ClusterInstance files (required)")
-		clusterTemplate     = flag.String("t", "open-cluster-management/ai-cluster-templates-v1", "Comma-separated list of template references for Cluster (format: namespace/name,namespace/name,...)")
-		nodeTemplate        = flag.String("n", "open-cluster-management/ai-node-templates-v1", "Comma-separated list of template references for Nodes (format: namespace/name,namespace/name,...)")
+		clusterTemplate     = flag.String("t", DefaultClusterTemplates, "Comma-separated list of template references for Cluster (format: namespace/name,namespace/name,...)")
+		nodeTemplate        = flag.String("n", DefaultNodeTemplates, "Comma-separated list of template references for Nodes (format: namespace/name,namespace/name,...)")
 		extraManifestsRefs  = flag.String("m", "", "Comma-separated list of ConfigMap names for extra manifests references")
 		suppressedManifests = flag.String("s", "", "Comma-separated list of manifest names to suppress at cluster level")
 		writeWarnings       = flag.Bool("w", false, "Write conversion warnings as comments to the head of converted YAML files")
 		copyComments        = flag.Bool("c", false, "Copy comments from SiteConfig to ClusterInstance YAML files")
+		reverse             = flag.Bool("reverse", false, "Convert ClusterInstance files, along with the kustomization files of their extra manifests ConfigMap, to SiteConfig files")
 		// Hardcoded values for extra manifest configuration
-		extraManifestConfigMapName = "extra-manifests-cm"
+		extraManifestConfigMapName = DefaultExtraManifestConfigMapName
 		manifestsDir               = "extra-manifests"
 	)
 	flag.Parse()
@@ -269,10 +280,22 @@ func main() {
 		fmt.Println("  siteconfig-converter -w -d ./output example-siteconfig.yaml")
 		fmt.Println("  siteconfig-converter -c -d ./output example-siteconfig.yaml")
 		fmt.Println("  siteconfig-converter -w -c -d ./output example-siteconfig.yaml")
+		fmt.Println("  siteconfig-converter -reverse -d ./output example-sno.yaml kustomization.yaml")
+		fmt.Println("  siteconfig-converter verify example-siteconfig.yaml output/example-sno.yaml output/kustomization-configMapGenerator-snippet.yaml")
+		fmt.Println("  siteconfig-converter batch -d ./clusterinstances site-configs/kustomization.yaml")
+		fmt.Println("  siteconfig-converter render -d ./rendered -T ./templates output/example-sno.yaml")
 
 		os.Exit(1)
 	}
 
+	if *reverse {
+		if err := convertToSiteConfig(args, *outputDir, *writeWarnings); err != nil {
+			fmt.Printf("Error converting to SiteConfig: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	inputFile := args[0]
 
 	// Read the SiteConfig file
@@ -290,6 +313,15 @@ func main() {
 
 	fmt.Printf("Successfully read SiteConfig: %s/%s\n", siteConfig.Metadata.Namespace, siteConfig.Metadata.Name)
 
+	// Validate the SiteConfig before converting it
+	validationCollector := &WarningsCollector{}
+	validateSiteConfig(siteConfig, validationCollector)
+	validationCollector.PrintWarnings()
+	if len(validationCollector.Errors) > 0 {
+		fmt.Printf("Error: SiteConfig is invalid, %d error(s) found\n", len(validationCollector.Errors))
+		os.Exit(1)
+	}
+
 	// Convert to ClusterInstance
 	err = convertToClusterInstance(siteConfig, *outputDir, *clusterTemplate, *nodeTemplate, *extraManifestsRefs, *suppressedManifests, *writeWarnings, *copyComments, inputFile, extraManifestConfigMapName)
 	if err != nil {
@@ -298,12 +330,11 @@ func main() {
 	}
 
 	// Generate extra manifest kustomization files (runs by default)
-	// Always use the cluster name from SiteConfig as the namespace
+	// The ConfigMap of each cluster is generated in the namespace of the cluster
 	if len(siteConfig.Spec.Clusters) > 0 {
-		configMapNamespace := siteConfig.Spec.Clusters[0].ClusterName
 		fmt.Printf("Generating ConfigMap kustomization files...\n")
-		fmt.Printf("Using ConfigMap name: %s, namespace: %s, manifests directory: %s\n", extraManifestConfigMapName, configMapNamespace, manifestsDir)
-		err = handleNewExtraManifestFlags(extraManifestConfigMapName, configMapNamespace, manifestsDir, inputFile, *outputDir)
+		fmt.Printf("Using ConfigMap name: %s, manifests directory: %s\n", extraManifestConfigMapName, manifestsDir)
+		err = handleNewExtraManifestFlags(extraManifestConfigMapName, manifestsDir, inputFile, *outputDir)
 		if err != nil {
 			fmt.Printf("Error: Failed to generate kustomization files: %v\n", err)
 			os.Exit(1)
@@ -313,9 +344,12 @@ func main() {
 	}
 }
 
-// handleNewExtraManifestFlags handles the new separate flags for extra manifest configuration
-func handleNewExtraManifestFlags(configMapName, configMapNamespace, manifestsDir, inputFile, outputDir string) error {
-	fmt.Printf("Generating ConfigMap kustomization files with name: %s, namespace: %s, manifests directory: %s\n", configMapName, configMapNamespace, manifestsDir)
+// handleNewExtraManifestFlags handles the new separate flags for extra manifest configuration.
+// The extra manifests ConfigMap of each cluster is generated in the namespace
+// of the cluster, from the manifests directory, or from a directory per
+// cluster within it when the SiteConfig holds several clusters.
+func handleNewExtraManifestFlags(configMapName, manifestsDir, inputFile, outputDir string) error {
+	fmt.Printf("Generating ConfigMap kustomization files with name: %s, manifests directory: %s\n", configMapName, manifestsDir)
 
 	manifestsDir = filepath.Join(outputDir, manifestsDir)
 	if err := os.MkdirAll(manifestsDir, 0755); err != nil {
@@ -339,14 +373,28 @@ func handleNewExtraManifestFlags(configMapName, configMapNamespace, manifestsDir
 		}
 	}
 
-	// Generate extra manifests directly
-	if err := generateExtraManifests(siteConfig, manifestsDir, inputFileDir); err != nil {
-		return fmt.Errorf("failed to generate extra manifests: %w", err)
+	if len(siteConfig.Spec.Clusters) == 0 {
+		return fmt.Errorf("failed to generate extra manifests: no clusters found in SiteConfig")
 	}
+	var generators []ConfigMapGenerator
+	for _, cluster := range siteConfig.Spec.Clusters {
+		clusterManifestsDir := manifestsDir
+		if len(siteConfig.Spec.Clusters) > 1 {
+			clusterManifestsDir = filepath.Join(manifestsDir, cluster.ClusterName)
+		}
+		if err := generateExtraManifests(cluster, clusterManifestsDir, inputFileDir); err != nil {
+			return fmt.Errorf("failed to generate extra manifests: %w", err)
+		}
+		fmt.Printf("Successfully generated extra manifests of cluster %s in %s\n", cluster.ClusterName, clusterManifestsDir)
 
-	fmt.Printf("Successfully generated extra manifests in %s\n", manifestsDir)
+		generator, err := extraManifestsConfigMapGenerator(configMapName, cluster.ClusterName, clusterManifestsDir, outputDir)
+		if err != nil {
+			return fmt.Errorf("failed to generate kustomization.yaml: %w", err)
+		}
+		generators = append(generators, generator)
+	}
 
-	if err := generateKustomizationYAML(configMapName, configMapNamespace, manifestsDir, outputDir); err != nil {
+	if err := generateKustomizationYAML(generators, outputDir); err != nil {
 		return fmt.Errorf("failed to generate kustomization.yaml: %w", err)
 	}
 
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NMState is the typed model of the nmstate config of a node network. Only the
+// fields checked by the converter are modeled, the config itself being passed
+// through to the ClusterInstance unchanged.
+type NMState struct {
+	Interfaces  []NMStateInterface `yaml:"interfaces,omitempty"`
+	Routes      NMStateRoutes      `yaml:"routes,omitempty"`
+	DNSResolver NMStateDNSResolver `yaml:"dns-resolver,omitempty"`
+}
+
+// NMStateInterface represents an nmstate interface
+type NMStateInterface struct {
+	Name            string                  `yaml:"name"`
+	Type            string                  `yaml:"type,omitempty"`
+	State           string                  `yaml:"state,omitempty"`
+	MacAddress      string                  `yaml:"mac-address,omitempty"`
+	IPv4            *NMStateIP              `yaml:"ipv4,omitempty"`
+	IPv6            *NMStateIP              `yaml:"ipv6,omitempty"`
+	LinkAggregation *NMStateLinkAggregation `yaml:"link-aggregation,omitempty"`
+	VLAN            *NMStateVLAN            `yaml:"vlan,omitempty"`
+}
+
+// NMStateIP represents the ipv4 or ipv6 settings of an nmstate interface
+type NMStateIP struct {
+	Enabled  bool             `yaml:"enabled"`
+	DHCP     bool             `yaml:"dhcp,omitempty"`
+	Autoconf bool             `yaml:"autoconf,omitempty"`
+	Address  []NMStateAddress `yaml:"address,omitempty"`
+}
+
+// NMStateAddress represents a static address of an nmstate interface
+type NMStateAddress struct {
+	IP           string `yaml:"ip"`
+	PrefixLength int    `yaml:"prefix-length"`
+}
+
+// NMStateLinkAggregation represents the bond settings of an nmstate interface.
+// The ports are listed in port, or in slaves with nmstate 1.x.
+type NMStateLinkAggregation struct {
+	Mode   string   `yaml:"mode,omitempty"`
+	Port   []string `yaml:"port,omitempty"`
+	Slaves []string `yaml:"slaves,omitempty"`
+}
+
+// NMStateVLAN represents the VLAN settings of an nmstate interface
+type NMStateVLAN struct {
+	BaseIface string `yaml:"base-iface"`
+	ID        int    `yaml:"id"`
+}
+
+// NMStateRoutes represents the nmstate routes
+type NMStateRoutes struct {
+	Config []NMStateRoute `yaml:"config,omitempty"`
+}
+
+// NMStateRoute represents an nmstate route
+type NMStateRoute struct {
+	Destination      string `yaml:"destination"`
+	NextHopInterface string `yaml:"next-hop-interface,omitempty"`
+	NextHopAddress   string `yaml:"next-hop-address,omitempty"`
+	State            string `yaml:"state,omitempty"`
+	TableID          int    `yaml:"table-id,omitempty"`
+}
+
+// NMStateDNSResolver represents the nmstate DNS resolver
+type NMStateDNSResolver struct {
+	Config NMStateDNSConfig `yaml:"config,omitempty"`
+}
+
+// NMStateDNSConfig represents the nmstate DNS resolver config
+type NMStateDNSConfig struct {
+	Search []string `yaml:"search,omitempty"`
+	Server []string `yaml:"server,omitempty"`
+}
+
+// yamlErrorLine matches the line prefix of the yaml errors, meaningless once
+// the config is marshaled again
+var yamlErrorLine = regexp.MustCompile(`^line \d+: `)
+
+// parseNMState parses the nmstate config of a node network into the typed model
+func parseNMState(config map[string]interface{}) (*NMState, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	nmstate := &NMState{}
+	if err := yaml.Unmarshal(data, nmstate); err != nil {
+		if typeErr, ok := err.(*yaml.TypeError); ok {
+			var messages []string
+			for _, message := range typeErr.Errors {
+				messages = append(messages, yamlErrorLine.ReplaceAllString(message, ""))
+			}
+			return nil, fmt.Errorf("%s", strings.Join(messages, "; "))
+		}
+		return nil, err
+	}
+	return nmstate, nil
+}
+
+// nmstateValidator adds the findings about the node network of a node to the
+// cluster validator, prefixed with the node and the YAML path
+type nmstateValidator struct {
+	*clusterValidator
+	node Node
+	path string
+}
+
+func (v *nmstateValidator) errorf(path string, format string, args ...interface{}) {
+	v.clusterValidator.errorf("node %s %s.%s: %s", v.node.HostName, v.path, path, fmt.Sprintf(format, args...))
+}
+
+// validateNodeNetwork checks the nmstate config of the node: the interfaces
+// referenced by the bonds, the VLANs and the routes must be defined, the
+// physical interfaces must have a MAC address in nodeNetwork.interfaces, and
+// the addresses must be valid
+func (v *clusterValidator) validateNodeNetwork(node Node, path string) {
+	nv := &nmstateValidator{clusterValidator: v, node: node, path: path + ".nodeNetwork"}
+
+	// The interfaces known on the node are the configured ones and the ones
+	// with a MAC address
+	macs := make(map[string]int)
+	for idx, iface := range node.NodeNetwork.Interfaces {
+		if iface.Name == "" {
+			nv.errorf(fmt.Sprintf("interfaces[%d].name", idx), "name is empty")
+		}
+		if iface.MacAddress == "" {
+			nv.errorf(fmt.Sprintf("interfaces[%d].macAddress", idx), "interface %s has no MAC address", iface.Name)
+		} else if _, err := net.ParseMAC(iface.MacAddress); err != nil {
+			nv.errorf(fmt.Sprintf("interfaces[%d].macAddress", idx), "'%s' is not a valid MAC address", iface.MacAddress)
+		}
+		if _, found := macs[iface.Name]; found && iface.Name != "" {
+			nv.errorf(fmt.Sprintf("interfaces[%d].name", idx), "interface %s is listed twice", iface.Name)
+		}
+		macs[iface.Name] = idx
+	}
+	if len(node.NodeNetwork.Config) == 0 {
+		return
+	}
+	nmstate, err := parseNMState(node.NodeNetwork.Config)
+	if err != nil {
+		nv.errorf("config", "invalid nmstate config: %v", err)
+		return
+	}
+
+	defined := make(map[string]NMStateInterface)
+	for idx, iface := range nmstate.Interfaces {
+		ifacePath := fmt.Sprintf("config.interfaces[%d]", idx)
+		if iface.Name == "" {
+			nv.errorf(ifacePath+".name", "name is empty")
+			continue
+		}
+		if _, found := defined[iface.Name]; found {
+			nv.errorf(ifacePath+".name", "interface %s is defined twice", iface.Name)
+		}
+		defined[iface.Name] = iface
+		nv.validateAddresses(ifacePath+".ipv4", iface.IPv4, "IPv4", 32)
+		nv.validateAddresses(ifacePath+".ipv6", iface.IPv6, "IPv6", 128)
+	}
+
+	// The interfaces referenced by the bonds, the VLANs and the routes, such
+	// as the ports of a bond, may be left out of the config when they have a
+	// MAC address
+	reference := func(refPath string, name string) {
+		_, isDefined := defined[name]
+		_, hasMAC := macs[name]
+		if !isDefined && !hasMAC {
+			nv.errorf(refPath, "interface %s is not defined", name)
+		}
+	}
+	var physical []int
+	for idx, iface := range nmstate.Interfaces {
+		ifacePath := fmt.Sprintf("config.interfaces[%d]", idx)
+		if iface.Name == "" || iface.State == "absent" {
+			continue
+		}
+		switch iface.Type {
+		case "ethernet":
+			physical = append(physical, idx)
+		case "bond":
+			if iface.LinkAggregation == nil {
+				nv.errorf(ifacePath, "bond %s has no link-aggregation", iface.Name)
+				continue
+			}
+			field, ports := "port", iface.LinkAggregation.Port
+			if len(ports) == 0 {
+				field, ports = "slaves", iface.LinkAggregation.Slaves
+			}
+			if len(ports) == 0 {
+				nv.errorf(ifacePath+".link-aggregation", "bond %s has no port", iface.Name)
+			}
+			for portIdx, port := range ports {
+				reference(fmt.Sprintf("%s.link-aggregation.%s[%d]", ifacePath, field, portIdx), port)
+			}
+		case "vlan":
+			if iface.VLAN == nil || iface.VLAN.BaseIface == "" {
+				nv.errorf(ifacePath+".vlan.base-iface", "vlan %s has no base-iface", iface.Name)
+				continue
+			}
+			if iface.VLAN.ID < 0 || iface.VLAN.ID > 4094 {
+				nv.errorf(ifacePath+".vlan.id", "vlan id %d is not within 0-4094", iface.VLAN.ID)
+			}
+			reference(ifacePath+".vlan.base-iface", iface.VLAN.BaseIface)
+		}
+	}
+	for _, idx := range physical {
+		configured := nmstate.Interfaces[idx]
+		namePath := fmt.Sprintf("config.interfaces[%d].name", idx)
+		macIdx, found := macs[configured.Name]
+		if !found {
+			nv.errorf(namePath, "interface %s has no MAC address in %s.interfaces", configured.Name, nv.path)
+			continue
+		}
+		iface := node.NodeNetwork.Interfaces[macIdx]
+		if configured.MacAddress != "" && !strings.EqualFold(configured.MacAddress, iface.MacAddress) {
+			nv.errorf(namePath, "mac-address %s of interface %s differs from the macAddress %s in %s.interfaces[%d]",
+				configured.MacAddress, configured.Name, iface.MacAddress, nv.path, macIdx)
+		}
+	}
+
+	for idx, route := range nmstate.Routes.Config {
+		routePath := fmt.Sprintf("config.routes.config[%d]", idx)
+		if route.State == "absent" {
+			continue
+		}
+		_, destination, err := net.ParseCIDR(route.Destination)
+		if err != nil {
+			nv.errorf(routePath+".destination", "'%s' is not a valid CIDR", route.Destination)
+		}
+		if route.NextHopAddress != "" {
+			nextHop := net.ParseIP(route.NextHopAddress)
+			if nextHop == nil {
+				nv.errorf(routePath+".next-hop-address", "'%s' is not a valid IP address", route.NextHopAddress)
+			} else if destination != nil && ipFamily(nextHop) != ipFamily(destination.IP) {
+				nv.errorf(routePath+".next-hop-address", "%s next hop for the %s destination %s", ipFamily(nextHop), ipFamily(destination.IP), route.Destination)
+			}
+		}
+		// nmstate finds the interface from the next-hop-address when unset
+		if route.NextHopInterface != "" {
+			reference(routePath+".next-hop-interface", route.NextHopInterface)
+		}
+	}
+
+	for idx, server := range nmstate.DNSResolver.Config.Server {
+		if net.ParseIP(server) == nil {
+			nv.errorf(fmt.Sprintf("config.dns-resolver.config.server[%d]", idx), "'%s' is not a valid IP address", server)
+		}
+	}
+}
+
+// validateAddresses checks the static addresses of an interface
+func (v *nmstateValidator) validateAddresses(path string, settings *NMStateIP, family string, maxPrefixLength int) {
+	if settings == nil {
+		return
+	}
+	for idx, address := range settings.Address {
+		addressPath := fmt.Sprintf("%s.address[%d]", path, idx)
+		ip := net.ParseIP(address.IP)
+		if ip == nil || ipFamily(ip) != family {
+			v.errorf(addressPath+".ip", "'%s' is not a valid %s address", address.IP, family)
+		}
+		if address.PrefixLength < 0 || address.PrefixLength > maxPrefixLength {
+			v.errorf(addressPath+".prefix-length", "%d is not within 0-%d", address.PrefixLength, maxPrefixLength)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testNodeNetwork = `
+interfaces:
+  - name: eno1
+    macAddress: "AA:BB:CC:DD:EE:01"
+  - name: eno2
+    macAddress: "AA:BB:CC:DD:EE:02"
+config:
+  interfaces:
+    - name: bond0
+      type: bond
+      state: up
+      link-aggregation:
+        mode: active-backup
+        port:
+          - eno1
+          - eno2
+    - name: bond0.100
+      type: vlan
+      state: up
+      vlan:
+        base-iface: bond0
+        id: 100
+      ipv4:
+        enabled: true
+        address:
+          - ip: 192.168.1.20
+            prefix-length: 24
+  routes:
+    config:
+      - destination: 0.0.0.0/0
+        next-hop-interface: bond0.100
+        next-hop-address: 192.168.1.1
+  dns-resolver:
+    config:
+      server:
+        - 192.168.1.2
+`
+
+func TestParseNMState(t *testing.T) {
+	network := NodeNetwork{}
+	if err := yaml.Unmarshal([]byte(testNodeNetwork), &network); err != nil {
+		t.Fatalf("Failed to unmarshal node network: %v", err)
+	}
+	nmstate, err := parseNMState(network.Config)
+	if err != nil {
+		t.Fatalf("Failed to parse nmstate: %v", err)
+	}
+	if len(nmstate.Interfaces) != 2 || nmstate.Interfaces[0].LinkAggregation.Port[1] != "eno2" ||
+		nmstate.Interfaces[1].VLAN.BaseIface != "bond0" || nmstate.Interfaces[1].IPv4.Address[0].PrefixLength != 24 {
+		t.Errorf("Unexpected interfaces %+v", nmstate.Interfaces)
+	}
+	if nmstate.Routes.Config[0].NextHopInterface != "bond0.100" || nmstate.DNSResolver.Config.Server[0] != "192.168.1.2" {
+		t.Errorf("Unexpected routes %+v or dns-resolver %+v", nmstate.Routes, nmstate.DNSResolver)
+	}
+
+	if _, err := parseNMState(map[string]interface{}{"interfaces": "eno1"}); err == nil ||
+		err.Error() != "cannot unmarshal !!str `eno1` into []main.NMStateInterface" {
+		t.Errorf("Expected a type error, got %v", err)
+	}
+}
+
+func TestValidateNodeNetwork(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(network *NodeNetwork)
+		expected []string
+	}{
+		{
+			name:   "valid",
+			modify: func(network *NodeNetwork) {},
+		},
+		{
+			name: "undefined interfaces",
+			modify: func(network *NodeNetwork) {
+				network.Interfaces = network.Interfaces[:1]
+				network.Config["routes"] = map[string]interface{}{"config": []interface{}{
+					map[string]interface{}{"destination": "0.0.0.0/0", "next-hop-interface": "eno3"},
+				}}
+			},
+			expected: []string{
+				"config.interfaces[0].link-aggregation.port[1]: interface eno2 is not defined",
+				"config.routes.config[0].next-hop-interface: interface eno3 is not defined",
+			},
+		},
+		{
+			name: "physical interface without MAC address",
+			modify: func(network *NodeNetwork) {
+				interfaces := network.Config["interfaces"].([]interface{})
+				network.Config["interfaces"] = append(interfaces,
+					map[string]interface{}{"name": "eno3", "type": "ethernet", "state": "up"},
+					map[string]interface{}{"name": "eno2", "type": "ethernet", "mac-address": "aa:bb:cc:dd:ee:99"})
+			},
+			expected: []string{
+				"config.interfaces[2].name: interface eno3 has no MAC address in spec.clusters[0].nodes[0].nodeNetwork.interfaces",
+				"config.interfaces[3].name: mac-address aa:bb:cc:dd:ee:99 of interface eno2 differs from the macAddress AA:BB:CC:DD:EE:02 in spec.clusters[0].nodes[0].nodeNetwork.interfaces[1]",
+			},
+		},
+		{
+			name: "invalid addresses",
+			modify: func(network *NodeNetwork) {
+				network.Interfaces[1].MacAddress = "AA:BB:CC"
+				network.Config["dns-resolver"] = map[string]interface{}{"config": map[string]interface{}{"server": []interface{}{"dns1"}}}
+				network.Config["routes"] = map[string]interface{}{"config": []interface{}{
+					map[string]interface{}{"destination": "::/0", "next-hop-interface": "bond0.100", "next-hop-address": "192.168.1.1"},
+				}}
+				vlan := network.Config["interfaces"].([]interface{})[1].(map[string]interface{})
+				vlan["ipv4"] = map[string]interface{}{"enabled": true, "address": []interface{}{
+					map[string]interface{}{"ip": "fd00::1", "prefix-length": 33},
+				}}
+			},
+			expected: []string{
+				"interfaces[1].macAddress: 'AA:BB:CC' is not a valid MAC address",
+				"config.interfaces[1].ipv4.address[0].ip: 'fd00::1' is not a valid IPv4 address",
+				"config.interfaces[1].ipv4.address[0].prefix-length: 33 is not within 0-32",
+				"config.routes.config[0].next-hop-address: IPv4 next hop for the IPv6 destination ::/0",
+				"config.dns-resolver.config.server[0]: 'dns1' is not a valid IP address",
+			},
+		},
+		{
+			name: "bond and VLAN without interfaces",
+			modify: func(network *NodeNetwork) {
+				interfaces := network.Config["interfaces"].([]interface{})
+				delete(interfaces[0].(map[string]interface{}), "link-aggregation")
+				interfaces[1].(map[string]interface{})["vlan"] = map[string]interface{}{"id": 5000, "base-iface": "bond0"}
+			},
+			expected: []string{
+				"config.interfaces[0]: bond bond0 has no link-aggregation",
+				"config.interfaces[1].vlan.id: vlan id 5000 is not within 0-4094",
+			},
+		},
+		{
+			name: "route without next-hop-interface",
+			modify: func(network *NodeNetwork) {
+				network.Config["routes"] = map[string]interface{}{"config": []interface{}{
+					map[string]interface{}{"destination": "0.0.0.0/0", "next-hop-address": "192.168.1.1"},
+				}}
+			},
+		},
+		{
+			name: "invalid nmstate",
+			modify: func(network *NodeNetwork) {
+				network.Config["routes"] = map[string]interface{}{"config": "none"}
+			},
+			expected: []string{"config: invalid nmstate config: cannot unmarshal !!str `none` into []main.NMStateRoute"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cluster := validCluster()
+			cluster.Nodes = cluster.Nodes[:1]
+			cluster.NumMasters = 1
+			cluster.Nodes[0].BootMACAddress = "AA:BB:CC:DD:EE:01"
+			if err := yaml.Unmarshal([]byte(testNodeNetwork), &cluster.Nodes[0].NodeNetwork); err != nil {
+				t.Fatalf("Failed to unmarshal node network: %v", err)
+			}
+			test.modify(&cluster.Nodes[0].NodeNetwork)
+			warnings := &WarningsCollector{}
+			validateCluster(cluster, 0, make(map[string]string), warnings)
+			if len(warnings.Errors) != len(test.expected) {
+				t.Fatalf("Expected %d error(s), got %v", len(test.expected), warnings.Errors)
+			}
+			for idx, expected := range test.expected {
+				expected = "ERROR: cluster mno1: node node1 spec.clusters[0].nodes[0].nodeNetwork." + expected + "\n"
+				if warnings.Errors[idx] != expected {
+					t.Errorf("Expected error %q, got %q", expected, warnings.Errors[idx])
+				}
+			}
+		})
+	}
+}
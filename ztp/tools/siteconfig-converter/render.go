@@ -0,0 +1,663 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SyncWaveAnnotation orders the rendered manifests, the lowest wave first
+	SyncWaveAnnotation = "siteconfig.open-cluster-management.io/sync-wave"
+	// RenderedManifestsFileSuffix is the suffix of the file of the rendered manifests of a cluster
+	RenderedManifestsFileSuffix = "-installation-crs.yaml"
+)
+
+// TemplateConfigMap is a ConfigMap holding installation manifest templates,
+// keyed by name
+type TemplateConfigMap struct {
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Data map[string]string `yaml:"data"`
+}
+
+// templateData is the data the templates are executed with. It follows the
+// data of the SiteConfig operator so that the same templates can be used.
+type templateData struct {
+	Spec        renderSpec
+	SpecialVars specialVars
+}
+
+// specialVars are the values computed from the ClusterInstance for the
+// templates, along with the node a node template is executed for
+type specialVars struct {
+	CurrentNode            renderNode
+	InstallConfigOverrides string
+	ControlPlaneAgents     int
+	WorkerAgents           int
+}
+
+// renderSpec is the ClusterInstance spec the templates are executed with,
+// its fields named after the ones of the SiteConfig operator API
+type renderSpec struct {
+	ClusterName            string                         `yaml:"clusterName"`
+	PullSecretRef          LocalObjectReference           `yaml:"pullSecretRef"`
+	ClusterImageSetNameRef string                         `yaml:"clusterImageSetNameRef"`
+	SSHPublicKey           string                         `yaml:"sshPublicKey,omitempty"`
+	BaseDomain             string                         `yaml:"baseDomain"`
+	ApiVIPs                []string                       `yaml:"apiVIPs,omitempty"`
+	IngressVIPs            []string                       `yaml:"ingressVIPs,omitempty"`
+	HoldInstallation       bool                           `yaml:"holdInstallation,omitempty"`
+	AdditionalNTPSources   []string                       `yaml:"additionalNTPSources,omitempty"`
+	MachineNetwork         []MachineNetworkEntry          `yaml:"machineNetwork,omitempty"`
+	ClusterNetwork         []ClusterNetworkEntry          `yaml:"clusterNetwork,omitempty"`
+	ServiceNetwork         []ServiceNetworkEntry          `yaml:"serviceNetwork,omitempty"`
+	NetworkType            string                         `yaml:"networkType,omitempty"`
+	PlatformType           string                         `yaml:"platformType,omitempty"`
+	ExtraAnnotations       map[string]map[string]string   `yaml:"extraAnnotations,omitempty"`
+	ExtraLabels            map[string]map[string]string   `yaml:"extraLabels,omitempty"`
+	InstallConfigOverrides string                         `yaml:"installConfigOverrides,omitempty"`
+	IgnitionConfigOverride string                         `yaml:"ignitionConfigOverride,omitempty"`
+	DiskEncryption         *ClusterInstanceDiskEncryption `yaml:"diskEncryption,omitempty"`
+	Proxy                  *ClusterInstanceProxy          `yaml:"proxy,omitempty"`
+	ExtraManifestsRefs     []LocalObjectReference         `yaml:"extraManifestsRefs,omitempty"`
+	SuppressedManifests    []string                       `yaml:"suppressedManifests,omitempty"`
+	PruneManifests         []ResourceRef                  `yaml:"pruneManifests,omitempty"`
+	CPUPartitioning        string                         `yaml:"cpuPartitioningMode,omitempty"`
+	CPUArchitecture        string                         `yaml:"cpuArchitecture,omitempty"`
+	ClusterType            string                         `yaml:"clusterType,omitempty"`
+	TemplateRefs           []TemplateRef                  `yaml:"templateRefs,omitempty"`
+	CaBundleRef            *LocalObjectReference          `yaml:"caBundleRef,omitempty"`
+	Nodes                  []renderNode                   `yaml:"nodes,omitempty"`
+	Reinstall              *ReinstallSpec                 `yaml:"reinstall,omitempty"`
+}
+
+// renderNode is a ClusterInstance node the templates are executed with
+type renderNode struct {
+	BmcAddress             string                            `yaml:"bmcAddress"`
+	BmcCredentialsName     ClusterInstanceBmcCredentialsName `yaml:"bmcCredentialsName"`
+	BootMACAddress         string                            `yaml:"bootMACAddress"`
+	AutomatedCleaningMode  string                            `yaml:"automatedCleaningMode,omitempty"`
+	RootDeviceHints        *renderRootDeviceHints            `yaml:"rootDeviceHints,omitempty"`
+	NodeNetwork            *renderNodeNetwork                `yaml:"nodeNetwork,omitempty"`
+	NodeLabels             map[string]string                 `yaml:"nodeLabels,omitempty"`
+	HostName               string                            `yaml:"hostName"`
+	HostRef                *HostRef                          `yaml:"hostRef,omitempty"`
+	CPUArchitecture        string                            `yaml:"cpuArchitecture,omitempty"`
+	BootMode               string                            `yaml:"bootMode,omitempty"`
+	InstallerArgs          string                            `yaml:"installerArgs,omitempty"`
+	IgnitionConfigOverride string                            `yaml:"ignitionConfigOverride,omitempty"`
+	Role                   string                            `yaml:"role,omitempty"`
+	ExtraAnnotations       map[string]map[string]string      `yaml:"extraAnnotations,omitempty"`
+	ExtraLabels            map[string]map[string]string      `yaml:"extraLabels,omitempty"`
+	SuppressedManifests    []string                          `yaml:"suppressedManifests,omitempty"`
+	PruneManifests         []ResourceRef                     `yaml:"pruneManifests,omitempty"`
+	IronicInspect          string                            `yaml:"ironicInspect,omitempty"`
+	TemplateRefs           []TemplateRef                     `yaml:"templateRefs,omitempty"`
+}
+
+// renderRootDeviceHints are the BareMetalHost root device hints of a node
+type renderRootDeviceHints struct {
+	DeviceName         string `yaml:"deviceName,omitempty"`
+	HCTL               string `yaml:"hctl,omitempty"`
+	Model              string `yaml:"model,omitempty"`
+	Vendor             string `yaml:"vendor,omitempty"`
+	SerialNumber       string `yaml:"serialNumber,omitempty"`
+	MinSizeGigabytes   int    `yaml:"minSizeGigabytes,omitempty"`
+	WWN                string `yaml:"wwn,omitempty"`
+	WWNWithExtension   string `yaml:"wwnWithExtension,omitempty"`
+	WWNVendorExtension string `yaml:"wwnVendorExtension,omitempty"`
+	Rotational         *bool  `yaml:"rotational,omitempty"`
+}
+
+// renderNodeNetwork is the NMStateConfig spec of a node
+type renderNodeNetwork struct {
+	NetConfig  renderNetConfig                    `yaml:"config,omitempty"`
+	Interfaces []*ClusterInstanceNetworkInterface `yaml:"interfaces,omitempty"`
+}
+
+// renderNetConfig is the nmstate configuration of a node, marshalled as is
+type renderNetConfig struct {
+	Raw map[string]interface{}
+}
+
+// MarshalYAML marshals the raw nmstate configuration
+func (c renderNetConfig) MarshalYAML() (interface{}, error) {
+	return c.Raw, nil
+}
+
+// runRender implements the render subcommand and returns the exit code
+func runRender(args []string) int {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	outputDir := flags.String("d", "", "Output directory for the rendered manifests (required)")
+	templates := flags.String("T", "", "Comma-separated list of files or directories holding the template ConfigMaps (required)")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if *outputDir == "" || *templates == "" || flags.NArg() == 0 {
+		fmt.Println("Usage: siteconfig-converter render -d output_dir -T templates_dir,templates.yaml,... <clusterinstance.yaml>...")
+		return 1
+	}
+
+	if err := renderClusterInstances(flags.Args(), strings.Split(*templates, ","), *outputDir); err != nil {
+		fmt.Printf("Error rendering ClusterInstance: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// renderClusterInstances renders the manifests of the ClusterInstances of the
+// files and writes them to a file per cluster in outputDir
+func renderClusterInstances(filenames []string, templatePaths []string, outputDir string) error {
+	clusterInstances, _, err := readClusterInstancesAndKustomizations(filenames)
+	if err != nil {
+		return err
+	}
+	if len(clusterInstances) == 0 {
+		return fmt.Errorf("no ClusterInstance found in %s", strings.Join(filenames, ", "))
+	}
+	templates, err := readTemplateConfigMaps(templatePaths)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	for _, clusterInstance := range clusterInstances {
+		warningsCollector := &WarningsCollector{}
+		manifests, err := renderClusterInstance(clusterInstance, templates, warningsCollector)
+		if err != nil {
+			return fmt.Errorf("failed to render ClusterInstance %s: %w", clusterInstance.Metadata.Name, err)
+		}
+		outputPath := filepath.Join(outputDir, clusterInstance.Spec.ClusterName+RenderedManifestsFileSuffix)
+		if err := writeRenderedManifests(manifests, outputPath); err != nil {
+			return fmt.Errorf("failed to write the manifests of cluster %s: %w", clusterInstance.Spec.ClusterName, err)
+		}
+		fmt.Printf("Rendered %d manifest(s) of ClusterInstance %s/%s: %s\n", len(manifests), clusterInstance.Metadata.Namespace, clusterInstance.Metadata.Name, outputPath)
+		warningsCollector.PrintWarnings()
+	}
+	return nil
+}
+
+// readTemplateConfigMaps reads the ConfigMaps of the files, and of the YAML
+// files of the directories, the other objects being skipped
+func readTemplateConfigMaps(paths []string) ([]TemplateConfigMap, error) {
+	var filenames []string
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read templates: %w", err)
+		}
+		if !info.IsDir() {
+			filenames = append(filenames, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read templates directory: %w", err)
+		}
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				filenames = append(filenames, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	var configMaps []TemplateConfigMap
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		for {
+			var document yaml.Node
+			if err := decoder.Decode(&document); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal YAML of %s: %w", filename, err)
+			}
+			header := struct {
+				Kind string `yaml:"kind"`
+			}{}
+			if err := document.Decode(&header); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal YAML of %s: %w", filename, err)
+			}
+			if header.Kind != "ConfigMap" {
+				continue
+			}
+			configMap := TemplateConfigMap{}
+			if err := document.Decode(&configMap); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal ConfigMap of %s: %w", filename, err)
+			}
+			configMaps = append(configMaps, configMap)
+		}
+	}
+	return configMaps, nil
+}
+
+// findTemplateConfigMap returns the ConfigMap of the template reference, the
+// ConfigMaps without namespace matching any namespace
+func findTemplateConfigMap(ref TemplateRef, configMaps []TemplateConfigMap) (*TemplateConfigMap, error) {
+	for idx, configMap := range configMaps {
+		if configMap.Metadata.Name != ref.Name {
+			continue
+		}
+		if configMap.Metadata.Namespace != "" && configMap.Metadata.Namespace != ref.Namespace {
+			continue
+		}
+		return &configMaps[idx], nil
+	}
+	return nil, fmt.Errorf("template ConfigMap %s/%s not found", ref.Namespace, ref.Name)
+}
+
+// renderClusterInstance executes the templates of the cluster templateRefs,
+// then the ones of the node templateRefs for each node, as the SiteConfig
+// operator does. The manifests of the suppressedManifests kinds are dropped,
+// the extraAnnotations and extraLabels are added and the manifests are sorted
+// by sync wave.
+func renderClusterInstance(clusterInstance *ClusterInstance, templates []TemplateConfigMap, warningsCollector *WarningsCollector) ([]map[string]interface{}, error) {
+	spec, err := newRenderSpec(clusterInstance.Spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(spec.TemplateRefs) == 0 {
+		return nil, fmt.Errorf("cluster %s has no templateRefs", spec.ClusterName)
+	}
+	data := templateData{Spec: spec}
+	if data.SpecialVars.InstallConfigOverrides, err = installConfigOverrides(spec); err != nil {
+		return nil, err
+	}
+	for _, node := range spec.Nodes {
+		switch node.Role {
+		case "master":
+			data.SpecialVars.ControlPlaneAgents++
+		case "worker":
+			data.SpecialVars.WorkerAgents++
+		}
+	}
+
+	var manifests []map[string]interface{}
+	clusterKinds := make(map[string]bool)
+	clusterManifests, err := renderTemplateRefs(spec.TemplateRefs, templates, data)
+	if err != nil {
+		return nil, err
+	}
+	for _, manifest := range clusterManifests {
+		kind, _ := manifest["kind"].(string)
+		clusterKinds[kind] = true
+		if contains(spec.SuppressedManifests, kind) {
+			continue
+		}
+		addExtraMetadata(manifest, "annotations", spec.ExtraAnnotations[kind])
+		addExtraMetadata(manifest, "labels", spec.ExtraLabels[kind])
+		manifests = append(manifests, manifest)
+	}
+
+	for idx, node := range spec.Nodes {
+		if len(node.TemplateRefs) == 0 {
+			return nil, fmt.Errorf("node %s has no templateRefs", node.HostName)
+		}
+		data.SpecialVars.CurrentNode = node
+		nodeManifests, err := renderTemplateRefs(node.TemplateRefs, templates, data)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", node.HostName, err)
+		}
+		nodeKinds := make(map[string]bool)
+		for _, manifest := range nodeManifests {
+			kind, _ := manifest["kind"].(string)
+			nodeKinds[kind] = true
+			clusterKinds[kind] = true
+			if contains(spec.SuppressedManifests, kind) || contains(node.SuppressedManifests, kind) {
+				continue
+			}
+			addExtraMetadata(manifest, "annotations", node.ExtraAnnotations[kind])
+			addExtraMetadata(manifest, "labels", node.ExtraLabels[kind])
+			addExtraMetadata(manifest, "annotations", spec.ExtraAnnotations[kind])
+			addExtraMetadata(manifest, "labels", spec.ExtraLabels[kind])
+			manifests = append(manifests, manifest)
+		}
+		where := fmt.Sprintf("spec.nodes[%d]", idx)
+		warnUnrenderedKinds(where+".suppressedManifests", node.SuppressedManifests, nodeKinds, warningsCollector)
+		warnUnrenderedKinds(where+".extraAnnotations", mapKeys(node.ExtraAnnotations), nodeKinds, warningsCollector)
+		warnUnrenderedKinds(where+".extraLabels", mapKeys(node.ExtraLabels), nodeKinds, warningsCollector)
+	}
+	warnUnrenderedKinds("spec.suppressedManifests", spec.SuppressedManifests, clusterKinds, warningsCollector)
+	warnUnrenderedKinds("spec.extraAnnotations", mapKeys(spec.ExtraAnnotations), clusterKinds, warningsCollector)
+	warnUnrenderedKinds("spec.extraLabels", mapKeys(spec.ExtraLabels), clusterKinds, warningsCollector)
+
+	waves := make([]int, len(manifests))
+	for idx, manifest := range manifests {
+		if waves[idx], err = syncWave(manifest); err != nil {
+			return nil, err
+		}
+	}
+	order := make([]int, len(manifests))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool { return waves[order[i]] < waves[order[j]] })
+	sorted := make([]map[string]interface{}, len(manifests))
+	for idx, manifestIdx := range order {
+		sorted[idx] = manifests[manifestIdx]
+	}
+	return sorted, nil
+}
+
+// renderTemplateRefs executes the templates of the referenced ConfigMaps, in
+// the order of the references then of the template names. The templates
+// rendering to nothing but whitespace are skipped.
+func renderTemplateRefs(refs []TemplateRef, templates []TemplateConfigMap, data templateData) ([]map[string]interface{}, error) {
+	var manifests []map[string]interface{}
+	for _, ref := range refs {
+		configMap, err := findTemplateConfigMap(ref, templates)
+		if err != nil {
+			return nil, err
+		}
+		names := mapKeys(configMap.Data)
+		for _, name := range names {
+			rendered, err := executeTemplate(name, configMap.Data[name], data)
+			if err != nil {
+				return nil, fmt.Errorf("template %s of %s/%s: %w", name, ref.Namespace, ref.Name, err)
+			}
+			decoder := yaml.NewDecoder(strings.NewReader(rendered))
+			for {
+				var manifest map[string]interface{}
+				if err := decoder.Decode(&manifest); errors.Is(err, io.EOF) {
+					break
+				} else if err != nil {
+					return nil, fmt.Errorf("template %s of %s/%s doesn't render to YAML: %w", name, ref.Namespace, ref.Name, err)
+				}
+				if len(manifest) == 0 {
+					continue
+				}
+				if kind, _ := manifest["kind"].(string); kind == "" {
+					return nil, fmt.Errorf("template %s of %s/%s renders a manifest without kind", name, ref.Namespace, ref.Name)
+				}
+				manifests = append(manifests, manifest)
+			}
+		}
+	}
+	return manifests, nil
+}
+
+// executeTemplate executes a template with the functions the SiteConfig
+// operator templates use
+func executeTemplate(name string, text string, data templateData) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var output strings.Builder
+	if err := tmpl.Execute(&output, data); err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+// templateFuncs returns the template functions of the SiteConfig operator:
+// the sprig ones along with toYaml, and toJson following the yaml tags
+func templateFuncs() template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	funcs["toYaml"] = func(value interface{}) (string, error) {
+		var buf strings.Builder
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return "", err
+		}
+		encoder.Close()
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	}
+	funcs["toJson"] = func(value interface{}) (string, error) {
+		generic, err := toGeneric(value)
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(generic)
+		return string(data), err
+	}
+	return funcs
+}
+
+// newRenderSpec returns the ClusterInstance spec for the templates, with the
+// defaults of the ClusterInstance CRD set as the hub API server would
+func newRenderSpec(ciSpec ClusterInstanceSpec) (renderSpec, error) {
+	spec := renderSpec{
+		ClusterName:            ciSpec.ClusterName,
+		PullSecretRef:          ciSpec.PullSecretRef,
+		ClusterImageSetNameRef: ciSpec.ClusterImageSetNameRef,
+		SSHPublicKey:           ciSpec.SshPublicKey,
+		BaseDomain:             ciSpec.BaseDomain,
+		ApiVIPs:                ciSpec.ApiVIPs,
+		IngressVIPs:            ciSpec.IngressVIPs,
+		HoldInstallation:       ciSpec.HoldInstallation,
+		AdditionalNTPSources:   ciSpec.AdditionalNTPSources,
+		MachineNetwork:         ciSpec.MachineNetwork,
+		ClusterNetwork:         ciSpec.ClusterNetwork,
+		ServiceNetwork:         ciSpec.ServiceNetwork,
+		NetworkType:            ciSpec.NetworkType,
+		PlatformType:           ciSpec.PlatformType,
+		ExtraAnnotations:       ciSpec.ExtraAnnotations,
+		ExtraLabels:            ciSpec.ExtraLabels,
+		InstallConfigOverrides: ciSpec.InstallConfigOverrides,
+		IgnitionConfigOverride: ciSpec.IgnitionConfigOverride,
+		DiskEncryption:         ciSpec.DiskEncryption,
+		Proxy:                  ciSpec.Proxy,
+		ExtraManifestsRefs:     ciSpec.ExtraManifestsRefs,
+		SuppressedManifests:    ciSpec.SuppressedManifests,
+		PruneManifests:         ciSpec.PruneManifests,
+		CPUPartitioning:        ciSpec.CPUPartitioningMode,
+		CPUArchitecture:        ciSpec.CPUArchitecture,
+		ClusterType:            ciSpec.ClusterType,
+		TemplateRefs:           ciSpec.TemplateRefs,
+		CaBundleRef:            ciSpec.CaBundleRef,
+		Reinstall:              ciSpec.Reinstall,
+	}
+	if spec.NetworkType == "" {
+		spec.NetworkType = "OVNKubernetes"
+	}
+	if spec.CPUPartitioning == "" {
+		spec.CPUPartitioning = string(CPUPartitioningNone)
+	}
+	if spec.CPUArchitecture == "" {
+		spec.CPUArchitecture = "x86_64"
+	}
+
+	for _, ciNode := range ciSpec.Nodes {
+		node := renderNode{
+			BmcAddress:             ciNode.BmcAddress,
+			BmcCredentialsName:     ciNode.BmcCredentialsName,
+			BootMACAddress:         ciNode.BootMACAddress,
+			AutomatedCleaningMode:  ciNode.AutomatedCleaningMode,
+			NodeLabels:             ciNode.NodeLabels,
+			HostName:               ciNode.HostName,
+			HostRef:                ciNode.HostRef,
+			CPUArchitecture:        ciNode.CPUArchitecture,
+			BootMode:               ciNode.BootMode,
+			InstallerArgs:          ciNode.InstallerArgs,
+			IgnitionConfigOverride: ciNode.IgnitionConfigOverride,
+			Role:                   ciNode.Role,
+			ExtraAnnotations:       ciNode.ExtraAnnotations,
+			ExtraLabels:            ciNode.ExtraLabels,
+			SuppressedManifests:    ciNode.SuppressedManifests,
+			PruneManifests:         ciNode.PruneManifests,
+			IronicInspect:          ciNode.IronicInspect,
+			TemplateRefs:           ciNode.TemplateRefs,
+		}
+		if len(ciNode.RootDeviceHints) > 0 {
+			hints, err := newRootDeviceHints(ciNode.RootDeviceHints)
+			if err != nil {
+				return spec, fmt.Errorf("node %s: %w", ciNode.HostName, err)
+			}
+			node.RootDeviceHints = hints
+		}
+		if ciNode.NodeNetwork != nil {
+			node.NodeNetwork = &renderNodeNetwork{NetConfig: renderNetConfig{Raw: ciNode.NodeNetwork.Config}}
+			for idx := range ciNode.NodeNetwork.Interfaces {
+				node.NodeNetwork.Interfaces = append(node.NodeNetwork.Interfaces, &ciNode.NodeNetwork.Interfaces[idx])
+			}
+		}
+		if node.AutomatedCleaningMode == "" {
+			node.AutomatedCleaningMode = "disabled"
+		}
+		if node.BootMode == "" {
+			node.BootMode = "UEFI"
+		}
+		if node.Role == "" {
+			node.Role = "master"
+		}
+		if node.CPUArchitecture == "" {
+			node.CPUArchitecture = spec.CPUArchitecture
+		}
+		spec.Nodes = append(spec.Nodes, node)
+	}
+	return spec, nil
+}
+
+// newRootDeviceHints returns the typed root device hints, the unknown hints
+// being rejected
+func newRootDeviceHints(hints map[string]interface{}) (*renderRootDeviceHints, error) {
+	data, err := yaml.Marshal(hints)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	typed := &renderRootDeviceHints{}
+	if err := decoder.Decode(typed); err != nil {
+		return nil, fmt.Errorf("invalid rootDeviceHints: %w", err)
+	}
+	return typed, nil
+}
+
+// installConfigOverrides returns the installConfigOverrides of the cluster
+// along with its networkType and cpuPartitioningMode, the ones set in the
+// installConfigOverrides taking precedence
+func installConfigOverrides(spec renderSpec) (string, error) {
+	overrides := make(map[string]interface{})
+	if spec.InstallConfigOverrides != "" {
+		if err := json.Unmarshal([]byte(spec.InstallConfigOverrides), &overrides); err != nil {
+			return "", fmt.Errorf("installConfigOverrides is not a JSON object: %w", err)
+		}
+	}
+	networking, ok := overrides["networking"].(map[string]interface{})
+	if !ok {
+		if _, set := overrides["networking"]; set {
+			return "", fmt.Errorf("installConfigOverrides networking is not a JSON object")
+		}
+		networking = make(map[string]interface{})
+		overrides["networking"] = networking
+	}
+	if _, set := networking["networkType"]; !set {
+		networking["networkType"] = spec.NetworkType
+	}
+	if _, set := overrides["cpuPartitioningMode"]; !set && spec.CPUPartitioning == string(CPUPartitioningAllNodes) {
+		overrides["cpuPartitioningMode"] = spec.CPUPartitioning
+	}
+	data, err := json.Marshal(overrides)
+	return string(data), err
+}
+
+// addExtraMetadata adds the extra annotations or labels to the metadata of
+// the manifest, the ones set by the template taking precedence
+func addExtraMetadata(manifest map[string]interface{}, field string, extra map[string]string) {
+	if len(extra) == 0 {
+		return
+	}
+	metadata, ok := manifest["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = make(map[string]interface{})
+		manifest["metadata"] = metadata
+	}
+	values, ok := metadata[field].(map[string]interface{})
+	if !ok {
+		values = make(map[string]interface{})
+		metadata[field] = values
+	}
+	for key, value := range extra {
+		if _, set := values[key]; !set {
+			values[key] = value
+		}
+	}
+}
+
+// syncWave returns the sync wave of the manifest, 0 by default
+func syncWave(manifest map[string]interface{}) (int, error) {
+	metadata, _ := manifest["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	value, ok := annotations[SyncWaveAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	wave, err := strconv.Atoi(fmt.Sprint(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s annotation '%v' of %s %v", SyncWaveAnnotation, value, manifest["kind"], metadata["name"])
+	}
+	return wave, nil
+}
+
+// warnUnrenderedKinds warns about the kinds of the field which no template
+// renders
+func warnUnrenderedKinds(field string, kinds []string, rendered map[string]bool, warningsCollector *WarningsCollector) {
+	for _, kind := range kinds {
+		if !rendered[kind] {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: %s names kind %s which no template renders\n", field, kind))
+		}
+	}
+}
+
+// mapKeys returns the sorted keys of the map
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRenderedManifests writes the manifests to a multi-document YAML file
+func writeRenderedManifests(manifests []map[string]interface{}, filename string) error {
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, manifest := range manifests {
+		if err := encoder.Encode(manifest); err != nil {
+			return fmt.Errorf("failed to marshal manifest to YAML: %w", err)
+		}
+	}
+	encoder.Close()
+	if err := os.WriteFile(filename, []byte("---\n"+buf.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testTemplates = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ai-cluster-templates-v1
+  namespace: open-cluster-management
+data:
+  AgentClusterInstall: |-
+    apiVersion: extensions.hive.openshift.io/v1beta1
+    kind: AgentClusterInstall
+    metadata:
+      name: "{{ .Spec.ClusterName }}"
+      namespace: "{{ .Spec.ClusterName }}"
+      annotations:
+        siteconfig.open-cluster-management.io/sync-wave: "1"
+        agent-install.openshift.io/install-config-overrides: '{{ .SpecialVars.InstallConfigOverrides }}'
+    spec:
+      clusterDeploymentRef:
+        name: "{{ .Spec.ClusterName }}"
+      imageSetRef:
+        name: "{{ .Spec.ClusterImageSetNameRef }}"
+    {{- if .Spec.ApiVIPs }}
+      apiVIPs:
+    {{ .Spec.ApiVIPs | toYaml | indent 4 }}
+    {{- end }}
+      networking:
+        clusterNetwork:
+    {{ .Spec.ClusterNetwork | toYaml | indent 6 }}
+      provisionRequirements:
+        controlPlaneAgents: {{ .SpecialVars.ControlPlaneAgents }}
+        workerAgents: {{ .SpecialVars.WorkerAgents }}
+  ClusterDeployment: |-
+    apiVersion: hive.openshift.io/v1
+    kind: ClusterDeployment
+    metadata:
+      name: "{{ .Spec.ClusterName }}"
+      namespace: "{{ .Spec.ClusterName }}"
+      annotations:
+        siteconfig.open-cluster-management.io/sync-wave: "1"
+    spec:
+      baseDomain: "{{ .Spec.BaseDomain }}"
+      pullSecretRef:
+        name: "{{ .Spec.PullSecretRef.Name }}"
+  ManagedCluster: |-
+    apiVersion: cluster.open-cluster-management.io/v1
+    kind: ManagedCluster
+    metadata:
+      name: "{{ .Spec.ClusterName }}"
+      annotations:
+        siteconfig.open-cluster-management.io/sync-wave: "2"
+    spec:
+      hubAcceptsClient: true
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ai-node-templates-v1
+  namespace: open-cluster-management
+data:
+  BareMetalHost: |-
+    apiVersion: metal3.io/v1alpha1
+    kind: BareMetalHost
+    metadata:
+      name: "{{ .SpecialVars.CurrentNode.HostName }}"
+      namespace: "{{ .Spec.ClusterName }}"
+      annotations:
+        siteconfig.open-cluster-management.io/sync-wave: "1"
+        bmac.agent-install.openshift.io/role: "{{ .SpecialVars.CurrentNode.Role }}"
+    {{- range $key, $value := .SpecialVars.CurrentNode.NodeLabels }}
+        bmac.agent-install.openshift.io.node-label.{{ $key }}: {{ $value | quote }}
+    {{- end }}
+    spec:
+      bootMode: "{{ .SpecialVars.CurrentNode.BootMode }}"
+      bmc:
+        address: "{{ .SpecialVars.CurrentNode.BmcAddress }}"
+        credentialsName: "{{ .SpecialVars.CurrentNode.BmcCredentialsName.Name }}"
+      bootMACAddress: "{{ .SpecialVars.CurrentNode.BootMACAddress }}"
+      automatedCleaningMode: "{{ .SpecialVars.CurrentNode.AutomatedCleaningMode }}"
+    {{- if .SpecialVars.CurrentNode.RootDeviceHints }}
+      rootDeviceHints:
+    {{ .SpecialVars.CurrentNode.RootDeviceHints | toYaml | indent 4 }}
+    {{- end }}
+  NMStateConfig: |-
+    {{ if .SpecialVars.CurrentNode.NodeNetwork }}
+    apiVersion: agent-install.openshift.io/v1beta1
+    kind: NMStateConfig
+    metadata:
+      name: "{{ .SpecialVars.CurrentNode.HostName }}"
+      namespace: "{{ .Spec.ClusterName }}"
+      annotations:
+        siteconfig.open-cluster-management.io/sync-wave: "0"
+    spec:
+      config:
+    {{ .SpecialVars.CurrentNode.NodeNetwork.NetConfig | toYaml | indent 4 }}
+      interfaces:
+    {{ .SpecialVars.CurrentNode.NodeNetwork.Interfaces | toYaml | indent 4 }}
+    {{ end }}
+`
+
+func writeTestTemplates(t *testing.T) []TemplateConfigMap {
+	file := filepath.Join(t.TempDir(), "templates.yaml")
+	if err := os.WriteFile(file, []byte(testTemplates), 0644); err != nil {
+		t.Fatalf("Failed to write templates: %v", err)
+	}
+	templates, err := readTemplateConfigMaps([]string{filepath.Dir(file)})
+	if err != nil {
+		t.Fatalf("Failed to read templates: %v", err)
+	}
+	if len(templates) != 2 {
+		t.Fatalf("Expected 2 template ConfigMaps, got %d", len(templates))
+	}
+	return templates
+}
+
+func TestRenderClusterInstance(t *testing.T) {
+	templates := writeTestTemplates(t)
+	siteConfig, err := readSiteConfig("samples/test-3node-siteconfig.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read SiteConfig: %v", err)
+	}
+	cluster := siteConfig.Spec.Clusters[0]
+	clusterInstance := convertClusterToClusterInstance(siteConfig, cluster, createTemplateRefs("open-cluster-management", "ai-cluster-templates-v1"),
+		createTemplateRefs("open-cluster-management", "ai-node-templates-v1"), nil, "", &WarningsCollector{}, 0, "test", DefaultExtraManifestConfigMapName)
+	clusterInstance.Spec.SuppressedManifests = []string{"ManagedCluster", "KlusterletAddonConfig"}
+	clusterInstance.Spec.ExtraLabels = map[string]map[string]string{"ClusterDeployment": {"common": "true"}}
+
+	warnings := &WarningsCollector{}
+	manifests, err := renderClusterInstance(clusterInstance, templates, warnings)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+
+	var kinds []string
+	for _, manifest := range manifests {
+		kinds = append(kinds, manifest["kind"].(string))
+	}
+	// The NMStateConfigs of wave 0 come first, the rendering order being kept within a wave
+	expected := "NMStateConfig NMStateConfig NMStateConfig AgentClusterInstall ClusterDeployment BareMetalHost BareMetalHost BareMetalHost"
+	if strings.Join(kinds, " ") != expected {
+		t.Errorf("Expected kinds %s, got %s", expected, strings.Join(kinds, " "))
+	}
+	if len(warnings.Warnings) != 1 || !strings.Contains(warnings.Warnings[0], "spec.suppressedManifests names kind KlusterletAddonConfig") {
+		t.Errorf("Expected a warning about KlusterletAddonConfig, got %v", warnings.Warnings)
+	}
+
+	aci := manifests[3]
+	annotations := aci["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if overrides := annotations["agent-install.openshift.io/install-config-overrides"]; !strings.Contains(overrides.(string), `"networkType":"OVNKubernetes"`) {
+		t.Errorf("Expected the networkType in the installConfigOverrides, got %v", overrides)
+	}
+	requirements := aci["spec"].(map[string]interface{})["provisionRequirements"].(map[string]interface{})
+	if requirements["controlPlaneAgents"] != 3 || requirements["workerAgents"] != 0 {
+		t.Errorf("Expected 3 control plane agents, got %v", requirements)
+	}
+	labels := manifests[4]["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+	if labels["common"] != "true" {
+		t.Errorf("Expected the extraLabels on the ClusterDeployment, got %v", labels)
+	}
+
+	bmh := manifests[5]
+	spec := bmh["spec"].(map[string]interface{})
+	if spec["bootMACAddress"] != cluster.Nodes[0].BootMACAddress || spec["automatedCleaningMode"] == "" {
+		t.Errorf("Unexpected BareMetalHost spec %v", spec)
+	}
+	nmstate := manifests[0]["spec"].(map[string]interface{})
+	interfaces := nmstate["interfaces"].([]interface{})
+	if len(interfaces) != len(cluster.Nodes[0].NodeNetwork.Interfaces) || nmstate["config"] == nil {
+		t.Errorf("Unexpected NMStateConfig spec %v", nmstate)
+	}
+}
+
+func TestRenderInRepoTemplates(t *testing.T) {
+	// The cluster templates of the repository use the sprig functions, such as list and append
+	templatesFile := filepath.Join(t.TempDir(), "templates.yaml")
+	if err := os.WriteFile(templatesFile, []byte(testTemplates), 0644); err != nil {
+		t.Fatalf("Failed to write templates: %v", err)
+	}
+	templates, err := readTemplateConfigMaps([]string{"single-vip.yaml", templatesFile})
+	if err != nil {
+		t.Fatalf("Failed to read templates: %v", err)
+	}
+	siteConfig, err := readSiteConfig("samples/test-sno-siteconfig.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read SiteConfig: %v", err)
+	}
+	cluster := siteConfig.Spec.Clusters[0]
+	clusterInstance := convertClusterToClusterInstance(siteConfig, cluster, createTemplateRefs("open-cluster-management", "ai-single-vip-cluster-templates-v1"),
+		createTemplateRefs("open-cluster-management", "ai-node-templates-v1"), nil, "", &WarningsCollector{}, 0, "test", DefaultExtraManifestConfigMapName)
+
+	manifests, err := renderClusterInstance(clusterInstance, templates, &WarningsCollector{})
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	var kinds []string
+	for _, manifest := range manifests {
+		kinds = append(kinds, manifest["kind"].(string))
+	}
+	expected := "NMStateConfig AgentClusterInstall ClusterDeployment BareMetalHost KlusterletAddonConfig ManagedCluster"
+	if strings.Join(kinds, " ") != expected {
+		t.Errorf("Expected kinds %s, got %s", expected, strings.Join(kinds, " "))
+	}
+	networking := manifests[1]["spec"].(map[string]interface{})["networking"].(map[string]interface{})
+	serviceNetwork := networking["serviceNetwork"].([]interface{})
+	if len(serviceNetwork) != len(cluster.ServiceNetwork) || serviceNetwork[0] != cluster.ServiceNetwork[0] {
+		t.Errorf("Expected the serviceNetwork %v, got %v", cluster.ServiceNetwork, serviceNetwork)
+	}
+}
+
+func TestRenderClusterInstanceErrors(t *testing.T) {
+	templates := writeTestTemplates(t)
+	clusterInstance := &ClusterInstance{
+		Metadata: ClusterInstanceMetadata{Name: "sno1", Namespace: "sno1"},
+		Spec: ClusterInstanceSpec{
+			ClusterName:  "sno1",
+			TemplateRefs: createTemplateRefs("open-cluster-management", "missing"),
+		},
+	}
+	if _, err := renderClusterInstance(clusterInstance, templates, &WarningsCollector{}); err == nil ||
+		err.Error() != "template ConfigMap open-cluster-management/missing not found" {
+		t.Errorf("Expected a missing template error, got %v", err)
+	}
+
+	clusterInstance.Spec.TemplateRefs = createTemplateRefs("open-cluster-management", "ai-cluster-templates-v1")
+	clusterInstance.Spec.InstallConfigOverrides = "not json"
+	if _, err := renderClusterInstance(clusterInstance, templates, &WarningsCollector{}); err == nil ||
+		!strings.Contains(err.Error(), "installConfigOverrides is not a JSON object") {
+		t.Errorf("Expected an installConfigOverrides error, got %v", err)
+	}
+}
+
+func TestInstallConfigOverrides(t *testing.T) {
+	tests := []struct {
+		overrides string
+		expected  string
+	}{
+		{"", `{"cpuPartitioningMode":"AllNodes","networking":{"networkType":"OVNKubernetes"}}`},
+		{`{"capabilities":{"baselineCapabilitySet":"None"}}`, `{"capabilities":{"baselineCapabilitySet":"None"},"cpuPartitioningMode":"AllNodes","networking":{"networkType":"OVNKubernetes"}}`},
+		{`{"networking":{"networkType":"OpenShiftSDN"}}`, `{"cpuPartitioningMode":"AllNodes","networking":{"networkType":"OpenShiftSDN"}}`},
+	}
+	for _, test := range tests {
+		result, err := installConfigOverrides(renderSpec{NetworkType: "OVNKubernetes", CPUPartitioning: "AllNodes", InstallConfigOverrides: test.overrides})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, result)
+		}
+	}
+}
+
+func TestRenderClusterInstances(t *testing.T) {
+	dir := t.TempDir()
+	templatesFile := filepath.Join(dir, "templates.yaml")
+	if err := os.WriteFile(templatesFile, []byte(testTemplates), 0644); err != nil {
+		t.Fatalf("Failed to write templates: %v", err)
+	}
+	siteConfig, err := readSiteConfig("samples/test-sno-siteconfig.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read SiteConfig: %v", err)
+	}
+	if err := convertToClusterInstance(siteConfig, dir, DefaultClusterTemplates, DefaultNodeTemplates, "", "", false, false,
+		"samples/test-sno-siteconfig.yaml", DefaultExtraManifestConfigMapName); err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+	clusterName := siteConfig.Spec.Clusters[0].ClusterName
+	outputDir := filepath.Join(dir, "rendered")
+	if err := renderClusterInstances([]string{filepath.Join(dir, clusterName+".yaml")}, []string{templatesFile}, outputDir); err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, clusterName+RenderedManifestsFileSuffix))
+	if err != nil {
+		t.Fatalf("Failed to read the rendered manifests: %v", err)
+	}
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	count := 0
+	for {
+		var manifest map[string]interface{}
+		if decoder.Decode(&manifest) != nil {
+			break
+		}
+		count++
+	}
+	if count != 5 {
+		t.Errorf("Expected 5 rendered manifests, got %d:\n%s", count, data)
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultClusterTemplates are the cluster template references of the conversion by default
+	DefaultClusterTemplates = "open-cluster-management/ai-cluster-templates-v1"
+	// DefaultNodeTemplates are the node template references of the conversion by default
+	DefaultNodeTemplates = "open-cluster-management/ai-node-templates-v1"
+	// DefaultExtraManifestConfigMapName is the name of the extra manifests ConfigMap generated by the conversion
+	DefaultExtraManifestConfigMapName = "extra-manifests-cm"
+	// ConverterAnnotation records the source of a converted ClusterInstance
+	ConverterAnnotation = "siteconfig-converter"
+)
+
+// ExtraManifestsConfigMap is a ConfigMap generated by a kustomization
+// configMapGenerator, along with the paths of its files
+type ExtraManifestsConfigMap struct {
+	Name      string
+	Namespace string
+	Files     []string
+}
+
+// readClusterInstancesAndKustomizations reads the ClusterInstances and the
+// ConfigMaps generated by the kustomizations of the files, the other objects
+// being skipped
+func readClusterInstancesAndKustomizations(filenames []string) ([]*ClusterInstance, []ExtraManifestsConfigMap, error) {
+	var clusterInstances []*ClusterInstance
+	var configMaps []ExtraManifestsConfigMap
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		for {
+			var document yaml.Node
+			if err := decoder.Decode(&document); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal YAML of %s: %w", filename, err)
+			}
+			header := struct {
+				Kind string `yaml:"kind"`
+			}{}
+			if err := document.Decode(&header); err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal YAML of %s: %w", filename, err)
+			}
+			switch header.Kind {
+			case "ClusterInstance":
+				clusterInstance := &ClusterInstance{}
+				if err := document.Decode(clusterInstance); err != nil {
+					return nil, nil, fmt.Errorf("failed to unmarshal ClusterInstance of %s: %w", filename, err)
+				}
+				clusterInstances = append(clusterInstances, clusterInstance)
+			case "Kustomization":
+				kustomization := Kustomization{}
+				if err := document.Decode(&kustomization); err != nil {
+					return nil, nil, fmt.Errorf("failed to unmarshal Kustomization of %s: %w", filename, err)
+				}
+				configMaps = append(configMaps, kustomizationConfigMaps(kustomization, filepath.Dir(filename))...)
+			}
+		}
+	}
+	return clusterInstances, configMaps, nil
+}
+
+// kustomizationConfigMaps returns the ConfigMaps of the configMapGenerator
+// entries, the paths of the files being resolved relative to dir
+func kustomizationConfigMaps(kustomization Kustomization, dir string) []ExtraManifestsConfigMap {
+	var configMaps []ExtraManifestsConfigMap
+	for _, generator := range kustomization.ConfigMapGenerator {
+		configMap := ExtraManifestsConfigMap{Name: generator.Name, Namespace: generator.Namespace}
+		for _, file := range generator.Files {
+			// The files may be given as key=path
+			if idx := strings.Index(file, "="); idx >= 0 {
+				file = file[idx+1:]
+			}
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			configMap.Files = append(configMap.Files, filepath.Clean(file))
+		}
+		configMaps = append(configMaps, configMap)
+	}
+	return configMaps
+}
+
+// findExtraManifestsConfigMap returns the ConfigMap of the extraManifestsRefs
+// of the ClusterInstance generated by a kustomization, if any
+func findExtraManifestsConfigMap(clusterInstance *ClusterInstance, configMaps []ExtraManifestsConfigMap) *ExtraManifestsConfigMap {
+	for _, ref := range clusterInstance.Spec.ExtraManifestsRefs {
+		for idx, configMap := range configMaps {
+			if configMap.Name != ref.Name {
+				continue
+			}
+			if configMap.Namespace != "" && configMap.Namespace != clusterInstance.Metadata.Namespace {
+				continue
+			}
+			return &configMaps[idx]
+		}
+	}
+	return nil
+}
+
+// convertClusterInstanceToSiteConfig converts a ClusterInstance back to a
+// SiteConfig holding a single cluster. The files of the extra manifests
+// ConfigMap become the extraManifests searchPaths, relative to baseDir when
+// set, with the files of the directories not in the ConfigMap excluded.
+func convertClusterInstanceToSiteConfig(clusterInstance *ClusterInstance, extraManifests *ExtraManifestsConfigMap, baseDir string, warningsCollector *WarningsCollector) (*SiteConfig, error) {
+	ciSpec := clusterInstance.Spec
+	siteConfig := &SiteConfig{
+		ApiVersion: "ran.openshift.io/v1",
+		Kind:       "SiteConfig",
+		Metadata: Metadata{
+			Name:      clusterInstance.Metadata.Name,
+			Namespace: clusterInstance.Metadata.Namespace,
+		},
+		Spec: Spec{
+			PullSecretRef:          PullSecretRef{Name: ciSpec.PullSecretRef.Name},
+			ClusterImageSetNameRef: ciSpec.ClusterImageSetNameRef,
+			SshPublicKey:           ciSpec.SshPublicKey,
+			BaseDomain:             ciSpec.BaseDomain,
+		},
+	}
+
+	cluster := Cluster{
+		ClusterName:            ciSpec.ClusterName,
+		ApiVIPs:                ciSpec.ApiVIPs,
+		IngressVIPs:            ciSpec.IngressVIPs,
+		HoldInstallation:       ciSpec.HoldInstallation,
+		AdditionalNTPSources:   ciSpec.AdditionalNTPSources,
+		MachineNetwork:         ciSpec.MachineNetwork,
+		NetworkType:            ciSpec.NetworkType,
+		InstallConfigOverrides: ciSpec.InstallConfigOverrides,
+		IgnitionConfigOverride: ciSpec.IgnitionConfigOverride,
+		CPUPartitioningMode:    CPUPartitioningMode(ciSpec.CPUPartitioningMode),
+		PlatformType:           ciSpec.PlatformType,
+		CPUArchitecture:        ciSpec.CPUArchitecture,
+		CrAnnotations:          CrAnnotations{Add: ciSpec.ExtraAnnotations},
+		CrSuppression:          ciSpec.SuppressedManifests,
+	}
+	for _, cn := range ciSpec.ClusterNetwork {
+		cluster.ClusterNetwork = append(cluster.ClusterNetwork, ClusterNetwork{CIDR: cn.CIDR, HostPrefix: cn.HostPrefix})
+	}
+	for _, sn := range ciSpec.ServiceNetwork {
+		cluster.ServiceNetwork = append(cluster.ServiceNetwork, sn.CIDR)
+	}
+	if ciSpec.DiskEncryption != nil {
+		cluster.DiskEncryption.Type = ciSpec.DiskEncryption.Type
+		for _, tang := range ciSpec.DiskEncryption.Tang {
+			cluster.DiskEncryption.Tang = append(cluster.DiskEncryption.Tang, TangServer{URL: tang.URL, Thumbprint: tang.Thumbprint})
+		}
+	}
+	if ciSpec.Proxy != nil {
+		cluster.Proxy = Proxy{HTTPProxy: ciSpec.Proxy.HTTPProxy, HTTPSProxy: ciSpec.Proxy.HTTPSProxy, NoProxy: ciSpec.Proxy.NoProxy}
+	}
+
+	// Only the ManagedCluster extra labels are cluster labels in SiteConfig
+	kinds := make([]string, 0, len(ciSpec.ExtraLabels))
+	for kind := range ciSpec.ExtraLabels {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		if kind == "ManagedCluster" {
+			cluster.ClusterLabels = ciSpec.ExtraLabels[kind]
+			continue
+		}
+		warningsCollector.AddWarning(fmt.Sprintf("WARNING: extraLabels for %s are not supported in SiteConfig and will be ignored\n", kind))
+	}
+
+	// The extra manifests ConfigMap generated by the conversion is replaced by
+	// the extraManifests it is generated from, the others are kept as refs
+	for _, ref := range ciSpec.ExtraManifestsRefs {
+		if extraManifests != nil && ref.Name == extraManifests.Name {
+			continue
+		}
+		cluster.ManifestsConfigMapRefs = append(cluster.ManifestsConfigMapRefs, ManifestsConfigMapReference{Name: ref.Name})
+	}
+	if extraManifests != nil {
+		searchPaths, filter, err := extraManifestsSearchPaths(extraManifests.Files, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("extra manifests ConfigMap '%s': %w", extraManifests.Name, err)
+		}
+		cluster.ExtraManifests = ExtraManifests{SearchPaths: &searchPaths, Filter: filter}
+	} else {
+		warningsCollector.AddWarning("WARNING: no kustomization generates the ConfigMaps of extraManifestsRefs, they are kept as manifestsConfigMapRefs " +
+			"and the extra manifests of the ztp container are used by default.\n")
+	}
+
+	if len(ciSpec.PruneManifests) > 0 {
+		warningsCollector.AddWarning("WARNING: pruneManifests field is not supported in SiteConfig and will be ignored\n")
+	}
+	if ciSpec.CaBundleRef != nil {
+		warningsCollector.AddWarning(fmt.Sprintf("WARNING: caBundleRef field '%s' is not supported in SiteConfig and will be ignored\n", ciSpec.CaBundleRef.Name))
+	}
+	if ciSpec.Reinstall != nil {
+		warningsCollector.AddWarning("WARNING: reinstall field is not supported in SiteConfig and will be ignored\n")
+	}
+	if refs := formatTemplateReferences(ciSpec.TemplateRefs); refs != DefaultClusterTemplates {
+		warningsCollector.AddWarning(fmt.Sprintf("WARNING: cluster templateRefs '%s' are not part of SiteConfig, pass them with -t when converting it to ClusterInstance\n", refs))
+	}
+
+	for _, ciNode := range ciSpec.Nodes {
+		node := Node{
+			BmcAddress:             ciNode.BmcAddress,
+			BootMACAddress:         ciNode.BootMACAddress,
+			AutomatedCleaningMode:  ciNode.AutomatedCleaningMode,
+			RootDeviceHints:        ciNode.RootDeviceHints,
+			NodeLabels:             ciNode.NodeLabels,
+			HostName:               ciNode.HostName,
+			BmcCredentialsName:     BmcCredentialsName{Name: ciNode.BmcCredentialsName.Name},
+			BootMode:               ciNode.BootMode,
+			InstallerArgs:          ciNode.InstallerArgs,
+			IgnitionConfigOverride: ciNode.IgnitionConfigOverride,
+			Role:                   ciNode.Role,
+			CrAnnotations:          CrAnnotations{Add: ciNode.ExtraAnnotations},
+			CrSuppression:          ciNode.SuppressedManifests,
+			IronicInspect:          IronicInspect(ciNode.IronicInspect),
+		}
+		if ciNode.NodeNetwork != nil {
+			node.NodeNetwork.Config = ciNode.NodeNetwork.Config
+			for _, iface := range ciNode.NodeNetwork.Interfaces {
+				node.NodeNetwork.Interfaces = append(node.NodeNetwork.Interfaces, NetworkInterface{Name: iface.Name, MacAddress: iface.MacAddress})
+			}
+		}
+
+		if ciNode.HostRef != nil {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: hostRef field on node '%s' is not supported in SiteConfig and will be ignored\n", ciNode.HostName))
+		}
+		if ciNode.CPUArchitecture != "" {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: cpuArchitecture field '%s' on node '%s' is not supported in SiteConfig and will be ignored\n",
+				ciNode.CPUArchitecture, ciNode.HostName))
+		}
+		if len(ciNode.ExtraLabels) > 0 {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: extraLabels field on node '%s' is not supported in SiteConfig and will be ignored\n", ciNode.HostName))
+		}
+		if len(ciNode.PruneManifests) > 0 {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: pruneManifests field on node '%s' is not supported in SiteConfig and will be ignored\n", ciNode.HostName))
+		}
+		if refs := formatTemplateReferences(ciNode.TemplateRefs); refs != DefaultNodeTemplates {
+			warningsCollector.AddWarning(fmt.Sprintf("WARNING: templateRefs '%s' on node '%s' are not part of SiteConfig, pass them with -n when converting it to ClusterInstance\n",
+				refs, ciNode.HostName))
+		}
+		cluster.Nodes = append(cluster.Nodes, node)
+	}
+
+	siteConfig.Spec.Clusters = []Cluster{cluster}
+	return siteConfig, nil
+}
+
+// extraManifestsSearchPaths returns the directories of the files as
+// extraManifests searchPaths, and the filter excluding the other files of
+// the directories
+func extraManifestsSearchPaths(files []string, baseDir string) ([]string, *Filter, error) {
+	var dirs []string
+	seenDirs := make(map[string]bool)
+	listed := make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if !seenDirs[dir] {
+			dirs = append(dirs, dir)
+			seenDirs[dir] = true
+		}
+		// The extra manifests are keyed by file name
+		if listed[filepath.Base(file)] {
+			return nil, nil, fmt.Errorf("file name %s is used more than once", filepath.Base(file))
+		}
+		listed[filepath.Base(file)] = true
+	}
+
+	var excluded []string
+	searchPaths := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			// The hidden files and the directories are skipped by the conversion
+			if entry.IsDir() || entry.Name()[0] == '.' || listed[entry.Name()] {
+				continue
+			}
+			excluded = append(excluded, entry.Name())
+		}
+		if baseDir != "" {
+			if rel, err := filepath.Rel(baseDir, dir); err == nil {
+				dir = rel
+			}
+		}
+		searchPaths = append(searchPaths, dir)
+	}
+	if len(excluded) == 0 {
+		return searchPaths, nil, nil
+	}
+	sort.Strings(excluded)
+	return searchPaths, &Filter{Exclude: excluded}, nil
+}
+
+// formatTemplateReferences returns the template references in the format of
+// the -t and -n options
+func formatTemplateReferences(refs []TemplateRef) string {
+	formatted := make([]string, len(refs))
+	for idx, ref := range refs {
+		formatted[idx] = ref.Namespace + "/" + ref.Name
+	}
+	return strings.Join(formatted, ",")
+}
+
+// convertToSiteConfig converts the ClusterInstances of the files to SiteConfig
+// files, the extra manifests being read from the kustomizations of the files
+func convertToSiteConfig(filenames []string, outputDir string, writeWarnings bool) error {
+	clusterInstances, configMaps, err := readClusterInstancesAndKustomizations(filenames)
+	if err != nil {
+		return err
+	}
+	if len(clusterInstances) == 0 {
+		return fmt.Errorf("no ClusterInstance found in %s", strings.Join(filenames, ", "))
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	for _, clusterInstance := range clusterInstances {
+		warningsCollector := &WarningsCollector{}
+		extraManifests := findExtraManifestsConfigMap(clusterInstance, configMaps)
+		if extraManifests != nil {
+			absConfigMap := *extraManifests
+			absConfigMap.Files = make([]string, len(extraManifests.Files))
+			for idx, file := range extraManifests.Files {
+				if absConfigMap.Files[idx], err = filepath.Abs(file); err != nil {
+					return fmt.Errorf("failed to get absolute path: %w", err)
+				}
+			}
+			extraManifests = &absConfigMap
+		}
+		siteConfig, err := convertClusterInstanceToSiteConfig(clusterInstance, extraManifests, absOutputDir, warningsCollector)
+		if err != nil {
+			return fmt.Errorf("failed to convert ClusterInstance %s: %w", clusterInstance.Metadata.Name, err)
+		}
+
+		outputPath := filepath.Join(outputDir, fmt.Sprintf("%s.yaml", clusterInstance.Spec.ClusterName))
+		if err := writeSiteConfigToFile(siteConfig, outputPath, warningsCollector, writeWarnings); err != nil {
+			return fmt.Errorf("failed to write SiteConfig for cluster %s: %w", clusterInstance.Spec.ClusterName, err)
+		}
+		fmt.Printf("Converted ClusterInstance %s/%s to SiteConfig: %s\n", clusterInstance.Metadata.Namespace, clusterInstance.Metadata.Name, outputPath)
+		if !writeWarnings {
+			warningsCollector.PrintWarnings()
+		}
+	}
+	return nil
+}
+
+// writeSiteConfigToFile writes a SiteConfig to a YAML file without its empty fields
+func writeSiteConfigToFile(siteConfig *SiteConfig, filename string, warningsCollector *WarningsCollector, writeWarnings bool) error {
+	content, err := marshalWithoutEmptyFields(siteConfig)
+	if err != nil {
+		return fmt.Errorf("failed to marshal SiteConfig to YAML: %w", err)
+	}
+	header := "---\n"
+	if writeWarnings {
+		header += warningsCollector.GenerateYAMLComments()
+	}
+	if err := os.WriteFile(filename, []byte(header+content), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// marshalWithoutEmptyFields returns the YAML of the object without the
+// fields set to empty values, as the SiteConfig fields aren't omitempty
+func marshalWithoutEmptyFields(object interface{}) (string, error) {
+	generic, err := toGeneric(object)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(pruneEmpty(generic)); err != nil {
+		return "", err
+	}
+	encoder.Close()
+	return buf.String(), nil
+}
+
+// toGeneric returns the object as decoded from its YAML into generic maps and lists
+func toGeneric(object interface{}) (interface{}, error) {
+	data, err := yaml.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	err = yaml.Unmarshal(data, &generic)
+	return generic, err
+}
+
+// freeFormFields hold user data in which the empty values are meaningful, such
+// as the labels with an empty value
+var freeFormFields = map[string]bool{
+	"annotations":      true,
+	"labels":           true,
+	"clusterLabels":    true,
+	"nodeLabels":       true,
+	"add":              true,
+	"extraAnnotations": true,
+	"extraLabels":      true,
+	"rootDeviceHints":  true,
+	"config":           true,
+	"userData":         true,
+	"crTemplates":      true,
+	"data":             true,
+}
+
+// pruneEmpty removes the empty values of the maps, recursively, but for the
+// content of the free-form fields
+func pruneEmpty(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		pruned := make(map[string]interface{})
+		for key, item := range typed {
+			if !freeFormFields[key] {
+				item = pruneEmpty(item)
+			}
+			if !isEmpty(item) {
+				pruned[key] = item
+			}
+		}
+		return pruned
+	case []interface{}:
+		pruned := make([]interface{}, len(typed))
+		for idx, item := range typed {
+			pruned[idx] = pruneEmpty(item)
+		}
+		return pruned
+	}
+	return value
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int64:
+		return v.Int() == 0
+	}
+	return false
+}
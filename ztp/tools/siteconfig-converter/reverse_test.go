@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReverseConversion(t *testing.T) {
+	for _, sample := range []string{"samples/test-sno-siteconfig.yaml", "samples/test-3node-siteconfig.yaml", "samples/test-5node-siteconfig.yaml"} {
+		t.Run(sample, func(t *testing.T) {
+			siteConfig, err := readSiteConfig(sample)
+			if err != nil {
+				t.Fatalf("Failed to read SiteConfig: %v", err)
+			}
+			cluster := siteConfig.Spec.Clusters[0]
+			clusterInstance := convertClusterToClusterInstance(siteConfig, cluster, createTemplateRefs("open-cluster-management", "ai-cluster-templates-v1"),
+				createTemplateRefs("open-cluster-management", "ai-node-templates-v1"), nil, "", &WarningsCollector{}, 0, sample, DefaultExtraManifestConfigMapName)
+
+			warnings := &WarningsCollector{}
+			configMap := &ExtraManifestsConfigMap{Name: DefaultExtraManifestConfigMapName}
+			reversed, err := convertClusterInstanceToSiteConfig(clusterInstance, configMap, "", warnings)
+			if err != nil {
+				t.Fatalf("Failed to convert ClusterInstance to SiteConfig: %v", err)
+			}
+			if len(warnings.Warnings) != 0 {
+				t.Errorf("Expected no warnings, got %v", warnings.Warnings)
+			}
+			if reversed.Kind != "SiteConfig" || len(reversed.Spec.Clusters) != 1 {
+				t.Fatalf("Expected a SiteConfig with one cluster, got %s with %d clusters", reversed.Kind, len(reversed.Spec.Clusters))
+			}
+
+			// Converting the reversed SiteConfig gives the same ClusterInstance
+			again := convertClusterToClusterInstance(reversed, reversed.Spec.Clusters[0], clusterInstance.Spec.TemplateRefs,
+				clusterInstance.Spec.Nodes[0].TemplateRefs, nil, "", &WarningsCollector{}, 0, sample, DefaultExtraManifestConfigMapName)
+			differences, err := diffClusterInstances(clusterInstance, again, false)
+			if err != nil {
+				t.Fatalf("Failed to compare ClusterInstances: %v", err)
+			}
+			if len(differences) != 0 {
+				t.Errorf("Expected no difference, got %v", differences)
+			}
+			if !reflect.DeepEqual(reversed.Spec.Clusters[0].ClusterLabels, cluster.ClusterLabels) {
+				t.Errorf("Expected clusterLabels %v, got %v", cluster.ClusterLabels, reversed.Spec.Clusters[0].ClusterLabels)
+			}
+		})
+	}
+}
+
+func TestReverseConversionUnsupportedFields(t *testing.T) {
+	clusterInstance := &ClusterInstance{
+		Kind:     "ClusterInstance",
+		Metadata: ClusterInstanceMetadata{Name: "sno1", Namespace: "sno1"},
+		Spec: ClusterInstanceSpec{
+			ClusterName:        "sno1",
+			ExtraLabels:        map[string]map[string]string{"ManagedCluster": {"common": "true"}, "AgentClusterInstall": {"x": "y"}},
+			ExtraManifestsRefs: []LocalObjectReference{{Name: "custom-cm"}, {Name: "extra-manifests-cm"}},
+			CaBundleRef:        &LocalObjectReference{Name: "ca"},
+			TemplateRefs:       createTemplateRefs("custom", "cluster-templates"),
+			Nodes: []ClusterInstanceNode{{
+				HostName:     "node1",
+				HostRef:      &HostRef{Name: "bmh", Namespace: "sno1"},
+				TemplateRefs: createTemplateRefs("open-cluster-management", "ai-node-templates-v1"),
+			}},
+		},
+	}
+	warnings := &WarningsCollector{}
+	siteConfig, err := convertClusterInstanceToSiteConfig(clusterInstance, nil, "", warnings)
+	if err != nil {
+		t.Fatalf("Failed to convert ClusterInstance to SiteConfig: %v", err)
+	}
+	cluster := siteConfig.Spec.Clusters[0]
+	if !reflect.DeepEqual(cluster.ClusterLabels, map[string]string{"common": "true"}) {
+		t.Errorf("Expected the ManagedCluster extraLabels as clusterLabels, got %v", cluster.ClusterLabels)
+	}
+	// Without kustomization all the refs are kept
+	if len(cluster.ManifestsConfigMapRefs) != 2 || cluster.ExtraManifests.SearchPaths != nil {
+		t.Errorf("Expected the refs kept without searchPaths, got %v and %v", cluster.ManifestsConfigMapRefs, cluster.ExtraManifests.SearchPaths)
+	}
+	output := strings.Join(warnings.Warnings, "")
+	for _, expected := range []string{"extraLabels for AgentClusterInstall", "caBundleRef field 'ca'", "hostRef field on node 'node1'",
+		"cluster templateRefs 'custom/cluster-templates'", "no kustomization generates the ConfigMaps"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected warning containing '%s', got %s", expected, output)
+		}
+	}
+}
+
+func TestExtraManifestsSearchPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.yaml", "b.yaml", "c.yaml", ".hidden.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("kind: ConfigMap\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kustomization := Kustomization{ConfigMapGenerator: []ConfigMapGenerator{{Name: "extra-manifests-cm", Files: []string{"manifests/a.yaml", "c=manifests/c.yaml"}}}}
+	configMaps := kustomizationConfigMaps(kustomization, filepath.Dir(dir))
+	for idx, file := range configMaps[0].Files {
+		configMaps[0].Files[idx] = filepath.Join(dir, filepath.Base(file))
+	}
+
+	searchPaths, filter, err := extraManifestsSearchPaths(configMaps[0].Files, filepath.Dir(dir))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(searchPaths, []string{filepath.Base(dir)}) {
+		t.Errorf("Expected the relative manifests directory, got %v", searchPaths)
+	}
+	if filter == nil || !reflect.DeepEqual(filter.Exclude, []string{"b.yaml"}) {
+		t.Errorf("Expected b.yaml excluded, got %v", filter)
+	}
+
+	if _, _, err := extraManifestsSearchPaths([]string{filepath.Join(dir, "a.yaml"), filepath.Join(t.TempDir(), "a.yaml")}, ""); err == nil {
+		t.Errorf("Expected an error for the file name used twice")
+	}
+}
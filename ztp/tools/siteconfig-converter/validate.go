@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// validateSiteConfig checks the consistency of the clusters of the SiteConfig
+// and adds the findings to the collector, the errors failing the conversion
+func validateSiteConfig(siteConfig *SiteConfig, warningsCollector *WarningsCollector) {
+	seen := make(map[string]string)
+	for idx, cluster := range siteConfig.Spec.Clusters {
+		validateCluster(cluster, idx, seen, warningsCollector)
+	}
+}
+
+// validateCluster checks the consistency of the cluster at index idx of the
+// SiteConfig. The hostnames and the MAC addresses are recorded in seen along
+// with their node, to detect the hostnames used twice in the cluster and the
+// MAC addresses used twice across clusters.
+func validateCluster(cluster Cluster, idx int, seen map[string]string, warningsCollector *WarningsCollector) {
+	v := &clusterValidator{cluster: cluster, path: fmt.Sprintf("spec.clusters[%d]", idx), warningsCollector: warningsCollector}
+	machineNetworks := v.parseNetworks("machineNetwork", machineNetworkCIDRs(cluster.MachineNetwork))
+	clusterNetworks := v.parseNetworks("clusterNetwork", clusterNetworkCIDRs(cluster.ClusterNetwork))
+	serviceNetworks := v.parseNetworks("serviceNetwork", cluster.ServiceNetwork)
+
+	v.validateVIPs("apiVIP", vipList(cluster.ApiVIP, cluster.ApiVIPs), machineNetworks)
+	v.validateVIPs("ingressVIP", vipList(cluster.IngressVIP, cluster.IngressVIPs), machineNetworks)
+	v.validateDualStack(map[string][]*net.IPNet{
+		"machineNetwork": machineNetworks,
+		"clusterNetwork": clusterNetworks,
+		"serviceNetwork": serviceNetworks,
+	})
+	v.validateRoles()
+	v.validateDiskEncryption()
+	for nodeIdx, node := range cluster.Nodes {
+		v.validateNode(node, fmt.Sprintf("%s.nodes[%d]", v.path, nodeIdx), seen)
+	}
+}
+
+// clusterValidator adds the findings about a cluster to the collector, path
+// being the YAML path of the cluster in the SiteConfig
+type clusterValidator struct {
+	cluster           Cluster
+	path              string
+	warningsCollector *WarningsCollector
+}
+
+func (v *clusterValidator) errorf(format string, args ...interface{}) {
+	v.warningsCollector.AddError(fmt.Sprintf("ERROR: cluster %s: %s\n", v.cluster.ClusterName, fmt.Sprintf(format, args...)))
+}
+
+func (v *clusterValidator) warnf(format string, args ...interface{}) {
+	v.warningsCollector.AddWarning(fmt.Sprintf("WARNING: cluster %s: %s\n", v.cluster.ClusterName, fmt.Sprintf(format, args...)))
+}
+
+func machineNetworkCIDRs(entries []MachineNetworkEntry) []string {
+	cidrs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		cidrs = append(cidrs, entry.CIDR)
+	}
+	return cidrs
+}
+
+func clusterNetworkCIDRs(entries []ClusterNetwork) []string {
+	cidrs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		cidrs = append(cidrs, entry.CIDR)
+	}
+	return cidrs
+}
+
+// vipList returns the VIPs of the singular and the plural fields
+func vipList(vip string, vips []string) []string {
+	if vip != "" && !contains(vips, vip) {
+		return append([]string{vip}, vips...)
+	}
+	return vips
+}
+
+// parseNetworks returns the networks of the field, the invalid CIDRs being
+// reported and skipped
+func (v *clusterValidator) parseNetworks(field string, cidrs []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			v.errorf("%s '%s' is not a valid CIDR", field, cidr)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// validateVIPs checks that the VIPs are addresses of the machine networks, one
+// per IP family
+func (v *clusterValidator) validateVIPs(field string, vips []string, machineNetworks []*net.IPNet) {
+	families := make(map[string]bool)
+	for _, vip := range vips {
+		ip := net.ParseIP(vip)
+		if ip == nil {
+			v.errorf("%s '%s' is not a valid IP address", field, vip)
+			continue
+		}
+		family := ipFamily(ip)
+		if families[family] {
+			v.errorf("%s holds more than one %s address", field, family)
+		}
+		families[family] = true
+		if len(machineNetworks) == 0 {
+			continue
+		}
+		inMachineNetwork := false
+		for _, network := range machineNetworks {
+			if network.Contains(ip) {
+				inMachineNetwork = true
+				break
+			}
+		}
+		if !inMachineNetwork {
+			v.errorf("%s %s is not in the machineNetwork", field, vip)
+		}
+	}
+}
+
+// validateDualStack checks that the networks hold the same IP families, with
+// the same primary family
+func (v *clusterValidator) validateDualStack(networks map[string][]*net.IPNet) {
+	var reference string
+	var referenceFamilies []string
+	for _, field := range mapKeys(networks) {
+		families := networkFamilies(networks[field])
+		if len(families) == 0 {
+			continue
+		}
+		if referenceFamilies == nil {
+			reference, referenceFamilies = field, families
+			continue
+		}
+		if strings.Join(families, ",") != strings.Join(referenceFamilies, ",") {
+			v.errorf("%s is %s while %s is %s", field, describeFamilies(families), reference, describeFamilies(referenceFamilies))
+		}
+	}
+}
+
+// networkFamilies returns the IP families of the networks, the primary one first
+func networkFamilies(networks []*net.IPNet) []string {
+	var families []string
+	for _, network := range networks {
+		if family := ipFamily(network.IP); !contains(families, family) {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+func describeFamilies(families []string) string {
+	if len(families) == 1 {
+		return families[0]
+	}
+	return "dual-stack with " + families[0] + " primary"
+}
+
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// validateRoles checks the roles of the nodes, and that their number matches
+// numMasters and numWorkers when set
+func (v *clusterValidator) validateRoles() {
+	masters, workers := 0, 0
+	for _, node := range v.cluster.Nodes {
+		switch node.Role {
+		case "", "master":
+			masters++
+		case "worker":
+			workers++
+		default:
+			v.errorf("node %s role '%s' is neither master nor worker", node.HostName, node.Role)
+		}
+	}
+	if v.cluster.NumMasters != 0 && int(v.cluster.NumMasters) != masters {
+		v.errorf("numMasters is %d but %d node(s) have the master role", v.cluster.NumMasters, masters)
+	}
+	if v.cluster.NumWorkers != 0 && int(v.cluster.NumWorkers) != workers {
+		v.errorf("numWorkers is %d but %d node(s) have the worker role", v.cluster.NumWorkers, workers)
+	}
+}
+
+// validateDiskEncryption checks that each tang server has a URL and a thumbprint
+func (v *clusterValidator) validateDiskEncryption() {
+	encryption := v.cluster.DiskEncryption
+	if encryption.Type == "nbde" && len(encryption.Tang) == 0 {
+		v.errorf("diskEncryption type nbde requires tang servers")
+	}
+	for idx, tang := range encryption.Tang {
+		if tang.URL == "" || tang.Thumbprint == "" {
+			v.errorf("diskEncryption.tang[%d] requires both url and thumbprint", idx)
+			continue
+		}
+		parsed, err := url.Parse(tang.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			v.errorf("diskEncryption.tang[%d] url '%s' is not a valid http(s) URL", idx, tang.URL)
+		}
+	}
+}
+
+// validateNode checks the MAC addresses, the node network, the cpuset and the
+// disk partitions of the node at path, and that its hostname and its MAC
+// addresses aren't used by another node
+func (v *clusterValidator) validateNode(node Node, path string, seen map[string]string) {
+	v.checkUnique(seen, "hostName", node.HostName, node.HostName, v.cluster.ClusterName)
+
+	macs := make(map[string]bool)
+	for _, iface := range node.NodeNetwork.Interfaces {
+		mac := strings.ToLower(iface.MacAddress)
+		if macs[mac] {
+			v.errorf("node %s macAddress %s is used by two interfaces", node.HostName, iface.MacAddress)
+		}
+		macs[mac] = true
+	}
+	if node.BootMACAddress != "" && len(node.NodeNetwork.Interfaces) > 0 && !macs[strings.ToLower(node.BootMACAddress)] {
+		v.warnf("node %s bootMACAddress %s is not one of the nodeNetwork interfaces", node.HostName, node.BootMACAddress)
+	}
+	if node.BootMACAddress != "" {
+		macs[strings.ToLower(node.BootMACAddress)] = true
+	}
+	for _, mac := range mapKeys(macs) {
+		v.checkUnique(seen, "MAC address", mac, node.HostName, "")
+	}
+	v.validateNodeNetwork(node, path)
+
+	if node.Cpuset != "" {
+		if err := validateCpuset(node.Cpuset); err != nil {
+			v.errorf("node %s cpuset '%s' is invalid: %v", node.HostName, node.Cpuset, err)
+		}
+	}
+	v.validateDiskPartitions(node)
+}
+
+// checkUnique reports the value already recorded in seen for another node,
+// within the scope
+func (v *clusterValidator) checkUnique(seen map[string]string, field string, value string, hostName string, scope string) {
+	if value == "" {
+		return
+	}
+	key := scope + "/" + field + " " + value
+	owner := v.cluster.ClusterName + "/" + hostName
+	if other, found := seen[key]; found {
+		v.errorf("%s %s is used twice, by node %s and by node %s", field, value, other, owner)
+		return
+	}
+	seen[key] = owner
+}
+
+// validateCpuset checks the syntax of a CPU list such as 0-1,52-53
+func validateCpuset(cpuset string) error {
+	for _, part := range strings.Split(cpuset, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		first, err := strconv.ParseUint(bounds[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a CPU or a CPU range", part)
+		}
+		if len(bounds) == 1 {
+			continue
+		}
+		last, err := strconv.ParseUint(bounds[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a CPU or a CPU range", part)
+		}
+		if last < first {
+			return fmt.Errorf("range '%s' ends before it starts", part)
+		}
+	}
+	return nil
+}
+
+// validateDiskPartitions checks that the partitions of each device with an
+// explicit start don't overlap, a size of 0 extending to the end of the disk,
+// and that no mount point is used twice
+func (v *clusterValidator) validateDiskPartitions(node Node) {
+	mountPoints := make(map[string]bool)
+	for _, disk := range node.DiskPartition {
+		var placed []Partition
+		for _, partition := range disk.Partitions {
+			if partition.MountPoint != "" {
+				if mountPoints[partition.MountPoint] {
+					v.errorf("node %s diskPartition mount_point %s is used twice", node.HostName, partition.MountPoint)
+				}
+				mountPoints[partition.MountPoint] = true
+			}
+			if partition.Size < 0 || partition.Start < 0 {
+				v.errorf("node %s diskPartition %s partition %s has a negative start or size", node.HostName, disk.Device, partition.MountPoint)
+				continue
+			}
+			if partition.Start > 0 {
+				placed = append(placed, partition)
+			}
+		}
+		sort.SliceStable(placed, func(i, j int) bool { return placed[i].Start < placed[j].Start })
+		for idx := 1; idx < len(placed); idx++ {
+			previous := placed[idx-1]
+			if previous.Size == 0 || previous.Start+previous.Size > placed[idx].Start {
+				v.errorf("node %s diskPartition %s partitions %s (start %d, size %d) and %s (start %d) overlap", node.HostName, disk.Device,
+					previous.MountPoint, previous.Start, previous.Size, placed[idx].MountPoint, placed[idx].Start)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateSamples(t *testing.T) {
+	samples, err := filepath.Glob("samples/*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to list samples: %v", err)
+	}
+	for _, sample := range samples {
+		siteConfig, err := readSiteConfig(sample)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", sample, err)
+		}
+		warnings := &WarningsCollector{}
+		validateSiteConfig(siteConfig, warnings)
+		if len(warnings.Errors) != 0 {
+			t.Errorf("Expected no validation error in %s, got %v", sample, warnings.Errors)
+		}
+	}
+}
+
+func validCluster() Cluster {
+	return Cluster{
+		ClusterName:    "mno1",
+		ApiVIPs:        []string{"192.168.1.10"},
+		IngressVIPs:    []string{"192.168.1.11"},
+		MachineNetwork: []MachineNetworkEntry{{CIDR: "192.168.1.0/24"}},
+		ClusterNetwork: []ClusterNetwork{{CIDR: "10.128.0.0/14", HostPrefix: 23}},
+		ServiceNetwork: []string{"172.30.0.0/16"},
+		NumMasters:     2,
+		Nodes: []Node{
+			{
+				HostName:       "node1",
+				BootMACAddress: "AA:BB:CC:DD:EE:01",
+				Role:           "master",
+				Cpuset:         "0-1,52-53",
+				NodeNetwork:    NodeNetwork{Interfaces: []NetworkInterface{{Name: "eno1", MacAddress: "aa:bb:cc:dd:ee:01"}}},
+				DiskPartition: []DiskPartition{{Device: "/dev/sda", Partitions: []Partition{
+					{MountPoint: "/var/lib/containers", Start: 25000, Size: 1000},
+					{MountPoint: "/var/lib/etcd", Start: 26000},
+				}}},
+			},
+			{HostName: "node2", BootMACAddress: "AA:BB:CC:DD:EE:02"},
+		},
+	}
+}
+
+func TestValidateCluster(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(cluster *Cluster)
+		expected []string
+	}{
+		{
+			name:   "valid",
+			modify: func(cluster *Cluster) {},
+		},
+		{
+			name: "VIPs outside the machineNetwork",
+			modify: func(cluster *Cluster) {
+				cluster.ApiVIPs = []string{"192.168.2.10"}
+				cluster.IngressVIPs = []string{"192.168.1.11", "192.168.1.12"}
+			},
+			expected: []string{"apiVIP 192.168.2.10 is not in the machineNetwork", "ingressVIP holds more than one IPv4 address"},
+		},
+		{
+			name: "invalid networks",
+			modify: func(cluster *Cluster) {
+				cluster.ServiceNetwork = []string{"172.30.0.0"}
+				cluster.ApiVIPs = []string{"192.168.1"}
+			},
+			expected: []string{"serviceNetwork '172.30.0.0' is not a valid CIDR", "apiVIP '192.168.1' is not a valid IP address"},
+		},
+		{
+			name: "dual-stack",
+			modify: func(cluster *Cluster) {
+				cluster.MachineNetwork = append(cluster.MachineNetwork, MachineNetworkEntry{CIDR: "fd00::/64"})
+				cluster.ClusterNetwork = []ClusterNetwork{{CIDR: "fd01::/48"}, {CIDR: "10.128.0.0/14"}}
+			},
+			expected: []string{
+				"machineNetwork is dual-stack with IPv4 primary while clusterNetwork is dual-stack with IPv6 primary",
+				"serviceNetwork is IPv4 while clusterNetwork is dual-stack with IPv6 primary",
+			},
+		},
+		{
+			name: "nodes",
+			modify: func(cluster *Cluster) {
+				cluster.NumMasters = 3
+				cluster.Nodes[1].HostName = "node1"
+				cluster.Nodes[1].Role = "infra"
+				cluster.Nodes[1].BootMACAddress = "aa:bb:cc:dd:ee:01"
+				cluster.Nodes[0].Cpuset = "0-1,3-2,x"
+			},
+			expected: []string{
+				"node node1 role 'infra' is neither master nor worker",
+				"numMasters is 3 but 1 node(s) have the master role",
+				"node node1 cpuset '0-1,3-2,x' is invalid: range '3-2' ends before it starts",
+				"hostName node1 is used twice, by node mno1/node1 and by node mno1/node1",
+				"MAC address aa:bb:cc:dd:ee:01 is used twice, by node mno1/node1 and by node mno1/node1",
+			},
+		},
+		{
+			name: "disk partitions",
+			modify: func(cluster *Cluster) {
+				cluster.Nodes[0].DiskPartition[0].Partitions = append(cluster.Nodes[0].DiskPartition[0].Partitions,
+					Partition{MountPoint: "/var/lib/containers", Start: 25500, Size: 100})
+			},
+			expected: []string{
+				"node node1 diskPartition mount_point /var/lib/containers is used twice",
+				"node node1 diskPartition /dev/sda partitions /var/lib/containers (start 25000, size 1000) and /var/lib/containers (start 25500) overlap",
+			},
+		},
+		{
+			name: "tang servers",
+			modify: func(cluster *Cluster) {
+				cluster.DiskEncryption = DiskEncryption{Type: "nbde", Tang: []TangServer{
+					{URL: "http://tang1:7500"},
+					{URL: "tang2:7500", Thumbprint: "abc"},
+				}}
+			},
+			expected: []string{
+				"diskEncryption.tang[0] requires both url and thumbprint",
+				"diskEncryption.tang[1] url 'tang2:7500' is not a valid http(s) URL",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cluster := validCluster()
+			test.modify(&cluster)
+			warnings := &WarningsCollector{}
+			validateCluster(cluster, 0, make(map[string]string), warnings)
+			if len(warnings.Errors) != len(test.expected) {
+				t.Fatalf("Expected %d error(s), got %v", len(test.expected), warnings.Errors)
+			}
+			for _, expected := range test.expected {
+				found := false
+				for _, err := range warnings.Errors {
+					if err == "ERROR: cluster mno1: "+expected+"\n" {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("Expected error %q, got %v", expected, warnings.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSiteConfigWarnings(t *testing.T) {
+	cluster := validCluster()
+	cluster.Nodes[0].BootMACAddress = "AA:BB:CC:DD:EE:09"
+	other := validCluster()
+	other.ClusterName = "mno2"
+	siteConfig := &SiteConfig{Spec: Spec{Clusters: []Cluster{cluster, other}}}
+
+	warnings := &WarningsCollector{}
+	validateSiteConfig(siteConfig, warnings)
+	// The hostnames may be the same in two clusters, not the MAC addresses
+	if len(warnings.Errors) != 2 || !strings.Contains(warnings.Errors[0], "by node mno1/node1 and by node mno2/node1") ||
+		!strings.Contains(warnings.Errors[1], "by node mno1/node2 and by node mno2/node2") {
+		t.Errorf("Expected the MAC addresses used in both clusters, got %v", warnings.Errors)
+	}
+	if len(warnings.Warnings) != 1 || warnings.Warnings[0] != "WARNING: cluster mno1: node node1 bootMACAddress AA:BB:CC:DD:EE:09 is not one of the nodeNetwork interfaces\n" {
+		t.Errorf("Expected a bootMACAddress warning, got %v", warnings.Warnings)
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// conversionOptions are the options of the SiteConfig to ClusterInstance conversion
+type conversionOptions struct {
+	clusterTemplateRefs []TemplateRef
+	nodeTemplateRefs    []TemplateRef
+	extraManifestsRefs  []LocalObjectReference
+	suppressedManifests string
+	configMapName       string
+}
+
+// newConversionOptions parses the conversion options given on the command line
+func newConversionOptions(clusterTemplate, nodeTemplate, extraManifestsRefs, suppressedManifests string) (conversionOptions, error) {
+	opts := conversionOptions{suppressedManifests: suppressedManifests, configMapName: DefaultExtraManifestConfigMapName}
+	var err error
+	if opts.clusterTemplateRefs, err = parseTemplateReferences(clusterTemplate); err != nil {
+		return opts, fmt.Errorf("invalid cluster template reference format: %w", err)
+	}
+	if opts.nodeTemplateRefs, err = parseTemplateReferences(nodeTemplate); err != nil {
+		return opts, fmt.Errorf("invalid node template reference format: %w", err)
+	}
+	for _, name := range strings.Split(extraManifestsRefs, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.extraManifestsRefs = append(opts.extraManifestsRefs, LocalObjectReference{Name: name})
+		}
+	}
+	return opts, nil
+}
+
+// runVerify implements the verify subcommand and returns the exit code: 1
+// when a field doesn't survive the round trip or the given ClusterInstances
+// don't match the SiteConfig, 2 on errors
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	clusterTemplate := flags.String("t", DefaultClusterTemplates, "Comma-separated list of template references for Cluster (format: namespace/name,namespace/name,...)")
+	nodeTemplate := flags.String("n", DefaultNodeTemplates, "Comma-separated list of template references for Nodes (format: namespace/name,namespace/name,...)")
+	extraManifestsRefs := flags.String("m", "", "Comma-separated list of ConfigMap names for extra manifests references")
+	suppressedManifests := flags.String("s", "", "Comma-separated list of manifest names to suppress at cluster level")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Println("Usage: siteconfig-converter verify [-t cluster_namespace/name,...] [-n node_namespace/name,...] [-m configmap1,configmap2,...] [-s manifest1,manifest2,...] <siteconfig.yaml> [<clusterinstance.yaml|kustomization.yaml>...]")
+		return 2
+	}
+
+	opts, err := newConversionOptions(*clusterTemplate, *nodeTemplate, *extraManifestsRefs, *suppressedManifests)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	findings, err := verifySiteConfig(flags.Arg(0), flags.Args()[1:], opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	for _, finding := range findings {
+		fmt.Println(finding)
+	}
+	if len(findings) > 0 {
+		fmt.Printf("%d difference(s) found\n", len(findings))
+		return 1
+	}
+	fmt.Printf("SiteConfig %s survives the round trip\n", flags.Arg(0))
+	return 0
+}
+
+// verifySiteConfig converts each cluster of the SiteConfig to ClusterInstance
+// and back, and returns the fields which don't survive the round trip. The
+// given ClusterInstances are compared with the ones converted from the
+// SiteConfig and converted back and forth too, along with the extra
+// manifests of their kustomizations.
+func verifySiteConfig(siteConfigFile string, otherFiles []string, opts conversionOptions) ([]string, error) {
+	siteConfig, err := readSiteConfig(siteConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SiteConfig file: %w", err)
+	}
+	if siteConfig.Kind != "SiteConfig" {
+		return nil, fmt.Errorf("file does not contain a SiteConfig (found Kind: %s)", siteConfig.Kind)
+	}
+	clusterInstances, configMaps, err := readClusterInstancesAndKustomizations(otherFiles)
+	if err != nil {
+		return nil, err
+	}
+	inputFileDir, err := filepath.Abs(filepath.Dir(siteConfigFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp("", "siteconfig-converter-verify-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var findings []string
+	matched := make(map[*ClusterInstance]bool)
+	for idx, cluster := range siteConfig.Spec.Clusters {
+		prefix := fmt.Sprintf("cluster %s: ", cluster.ClusterName)
+		clusterInstance := convertClusterToClusterInstance(siteConfig, cluster, opts.clusterTemplateRefs, opts.nodeTemplateRefs,
+			opts.extraManifestsRefs, opts.suppressedManifests, &WarningsCollector{}, idx, filepath.Base(siteConfigFile), opts.configMapName)
+		manifests, err := getExtraManifest(make(map[string]interface{}), cluster, inputFileDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate extra manifests for cluster %s: %w", cluster.ClusterName, err)
+		}
+		configMap, err := writeExtraManifests(manifests, filepath.Join(tmpDir, cluster.ClusterName), opts.configMapName)
+		if err != nil {
+			return nil, err
+		}
+
+		// SiteConfig -> ClusterInstance -> SiteConfig
+		roundTrip, err := convertClusterInstanceToSiteConfig(clusterInstance, configMap, "", &WarningsCollector{})
+		if err != nil {
+			return nil, err
+		}
+		before, err := comparableSiteConfig(siteConfig, idx)
+		if err != nil {
+			return nil, err
+		}
+		after, err := comparableSiteConfig(roundTrip, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, difference := range diffValues(before, after, "", true) {
+			findings = append(findings, prefix+"SiteConfig "+difference)
+		}
+		roundTripManifests, err := getExtraManifest(make(map[string]interface{}), roundTrip.Spec.Clusters[0], "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate extra manifests for cluster %s: %w", cluster.ClusterName, err)
+		}
+		for _, difference := range diffManifests(manifests, roundTripManifests, "after the round trip") {
+			findings = append(findings, prefix+difference)
+		}
+
+		// The ClusterInstance kept in git matches the SiteConfig
+		for _, existing := range clusterInstances {
+			if existing.Spec.ClusterName != cluster.ClusterName {
+				continue
+			}
+			matched[existing] = true
+			differences, err := diffClusterInstances(clusterInstance, existing, false)
+			if err != nil {
+				return nil, err
+			}
+			for _, difference := range differences {
+				findings = append(findings, prefix+"ClusterInstance "+difference+" in git")
+			}
+			existingConfigMap := findExtraManifestsConfigMap(existing, configMaps)
+			if existingConfigMap == nil {
+				continue
+			}
+			existingManifests, err := readExtraManifests(existingConfigMap.Files)
+			if err != nil {
+				return nil, err
+			}
+			for _, difference := range diffManifests(manifests, existingManifests, "in git") {
+				findings = append(findings, prefix+difference)
+			}
+		}
+	}
+
+	for _, existing := range clusterInstances {
+		if !matched[existing] {
+			findings = append(findings, fmt.Sprintf("ClusterInstance %s/%s is not converted from the SiteConfig",
+				existing.Metadata.Namespace, existing.Metadata.Name))
+		}
+		// ClusterInstance -> SiteConfig -> ClusterInstance
+		differences, err := verifyClusterInstance(existing, findExtraManifestsConfigMap(existing, configMaps))
+		if err != nil {
+			return nil, err
+		}
+		for _, difference := range differences {
+			findings = append(findings, fmt.Sprintf("cluster %s: %s", existing.Spec.ClusterName, difference))
+		}
+	}
+	return findings, nil
+}
+
+// verifyClusterInstance converts the ClusterInstance to SiteConfig and back,
+// with the templateRefs of the ClusterInstance, and returns the fields which
+// don't survive the round trip
+func verifyClusterInstance(clusterInstance *ClusterInstance, configMap *ExtraManifestsConfigMap) ([]string, error) {
+	siteConfig, err := convertClusterInstanceToSiteConfig(clusterInstance, configMap, "", &WarningsCollector{})
+	if err != nil {
+		return nil, err
+	}
+	var nodeTemplateRefs []TemplateRef
+	if len(clusterInstance.Spec.Nodes) > 0 {
+		nodeTemplateRefs = clusterInstance.Spec.Nodes[0].TemplateRefs
+	}
+	configMapName := DefaultExtraManifestConfigMapName
+	if configMap != nil {
+		configMapName = configMap.Name
+	}
+	roundTrip := convertClusterToClusterInstance(siteConfig, siteConfig.Spec.Clusters[0], clusterInstance.Spec.TemplateRefs, nodeTemplateRefs,
+		nil, "", &WarningsCollector{}, 0, "", configMapName)
+	differences, err := diffClusterInstances(clusterInstance, roundTrip, true)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range differences {
+		differences[idx] = "ClusterInstance " + differences[idx]
+	}
+	if configMap == nil {
+		return differences, nil
+	}
+
+	manifests, err := readExtraManifests(configMap.Files)
+	if err != nil {
+		return nil, err
+	}
+	roundTripManifests, err := getExtraManifest(make(map[string]interface{}), siteConfig.Spec.Clusters[0], "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate extra manifests for cluster %s: %w", clusterInstance.Spec.ClusterName, err)
+	}
+	return append(differences, diffManifests(manifests, roundTripManifests, "after the round trip")...), nil
+}
+
+// comparableSiteConfig returns the SiteConfig with only its cluster idx, in a
+// form in which the equivalent settings are equal: the VIPs are lists, the
+// clusterImageSetNameRef is set on the cluster and ironicInspect is unset
+// when enabled. The metadata and the extra manifests paths are left out, the
+// extra manifests being compared by content.
+func comparableSiteConfig(siteConfig *SiteConfig, idx int) (interface{}, error) {
+	comparable := *siteConfig
+	comparable.Metadata = Metadata{}
+	cluster := siteConfig.Spec.Clusters[idx]
+	cluster.ClusterImageSetNameRef = getClusterImageSetRef(siteConfig, cluster)
+	comparable.Spec.ClusterImageSetNameRef = ""
+	if len(cluster.ApiVIPs) == 0 && cluster.ApiVIP != "" {
+		cluster.ApiVIPs = []string{cluster.ApiVIP}
+	}
+	if len(cluster.ApiVIPs) > 0 && cluster.ApiVIP == cluster.ApiVIPs[0] {
+		cluster.ApiVIP = ""
+	}
+	if len(cluster.IngressVIPs) == 0 && cluster.IngressVIP != "" {
+		cluster.IngressVIPs = []string{cluster.IngressVIP}
+	}
+	if len(cluster.IngressVIPs) > 0 && cluster.IngressVIP == cluster.IngressVIPs[0] {
+		cluster.IngressVIP = ""
+	}
+	cluster.ExtraManifests = ExtraManifests{}
+	cluster.ExtraManifestPath = ""
+	cluster.Nodes = make([]Node, len(siteConfig.Spec.Clusters[idx].Nodes))
+	for nodeIdx, node := range siteConfig.Spec.Clusters[idx].Nodes {
+		if node.IronicInspect == InspectEnabled {
+			node.IronicInspect = ""
+		}
+		cluster.Nodes[nodeIdx] = node
+	}
+	comparable.Spec.Clusters = []Cluster{cluster}
+
+	generic, err := toGeneric(comparable)
+	if err != nil {
+		return nil, err
+	}
+	return pruneEmpty(generic), nil
+}
+
+// diffClusterInstances returns the differences between the ClusterInstances,
+// but for the conversion annotation
+func diffClusterInstances(before *ClusterInstance, after *ClusterInstance, ignoreAdded bool) ([]string, error) {
+	values := make([]interface{}, 2)
+	for idx, clusterInstance := range []*ClusterInstance{before, after} {
+		comparable := *clusterInstance
+		comparable.Metadata.Annotations = make(map[string]string)
+		for key, value := range clusterInstance.Metadata.Annotations {
+			if key != ConverterAnnotation {
+				comparable.Metadata.Annotations[key] = value
+			}
+		}
+		generic, err := toGeneric(comparable)
+		if err != nil {
+			return nil, err
+		}
+		values[idx] = pruneEmpty(generic)
+	}
+	return diffValues(values[0], values[1], "", ignoreAdded), nil
+}
+
+// diffValues returns the paths at which the after value differs from the
+// before one. The paths only set in the after value are skipped when
+// ignoreAdded is set.
+func diffValues(before interface{}, after interface{}, path string, ignoreAdded bool) []string {
+	switch typed := before.(type) {
+	case map[string]interface{}:
+		afterMap, isMap := after.(map[string]interface{})
+		if !isMap {
+			break
+		}
+		keys := make([]string, 0, len(typed)+len(afterMap))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		for key := range afterMap {
+			if _, found := typed[key]; !found {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		var differences []string
+		for _, key := range keys {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			beforeValue, inBefore := typed[key]
+			afterValue, inAfter := afterMap[key]
+			switch {
+			case !inAfter:
+				differences = append(differences, fmt.Sprintf("%s: '%v' is lost", keyPath, beforeValue))
+			case !inBefore:
+				if !ignoreAdded {
+					differences = append(differences, fmt.Sprintf("%s: '%v' is added", keyPath, afterValue))
+				}
+			default:
+				differences = append(differences, diffValues(beforeValue, afterValue, keyPath, ignoreAdded)...)
+			}
+		}
+		return differences
+	case []interface{}:
+		afterList, isList := after.([]interface{})
+		if !isList {
+			break
+		}
+		var differences []string
+		for idx := 0; idx < len(typed) || idx < len(afterList); idx++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, idx)
+			switch {
+			case idx >= len(afterList):
+				differences = append(differences, fmt.Sprintf("%s: '%v' is lost", itemPath, typed[idx]))
+			case idx >= len(typed):
+				if !ignoreAdded {
+					differences = append(differences, fmt.Sprintf("%s: '%v' is added", itemPath, afterList[idx]))
+				}
+			default:
+				differences = append(differences, diffValues(typed[idx], afterList[idx], itemPath, ignoreAdded)...)
+			}
+		}
+		return differences
+	}
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: '%v' becomes '%v'", path, before, after)}
+}
+
+// writeExtraManifests writes the extra manifests to the directory and returns
+// the ConfigMap generated from them
+func writeExtraManifests(manifests map[string]interface{}, dir string, configMapName string) (*ExtraManifestsConfigMap, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create manifests directory: %w", err)
+	}
+	configMap := &ExtraManifestsConfigMap{Name: configMapName}
+	for filename, content := range manifests {
+		manifestContent, ok := content.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid manifest content type for %s", filename)
+		}
+		outputFile := filepath.Join(dir, filename)
+		if err := os.WriteFile(outputFile, []byte(manifestContent), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write manifest file %s: %w", outputFile, err)
+		}
+		configMap.Files = append(configMap.Files, outputFile)
+	}
+	sort.Strings(configMap.Files)
+	return configMap, nil
+}
+
+// readExtraManifests reads the files of an extra manifests ConfigMap, keyed by
+// file name like the generated extra manifests
+func readExtraManifests(files []string) (map[string]interface{}, error) {
+	manifests := make(map[string]interface{}, len(files))
+	for _, file := range files {
+		content, err := ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		manifests[filepath.Base(file)] = string(content)
+	}
+	return manifests, nil
+}
+
+// diffManifests returns the extra manifests which differ between before and
+// after. The manifests are compared once they carry the ztp annotation, so
+// that their formatting doesn't matter.
+func diffManifests(before map[string]interface{}, after map[string]interface{}, when string) []string {
+	names := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, found := before[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	normalize := func(content interface{}) string {
+		str, _ := content.(string)
+		if normalized, err := addZTPAnnotationToManifest(str); err == nil {
+			return normalized
+		}
+		return str
+	}
+	var differences []string
+	for _, name := range names {
+		beforeContent, inBefore := before[name]
+		afterContent, inAfter := after[name]
+		switch {
+		case !inAfter:
+			differences = append(differences, fmt.Sprintf("extra manifest %s is missing %s", name, when))
+		case !inBefore:
+			differences = append(differences, fmt.Sprintf("extra manifest %s is added %s", name, when))
+		case normalize(beforeContent) != normalize(afterContent):
+			differences = append(differences, fmt.Sprintf("extra manifest %s differs %s", name, when))
+		}
+	}
+	return differences
+}
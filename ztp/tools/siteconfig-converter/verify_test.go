@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifySiteConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "manifests"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "manifests", "a.yaml"), []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	siteConfig := `apiVersion: ran.openshift.io/v1
+kind: SiteConfig
+metadata:
+  name: sno1
+  namespace: sno1
+spec:
+  baseDomain: example.com
+  clusterImageSetNameRef: openshift-4.19
+  clusters:
+  - clusterName: sno1
+    apiVIP: 10.0.0.1
+    extraManifests:
+      searchPaths:
+      - manifests
+    clusterLabels:
+      group: ""
+    nodes:
+    - hostName: node1
+      role: master
+      ironicInspect: enabled
+`
+	siteConfigFile := filepath.Join(dir, "sno1-siteconfig.yaml")
+	if err := os.WriteFile(siteConfigFile, []byte(siteConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := conversionOptions{
+		clusterTemplateRefs: createTemplateRefs("open-cluster-management", "ai-cluster-templates-v1"),
+		nodeTemplateRefs:    createTemplateRefs("open-cluster-management", "ai-node-templates-v1"),
+		configMapName:       DefaultExtraManifestConfigMapName,
+	}
+
+	// The equivalent forms survive the round trip
+	findings, err := verifySiteConfig(siteConfigFile, nil, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("Expected no findings, got %v", findings)
+	}
+
+	// The converted files match the SiteConfig
+	outputDir := filepath.Join(dir, "output")
+	if err := convertToClusterInstance(mustReadSiteConfig(t, siteConfigFile), outputDir, "open-cluster-management/ai-cluster-templates-v1",
+		"open-cluster-management/ai-node-templates-v1", "", "", false, false, siteConfigFile, DefaultExtraManifestConfigMapName); err != nil {
+		t.Fatal(err)
+	}
+	if err := handleNewExtraManifestFlags(DefaultExtraManifestConfigMapName, "extra-manifests", siteConfigFile, outputDir); err != nil {
+		t.Fatal(err)
+	}
+	converted := []string{filepath.Join(outputDir, "sno1.yaml"), filepath.Join(outputDir, KustomizationConfigMapGeneratorSnippetFile)}
+	findings, err = verifySiteConfig(siteConfigFile, converted, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("Expected no findings, got %v", findings)
+	}
+
+	// The unsupported fields and the changes in git are reported
+	lossy := strings.Replace(siteConfig, "      role: master\n", "      role: master\n      cpuset: 0-1\n", 1)
+	if err := os.WriteFile(siteConfigFile, []byte(lossy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "extra-manifests", "a.yaml"), []byte("kind: ConfigMap\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	findings, err = verifySiteConfig(siteConfigFile, converted, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		"cluster sno1: SiteConfig spec.clusters[0].nodes[0].cpuset: '0-1' is lost",
+		"cluster sno1: extra manifest a.yaml differs in git",
+	}
+	if strings.Join(findings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected findings %v, got %v", expected, findings)
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	before := map[string]interface{}{"a": "x", "b": []interface{}{"1", "2"}, "c": map[string]interface{}{"d": "y"}}
+	after := map[string]interface{}{"a": "z", "b": []interface{}{"1"}, "c": map[string]interface{}{"d": "y", "e": "w"}}
+	expected := []string{"a: 'x' becomes 'z'", "b[1]: '2' is lost", "c.e: 'w' is added"}
+	if differences := diffValues(before, after, "", false); strings.Join(differences, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, differences)
+	}
+	if differences := diffValues(before, after, "", true); len(differences) != 2 {
+		t.Errorf("Expected the added field skipped, got %v", differences)
+	}
+}
+
+func mustReadSiteConfig(t *testing.T, filename string) *SiteConfig {
+	siteConfig, err := readSiteConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return siteConfig
+}